@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+const (
+	adminSessionsPath = "/admin/sessions"
+	adminSessionPath  = "/admin/sessions/{id}"
+)
+
+// buildAdminSubrouter registers the admin API to list and revoke the sessions
+// of a user. It is only enabled when admins are configured.
+func (p *OAuthProxy) buildAdminSubrouter(s *mux.Router) {
+	if len(p.adminEmails) == 0 && len(p.adminGroups) == 0 {
+		return
+	}
+
+	// The admin endpoints need to load sessions to authorize the admin
+	s.Path(adminSessionsPath).Methods(http.MethodGet).Handler(p.sessionChain.ThenFunc(p.ListUserSessions))
+	s.Path(adminSessionsPath).Methods(http.MethodDelete).Handler(p.sessionChain.ThenFunc(p.RevokeUserSessions))
+	s.Path(adminSessionPath).Methods(http.MethodDelete).Handler(p.sessionChain.ThenFunc(p.RevokeUserSession))
+}
+
+// ListUserSessions responds with the active sessions of the user identified by
+// the `email` or `user` query parameter
+func (p *OAuthProxy) ListUserSessions(rw http.ResponseWriter, req *http.Request) {
+	store, key, ok := p.authorizeAdminRequest(rw, req)
+	if !ok {
+		return
+	}
+
+	userSessions, err := store.ListUserSessions(req.Context(), key)
+	if err != nil {
+		logger.Errorf("Error listing sessions of %s %q: %v", key.Attribute, key.Value, err)
+		writeAdminError(rw, http.StatusInternalServerError, "error listing sessions")
+		return
+	}
+
+	writeAdminResponse(rw, http.StatusOK, struct {
+		Sessions []sessionsapi.UserSession `json:"sessions"`
+	}{
+		Sessions: userSessions,
+	})
+}
+
+// RevokeUserSessions revokes all sessions of the user identified by the
+// `email` or `user` query parameter
+func (p *OAuthProxy) RevokeUserSessions(rw http.ResponseWriter, req *http.Request) {
+	store, key, ok := p.authorizeAdminRequest(rw, req)
+	if !ok {
+		return
+	}
+
+	revoked, err := store.RevokeUserSessions(req.Context(), key)
+	if err != nil {
+		logger.Errorf("Error revoking sessions of %s %q: %v", key.Attribute, key.Value, err)
+		writeAdminError(rw, http.StatusInternalServerError, "error revoking sessions")
+		return
+	}
+
+	logger.PrintAuthf(key.Value, req, logger.AuthSuccess, "Revoked %d sessions of %s %q by admin request", revoked, key.Attribute, key.Value)
+	writeAdminResponse(rw, http.StatusOK, struct {
+		Revoked int `json:"revoked"`
+	}{
+		Revoked: revoked,
+	})
+}
+
+// RevokeUserSession revokes a single session of the user identified by the
+// `email` or `user` query parameter
+func (p *OAuthProxy) RevokeUserSession(rw http.ResponseWriter, req *http.Request) {
+	store, key, ok := p.authorizeAdminRequest(rw, req)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	err := store.RevokeUserSession(req.Context(), key, id)
+	switch {
+	case errors.Is(err, sessionsapi.ErrSessionNotFound):
+		writeAdminError(rw, http.StatusNotFound, "session not found")
+		return
+	case err != nil:
+		logger.Errorf("Error revoking session %s of %s %q: %v", id, key.Attribute, key.Value, err)
+		writeAdminError(rw, http.StatusInternalServerError, "error revoking session")
+		return
+	}
+
+	logger.PrintAuthf(key.Value, req, logger.AuthSuccess, "Revoked session %s of %s %q by admin request", id, key.Attribute, key.Value)
+	writeAdminResponse(rw, http.StatusOK, struct {
+		Revoked int `json:"revoked"`
+	}{
+		Revoked: 1,
+	})
+}
+
+// authorizeAdminRequest checks the request was made by an admin and extracts
+// the user whose sessions are managed. It writes the error response when the
+// request is not allowed.
+func (p *OAuthProxy) authorizeAdminRequest(rw http.ResponseWriter, req *http.Request) (sessionsapi.UserSessionStore, sessionsapi.IndexKey, bool) {
+	session, err := p.getAuthenticatedSession(rw, req)
+	if err != nil || session == nil {
+		writeAdminError(rw, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return nil, sessionsapi.IndexKey{}, false
+	}
+	if !p.isAdmin(session) {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Admin API request denied for %s", session)
+		writeAdminError(rw, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return nil, sessionsapi.IndexKey{}, false
+	}
+
+	store, ok := p.sessionStore.(sessionsapi.UserSessionStore)
+	if !ok {
+		writeAdminError(rw, http.StatusNotImplemented, "the session store does not support listing sessions")
+		return nil, sessionsapi.IndexKey{}, false
+	}
+
+	email, user := req.URL.Query().Get("email"), req.URL.Query().Get("user")
+	switch {
+	case email != "" && user == "":
+		return store, sessionsapi.IndexKey{Attribute: sessionsapi.EmailIndex, Value: email}, true
+	case user != "" && email == "":
+		return store, sessionsapi.IndexKey{Attribute: sessionsapi.UserIndex, Value: user}, true
+	default:
+		writeAdminError(rw, http.StatusBadRequest, "exactly one of the email or user query parameters must be set")
+		return nil, sessionsapi.IndexKey{}, false
+	}
+}
+
+// isAdmin checks the session belongs to one of the configured admin emails or
+// groups
+func (p *OAuthProxy) isAdmin(session *sessionsapi.SessionState) bool {
+	for _, email := range p.adminEmails {
+		if session.Email != "" && strings.EqualFold(email, session.Email) {
+			return true
+		}
+	}
+	for _, group := range p.adminGroups {
+		for _, sessionGroup := range session.Groups {
+			if group == sessionGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeAdminResponse(rw http.ResponseWriter, code int, body interface{}) {
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		logger.Errorf("Error encoding admin response: %v", err)
+	}
+}
+
+func writeAdminError(rw http.ResponseWriter, code int, message string) {
+	writeAdminResponse(rw, code, struct {
+		Error string `json:"error"`
+	}{
+		Error: message,
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	sqlsessions "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/sql"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+type adminTest struct {
+	proxy        *OAuthProxy
+	adminCookies []*http.Cookie
+}
+
+func newAdminTest(t *testing.T) *adminTest {
+	opts := baseTestOptions()
+	opts.Session.Type = options.SQLSessionStoreType
+	opts.Session.SQL.Driver = sqlsessions.SQLiteDriver
+	opts.Session.SQL.ConnectionURL = "file::memory:"
+	opts.Session.SQL.CleanupInterval = 0
+	opts.AdminEmails = []string{"admin@example.com"}
+	opts.AdminGroups = []string{"admins"}
+	err := validation.Validate(opts)
+	assert.NoError(t, err)
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test := &adminTest{proxy: proxy}
+	test.adminCookies = test.saveSession(t, &sessions.SessionState{Email: "admin@example.com", User: "admin"})
+	return test
+}
+
+func (test *adminTest) saveSession(t *testing.T, session *sessions.SessionState) []*http.Cookie {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := test.proxy.sessionStore.Save(rw, req, session); err != nil {
+		t.Fatal(err)
+	}
+	return rw.Result().Cookies()
+}
+
+func (test *adminTest) serve(method, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	test.proxy.ServeHTTP(rw, req)
+	return rw
+}
+
+func (test *adminTest) listSessions(t *testing.T, query string) []sessions.UserSession {
+	rw := test.serve(http.MethodGet, "/oauth2/admin/sessions?"+query, test.adminCookies)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	var body struct {
+		Sessions []sessions.UserSession `json:"sessions"`
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Sessions
+}
+
+func TestAdminListUserSessions(t *testing.T) {
+	test := newAdminTest(t)
+	created := time.Now().Add(-time.Hour)
+	test.saveSession(t, &sessions.SessionState{Email: "john.doe@example.com", User: "john", CreatedAt: &created})
+	test.saveSession(t, &sessions.SessionState{Email: "john.doe@example.com", User: "john"})
+	test.saveSession(t, &sessions.SessionState{Email: "jane.doe@example.com", User: "jane"})
+
+	byEmail := test.listSessions(t, "email=john.doe@example.com")
+	assert.Len(t, byEmail, 2)
+	assert.True(t, byEmail[0].CreatedAt.Before(byEmail[1].CreatedAt))
+
+	byUser := test.listSessions(t, "user=jane")
+	assert.Len(t, byUser, 1)
+
+	assert.Len(t, test.listSessions(t, "email=unknown@example.com"), 0)
+}
+
+func TestAdminRevokeUserSessions(t *testing.T) {
+	test := newAdminTest(t)
+	first := test.saveSession(t, &sessions.SessionState{Email: "john.doe@example.com", User: "john"})
+	second := test.saveSession(t, &sessions.SessionState{Email: "john.doe@example.com", User: "john"})
+	other := test.saveSession(t, &sessions.SessionState{Email: "jane.doe@example.com", User: "jane"})
+
+	rw := test.serve(http.MethodDelete, "/oauth2/admin/sessions?email=john.doe@example.com", test.adminCookies)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "{\"revoked\":2}\n", rw.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, test.serve(http.MethodGet, "/oauth2/userinfo", first).Code)
+	assert.Equal(t, http.StatusUnauthorized, test.serve(http.MethodGet, "/oauth2/userinfo", second).Code)
+	assert.Equal(t, http.StatusOK, test.serve(http.MethodGet, "/oauth2/userinfo", other).Code)
+	assert.Len(t, test.listSessions(t, "email=john.doe@example.com"), 0)
+}
+
+func TestAdminRevokeUserSession(t *testing.T) {
+	test := newAdminTest(t)
+	created := time.Now().Add(-time.Hour)
+	first := test.saveSession(t, &sessions.SessionState{Email: "john.doe@example.com", User: "john", CreatedAt: &created})
+	second := test.saveSession(t, &sessions.SessionState{Email: "john.doe@example.com", User: "john"})
+
+	userSessions := test.listSessions(t, "email=john.doe@example.com")
+	if len(userSessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(userSessions))
+	}
+
+	path := fmt.Sprintf("/oauth2/admin/sessions/%s?email=john.doe@example.com", userSessions[0].ID)
+	rw := test.serve(http.MethodDelete, path, test.adminCookies)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, test.serve(http.MethodGet, "/oauth2/userinfo", first).Code)
+	assert.Equal(t, http.StatusOK, test.serve(http.MethodGet, "/oauth2/userinfo", second).Code)
+
+	rw = test.serve(http.MethodDelete, path, test.adminCookies)
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestAdminAPIAuthorization(t *testing.T) {
+	test := newAdminTest(t)
+	user := test.saveSession(t, &sessions.SessionState{Email: "john.doe@example.com", User: "john"})
+	groupAdmin := test.saveSession(t, &sessions.SessionState{Email: "jane.doe@example.com", User: "jane", Groups: []string{"admins"}})
+
+	testCases := []struct {
+		name         string
+		path         string
+		cookies      []*http.Cookie
+		expectedCode int
+	}{
+		{
+			name:         "No session",
+			path:         "/oauth2/admin/sessions?email=john.doe@example.com",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Not an admin",
+			path:         "/oauth2/admin/sessions?email=john.doe@example.com",
+			cookies:      user,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Admin by email",
+			path:         "/oauth2/admin/sessions?email=john.doe@example.com",
+			cookies:      test.adminCookies,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Admin by group",
+			path:         "/oauth2/admin/sessions?email=john.doe@example.com",
+			cookies:      groupAdmin,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Missing user",
+			path:         "/oauth2/admin/sessions",
+			cookies:      test.adminCookies,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Both email and user",
+			path:         "/oauth2/admin/sessions?email=john.doe@example.com&user=john",
+			cookies:      test.adminCookies,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rw := test.serve(http.MethodGet, tc.path, tc.cookies)
+			assert.Equal(t, tc.expectedCode, rw.Code)
+			assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+		})
+	}
+}
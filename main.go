@@ -60,6 +60,11 @@ func main() {
 		logger.Fatalf("ERROR: Failed to initialise OAuth2 Proxy: %v", err)
 	}
 
+	reloader := newConfigReloader(oauthproxy, opts, func() (*options.Options, error) {
+		return loadConfiguration(*config, *alphaConfig, configFlagSet, os.Args[1:])
+	})
+	reloader.Watch(append([]string{*config, *alphaConfig}, secretFiles(opts)...), nil)
+
 	rand.Seed(time.Now().UnixNano())
 
 	if err := oauthproxy.Start(); err != nil {
@@ -5,13 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -23,8 +26,11 @@ import (
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/redirect"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authentication/apikey"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authentication/basic"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authorization"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	proxyhttp "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/http"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
@@ -48,6 +54,8 @@ const (
 	oauthCallbackPath = "/callback"
 	authOnlyPath      = "/auth"
 	userInfoPath      = "/userinfo"
+
+	backChannelLogoutPath = "/backchannel_logout"
 )
 
 var (
@@ -56,6 +64,15 @@ var (
 
 	// ErrAccessDenied means the user should receive a 401 Unauthorized response
 	ErrAccessDenied = errors.New("access denied")
+
+	// ErrForbidden means the authenticated user is not allowed to access the
+	// requested resource and should receive a 403 Forbidden response
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrInsufficientScope means the bearer token of the request does not meet
+	// the bearer token rules and the request should receive a 403 Forbidden
+	// response with a WWW-Authenticate challenge
+	ErrInsufficientScope = errors.New("insufficient scope")
 )
 
 // allowedRoute manages method + path based allowlists
@@ -74,15 +91,21 @@ type OAuthProxy struct {
 	allowedRoutes       []allowedRoute
 	redirectURL         *url.URL // the url to receive requests at
 	whitelistDomains    []string
-	provider            providers.Provider
+	providers           *providerRegistry
 	sessionStore        sessionsapi.SessionStore
 	ProxyPrefix         string
 	basicAuthValidator  basic.Validator
+	apiKeys             *apikey.Store
 	SkipProviderButton  bool
 	skipAuthPreflight   bool
 	skipJwtBearerTokens bool
 	realClientIPParser  ipapi.RealClientIPParser
 	trustedIPs          *ip.NetSet
+	adminEmails         []string
+	adminGroups         []string
+	authzEngine         authorization.Engine
+	sessionIdleTimeout  time.Duration
+	sessionMaxLifetime  time.Duration
 
 	sessionChain      alice.Chain
 	headersChain      alice.Chain
@@ -93,6 +116,14 @@ type OAuthProxy struct {
 	serveMux          *mux.Router
 	redirectValidator redirect.Validator
 	appDirector       redirect.AppDirector
+
+	// opts are the options the OAuthProxy was built from, a Reload compares
+	// them to the new options to apply rotated secrets
+	opts *options.Options
+
+	// active holds the OAuthProxy built by the latest Reload, which serves
+	// all requests once the configuration was reloaded
+	active atomic.Value
 }
 
 // NewOAuthProxy creates a new instance of OAuthProxy from the options provided
@@ -106,12 +137,120 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 	if opts.HtpasswdFile != "" {
 		logger.Printf("using htpasswd file: %s", opts.HtpasswdFile)
 		var err error
-		basicAuthValidator, err = basic.NewHTPasswdValidator(opts.HtpasswdFile)
+		basicAuthValidator, err = basic.NewHTPasswdValidator(opts.HtpasswdFile, basic.HTPasswdOptions{
+			RejectWeakHashes: opts.HtpasswdRejectWeak,
+			RehashFile:       opts.HtpasswdRehashFile,
+		})
 		if err != nil {
 			return nil, fmt.Errorf("could not load htpasswdfile: %v", err)
 		}
 	}
+	if opts.LDAP.URL != "" {
+		logger.Printf("using LDAP server: %s", opts.LDAP.URL)
+		var err error
+		basicAuthValidator, err = basic.NewLDAPValidator(opts.LDAP)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialise LDAP validator: %v", err)
+		}
+	}
+
+	var apiKeys *apikey.Store
+	if opts.APIKeysFile != "" {
+		logger.Printf("using API keys file: %s", opts.APIKeysFile)
+		var err error
+		apiKeys, err = apikey.NewFileStore(opts.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load API keys file: %v", err)
+		}
+	}
 
+	p, err := buildOAuthProxy(opts, validator, sessionStore, basicAuthValidator, apiKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.setupServer(opts); err != nil {
+		return nil, fmt.Errorf("error setting up server: %v", err)
+	}
+
+	return p, nil
+}
+
+// Reload rebuilds the request handling of the OAuthProxy from the options,
+// and swaps it in once it was built successfully.
+// Requests in flight finish with the previous configuration.
+// The session store, the htpasswd validator, the API keys and the servers
+// are kept, so changing their options requires a restart. Only rotated
+// cookie secrets, session store passwords and LDAP bind passwords are applied
+// to them, the replaced session store and LDAP validator are closed once the
+// new configuration serves requests.
+func (p *OAuthProxy) Reload(opts *options.Options) error {
+	current := p.activeProxy()
+
+	sessionStore := current.sessionStore
+	// A store rebuilt for a rotated cookie secret shares the connections of
+	// the current store, which is only closed when the store was replaced
+	replacedStore := false
+	var err error
+	switch {
+	case !reflect.DeepEqual(current.opts.Session, opts.Session):
+		logger.Printf("Applying rotated session store secrets")
+		sessionStore, err = sessions.NewSessionStore(&opts.Session, &opts.Cookie)
+		replacedStore = true
+	case !reflect.DeepEqual(current.opts.Cookie, opts.Cookie):
+		logger.Printf("Applying rotated cookie secrets")
+		sessionStore, err = sessions.WithCookieOptions(current.sessionStore, &opts.Session, &opts.Cookie)
+	}
+	if err != nil {
+		return fmt.Errorf("error initialising session store: %v", err)
+	}
+
+	basicAuthValidator := current.basicAuthValidator
+	if opts.LDAP.URL != "" && !reflect.DeepEqual(current.opts.LDAP, opts.LDAP) {
+		logger.Printf("Applying rotated LDAP bind password")
+		basicAuthValidator, err = basic.NewLDAPValidator(opts.LDAP)
+		if err != nil {
+			return fmt.Errorf("could not initialise LDAP validator: %v", err)
+		}
+	}
+
+	next, err := buildOAuthProxy(opts, p.Validator, sessionStore, basicAuthValidator, p.apiKeys)
+	if err != nil {
+		if replacedStore {
+			closeReplaced("session store", sessionStore)
+		}
+		if basicAuthValidator != current.basicAuthValidator {
+			closeReplaced("LDAP validator", basicAuthValidator)
+		}
+		return err
+	}
+
+	p.active.Store(next)
+
+	if replacedStore {
+		closeReplaced("session store", current.sessionStore)
+	}
+	if basicAuthValidator != current.basicAuthValidator {
+		closeReplaced("LDAP validator", current.basicAuthValidator)
+	}
+	return nil
+}
+
+// closeReplaced releases the connections and goroutines of a session store
+// or validator that was replaced by a Reload
+func closeReplaced(name string, v interface{}) {
+	closer, ok := v.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		logger.Errorf("Error closing the replaced %s: %v", name, err)
+	}
+}
+
+// buildOAuthProxy builds the request handling of an OAuthProxy from the
+// options around the given session store and validators
+func buildOAuthProxy(opts *options.Options, validator func(string) bool, sessionStore sessionsapi.SessionStore, basicAuthValidator basic.Validator, apiKeys *apikey.Store) (*OAuthProxy, error) {
 	pageWriter, err := pagewriter.NewWriter(pagewriter.Opts{
 		TemplatesPath:    opts.Templates.Path,
 		CustomLogo:       opts.Templates.CustomLogo,
@@ -120,6 +259,7 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		Version:          VERSION,
 		Debug:            opts.Templates.Debug,
 		ProviderName:     buildProviderName(opts.GetProvider(), opts.Providers[0].Name),
+		Providers:        buildSignInProviders(opts),
 		SignInMessage:    buildSignInMessage(opts),
 		DisplayLoginForm: basicAuthValidator != nil && opts.Templates.DisplayLoginForm,
 	})
@@ -133,7 +273,14 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 	}
 
 	if opts.SkipJwtBearerTokens {
-		logger.Printf("Skipping JWT tokens from configured OIDC issuer: %q", opts.Providers[0].OIDCConfig.IssuerURL)
+		for _, provider := range opts.Providers {
+			if provider.OIDCConfig.IssuerURL != "" {
+				logger.Printf("Skipping JWT tokens from configured OIDC issuer: %q", provider.OIDCConfig.IssuerURL)
+			}
+			if provider.OIDCConfig.IntrospectBearerTokens {
+				logger.Printf("Skipping bearer tokens introspected at: %q", provider.OIDCConfig.IntrospectionURL)
+			}
+		}
 		for _, issuer := range opts.ExtraJwtIssuers {
 			logger.Printf("Skipping JWT tokens from extra JWT issuer: %q", issuer)
 		}
@@ -143,7 +290,10 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		redirectURL.Path = fmt.Sprintf("%s/callback", opts.ProxyPrefix)
 	}
 
-	logger.Printf("OAuthProxy configured for %s Client ID: %s", opts.GetProvider().Data().ProviderName, opts.Providers[0].ClientID)
+	registry := newProviderRegistry(opts.GetProviders())
+	for _, provider := range registry.all() {
+		logger.Printf("OAuthProxy configured for %s Client ID: %s", provider.Data().ProviderName, provider.Data().ClientID)
+	}
 	refresh := "disabled"
 	if opts.Cookie.Refresh != time.Duration(0) {
 		refresh = fmt.Sprintf("after %s", opts.Cookie.Refresh)
@@ -165,11 +315,19 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		return nil, err
 	}
 
+	authzEngine, err := authorization.NewEngine(opts.UpstreamServers)
+	if err != nil {
+		return nil, fmt.Errorf("could not build authorization engine: %v", err)
+	}
+
 	preAuthChain, err := buildPreAuthChain(opts)
 	if err != nil {
 		return nil, fmt.Errorf("could not build pre-auth chain: %v", err)
 	}
-	sessionChain := buildSessionChain(opts, sessionStore, basicAuthValidator)
+	sessionChain, err := buildSessionChain(opts, registry, sessionStore, basicAuthValidator, apiKeys)
+	if err != nil {
+		return nil, fmt.Errorf("could not build session chain: %v", err)
+	}
 	headersChain, err := buildHeadersChain(opts)
 	if err != nil {
 		return nil, fmt.Errorf("could not build headers chain: %v", err)
@@ -184,11 +342,12 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 	p := &OAuthProxy{
 		CookieOptions: &opts.Cookie,
 		Validator:     validator,
+		opts:          opts,
 
 		SignInPath: fmt.Sprintf("%s/sign_in", opts.ProxyPrefix),
 
 		ProxyPrefix:         opts.ProxyPrefix,
-		provider:            opts.GetProvider(),
+		providers:           registry,
 		sessionStore:        sessionStore,
 		redirectURL:         redirectURL,
 		allowedRoutes:       allowedRoutes,
@@ -198,8 +357,14 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		realClientIPParser:  opts.GetRealClientIPParser(),
 		SkipProviderButton:  opts.SkipProviderButton,
 		trustedIPs:          trustedIPs,
+		adminEmails:         opts.AdminEmails,
+		adminGroups:         opts.AdminGroups,
+		authzEngine:         authzEngine,
+		sessionIdleTimeout:  opts.Session.IdleTimeout,
+		sessionMaxLifetime:  opts.Session.MaxLifetime,
 
 		basicAuthValidator: basicAuthValidator,
+		apiKeys:            apiKeys,
 		sessionChain:       sessionChain,
 		headersChain:       headersChain,
 		preAuthChain:       preAuthChain,
@@ -210,10 +375,6 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 	}
 	p.buildServeMux(opts.ProxyPrefix)
 
-	if err := p.setupServer(opts); err != nil {
-		return nil, fmt.Errorf("error setting up server: %v", err)
-	}
-
 	return p, nil
 }
 
@@ -275,7 +436,7 @@ func (p *OAuthProxy) buildServeMux(proxyPrefix string) {
 	// The authonly path should be registered separately to prevent it from getting no-cache headers.
 	// We do this to allow users to have a short cache (via nginx) of the response to reduce the
 	// likelihood of multiple reuests trying to referesh sessions simultaneously.
-	r.Path(proxyPrefix + authOnlyPath).Handler(p.sessionChain.ThenFunc(p.AuthOnly))
+	r.Path(proxyPrefix + authOnlyPath).Handler(alice.New(middleware.NewAuthRequestScope()).Extend(p.sessionChain).ThenFunc(p.AuthOnly))
 
 	// This will register all of the paths under the proxy prefix, except the auth only path so that no cache headers
 	// are not applied.
@@ -294,9 +455,14 @@ func (p *OAuthProxy) buildProxySubrouter(s *mux.Router) {
 	s.Path(signOutPath).HandlerFunc(p.SignOut)
 	s.Path(oauthStartPath).HandlerFunc(p.OAuthStart)
 	s.Path(oauthCallbackPath).HandlerFunc(p.OAuthCallback)
+	s.Path(backChannelLogoutPath).Methods(http.MethodPost).HandlerFunc(p.BackChannelLogout)
+	s.Path(samlMetadataPath).Methods(http.MethodGet).HandlerFunc(p.SAMLMetadata)
+	s.Path(samlACSPath).Methods(http.MethodPost).HandlerFunc(p.SAMLCallback)
 
 	// The userinfo endpoint needs to load sessions before handling the request
 	s.Path(userInfoPath).Handler(p.sessionChain.ThenFunc(p.UserInfo))
+
+	p.buildAdminSubrouter(s)
 }
 
 // buildPreAuthChain constructs a chain that should process every request before
@@ -340,12 +506,18 @@ func buildPreAuthChain(opts *options.Options) (alice.Chain, error) {
 	return chain, nil
 }
 
-func buildSessionChain(opts *options.Options, sessionStore sessionsapi.SessionStore, validator basic.Validator) alice.Chain {
+func buildSessionChain(opts *options.Options, registry *providerRegistry, sessionStore sessionsapi.SessionStore, validator basic.Validator, apiKeys *apikey.Store) (alice.Chain, error) {
 	chain := alice.New()
 
+	// API keys may be sent as bearer tokens, so they are loaded before JWTs
+	if apiKeys != nil {
+		chain = chain.Append(middleware.NewAPIKeySessionLoader(apiKeys))
+	}
+
 	if opts.SkipJwtBearerTokens {
-		sessionLoaders := []middlewareapi.TokenToSessionFunc{
-			opts.GetProvider().CreateSessionFromToken,
+		sessionLoaders := []middlewareapi.TokenToSessionFunc{}
+		for _, provider := range registry.all() {
+			sessionLoaders = append(sessionLoaders, providerTokenToSessionFunc(provider))
 		}
 
 		for _, verifier := range opts.GetJWTBearerVerifiers() {
@@ -353,7 +525,26 @@ func buildSessionChain(opts *options.Options, sessionStore sessionsapi.SessionSt
 				middlewareapi.CreateTokenToSessionFunc(verifier.Verify))
 		}
 
-		chain = chain.Append(middleware.NewJwtSessionLoader(sessionLoaders))
+		introspectionLoaders := []middlewareapi.TokenToSessionFunc{}
+		for _, provider := range registry.all() {
+			if provider.Data().IntrospectionURL != nil {
+				introspectionLoaders = append(introspectionLoaders, providerIntrospectionTokenToSessionFunc(provider))
+			}
+		}
+
+		rules, err := authorization.NewBearerRules(opts.JWTBearer)
+		if err != nil {
+			return alice.Chain{}, err
+		}
+
+		loaderOpts := &middleware.JwtSessionLoaderOptions{
+			SessionLoaders:       sessionLoaders,
+			IntrospectionLoaders: introspectionLoaders,
+		}
+		if rules != nil {
+			loaderOpts.Rules = rules
+		}
+		chain = chain.Append(middleware.NewJwtSessionLoaderWithOptions(loaderOpts))
 	}
 
 	if validator != nil {
@@ -363,11 +554,47 @@ func buildSessionChain(opts *options.Options, sessionStore sessionsapi.SessionSt
 	chain = chain.Append(middleware.NewStoredSessionLoader(&middleware.StoredSessionLoaderOptions{
 		SessionStore:    sessionStore,
 		RefreshPeriod:   opts.Cookie.Refresh,
-		RefreshSession:  opts.GetProvider().RefreshSession,
-		ValidateSession: opts.GetProvider().ValidateSession,
+		RefreshSession:  registry.refreshSession,
+		ValidateSession: registry.validateSession,
+
+		RefreshBeforeExpiry: opts.Cookie.RefreshBeforeExpiry,
+
+		IdleTimeout: opts.Session.IdleTimeout,
+		MaxLifetime: opts.Session.MaxLifetime,
+		// Polling the remaining session time must not keep the session alive
+		IgnoreActivity: func(req *http.Request) bool {
+			return req.URL.Path == opts.ProxyPrefix+userInfoPath
+		},
 	}))
 
-	return chain
+	return chain, nil
+}
+
+// providerTokenToSessionFunc wraps the provider's CreateSessionFromToken so
+// that sessions created from bearer tokens are linked to the provider.
+func providerTokenToSessionFunc(provider providers.Provider) middlewareapi.TokenToSessionFunc {
+	return func(ctx context.Context, token string) (*sessionsapi.SessionState, error) {
+		session, err := provider.CreateSessionFromToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		session.ProviderID = provider.Data().ID
+		return session, nil
+	}
+}
+
+// providerIntrospectionTokenToSessionFunc converts opaque bearer tokens into
+// sessions with the introspection endpoint of the provider
+func providerIntrospectionTokenToSessionFunc(provider providers.Provider) middlewareapi.TokenToSessionFunc {
+	introspect := provider.Data().CreateIntrospectionTokenToSessionFunc()
+	return func(ctx context.Context, token string) (*sessionsapi.SessionState, error) {
+		session, err := introspect(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		session.ProviderID = provider.Data().ID
+		return session, nil
+	}
 }
 
 func buildHeadersChain(opts *options.Options) (alice.Chain, error) {
@@ -402,6 +629,24 @@ func buildSignInMessage(opts *options.Options) string {
 	return msg
 }
 
+// buildSignInProviders lists the configured providers with the names
+// that should be displayed on the sign-in page.
+func buildSignInProviders(opts *options.Options) []pagewriter.SignInProvider {
+	nameOverrides := make(map[string]string, len(opts.Providers))
+	for _, provider := range opts.Providers {
+		nameOverrides[provider.ID] = provider.Name
+	}
+
+	signInProviders := make([]pagewriter.SignInProvider, 0, len(opts.GetProviders()))
+	for _, provider := range opts.GetProviders() {
+		signInProviders = append(signInProviders, pagewriter.SignInProvider{
+			ID:   provider.Data().ID,
+			Name: buildProviderName(provider, nameOverrides[provider.Data().ID]),
+		})
+	}
+	return signInProviders
+}
+
 func buildProviderName(p providers.Provider, override string) string {
 	if override != "" {
 		return override
@@ -472,8 +717,24 @@ func (p *OAuthProxy) SaveSession(rw http.ResponseWriter, req *http.Request, s *s
 	return p.sessionStore.Save(rw, req, s)
 }
 
+// sessionLimitPage rejects a sign in when the user already has the maximum
+// number of sessions
+func (p *OAuthProxy) sessionLimitPage(rw http.ResponseWriter, req *http.Request, username string) {
+	logger.PrintAuthf(username, req, logger.AuthFailure, "Session limit reached: %v", sessionsapi.ErrTooManySessions)
+	p.ErrorPage(rw, req, http.StatusForbidden, sessionsapi.ErrTooManySessions.Error(),
+		"You have reached the maximum number of active sessions. Sign out of another session and try again.")
+}
+
 func (p *OAuthProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	p.serveMux.ServeHTTP(rw, req)
+	p.activeProxy().serveMux.ServeHTTP(rw, req)
+}
+
+// activeProxy returns the OAuthProxy built from the latest configuration
+func (p *OAuthProxy) activeProxy() *OAuthProxy {
+	if active, ok := p.active.Load().(*OAuthProxy); ok {
+		return active
+	}
+	return p
 }
 
 // ErrorPage writes an error response
@@ -557,23 +818,31 @@ func (p *OAuthProxy) SignInPage(rw http.ResponseWriter, req *http.Request, code
 	p.pageWriter.WriteSignInPage(rw, req, redirectURL)
 }
 
-// ManualSignIn handles basic auth logins to the proxy
-func (p *OAuthProxy) ManualSignIn(req *http.Request) (string, bool) {
+// ManualSignIn handles basic auth logins to the proxy.
+// The groups of the user are returned when the validator resolves them.
+func (p *OAuthProxy) ManualSignIn(req *http.Request) (string, []string, bool) {
 	if req.Method != "POST" || p.basicAuthValidator == nil {
-		return "", false
+		return "", nil, false
 	}
 	user := req.FormValue("username")
 	passwd := req.FormValue("password")
 	if user == "" {
-		return "", false
+		return "", nil, false
 	}
 	// check auth
-	if p.basicAuthValidator.Validate(user, passwd) {
+	var groups []string
+	var valid bool
+	if groupValidator, ok := p.basicAuthValidator.(basic.GroupValidator); ok {
+		groups, valid = groupValidator.ValidateGroups(user, passwd)
+	} else {
+		valid = p.basicAuthValidator.Validate(user, passwd)
+	}
+	if valid {
 		logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via HtpasswdFile")
-		return user, true
+		return user, groups, true
 	}
 	logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via HtpasswdFile")
-	return "", false
+	return "", nil, false
 }
 
 // SignIn serves a page prompting users to sign in
@@ -585,10 +854,14 @@ func (p *OAuthProxy) SignIn(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	user, ok := p.ManualSignIn(req)
+	user, groups, ok := p.ManualSignIn(req)
 	if ok {
-		session := &sessionsapi.SessionState{User: user}
+		session := &sessionsapi.SessionState{User: user, Groups: groups}
 		err = p.SaveSession(rw, req, session)
+		if errors.Is(err, sessionsapi.ErrTooManySessions) {
+			p.sessionLimitPage(rw, req, user)
+			return
+		}
 		if err != nil {
 			logger.Printf("Error saving session: %v", err)
 			p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
@@ -627,12 +900,22 @@ func (p *OAuthProxy) UserInfo(rw http.ResponseWriter, req *http.Request) {
 		Email             string   `json:"email"`
 		Groups            []string `json:"groups,omitempty"`
 		PreferredUsername string   `json:"preferredUsername,omitempty"`
+
+		// Seconds left until the session ends, when the limits are enabled
+		IdleTimeoutRemaining *int64 `json:"idleTimeoutRemaining,omitempty"`
+		MaxLifetimeRemaining *int64 `json:"maxLifetimeRemaining,omitempty"`
 	}{
 		User:              session.User,
 		Email:             session.Email,
 		Groups:            session.Groups,
 		PreferredUsername: session.PreferredUsername,
 	}
+	if p.sessionIdleTimeout > time.Duration(0) {
+		userInfo.IdleTimeoutRemaining = remainingSeconds(session.IdleTimeoutRemaining(p.sessionIdleTimeout))
+	}
+	if p.sessionMaxLifetime > time.Duration(0) {
+		userInfo.MaxLifetimeRemaining = remainingSeconds(session.MaxLifetimeRemaining(p.sessionMaxLifetime))
+	}
 
 	if err := json.NewEncoder(rw).Encode(userInfo); err != nil {
 		logger.Printf("Error encoding user info: %v", err)
@@ -640,6 +923,16 @@ func (p *OAuthProxy) UserInfo(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// remainingSeconds returns the whole seconds of the remaining duration, which
+// is never negative
+func remainingSeconds(d time.Duration) *int64 {
+	seconds := int64(d / time.Second)
+	if seconds < 0 {
+		seconds = 0
+	}
+	return &seconds
+}
+
 // SignOut sends a response to clear the authentication cookie
 func (p *OAuthProxy) SignOut(rw http.ResponseWriter, req *http.Request) {
 	redirect, err := p.appDirector.GetRedirect(req)
@@ -648,25 +941,182 @@ func (p *OAuthProxy) SignOut(rw http.ResponseWriter, req *http.Request) {
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	// Load the session before it is cleared to end it at the provider too.
+	// Users without a valid session are only logged out locally.
+	session, _ := p.sessionStore.Load(req)
 	err = p.ClearSessionCookie(rw, req)
 	if err != nil {
 		logger.Errorf("Error clearing session cookie: %v", err)
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if session != nil {
+		logoutURL, err := p.getProviderLogoutURL(req, session, redirect)
+		if err != nil {
+			logger.Errorf("Error obtaining provider logout URL: %v", err)
+		} else if logoutURL != "" {
+			redirect = logoutURL
+		}
+	}
 	http.Redirect(rw, req, redirect, http.StatusFound)
 }
 
+// getProviderLogoutURL returns the URL that ends the session at the provider
+// that issued it, or an empty string if the provider does not support it.
+// The user is sent back to the validated redirect once logged out.
+func (p *OAuthProxy) getProviderLogoutURL(req *http.Request, session *sessionsapi.SessionState, redirect string) (string, error) {
+	provider, err := p.providers.forSession(session)
+	if err != nil {
+		return "", err
+	}
+
+	var postLogoutRedirectURI string
+	if p.redirectValidator.IsValidRedirect(redirect) {
+		postLogoutRedirectURI = p.getAbsoluteRedirectURI(req, redirect)
+	}
+	return provider.Data().GetLogoutURL(session, postLogoutRedirectURI)
+}
+
+// getAbsoluteRedirectURI resolves a relative redirect against the scheme and
+// host of the request, as the provider needs an absolute URL to redirect to.
+func (p *OAuthProxy) getAbsoluteRedirectURI(req *http.Request, redirect string) string {
+	rd, err := url.Parse(redirect)
+	if err != nil || rd.Host != "" {
+		return redirect
+	}
+
+	rd.Host = requestutil.GetRequestHost(req)
+	rd.Scheme = requestutil.GetRequestProto(req)
+	if rd.Scheme == "" {
+		rd.Scheme = schemeHTTP
+	}
+	if p.CookieOptions.Secure {
+		rd.Scheme = schemeHTTPS
+	}
+	return rd.String()
+}
+
+// BackChannelLogout implements the OpenID Connect Back-Channel Logout
+// endpoint. It revokes the stored sessions identified by the logout token the
+// provider sends when the user logs out at the provider.
+func (p *OAuthProxy) BackChannelLogout(rw http.ResponseWriter, req *http.Request) {
+	store, ok := p.sessionStore.(sessionsapi.UserSessionStore)
+	if !ok {
+		logger.Errorf("Error handling back-channel logout: the session store does not support finding sessions")
+		http.Error(rw, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		return
+	}
+
+	rawToken := req.PostFormValue("logout_token")
+	if rawToken == "" {
+		writeBackChannelLogoutError(rw, "missing logout_token")
+		return
+	}
+
+	provider, token, err := p.providers.verifyLogoutToken(req.Context(), rawToken)
+	if err != nil {
+		logger.Errorf("Error verifying back-channel logout token: %v", err)
+		writeBackChannelLogoutError(rw, "invalid logout_token")
+		return
+	}
+
+	// The sid identifies a single session at the provider. Without it, all
+	// sessions of the subject are logged out. Both are only unique at the
+	// provider, so only the sessions of the provider are looked up.
+	key := sessionsapi.IndexKey{Attribute: sessionsapi.SessionIDIndex, Value: token.SessionID, ProviderID: provider.Data().ID}
+	if token.SessionID == "" {
+		key = sessionsapi.IndexKey{Attribute: sessionsapi.SubjectIndex, Value: token.Subject, ProviderID: provider.Data().ID}
+	}
+
+	revoked, err := store.RevokeUserSessions(req.Context(), key)
+	if err != nil {
+		logger.Errorf("Error revoking sessions on back-channel logout: %v", err)
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.PrintAuthf(token.Subject, req, logger.AuthSuccess, "Back-channel logout from provider %q revoked %d sessions with %s %q",
+		provider.Data().ID, revoked, key.Attribute, key.Value)
+	rw.WriteHeader(http.StatusOK)
+}
+
+// writeBackChannelLogoutError writes an invalid_request error response as
+// defined by the OpenID Connect Back-Channel Logout specification
+func writeBackChannelLogoutError(rw http.ResponseWriter, description string) {
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(http.StatusBadRequest)
+	err := json.NewEncoder(rw).Encode(struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{
+		Error:            "invalid_request",
+		ErrorDescription: description,
+	})
+	if err != nil {
+		logger.Errorf("Error encoding back-channel logout error: %v", err)
+	}
+}
+
 // OAuthStart starts the OAuth2 authentication flow
 func (p *OAuthProxy) OAuthStart(rw http.ResponseWriter, req *http.Request) {
 	prepareNoCache(rw)
 
+	provider, err := p.providers.get(req.FormValue("provider"))
+	if err != nil {
+		logger.Errorf("Error selecting provider: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p.startOAuth(rw, req, provider, nil, url.Values{})
+}
+
+// stepUp restarts the OAuth flow with the provider of the session when the
+// session does not meet the authentication requirements of an upstream.
+// The user is sent back to the original request once authenticated.
+func (p *OAuthProxy) stepUp(rw http.ResponseWriter, req *http.Request, stepUpErr *authorization.StepUpRequiredError) {
+	prepareNoCache(rw)
+
+	scope := middlewareapi.GetRequestScope(req)
+	session := scope.Session
+	logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Step-up authentication required: %s", stepUpErr.Params.Encode())
+
+	if !scope.StoredSession {
+		// Sessions from bearer tokens, API keys or basic auth credentials
+		// can't be authenticated again by signing in
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if isAjax(req) {
+		// no point redirecting an AJAX request
+		p.errorJSON(rw, http.StatusUnauthorized)
+		return
+	}
+
+	provider, err := p.providers.forSession(session)
+	if err != nil {
+		logger.Errorf("Error selecting provider for step-up authentication: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	p.startOAuth(rw, req, provider, stepUpErr.Requirements, stepUpErr.Params)
+}
+
+// startOAuth redirects the user to sign in with the provider.
+// The extra params are added to the login URL, and the requirements of a
+// step-up authentication are kept in the CSRF cookie to be checked in the
+// callback.
+func (p *OAuthProxy) startOAuth(rw http.ResponseWriter, req *http.Request, provider providers.Provider, requirements *options.AuthenticationRequirements, extraParams url.Values) {
 	csrf, err := cookies.NewCSRF(p.CookieOptions)
 	if err != nil {
 		logger.Errorf("Error creating CSRF nonce: %v", err)
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	csrf.SetProviderID(provider.Data().ID)
+	csrf.SetStepUp(requirements)
 
 	appRedirect, err := p.appDirector.GetRedirect(req)
 	if err != nil {
@@ -675,11 +1125,28 @@ func (p *OAuthProxy) OAuthStart(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if samlProvider, ok := provider.(*providers.SAMLProvider); ok {
+		p.startSAML(rw, req, samlProvider, csrf, appRedirect, extraParams)
+		return
+	}
+
+	if method := provider.Data().CodeChallengeMethod; method != "" {
+		codeChallenge, err := newCodeChallenge(csrf, method)
+		if err != nil {
+			logger.Errorf("Error creating PKCE code challenge: %v", err)
+			p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+			return
+		}
+		extraParams.Add("code_challenge", codeChallenge)
+		extraParams.Add("code_challenge_method", method)
+	}
+
 	callbackRedirect := p.getOAuthRedirectURI(req)
-	loginURL := p.provider.GetLoginURL(
+	loginURL := provider.GetLoginURL(
 		callbackRedirect,
-		encodeState(csrf.HashOAuthState(), appRedirect),
+		encodeState(csrf.HashOAuthState(), provider.Data().ID, appRedirect),
 		csrf.HashOIDCNonce(),
+		extraParams,
 	)
 
 	if _, err := csrf.SetCookie(rw, req); err != nil {
@@ -691,11 +1158,24 @@ func (p *OAuthProxy) OAuthStart(rw http.ResponseWriter, req *http.Request) {
 	http.Redirect(rw, req, loginURL, http.StatusFound)
 }
 
+// newCodeChallenge generates a PKCE code verifier that is stored in the CSRF
+// cookie and returns its code challenge for the login URL
+func newCodeChallenge(csrf cookies.CSRF, method string) (string, error) {
+	codeVerifier, err := encryption.GenerateCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+	codeChallenge, err := encryption.GenerateCodeChallenge(method, codeVerifier)
+	if err != nil {
+		return "", err
+	}
+	csrf.SetCodeVerifier(codeVerifier)
+	return codeChallenge, nil
+}
+
 // OAuthCallback is the OAuth2 authentication flow callback that finishes the
 // OAuth2 authentication flow
 func (p *OAuthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
-	remoteAddr := ip.GetClientString(p.realClientIPParser, req, true)
-
 	// finish the oauth cycle
 	err := req.ParseForm()
 	if err != nil {
@@ -712,57 +1192,96 @@ func (p *OAuthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	session, err := p.redeemCode(req)
+	nonce, providerID, appRedirect, err := decodeState(req.Form.Get("state"))
 	if err != nil {
-		logger.Errorf("Error redeeming code during OAuth2 callback: %v", err)
+		logger.Errorf("Error while parsing OAuth2 state: %v", err)
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = p.enrichSessionState(req.Context(), session)
+	// The CSRF cookie holds the PKCE code verifier needed to redeem the code
+	csrf, err := cookies.LoadCSRFCookie(req, p.CookieOptions)
 	if err != nil {
-		logger.Errorf("Error creating session during OAuth2 callback: %v", err)
-		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		logger.PrintAuthf("", req, logger.AuthFailure, "Invalid authentication via OAuth2: unable to obtain CSRF cookie")
+		p.ErrorPage(rw, req, http.StatusForbidden, err.Error(), "Login Failed: Unable to find a valid CSRF token. Please try again.")
 		return
 	}
 
-	csrf, err := cookies.LoadCSRFCookie(req, p.CookieOptions)
+	// The code is only redeemed with the provider the authentication was
+	// started with, so that a state naming another provider is rejected
+	// before the code is sent anywhere
+	if !csrf.CheckOAuthState(nonce) || !csrf.CheckProviderID(providerID) {
+		csrf.ClearCookie(rw, req)
+		logger.PrintAuthf("", req, logger.AuthFailure, "Invalid authentication via OAuth2: CSRF token mismatch, potential attack")
+		p.ErrorPage(rw, req, http.StatusForbidden, "CSRF token mismatch, potential attack", "Login Failed: Unable to find a valid CSRF token. Please try again.")
+		return
+	}
+
+	provider, err := p.providers.get(providerID)
 	if err != nil {
-		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via OAuth2: unable to obtain CSRF cookie")
-		p.ErrorPage(rw, req, http.StatusForbidden, err.Error(), "Login Failed: Unable to find a valid CSRF token. Please try again.")
+		logger.Errorf("Error selecting provider during OAuth2 callback: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	csrf.ClearCookie(rw, req)
+	session, err := p.redeemCode(req, provider, csrf.GetCodeVerifier())
+	if err != nil {
+		logger.Errorf("Error redeeming code during OAuth2 callback: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	nonce, appRedirect, err := decodeState(req)
+	err = p.enrichSessionState(req.Context(), provider, session)
 	if err != nil {
-		logger.Errorf("Error while parsing OAuth2 state: %v", err)
+		logger.Errorf("Error creating session during OAuth2 callback: %v", err)
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	p.finishSignIn(rw, req, provider, csrf, session, nonce, appRedirect, "OAuth2")
+}
+
+// finishSignIn checks the CSRF state and authorizes the session created by
+// the callback of the provider, then saves it and redirects the user to the
+// application. The protocol names the authentication flow in the logs.
+func (p *OAuthProxy) finishSignIn(rw http.ResponseWriter, req *http.Request, provider providers.Provider, csrf cookies.CSRF, session *sessionsapi.SessionState, nonce, appRedirect, protocol string) {
+	remoteAddr := ip.GetClientString(p.realClientIPParser, req, true)
+
+	csrf.ClearCookie(rw, req)
+
 	if !csrf.CheckOAuthState(nonce) {
-		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via OAuth2: CSRF token mismatch, potential attack")
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via %s: CSRF token mismatch, potential attack", protocol)
 		p.ErrorPage(rw, req, http.StatusForbidden, "CSRF token mismatch, potential attack", "Login Failed: Unable to find a valid CSRF token. Please try again.")
 		return
 	}
 
 	csrf.SetSessionNonce(session)
-	p.provider.ValidateSession(req.Context(), session)
+	provider.ValidateSession(req.Context(), session)
+
+	// A step-up authentication must meet the requirements it was started for
+	if params := authorization.StepUpParams(csrf.GetStepUp(), session); params != nil {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via %s: step-up requirements not met: %s", protocol, params.Encode())
+		p.ErrorPage(rw, req, http.StatusForbidden, "step-up authentication requirements not met",
+			"Login Failed: The identity provider did not authenticate you as required to access this resource.")
+		return
+	}
 
 	if !p.redirectValidator.IsValidRedirect(appRedirect) {
 		appRedirect = "/"
 	}
 
 	// set cookie, or deny
-	authorized, err := p.provider.Authorize(req.Context(), session)
+	authorized, err := provider.Authorize(req.Context(), session)
 	if err != nil {
 		logger.Errorf("Error with authorization: %v", err)
 	}
 	if p.Validator(session.Email) && authorized {
-		logger.PrintAuthf(session.Email, req, logger.AuthSuccess, "Authenticated via OAuth2: %s", session)
+		logger.PrintAuthf(session.Email, req, logger.AuthSuccess, "Authenticated via %s: %s", protocol, session)
 		err := p.SaveSession(rw, req, session)
+		if errors.Is(err, sessionsapi.ErrTooManySessions) {
+			p.sessionLimitPage(rw, req, session.Email)
+			return
+		}
 		if err != nil {
 			logger.Errorf("Error saving session state for %s: %v", remoteAddr, err)
 			p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
@@ -770,22 +1289,23 @@ func (p *OAuthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
 		}
 		http.Redirect(rw, req, appRedirect, http.StatusFound)
 	} else {
-		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via OAuth2: unauthorized")
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via %s: unauthorized", protocol)
 		p.ErrorPage(rw, req, http.StatusForbidden, "Invalid session: unauthorized")
 	}
 }
 
-func (p *OAuthProxy) redeemCode(req *http.Request) (*sessionsapi.SessionState, error) {
+func (p *OAuthProxy) redeemCode(req *http.Request, provider providers.Provider, codeVerifier string) (*sessionsapi.SessionState, error) {
 	code := req.Form.Get("code")
 	if code == "" {
 		return nil, providers.ErrMissingCode
 	}
 
 	redirectURI := p.getOAuthRedirectURI(req)
-	s, err := p.provider.Redeem(req.Context(), redirectURI, code)
+	s, err := provider.Redeem(req.Context(), redirectURI, code, codeVerifier)
 	if err != nil {
 		return nil, err
 	}
+	s.ProviderID = provider.Data().ID
 
 	// Force setting these in case the Provider didn't
 	if s.CreatedAt == nil {
@@ -798,25 +1318,44 @@ func (p *OAuthProxy) redeemCode(req *http.Request) (*sessionsapi.SessionState, e
 	return s, nil
 }
 
-func (p *OAuthProxy) enrichSessionState(ctx context.Context, s *sessionsapi.SessionState) error {
+func (p *OAuthProxy) enrichSessionState(ctx context.Context, provider providers.Provider, s *sessionsapi.SessionState) error {
 	var err error
 	if s.Email == "" {
 		// TODO(@NickMeves): Remove once all provider are updated to implement EnrichSession
 		// nolint:staticcheck
-		s.Email, err = p.provider.GetEmailAddress(ctx, s)
+		s.Email, err = provider.GetEmailAddress(ctx, s)
 		if err != nil && !errors.Is(err, providers.ErrNotImplemented) {
 			return err
 		}
 	}
 
-	return p.provider.EnrichSession(ctx, s)
+	return provider.EnrichSession(ctx, s)
 }
 
 // AuthOnly checks whether the user is currently logged in (both authentication
 // and optional authorization).
 func (p *OAuthProxy) AuthOnly(rw http.ResponseWriter, req *http.Request) {
 	session, err := p.getAuthenticatedSession(rw, req)
-	if err != nil {
+	var stepUpErr *authorization.StepUpRequiredError
+	if errors.As(err, &stepUpErr) {
+		// A 401 would send the user to sign in again without the step-up
+		// parameters, which yields the same session and loops forever
+		scope := middlewareapi.GetRequestScope(req)
+		logger.PrintAuthf(scope.Session.Email, req, logger.AuthFailure, "Step-up authentication required: %s", stepUpErr.Params.Encode())
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	switch err {
+	case nil:
+	case ErrForbidden:
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	case ErrInsufficientScope:
+		setBearerChallenge(rw, req)
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	default:
 		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
@@ -839,6 +1378,13 @@ func (p *OAuthProxy) AuthOnly(rw http.ResponseWriter, req *http.Request) {
 // them to authenticate
 func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
 	session, err := p.getAuthenticatedSession(rw, req)
+	var stepUpErr *authorization.StepUpRequiredError
+	if errors.As(err, &stepUpErr) {
+		// we need to send the user to authenticate again as required
+		p.stepUp(rw, req, stepUpErr)
+		return
+	}
+
 	switch err {
 	case nil:
 		// we are authenticated
@@ -861,6 +1407,13 @@ func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
 	case ErrAccessDenied:
 		p.ErrorPage(rw, req, http.StatusForbidden, "The session failed authorization checks")
 
+	case ErrForbidden:
+		p.ErrorPage(rw, req, http.StatusForbidden, "You are not allowed to access this resource")
+
+	case ErrInsufficientScope:
+		setBearerChallenge(rw, req)
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
 	default:
 		// unknown error
 		logger.Errorf("Unexpected internal error: %v", err)
@@ -921,6 +1474,9 @@ func (p *OAuthProxy) getOAuthRedirectURI(req *http.Request) string {
 // Returns:
 // - `nil, ErrNeedsLogin` if user needs to login.
 // - `nil, ErrAccessDenied` if the authenticated user is not authorized
+// - `nil, ErrForbidden` if the authorization rules deny the request
+// - `nil, *authorization.StepUpRequiredError` if the session does not meet the authentication requirements of the upstream
+// - `nil, ErrInsufficientScope` if the bearer token does not meet the bearer token rules
 // Set-Cookie headers may be set on the response as a side-effect of calling this method.
 func (p *OAuthProxy) getAuthenticatedSession(rw http.ResponseWriter, req *http.Request) (*sessionsapi.SessionState, error) {
 	session := middlewareapi.GetRequestScope(req).Session
@@ -931,11 +1487,14 @@ func (p *OAuthProxy) getAuthenticatedSession(rw http.ResponseWriter, req *http.R
 	}
 
 	if session == nil {
+		if middlewareapi.GetRequestScope(req).BearerTokenError != nil {
+			return nil, ErrInsufficientScope
+		}
 		return nil, ErrNeedsLogin
 	}
 
 	invalidEmail := session.Email != "" && !p.Validator(session.Email)
-	authorized, err := p.provider.Authorize(req.Context(), session)
+	authorized, err := p.providers.authorize(req.Context(), session)
 	if err != nil {
 		logger.Errorf("Error with authorization: %v", err)
 	}
@@ -950,9 +1509,28 @@ func (p *OAuthProxy) getAuthenticatedSession(rw http.ResponseWriter, req *http.R
 		return nil, ErrAccessDenied
 	}
 
+	method, path := requestutil.GetAuthorizationRoute(req)
+	decision := p.authzEngine.Authorize(method, path, session)
+	if decision.StepUp != nil {
+		return nil, decision.StepUp
+	}
+	if !decision.Allowed {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Request denied by %s: %s", decision, session)
+		return nil, ErrForbidden
+	}
+
 	return session, nil
 }
 
+// setBearerChallenge sets the WWW-Authenticate challenge describing why the
+// bearer token of the request was rejected (RFC 6750)
+func setBearerChallenge(rw http.ResponseWriter, req *http.Request) {
+	var scopeErr *authorization.InsufficientScopeError
+	if errors.As(middlewareapi.GetRequestScope(req).BearerTokenError, &scopeErr) {
+		rw.Header().Set("WWW-Authenticate", scopeErr.WWWAuthenticate())
+	}
+}
+
 // authOnlyAuthorize handles special authorization logic that is only done
 // on the AuthOnly endpoint for use with Nginx subrequest architectures.
 //
@@ -1000,20 +1578,24 @@ func extractAllowedGroups(req *http.Request) map[string]struct{} {
 	return groups
 }
 
-// encodedState builds the OAuth state param out of our nonce and
-// original application redirect
-func encodeState(nonce string, redirect string) string {
-	return fmt.Sprintf("%v:%v", nonce, redirect)
+// encodedState builds the OAuth state param out of our nonce, the ID of the
+// provider used to login and the original application redirect
+func encodeState(nonce string, providerID string, redirect string) string {
+	return fmt.Sprintf("%v:%v:%v", nonce, url.QueryEscape(providerID), redirect)
 }
 
-// decodeState splits the reflected OAuth state response back into
-// the nonce and original application redirect
-func decodeState(req *http.Request) (string, string, error) {
-	state := strings.SplitN(req.Form.Get("state"), ":", 2)
-	if len(state) != 2 {
-		return "", "", errors.New("invalid length")
+// decodeState splits the reflected OAuth state (or SAML relay state) back
+// into the nonce, provider ID and original application redirect
+func decodeState(encoded string) (string, string, string, error) {
+	state := strings.SplitN(encoded, ":", 3)
+	if len(state) != 3 {
+		return "", "", "", errors.New("invalid length")
+	}
+	providerID, err := url.QueryUnescape(state[1])
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid provider ID: %v", err)
 	}
-	return state[0], state[1], nil
+	return state[0], providerID, state[2], nil
 }
 
 // addHeadersForProxying adds the appropriate headers the request / response for proxying
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -16,12 +18,18 @@ import (
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt"
 	"github.com/mbland/hmacauth"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authorization"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	sessionscookie "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	sqlsessions "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/sql"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/upstream"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
@@ -113,7 +121,7 @@ func Test_redeemCode(t *testing.T) {
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	_, err = proxy.redeemCode(req)
+	_, err = proxy.redeemCode(req, proxy.providers.defaultProvider(), "")
 	assert.Equal(t, providers.ErrMissingCode, err)
 }
 
@@ -167,7 +175,7 @@ func Test_enrichSession(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = proxy.enrichSessionState(context.Background(), tc.session)
+			err = proxy.enrichSessionState(context.Background(), proxy.providers.defaultProvider(), tc.session)
 			assert.NoError(t, err)
 			assert.Equal(t, tc.expectedUser, tc.session.User)
 			assert.Equal(t, tc.expectedEmail, tc.session.Email)
@@ -407,7 +415,7 @@ func (patTest *PassAccessTokenTest) getCallbackEndpoint() (httpCode int, cookie
 		http.MethodGet,
 		fmt.Sprintf(
 			"/oauth2/callback?code=callback_code&state=%s",
-			encodeState(csrf.HashOAuthState(), "%2F"),
+			encodeState(csrf.HashOAuthState(), "", "%2F"),
 		),
 		strings.NewReader(""),
 	)
@@ -658,6 +666,335 @@ func TestSignInPageSkipProviderDirect(t *testing.T) {
 	}
 }
 
+func newMultipleProvidersTest(t *testing.T, validator func(string) bool) (*OAuthProxy, *httptest.Server) {
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"access_token": "my_auth_token"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}))
+
+	opts := baseTestOptions()
+	opts.Providers = append(opts.Providers, options.Provider{
+		ID:           "providerB",
+		Type:         "github",
+		Name:         "Provider B",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	})
+	err := validation.Validate(opts)
+	assert.NoError(t, err)
+
+	providerURL, _ := url.Parse(providerServer.URL)
+	providerA := NewTestProvider(providerURL, "a@example.com")
+	providerA.ID = "providerID"
+	providerB := NewTestProvider(providerURL, "b@example.com")
+	providerB.ID = "providerB"
+	providerB.LoginURL.Path = "/oauth/b/authorize"
+	opts.SetProviders([]providers.Provider{providerA, providerB})
+
+	proxy, err := NewOAuthProxy(opts, validator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy, providerServer
+}
+
+func TestSignInPageMultipleProviders(t *testing.T) {
+	proxy, providerServer := newMultipleProvidersTest(t, func(string) bool { return true })
+	defer providerServer.Close()
+
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth2/sign_in", nil)
+	proxy.ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	body := rw.Body.String()
+	assert.Contains(t, body, `<input type="hidden" name="provider" value="providerID">`)
+	assert.Contains(t, body, "Sign in with Test Provider")
+	assert.Contains(t, body, `<input type="hidden" name="provider" value="providerB">`)
+	assert.Contains(t, body, "Sign in with Provider B")
+}
+
+func TestOAuthStartMultipleProviders(t *testing.T) {
+	proxy, providerServer := newMultipleProvidersTest(t, func(string) bool { return true })
+	defer providerServer.Close()
+
+	testCases := map[string]struct {
+		query         string
+		expectedCode  int
+		expectedPath  string
+		expectedState string
+	}{
+		"Without a provider uses the default provider": {
+			query:         "",
+			expectedCode:  http.StatusFound,
+			expectedPath:  "/oauth/authorize",
+			expectedState: ":providerID:/",
+		},
+		"With the default provider": {
+			query:         "?provider=providerID",
+			expectedCode:  http.StatusFound,
+			expectedPath:  "/oauth/authorize",
+			expectedState: ":providerID:/",
+		},
+		"With a second provider": {
+			query:         "?provider=providerB",
+			expectedCode:  http.StatusFound,
+			expectedPath:  "/oauth/b/authorize",
+			expectedState: ":providerB:/",
+		},
+		"With an unknown provider": {
+			query:        "?provider=unknown",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/oauth2/start"+tc.query, nil)
+			proxy.ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedCode, rw.Code)
+			if tc.expectedCode != http.StatusFound {
+				return
+			}
+
+			loginURL, err := url.Parse(rw.Header().Get("Location"))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPath, loginURL.Path)
+			assert.Contains(t, loginURL.Query().Get("state"), tc.expectedState)
+		})
+	}
+}
+
+func TestOAuthCallbackMultipleProviders(t *testing.T) {
+	testCases := map[string]struct {
+		providerID       string
+		cookieProviderID string
+		expectedCode     int
+		expectedEmail    string
+	}{
+		"With the default provider": {
+			providerID:       "providerID",
+			cookieProviderID: "providerID",
+			expectedCode:     http.StatusFound,
+			expectedEmail:    "a@example.com",
+		},
+		"With a second provider": {
+			providerID:       "providerB",
+			cookieProviderID: "providerB",
+			expectedCode:     http.StatusFound,
+			expectedEmail:    "b@example.com",
+		},
+		"With an unknown provider": {
+			providerID:       "unknown",
+			cookieProviderID: "unknown",
+			expectedCode:     http.StatusBadRequest,
+		},
+		"With another provider than the one the authentication was started with": {
+			providerID:       "providerB",
+			cookieProviderID: "providerID",
+			expectedCode:     http.StatusForbidden,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var validatedEmail string
+			proxy, providerServer := newMultipleProvidersTest(t, func(email string) bool {
+				validatedEmail = email
+				return true
+			})
+			defer providerServer.Close()
+
+			csrf, err := cookies.NewCSRF(proxy.CookieOptions)
+			assert.NoError(t, err)
+			csrf.SetProviderID(tc.cookieProviderID)
+
+			req, _ := http.NewRequest(
+				http.MethodGet,
+				fmt.Sprintf(
+					"/oauth2/callback?code=callback_code&state=%s",
+					encodeState(csrf.HashOAuthState(), tc.providerID, "%2F"),
+				),
+				nil,
+			)
+			csrfCookie, err := csrf.SetCookie(httptest.NewRecorder(), req)
+			assert.NoError(t, err)
+			req.AddCookie(csrfCookie)
+
+			rw := httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedCode, rw.Code)
+			assert.Equal(t, tc.expectedEmail, validatedEmail)
+		})
+	}
+}
+
+func newStepUpTest(t *testing.T) (*OAuthProxy, *httptest.Server) {
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"access_token": "my_auth_token"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}))
+
+	opts := baseTestOptions()
+	opts.UpstreamServers = options.Upstreams{
+		{
+			ID:     "admin",
+			Path:   "/admin/",
+			Static: true,
+			Authorization: &options.UpstreamAuthorization{
+				Authentication: &options.AuthenticationRequirements{
+					AcrValues: []string{"gold"},
+				},
+			},
+		},
+		{
+			ID:     "public",
+			Path:   "/",
+			Static: true,
+		},
+	}
+	err := validation.Validate(opts)
+	assert.NoError(t, err)
+
+	providerURL, _ := url.Parse(providerServer.URL)
+	provider := NewTestProvider(providerURL, "john.doe@example.com")
+	provider.ID = "providerID"
+	opts.SetProviders([]providers.Provider{provider})
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy, providerServer
+}
+
+func TestStepUpAuthentication(t *testing.T) {
+	proxy, providerServer := newStepUpTest(t)
+	defer providerServer.Close()
+
+	rw := httptest.NewRecorder()
+	err := proxy.SaveSession(rw, httptest.NewRequest(http.MethodGet, "/", nil), &sessions.SessionState{
+		Email:      "john.doe@example.com",
+		ProviderID: "providerID",
+		Acr:        "silver",
+	})
+	assert.NoError(t, err)
+	sessionCookies := rw.Result().Cookies()
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for _, c := range sessionCookies {
+			req.AddCookie(c)
+		}
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+
+	// Upstreams without requirements accept the session
+	assert.Equal(t, http.StatusOK, serve("/public").Code)
+
+	rw = serve("/admin/users?page=2")
+	assert.Equal(t, http.StatusFound, rw.Code)
+
+	loginURL, err := url.Parse(rw.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/oauth/authorize", loginURL.Path)
+	assert.Equal(t, "gold", loginURL.Query().Get("acr_values"))
+	assert.True(t, strings.HasSuffix(loginURL.Query().Get("state"), ":providerID:/admin/users?page=2"))
+
+	// The requirements are kept for the callback
+	callbackReq := httptest.NewRequest(http.MethodGet, "/oauth2/callback", nil)
+	for _, c := range rw.Result().Cookies() {
+		callbackReq.AddCookie(c)
+	}
+	csrf, err := cookies.LoadCSRFCookie(callbackReq, proxy.CookieOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gold"}, csrf.GetStepUp().AcrValues)
+
+	// Auth requests are denied, a 401 would restart the sign in without the
+	// step-up parameters
+	authReq := httptest.NewRequest(http.MethodGet, "/oauth2/auth", nil)
+	authReq.Header.Set("X-Forwarded-Uri", "/admin/users")
+	for _, c := range sessionCookies {
+		authReq.AddCookie(c)
+	}
+	rw = httptest.NewRecorder()
+	proxy.ServeHTTP(rw, authReq)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Empty(t, rw.Header().Get("Location"))
+}
+
+func TestStepUpAuthenticationWithoutStoredSession(t *testing.T) {
+	proxy, providerServer := newStepUpTest(t)
+	defer providerServer.Close()
+
+	// Sessions from bearer tokens, API keys or basic auth can't sign in again
+	req := middlewareapi.AddRequestScope(httptest.NewRequest(http.MethodGet, "/admin/users", nil), &middlewareapi.RequestScope{
+		Session: &sessions.SessionState{Email: "john.doe@example.com", ProviderID: "providerID"},
+	})
+	rw := httptest.NewRecorder()
+	proxy.stepUp(rw, req, &authorization.StepUpRequiredError{Params: url.Values{"acr_values": {"gold"}}})
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Empty(t, rw.Header().Get("Location"))
+}
+
+func TestOAuthCallbackStepUp(t *testing.T) {
+	testCases := map[string]struct {
+		requirements *options.AuthenticationRequirements
+		expectedCode int
+	}{
+		"Without step-up requirements": {
+			requirements: nil,
+			expectedCode: http.StatusFound,
+		},
+		"With step-up requirements the session does not meet": {
+			requirements: &options.AuthenticationRequirements{
+				AcrValues: []string{"gold"},
+			},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			proxy, providerServer := newStepUpTest(t)
+			defer providerServer.Close()
+
+			csrf, err := cookies.NewCSRF(proxy.CookieOptions)
+			assert.NoError(t, err)
+			csrf.SetProviderID("providerID")
+			csrf.SetStepUp(tc.requirements)
+
+			req, _ := http.NewRequest(
+				http.MethodGet,
+				fmt.Sprintf(
+					"/oauth2/callback?code=callback_code&state=%s",
+					encodeState(csrf.HashOAuthState(), "providerID", "%2Fadmin%2F"),
+				),
+				nil,
+			)
+			csrfCookie, err := csrf.SetCookie(httptest.NewRecorder(), req)
+			assert.NoError(t, err)
+			req.AddCookie(csrfCookie)
+
+			rw := httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedCode, rw.Code)
+		})
+	}
+}
+
 type ProcessCookieTest struct {
 	opts         *options.Options
 	proxy        *OAuthProxy
@@ -693,11 +1030,12 @@ func NewProcessCookieTest(opts ProcessCookieTestOpts, modifiers ...OptionsModifi
 	if err != nil {
 		return nil, err
 	}
-	pcTest.proxy.provider = &TestProvider{
+	testProvider := &TestProvider{
 		ProviderData: &providers.ProviderData{},
 		ValidToken:   opts.providerValidateCookieResponse,
 	}
-	pcTest.proxy.provider.(*TestProvider).SetAllowedGroups(pcTest.opts.Providers[0].AllowedGroups)
+	testProvider.SetAllowedGroups(pcTest.opts.Providers[0].AllowedGroups)
+	pcTest.proxy.providers = newProviderRegistry([]providers.Provider{testProvider})
 
 	// Now, zero-out proxy.CookieRefresh for the cases that don't involve
 	// access_token validation.
@@ -905,6 +1243,91 @@ func TestUserInfoEndpointAccepted(t *testing.T) {
 	}
 }
 
+func TestUserInfoEndpointSessionLifetime(t *testing.T) {
+	now := time.Now()
+	clock.Set(now)
+	defer clock.Reset()
+
+	test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+		opts.Session.IdleTimeout = 30 * time.Minute
+		opts.Session.MaxLifetime = 12 * time.Hour
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.req, _ = http.NewRequest("GET", test.opts.ProxyPrefix+"/userinfo", nil)
+
+	signedIn := now.Add(-1 * time.Hour)
+	lastActivity := now.Add(-10 * time.Minute)
+	err = test.SaveSession(&sessions.SessionState{
+		User:           "john.doe",
+		Email:          "john.doe@example.com",
+		SignedInAt:     &signedIn,
+		LastActivityAt: &lastActivity,
+	})
+	assert.NoError(t, err)
+
+	test.rw = httptest.NewRecorder()
+	test.proxy.ServeHTTP(test.rw, test.req)
+	assert.Equal(t, http.StatusOK, test.rw.Code)
+	bodyBytes, _ := ioutil.ReadAll(test.rw.Body)
+	assert.Equal(t, "{\"user\":\"john.doe\",\"email\":\"john.doe@example.com\",\"idleTimeoutRemaining\":1200,\"maxLifetimeRemaining\":39600}\n", string(bodyBytes))
+	// Polling the user info is not recorded as activity of the session
+	assert.Empty(t, test.rw.Header().Values("Set-Cookie"))
+}
+
+type acceptingBasicValidator struct{}
+
+func (acceptingBasicValidator) Validate(_, _ string) bool { return true }
+
+func TestSignInSessionLimit(t *testing.T) {
+	testCases := map[string]struct {
+		policy       string
+		expectedCode int
+	}{
+		"rejects the sign in": {
+			policy:       options.RejectSessionLimitPolicy,
+			expectedCode: http.StatusForbidden,
+		},
+		"evicts the oldest session": {
+			policy:       options.EvictOldestSessionLimitPolicy,
+			expectedCode: http.StatusFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+				opts.Session.Type = options.MemorySessionStoreType
+				opts.Session.MaxPerUser = 1
+				opts.Session.LimitPolicy = tc.policy
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.proxy.basicAuthValidator = acceptingBasicValidator{}
+
+			signIn := func() *httptest.ResponseRecorder {
+				form := url.Values{"username": {"john.doe"}, "password": {"secret"}}
+				req := httptest.NewRequest("POST", test.opts.ProxyPrefix+"/sign_in", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				rw := httptest.NewRecorder()
+				test.proxy.ServeHTTP(rw, req)
+				return rw
+			}
+
+			assert.Equal(t, http.StatusFound, signIn().Code)
+
+			rw := signIn()
+			assert.Equal(t, tc.expectedCode, rw.Code)
+			if tc.expectedCode == http.StatusForbidden {
+				assert.Contains(t, rw.Body.String(), "You have reached the maximum number of active sessions.")
+				assert.Empty(t, rw.Header().Values("Set-Cookie"))
+			}
+		})
+	}
+}
+
 func TestUserInfoEndpointUnauthorizedOnNoCookieSetError(t *testing.T) {
 	test, err := NewUserInfoEndpointTest()
 	if err != nil {
@@ -1052,10 +1475,10 @@ func TestAuthOnlyEndpointSetXAuthRequestHeaders(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	pcTest.proxy.provider = &TestProvider{
+	pcTest.proxy.providers = newProviderRegistry([]providers.Provider{&TestProvider{
 		ProviderData: &providers.ProviderData{},
 		ValidToken:   true,
-	}
+	}})
 
 	pcTest.validateUser = true
 
@@ -1145,10 +1568,10 @@ func TestAuthOnlyEndpointSetBasicAuthTrueRequestHeaders(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	pcTest.proxy.provider = &TestProvider{
+	pcTest.proxy.providers = newProviderRegistry([]providers.Provider{&TestProvider{
 		ProviderData: &providers.ProviderData{},
 		ValidToken:   true,
-	}
+	}})
 
 	pcTest.validateUser = true
 
@@ -1225,10 +1648,10 @@ func TestAuthOnlyEndpointSetBasicAuthFalseRequestHeaders(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	pcTest.proxy.provider = &TestProvider{
+	pcTest.proxy.providers = newProviderRegistry([]providers.Provider{&TestProvider{
 		ProviderData: &providers.ProviderData{},
 		ValidToken:   true,
-	}
+	}})
 
 	pcTest.validateUser = true
 
@@ -1719,7 +2142,7 @@ func TestGetJwtSession(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	tp, _ := test.proxy.provider.(*TestProvider)
+	tp, _ := test.proxy.providers.defaultProvider().(*TestProvider)
 	tp.GroupValidator = func(s string) bool {
 		return true
 	}
@@ -1745,6 +2168,37 @@ func TestGetJwtSession(t *testing.T) {
 	assert.Equal(t, test.rw.Header().Get("X-Auth-Request-Email"), "john@example.com")
 }
 
+func TestGetJwtSessionInsufficientScope(t *testing.T) {
+	// Same token as in TestGetJwtSession, it has no scope claim
+	goodJwt := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
+		"eyJzdWIiOiIxMjM0NTY3ODkwIiwiYXVkIjoiaHR0cHM6Ly90ZXN0Lm15YXBwLmNvbSIsIm5hbWUiOiJKb2huIERvZSIsImVtY" +
+		"WlsIjoiam9obkBleGFtcGxlLmNvbSIsImlzcyI6Imh0dHBzOi8vaXNzdWVyLmV4YW1wbGUuY29tIiwiaWF0IjoxNTUzNjkxMj" +
+		"E1LCJleHAiOjE5MTIxNTE4MjF9." +
+		"rLVyzOnEldUq_pNkfa-WiV8TVJYWyZCaM2Am_uo8FGg11zD7l-qmz3x1seTvqpH6Y0Ty00fmv6dJnGnC8WMnPXQiodRTfhBSe" +
+		"OKZMu0HkMD2sg52zlKkbfLTO6ic5VnbVgwjjrB8am_Ta6w7kyFUaB5C1BsIrrLMldkWEhynbb8"
+
+	verifier := oidc.NewVerifier("https://issuer.example.com", NoOpKeySet{},
+		&oidc.Config{ClientID: "https://test.myapp.com", SkipExpiryCheck: true})
+
+	test, err := NewAuthOnlyEndpointTest("", func(opts *options.Options) {
+		opts.SkipJwtBearerTokens = true
+		opts.SetJWTBearerVerifiers(append(opts.GetJWTBearerVerifiers(), verifier))
+		opts.JWTBearer = options.JWTBearer{
+			Routes: []options.JWTBearerRoute{{Scopes: []string{"admin"}}},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", goodJwt))
+	test.proxy.ServeHTTP(test.rw, test.req)
+
+	assert.Equal(t, http.StatusForbidden, test.rw.Code)
+	assert.Equal(t, "Bearer error=\"insufficient_scope\", error_description=\"missing scope 'admin'\", scope=\"admin\"",
+		test.rw.Header().Get("WWW-Authenticate"))
+}
+
 func Test_prepareNoCache(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		prepareNoCache(w)
@@ -2492,3 +2946,382 @@ func TestAuthOnlyAllowedGroups(t *testing.T) {
 		})
 	}
 }
+
+func TestBackChannelLogout(t *testing.T) {
+	const issuer = "https://issuer.example.com"
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLogoutToken := func(claims jwt.MapClaims) string {
+		claims["iss"] = issuer
+		claims["aud"] = clientID
+		claims["iat"] = time.Now().Unix()
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	logoutEvent := map[string]interface{}{
+		"http://schemas.openid.net/event/backchannel-logout": map[string]interface{}{},
+	}
+
+	testCases := []struct {
+		name            string
+		logoutToken     string
+		expectedCode    int
+		expectedRevoked []string
+	}{
+		{
+			name: "Logout by session ID",
+			logoutToken: newLogoutToken(jwt.MapClaims{
+				"sub":    "subject-a",
+				"sid":    "sid-a1",
+				"events": logoutEvent,
+			}),
+			expectedCode:    http.StatusOK,
+			expectedRevoked: []string{"sid-a1"},
+		},
+		{
+			name: "Logout by subject",
+			logoutToken: newLogoutToken(jwt.MapClaims{
+				"sub":    "subject-a",
+				"events": logoutEvent,
+			}),
+			expectedCode:    http.StatusOK,
+			expectedRevoked: []string{"sid-a1", "sid-a2"},
+		},
+		{
+			name: "Token without logout event",
+			logoutToken: newLogoutToken(jwt.MapClaims{
+				"sub": "subject-a",
+			}),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Missing token",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := baseTestOptions()
+			opts.Session.Type = options.SQLSessionStoreType
+			opts.Session.SQL.Driver = sqlsessions.SQLiteDriver
+			opts.Session.SQL.ConnectionURL = "file::memory:"
+			opts.Session.SQL.CleanupInterval = 0
+			err := validation.Validate(opts)
+			assert.NoError(t, err)
+
+			opts.SetProvider(providers.NewOIDCProvider(&providers.ProviderData{
+				ID:       "oidc",
+				ClientID: clientID,
+				Verifier: oidc.NewVerifier(issuer, NoOpKeySet{}, &oidc.Config{ClientID: clientID}),
+			}))
+			proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sessionCookies := map[string][]*http.Cookie{}
+			saveSession := func(name string, session *sessions.SessionState) {
+				rw := httptest.NewRecorder()
+				if err := proxy.sessionStore.Save(rw, httptest.NewRequest(http.MethodGet, "/", nil), session); err != nil {
+					t.Fatal(err)
+				}
+				sessionCookies[name] = rw.Result().Cookies()
+			}
+			for sub, sids := range map[string][]string{"subject-a": {"sid-a1", "sid-a2"}, "subject-b": {"sid-b1"}} {
+				for _, sid := range sids {
+					saveSession(sid, &sessions.SessionState{Email: sub + "@example.com", Subject: sub, SessionID: sid, ProviderID: "oidc"})
+				}
+			}
+			// The subject and session ID of another provider are not logged out
+			saveSession("other-sid-a1", &sessions.SessionState{Email: "other@example.com", Subject: "subject-a", SessionID: "sid-a1", ProviderID: "other"})
+
+			form := url.Values{}
+			if tc.logoutToken != "" {
+				form.Set("logout_token", tc.logoutToken)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/oauth2/backchannel_logout", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rw := httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+			assert.Equal(t, tc.expectedCode, rw.Code)
+
+			for sid, cookies := range sessionCookies {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+				_, err := proxy.sessionStore.Load(req)
+
+				revoked := false
+				for _, revokedSID := range tc.expectedRevoked {
+					revoked = revoked || revokedSID == sid
+				}
+				if revoked {
+					assert.Error(t, err, "session %s should be revoked", sid)
+				} else {
+					assert.NoError(t, err, "session %s should not be revoked", sid)
+				}
+			}
+		})
+	}
+}
+
+func TestSignOutProviderLogout(t *testing.T) {
+	testCases := []struct {
+		name             string
+		endSessionURL    string
+		logoutURL        string
+		session          *sessions.SessionState
+		redirect         string
+		expectedLocation string
+	}{
+		{
+			name:             "End session endpoint",
+			endSessionURL:    "https://issuer.example.com/logout",
+			session:          &sessions.SessionState{Email: "john.doe@example.com", IDToken: "id-token"},
+			redirect:         "/app",
+			expectedLocation: "https://issuer.example.com/logout?client_id=" + clientID + "&id_token_hint=id-token&post_logout_redirect_uri=https%3A%2F%2Fexample.com%2Fapp",
+		},
+		{
+			name:             "End session endpoint with invalid redirect",
+			endSessionURL:    "https://issuer.example.com/logout",
+			session:          &sessions.SessionState{Email: "john.doe@example.com", IDToken: "id-token"},
+			redirect:         "https://evil.example.org/",
+			expectedLocation: "https://issuer.example.com/logout?client_id=" + clientID + "&id_token_hint=id-token&post_logout_redirect_uri=https%3A%2F%2Fexample.com%2F",
+		},
+		{
+			name:             "Logout URL template",
+			logoutURL:        "https://provider.example.com/v2/logout?client_id={{.ClientID}}&returnTo={{.PostLogoutRedirectURI}}",
+			session:          &sessions.SessionState{Email: "john.doe@example.com"},
+			redirect:         "/app",
+			expectedLocation: "https://provider.example.com/v2/logout?client_id=" + clientID + "&returnTo=https%3A%2F%2Fexample.com%2Fapp",
+		},
+		{
+			name:             "No session",
+			endSessionURL:    "https://issuer.example.com/logout",
+			redirect:         "/app",
+			expectedLocation: "/app",
+		},
+		{
+			name:             "Provider without logout support",
+			session:          &sessions.SessionState{Email: "john.doe@example.com", IDToken: "id-token"},
+			redirect:         "/app",
+			expectedLocation: "/app",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := baseTestOptions()
+			opts.Providers[0].OIDCConfig.EndSessionURL = tc.endSessionURL
+			opts.Providers[0].LogoutURL = tc.logoutURL
+			err := validation.Validate(opts)
+			assert.NoError(t, err)
+
+			proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/oauth2/sign_out?rd="+url.QueryEscape(tc.redirect), nil)
+			if tc.session != nil {
+				rw := httptest.NewRecorder()
+				if err := proxy.sessionStore.Save(rw, req, tc.session); err != nil {
+					t.Fatal(err)
+				}
+				for _, c := range rw.Result().Cookies() {
+					req.AddCookie(c)
+				}
+			}
+
+			rw := httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+			assert.Equal(t, http.StatusFound, rw.Code)
+			assert.Equal(t, tc.expectedLocation, rw.Header().Get("Location"))
+		})
+	}
+}
+
+func TestAuthorizationRules(t *testing.T) {
+	testCases := []struct {
+		name         string
+		reverseProxy bool
+		path         string
+		forwardedURI string
+		groups       []string
+		expectedCode int
+	}{
+		{
+			name:         "Upstream without rules",
+			path:         "/",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Allowed by rule",
+			path:         "/admin/users",
+			groups:       []string{"ops"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Denied by default policy",
+			path:         "/admin/users",
+			groups:       []string{"dev"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Denied by default policy with an untrusted X-Forwarded-Uri",
+			path:         "/admin/users",
+			forwardedURI: "/",
+			groups:       []string{"dev"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Denied by default policy with a mismatched X-Forwarded-Uri in reverse proxy mode",
+			reverseProxy: true,
+			path:         "/admin/users",
+			forwardedURI: "/",
+			groups:       []string{"dev"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "AuthOnly allowed by rule",
+			path:         "/oauth2/auth",
+			forwardedURI: "/admin/users",
+			groups:       []string{"ops"},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "AuthOnly denied by default policy",
+			path:         "/oauth2/auth",
+			forwardedURI: "/admin/users",
+			groups:       []string{"dev"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "AuthOnly denied by default policy in reverse proxy mode",
+			reverseProxy: true,
+			path:         "/oauth2/auth",
+			forwardedURI: "/admin/users",
+			groups:       []string{"dev"},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := baseTestOptions()
+			opts.ReverseProxy = tc.reverseProxy
+			opts.UpstreamServers = options.Upstreams{
+				{ID: "app", Path: "/", Static: true},
+				{
+					ID:     "admin",
+					Path:   "/admin/",
+					Static: true,
+					Authorization: &options.UpstreamAuthorization{
+						Rules: []options.AuthorizationRule{
+							{ID: "ops", Policy: options.AllowPolicy, Groups: []string{"ops"}},
+						},
+						DefaultPolicy: options.DenyPolicy,
+					},
+				},
+			}
+			err := validation.Validate(opts)
+			assert.NoError(t, err)
+
+			proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.forwardedURI != "" {
+				req.Header.Set("X-Forwarded-Uri", tc.forwardedURI)
+			}
+			rw := httptest.NewRecorder()
+			session := &sessions.SessionState{Email: "john.doe@example.com", Groups: tc.groups}
+			if err := proxy.sessionStore.Save(rw, req, session); err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range rw.Result().Cookies() {
+				req.AddCookie(c)
+			}
+
+			rw = httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+			assert.Equal(t, tc.expectedCode, rw.Code)
+		})
+	}
+}
+
+func TestOAuthStartCodeChallenge(t *testing.T) {
+	testCases := []struct {
+		name                string
+		codeChallengeMethod string
+	}{
+		{
+			name: "PKCE disabled",
+		},
+		{
+			name:                "Plain code challenge",
+			codeChallengeMethod: encryption.CodeChallengeMethodPlain,
+		},
+		{
+			name:                "S256 code challenge",
+			codeChallengeMethod: encryption.CodeChallengeMethodS256,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := baseTestOptions()
+			opts.Providers[0].CodeChallengeMethod = tc.codeChallengeMethod
+			err := validation.Validate(opts)
+			assert.NoError(t, err)
+
+			proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/oauth2/start", nil)
+			proxy.ServeHTTP(rw, req)
+			assert.Equal(t, http.StatusFound, rw.Code)
+
+			location, err := url.Parse(rw.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The code verifier must be kept in the CSRF cookie for the callback
+			callbackReq := httptest.NewRequest(http.MethodGet, "/oauth2/callback", nil)
+			for _, c := range rw.Result().Cookies() {
+				callbackReq.AddCookie(c)
+			}
+			csrf, err := cookies.LoadCSRFCookie(callbackReq, proxy.CookieOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.codeChallengeMethod == "" {
+				assert.Empty(t, location.Query().Get("code_challenge"))
+				assert.Empty(t, location.Query().Get("code_challenge_method"))
+				assert.Empty(t, csrf.GetCodeVerifier())
+				return
+			}
+
+			expectedChallenge, err := encryption.GenerateCodeChallenge(tc.codeChallengeMethod, csrf.GetCodeVerifier())
+			assert.NoError(t, err)
+			assert.NotEmpty(t, csrf.GetCodeVerifier())
+			assert.Equal(t, expectedChallenge, location.Query().Get("code_challenge"))
+			assert.Equal(t, tc.codeChallengeMethod, location.Query().Get("code_challenge_method"))
+		})
+	}
+}
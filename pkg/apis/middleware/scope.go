@@ -21,6 +21,12 @@ type RequestScope struct {
 	// mode and if request `X-Forwarded-*` headers should be trusted
 	ReverseProxy bool
 
+	// AuthRequest tracks whether the request is an auth request made on behalf
+	// of another proxy, such as an nginx `auth_request`. The `X-Forwarded-Uri`
+	// and `X-Forwarded-Method` headers of auth requests describe the original
+	// request and are trusted even when not operating in reverse proxy mode.
+	AuthRequest bool
+
 	// RequestID is set to the request's `X-Request-Id` header if set.
 	// Otherwise a random UUID is set.
 	RequestID string
@@ -28,6 +34,12 @@ type RequestScope struct {
 	// Session details the authenticated users information (if it exists).
 	Session *sessions.SessionState
 
+	// StoredSession indicates whether the session was loaded from the session
+	// store, rather than from a bearer token, an API key or basic auth
+	// credentials. Only stored sessions can be authenticated again by
+	// redirecting the user to sign in.
+	StoredSession bool
+
 	// SaveSession indicates whether the session storage should attempt to save
 	// the session or not.
 	SaveSession bool
@@ -41,6 +53,10 @@ type RequestScope struct {
 
 	// Upstream tracks which upstream was used for this request
 	Upstream string
+
+	// BearerTokenError is set when a verified bearer token did not meet the
+	// bearer token rules for the request. No session is loaded in that case.
+	BearerTokenError error
 }
 
 // GetRequestScope returns the current request scope from the given request
@@ -42,7 +42,20 @@ type AlphaOptions struct {
 	MetricsServer Server `json:"metricsServer,omitempty"`
 
 	// Providers is used to configure multiple providers.
+	// When more than one provider is configured, the sign in page displays
+	// a login button for each provider. The first provider is the default
+	// provider, used when no provider is selected.
 	Providers Providers `json:"providers,omitempty"`
+
+	// JWTBearer is used to configure the audiences, claims and scopes required
+	// of bearer tokens when skip-jwt-bearer-tokens is set.
+	JWTBearer JWTBearer `json:"jwtBearer,omitempty"`
+
+	// Secrets is used to load the cookie secret, the signature key, the
+	// session store passwords and the LDAP bind password from a value, an
+	// environment variable or a file.
+	// Secrets loaded from files are reloaded when the files change.
+	Secrets Secrets `json:"secrets,omitempty"`
 }
 
 // MergeInto replaces alpha options in the Options struct with the values
@@ -54,7 +67,8 @@ func (a *AlphaOptions) MergeInto(opts *Options) {
 	opts.Server = a.Server
 	opts.MetricsServer = a.MetricsServer
 	opts.Providers = a.Providers
-
+	opts.JWTBearer = a.JWTBearer
+	opts.Secrets = a.Secrets
 }
 
 // ExtractFrom populates the fields in the AlphaOptions with the values from
@@ -66,4 +80,6 @@ func (a *AlphaOptions) ExtractFrom(opts *Options) {
 	a.Server = opts.Server
 	a.MetricsServer = opts.MetricsServer
 	a.Providers = opts.Providers
+	a.JWTBearer = opts.JWTBearer
+	a.Secrets = opts.Secrets
 }
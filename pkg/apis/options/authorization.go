@@ -0,0 +1,94 @@
+package options
+
+// AuthorizationPolicy is the decision a rule makes when it matches a request.
+type AuthorizationPolicy string
+
+const (
+	// AllowPolicy allows the requests matching the rule.
+	AllowPolicy AuthorizationPolicy = "allow"
+
+	// DenyPolicy denies the requests matching the rule.
+	DenyPolicy AuthorizationPolicy = "deny"
+)
+
+// UpstreamAuthorization holds the ordered authorization rules of an upstream.
+// The rules are evaluated for authenticated requests, on top of the email
+// domain and group restrictions.
+type UpstreamAuthorization struct {
+	// Rules is the ordered list of rules for the upstream.
+	// The first rule that matches a request decides whether it is allowed.
+	Rules []AuthorizationRule `json:"rules,omitempty"`
+
+	// DefaultPolicy is applied when no rule matches a request.
+	// Defaults to allow.
+	DefaultPolicy AuthorizationPolicy `json:"defaultPolicy,omitempty"`
+
+	// Authentication sets requirements on how the user must have
+	// authenticated with the provider to access the upstream.
+	// Sessions that don't meet them are sent to sign in again with the
+	// provider (step-up authentication).
+	Authentication *AuthenticationRequirements `json:"authentication,omitempty"`
+}
+
+// AuthenticationRequirements are the requirements on the authentication of
+// the user with the provider.
+type AuthenticationRequirements struct {
+	// AcrValues are the accepted authentication context class references.
+	// Sessions whose `acr` claim is not one of them sign in again with
+	// these `acr_values`.
+	AcrValues []string `json:"acrValues,omitempty"`
+
+	// MaxAge is the maximum time since the user authenticated with the
+	// provider, according to the `auth_time` claim or else the time the user
+	// signed in. Sessions authenticated longer ago sign in again with this
+	// `max_age` and `prompt=login`.
+	MaxAge *Duration `json:"maxAge,omitempty"`
+}
+
+// AuthorizationRule matches requests and sessions to allow or deny them.
+// A rule matches when all of its configured conditions match. Conditions
+// that are not set match every request.
+type AuthorizationRule struct {
+	// ID identifies the rule in the logs.
+	// Defaults to the index of the rule within the upstream rules.
+	ID string `json:"id,omitempty"`
+
+	// Policy is either allow or deny.
+	Policy AuthorizationPolicy `json:"policy,omitempty"`
+
+	// Path is a regular expression matched against the request path.
+	// Eg:
+	// - `^/admin/`: Match any path prefixed with `/admin/`
+	// - `^/api/public$`: Match only the explicit path `/api/public`
+	Path string `json:"path,omitempty"`
+
+	// Methods restricts the rule to the given HTTP methods.
+	Methods []string `json:"methods,omitempty"`
+
+	// Groups matches sessions that belong to any of the groups.
+	Groups []string `json:"groups,omitempty"`
+
+	// Emails matches sessions with any of the email addresses.
+	Emails []string `json:"emails,omitempty"`
+
+	// EmailDomains matches sessions with an email address in any of the
+	// domains.
+	EmailDomains []string `json:"emailDomains,omitempty"`
+
+	// Users matches sessions with any of the user names.
+	Users []string `json:"users,omitempty"`
+
+	// Claims matches sessions whose ID token contains all of the claims.
+	Claims []ClaimRequirement `json:"claims,omitempty"`
+}
+
+// ClaimRequirement matches an ID token claim against a list of values.
+type ClaimRequirement struct {
+	// Claim is the name of the ID token claim.
+	Claim string `json:"claim,omitempty"`
+
+	// Values matches claims with any of the values.
+	// A list claim matches when any of its items is one of the values.
+	// When no values are given, the claim only needs to be present.
+	Values []string `json:"values,omitempty"`
+}
@@ -17,6 +17,17 @@ type Cookie struct {
 	Secure   bool          `flag:"cookie-secure" cfg:"cookie_secure"`
 	HTTPOnly bool          `flag:"cookie-httponly" cfg:"cookie_httponly"`
 	SameSite string        `flag:"cookie-samesite" cfg:"cookie_samesite"`
+
+	RefreshBeforeExpiry time.Duration `flag:"cookie-refresh-before-expiry" cfg:"cookie_refresh_before_expiry"`
+
+	PreviousSecrets []string `flag:"cookie-previous-secret" cfg:"cookie_previous_secrets"`
+}
+
+// Secrets returns the cookie secret followed by the previous cookie secrets.
+// Cookies are signed and encrypted with the first secret and accepted when
+// signed with any of them.
+func (c *Cookie) Secrets() []string {
+	return append([]string{c.Secret}, c.PreviousSecrets...)
 }
 
 func cookieFlagSet() *pflag.FlagSet {
@@ -24,10 +35,12 @@ func cookieFlagSet() *pflag.FlagSet {
 
 	flagSet.String("cookie-name", "_oauth2_proxy", "the name of the cookie that the oauth_proxy creates")
 	flagSet.String("cookie-secret", "", "the seed string for secure cookies (optionally base64 encoded)")
+	flagSet.StringSlice("cookie-previous-secret", []string{}, "previous cookie secrets that are still accepted after rotating the cookie-secret, newest first (may be given multiple times)")
 	flagSet.StringSlice("cookie-domain", []string{}, "Optional cookie domains to force cookies to (ie: `.yourcompany.com`). The longest domain matching the request's host will be used (or the shortest cookie domain if there is no match).")
 	flagSet.String("cookie-path", "/", "an optional cookie path to force cookies to (ie: /poc/)*")
 	flagSet.Duration("cookie-expire", time.Duration(168)*time.Hour, "expire timeframe for cookie")
 	flagSet.Duration("cookie-refresh", time.Duration(0), "refresh the cookie after this duration; 0 to disable")
+	flagSet.Duration("cookie-refresh-before-expiry", time.Duration(0), "refresh the cookie when the access token expires within this duration; 0 to disable")
 	flagSet.Bool("cookie-secure", true, "set secure (HTTPS) cookie flag")
 	flagSet.Bool("cookie-httponly", true, "set HttpOnly cookie flag")
 	flagSet.String("cookie-samesite", "", "set SameSite cookie attribute (ie: \"lax\", \"strict\", \"none\", or \"\"). ")
@@ -47,5 +60,9 @@ func cookieDefaults() Cookie {
 		Secure:   true,
 		HTTPOnly: true,
 		SameSite: "",
+
+		RefreshBeforeExpiry: time.Duration(0),
+
+		PreviousSecrets: nil,
 	}
 }
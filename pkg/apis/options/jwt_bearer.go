@@ -0,0 +1,41 @@
+package options
+
+// JWTBearer configures additional checks of the bearer tokens that are
+// accepted when skip-jwt-bearer-tokens is set.
+type JWTBearer struct {
+	// Audiences are accepted in the `aud` claim of bearer tokens, in addition
+	// to the client ID of the providers and the audiences of the extra JWT
+	// issuers.
+	Audiences []string `json:"audiences,omitempty"`
+
+	// MaxAge rejects bearer tokens that were issued longer ago than the
+	// duration, according to their `iat` claim.
+	// Tokens without an `iat` claim are rejected when it is set.
+	MaxAge *Duration `json:"maxAge,omitempty"`
+
+	// Claims are required of all bearer tokens.
+	// Eg: the `azp` claim must be one of the allowed clients.
+	Claims []ClaimRequirement `json:"claims,omitempty"`
+
+	// Routes require scopes and claims of the bearer tokens used for the
+	// requests they match. The requirements of all matching routes apply.
+	Routes []JWTBearerRoute `json:"routes,omitempty"`
+}
+
+// JWTBearerRoute requires scopes and claims of the bearer tokens used for
+// the requests matching the route.
+type JWTBearerRoute struct {
+	// Path is a regular expression matched against the request path.
+	// All paths are matched when it is not set.
+	Path string `json:"path,omitempty"`
+
+	// Methods restricts the route to the given HTTP methods.
+	Methods []string `json:"methods,omitempty"`
+
+	// Scopes must all be granted to the token, in its space separated `scope`
+	// claim or its `scp` claim.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Claims are required of the token.
+	Claims []ClaimRequirement `json:"claims,omitempty"`
+}
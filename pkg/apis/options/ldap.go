@@ -0,0 +1,58 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// LDAP contains configuration options for validating basic auth credentials
+// against an LDAP directory
+type LDAP struct {
+	URL                string        `flag:"ldap-url" cfg:"ldap_url"`
+	StartTLS           bool          `flag:"ldap-start-tls" cfg:"ldap_start_tls"`
+	CAFile             string        `flag:"ldap-ca-file" cfg:"ldap_ca_file"`
+	InsecureSkipVerify bool          `flag:"ldap-insecure-skip-verify" cfg:"ldap_insecure_skip_verify"`
+	BindDN             string        `flag:"ldap-bind-dn" cfg:"ldap_bind_dn"`
+	BindPassword       string        `flag:"ldap-bind-password" cfg:"ldap_bind_password"`
+	UserBaseDN         string        `flag:"ldap-user-base-dn" cfg:"ldap_user_base_dn"`
+	UserAttribute      string        `flag:"ldap-user-attribute" cfg:"ldap_user_attribute"`
+	UserFilter         string        `flag:"ldap-user-filter" cfg:"ldap_user_filter"`
+	GroupBaseDN        string        `flag:"ldap-group-base-dn" cfg:"ldap_group_base_dn"`
+	NestedGroups       bool          `flag:"ldap-nested-groups" cfg:"ldap_nested_groups"`
+	PoolSize           int           `flag:"ldap-pool-size" cfg:"ldap_pool_size"`
+	CacheTTL           time.Duration `flag:"ldap-cache-ttl" cfg:"ldap_cache_ttl"`
+	Timeout            time.Duration `flag:"ldap-timeout" cfg:"ldap_timeout"`
+}
+
+func ldapFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("ldap", pflag.ExitOnError)
+
+	flagSet.String("ldap-url", "", "authenticate basic auth credentials against the LDAP server at this URL (ldap:// or ldaps://)")
+	flagSet.Bool("ldap-start-tls", false, "upgrade ldap:// connections to TLS with StartTLS")
+	flagSet.String("ldap-ca-file", "", "the CA certificate file used to verify the LDAP server certificate (defaults to the system CAs)")
+	flagSet.Bool("ldap-insecure-skip-verify", false, "skip verification of the LDAP server certificate")
+	flagSet.String("ldap-bind-dn", "", "the DN to bind with when searching for users and groups")
+	flagSet.String("ldap-bind-password", "", "the password of the ldap-bind-dn")
+	flagSet.String("ldap-user-base-dn", "", "the base DN to search for users in")
+	flagSet.String("ldap-user-attribute", "uid", "the attribute matched against the username (ie: \"sAMAccountName\" for Active Directory)")
+	flagSet.String("ldap-user-filter", "(objectClass=person)", "an additional filter that users must match")
+	flagSet.String("ldap-group-base-dn", "", "the base DN to search for nested groups in (defaults to ldap-user-base-dn)")
+	flagSet.Bool("ldap-nested-groups", false, "resolve nested Active Directory groups with the LDAP_MATCHING_RULE_IN_CHAIN rule instead of reading the memberOf attribute")
+	flagSet.Int("ldap-pool-size", 5, "the number of idle connections kept open to the LDAP server")
+	flagSet.Duration("ldap-cache-ttl", time.Minute, "how long successful LDAP logins and their groups are cached; 0 to disable")
+	flagSet.Duration("ldap-timeout", 10*time.Second, "the timeout for connecting to and querying the LDAP server")
+
+	return flagSet
+}
+
+// ldapDefaults creates a LDAP populating each field with its default value
+func ldapDefaults() LDAP {
+	return LDAP{
+		UserAttribute: "uid",
+		UserFilter:    "(objectClass=person)",
+		PoolSize:      5,
+		CacheTTL:      time.Minute,
+		Timeout:       10 * time.Second,
+	}
+}
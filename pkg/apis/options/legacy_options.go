@@ -25,6 +25,9 @@ type LegacyOptions struct {
 	// Legacy options for single provider
 	LegacyProvider LegacyProvider `cfg:",squash"`
 
+	// Legacy options for loading secrets from files
+	LegacySecrets LegacySecrets `cfg:",squash"`
+
 	Options Options `cfg:",squash"`
 }
 
@@ -68,6 +71,7 @@ func NewLegacyFlagSet() *pflag.FlagSet {
 	flagSet.AddFlagSet(legacyHeadersFlagSet())
 	flagSet.AddFlagSet(legacyServerFlagset())
 	flagSet.AddFlagSet(legacyProviderFlagSet())
+	flagSet.AddFlagSet(legacySecretsFlagSet())
 
 	return flagSet
 }
@@ -91,6 +95,8 @@ func (l *LegacyOptions) ToOptions() (*Options, error) {
 	}
 	l.Options.Providers = providers
 
+	l.Options.Secrets = l.LegacySecrets.convert()
+
 	return &l.Options, nil
 }
 
@@ -465,10 +471,77 @@ func legacyServerFlagset() *pflag.FlagSet {
 	return flagSet
 }
 
+type LegacySecrets struct {
+	CookieSecretFile          string   `flag:"cookie-secret-file" cfg:"cookie_secret_file"`
+	CookieSecretEnv           string   `flag:"cookie-secret-env" cfg:"cookie_secret_env"`
+	CookiePreviousSecretFiles []string `flag:"cookie-previous-secret-file" cfg:"cookie_previous_secret_files"`
+	CookiePreviousSecretEnvs  []string `flag:"cookie-previous-secret-env" cfg:"cookie_previous_secret_envs"`
+	SignatureKeyFile          string   `flag:"signature-key-file" cfg:"signature_key_file"`
+	SignatureKeyEnv           string   `flag:"signature-key-env" cfg:"signature_key_env"`
+	RedisPasswordFile         string   `flag:"redis-password-file" cfg:"redis_password_file"`
+	RedisPasswordEnv          string   `flag:"redis-password-env" cfg:"redis_password_env"`
+	RedisSentinelPasswordFile string   `flag:"redis-sentinel-password-file" cfg:"redis_sentinel_password_file"`
+	RedisSentinelPasswordEnv  string   `flag:"redis-sentinel-password-env" cfg:"redis_sentinel_password_env"`
+	SQLConnectionURLFile      string   `flag:"sql-connection-url-file" cfg:"sql_connection_url_file"`
+	SQLConnectionURLEnv       string   `flag:"sql-connection-url-env" cfg:"sql_connection_url_env"`
+	LDAPBindPasswordFile      string   `flag:"ldap-bind-password-file" cfg:"ldap_bind_password_file"`
+	LDAPBindPasswordEnv       string   `flag:"ldap-bind-password-env" cfg:"ldap_bind_password_env"`
+}
+
+func legacySecretsFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("secrets", pflag.ExitOnError)
+
+	flagSet.String("cookie-secret-file", "", "the file with the seed string for secure cookies, replaces cookie-secret")
+	flagSet.String("cookie-secret-env", "", "the environment variable with the seed string for secure cookies, replaces cookie-secret")
+	flagSet.StringSlice("cookie-previous-secret-file", []string{}, "the files with previous cookie secrets, replaces cookie-previous-secret (may be given multiple times)")
+	flagSet.StringSlice("cookie-previous-secret-env", []string{}, "the environment variables with previous cookie secrets, replaces cookie-previous-secret (may be given multiple times)")
+	flagSet.String("signature-key-file", "", "the file with the GAP-Signature request signature key (algorithm:secretkey), replaces signature-key")
+	flagSet.String("signature-key-env", "", "the environment variable with the GAP-Signature request signature key (algorithm:secretkey), replaces signature-key")
+	flagSet.String("redis-password-file", "", "the file with the Redis password, replaces redis-password")
+	flagSet.String("redis-password-env", "", "the environment variable with the Redis password, replaces redis-password")
+	flagSet.String("redis-sentinel-password-file", "", "the file with the Redis sentinel password, replaces redis-sentinel-password")
+	flagSet.String("redis-sentinel-password-env", "", "the environment variable with the Redis sentinel password, replaces redis-sentinel-password")
+	flagSet.String("sql-connection-url-file", "", "the file with the connection URL (DSN) of the sql session storage database, replaces sql-connection-url")
+	flagSet.String("sql-connection-url-env", "", "the environment variable with the connection URL (DSN) of the sql session storage database, replaces sql-connection-url")
+	flagSet.String("ldap-bind-password-file", "", "the file with the password of the LDAP bind DN, replaces ldap-bind-password")
+	flagSet.String("ldap-bind-password-env", "", "the environment variable with the password of the LDAP bind DN, replaces ldap-bind-password")
+
+	return flagSet
+}
+
+func (l *LegacySecrets) convert() Secrets {
+	secrets := Secrets{
+		CookieSecret:          secretSource(l.CookieSecretFile, l.CookieSecretEnv),
+		SignatureKey:          secretSource(l.SignatureKeyFile, l.SignatureKeyEnv),
+		RedisPassword:         secretSource(l.RedisPasswordFile, l.RedisPasswordEnv),
+		RedisSentinelPassword: secretSource(l.RedisSentinelPasswordFile, l.RedisSentinelPasswordEnv),
+		SQLConnectionURL:      secretSource(l.SQLConnectionURLFile, l.SQLConnectionURLEnv),
+		LDAPBindPassword:      secretSource(l.LDAPBindPasswordFile, l.LDAPBindPasswordEnv),
+	}
+	for _, file := range l.CookiePreviousSecretFiles {
+		secrets.PreviousCookieSecrets = append(secrets.PreviousCookieSecrets, SecretSource{FromFile: file})
+	}
+	for _, env := range l.CookiePreviousSecretEnvs {
+		secrets.PreviousCookieSecrets = append(secrets.PreviousCookieSecrets, SecretSource{FromEnv: env})
+	}
+	return secrets
+}
+
+// secretSource returns a SecretSource for the file or the environment
+// variable, or nil if neither is given. Giving both fails the validation
+// of the SecretSource.
+func secretSource(file, env string) *SecretSource {
+	if file == "" && env == "" {
+		return nil
+	}
+	return &SecretSource{FromFile: file, FromEnv: env}
+}
+
 type LegacyProvider struct {
 	ClientID         string `flag:"client-id" cfg:"client_id"`
 	ClientSecret     string `flag:"client-secret" cfg:"client_secret"`
 	ClientSecretFile string `flag:"client-secret-file" cfg:"client_secret_file"`
+	ClientSecretEnv  string `flag:"client-secret-env" cfg:"client_secret_env"`
 
 	KeycloakGroups           []string `flag:"keycloak-group" cfg:"keycloak_groups"`
 	AzureTenant              string   `flag:"azure-tenant" cfg:"azure_tenant"`
@@ -478,6 +551,8 @@ type LegacyProvider struct {
 	GitHubTeam               string   `flag:"github-team" cfg:"github_team"`
 	GitHubRepo               string   `flag:"github-repo" cfg:"github_repo"`
 	GitHubToken              string   `flag:"github-token" cfg:"github_token"`
+	GitHubTokenFile          string   `flag:"github-token-file" cfg:"github_token_file"`
+	GitHubTokenEnv           string   `flag:"github-token-env" cfg:"github_token_env"`
 	GitHubUsers              []string `flag:"github-user" cfg:"github_users"`
 	GitLabGroup              []string `flag:"gitlab-group" cfg:"gitlab_groups"`
 	GitLabProjects           []string `flag:"gitlab-project" cfg:"gitlab_projects"`
@@ -496,6 +571,9 @@ type LegacyProvider struct {
 	InsecureOIDCSkipNonce              bool     `flag:"insecure-oidc-skip-nonce" cfg:"insecure_oidc_skip_nonce"`
 	SkipOIDCDiscovery                  bool     `flag:"skip-oidc-discovery" cfg:"skip_oidc_discovery"`
 	OIDCJwksURL                        string   `flag:"oidc-jwks-url" cfg:"oidc_jwks_url"`
+	OIDCEndSessionURL                  string   `flag:"oidc-end-session-url" cfg:"oidc_end_session_url"`
+	OIDCIntrospectionURL               string   `flag:"oidc-introspection-url" cfg:"oidc_introspection_url"`
+	OIDCIntrospectBearerTokens         bool     `flag:"oidc-introspect-bearer-tokens" cfg:"oidc_introspect_bearer_tokens"`
 	OIDCEmailClaim                     string   `flag:"oidc-email-claim" cfg:"oidc_email_claim"`
 	OIDCGroupsClaim                    string   `flag:"oidc-groups-claim" cfg:"oidc_groups_claim"`
 	LoginURL                           string   `flag:"login-url" cfg:"login_url"`
@@ -503,6 +581,7 @@ type LegacyProvider struct {
 	ProfileURL                         string   `flag:"profile-url" cfg:"profile_url"`
 	ProtectedResource                  string   `flag:"resource" cfg:"resource"`
 	ValidateURL                        string   `flag:"validate-url" cfg:"validate_url"`
+	LogoutURL                          string   `flag:"logout-url" cfg:"logout_url"`
 	Scope                              string   `flag:"scope" cfg:"scope"`
 	Prompt                             string   `flag:"prompt" cfg:"prompt"`
 	ApprovalPrompt                     string   `flag:"approval-prompt" cfg:"approval_prompt"` // Deprecated by OIDC 1.0
@@ -514,6 +593,8 @@ type LegacyProvider struct {
 	JWTKey     string `flag:"jwt-key" cfg:"jwt_key"`
 	JWTKeyFile string `flag:"jwt-key-file" cfg:"jwt_key_file"`
 	PubJWKURL  string `flag:"pubjwk-url" cfg:"pubjwk_url"`
+
+	CodeChallengeMethod string `flag:"code-challenge-method" cfg:"code_challenge_method"`
 }
 
 func legacyProviderFlagSet() *pflag.FlagSet {
@@ -527,6 +608,8 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 	flagSet.String("github-team", "", "restrict logins to members of this team")
 	flagSet.String("github-repo", "", "restrict logins to collaborators of this repository")
 	flagSet.String("github-token", "", "the token to use when verifying repository collaborators (must have push access to the repository)")
+	flagSet.String("github-token-file", "", "the file with the token to use when verifying repository collaborators, replaces github-token")
+	flagSet.String("github-token-env", "", "the environment variable with the token to use when verifying repository collaborators, replaces github-token")
 	flagSet.StringSlice("github-user", []string{}, "allow users with these usernames to login even if they do not belong to the specified org and team or collaborators (may be given multiple times)")
 	flagSet.StringSlice("gitlab-group", []string{}, "restrict logins to members of this group (may be given multiple times)")
 	flagSet.StringSlice("gitlab-project", []string{}, "restrict logins to members of this project (may be given multiple times) (eg `group/project=accesslevel`). Access level should be a value matching Gitlab access levels (see https://docs.gitlab.com/ee/api/members.html#valid-access-levels), defaulted to 20 if absent")
@@ -536,6 +619,7 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 	flagSet.String("client-id", "", "the OAuth Client ID: ie: \"123456.apps.googleusercontent.com\"")
 	flagSet.String("client-secret", "", "the OAuth Client Secret")
 	flagSet.String("client-secret-file", "", "the file with OAuth Client Secret")
+	flagSet.String("client-secret-env", "", "the environment variable with OAuth Client Secret, replaces client-secret")
 
 	flagSet.String("provider", "google", "OAuth provider")
 	flagSet.String("provider-display-name", "", "Provider display name")
@@ -546,6 +630,9 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 	flagSet.Bool("insecure-oidc-skip-nonce", true, "skip verifying the OIDC ID Token's nonce claim")
 	flagSet.Bool("skip-oidc-discovery", false, "Skip OIDC discovery and use manually supplied Endpoints")
 	flagSet.String("oidc-jwks-url", "", "OpenID Connect JWKS URL (ie: https://www.googleapis.com/oauth2/v3/certs)")
+	flagSet.String("oidc-end-session-url", "", "OpenID Connect end session URL used to log out of the provider on sign out (discovered when not set)")
+	flagSet.String("oidc-introspection-url", "", "OAuth 2.0 token introspection URL used to verify opaque bearer tokens (discovered when not set)")
+	flagSet.Bool("oidc-introspect-bearer-tokens", false, "if skip-jwt-bearer-tokens is set, verify bearer tokens that are not JWTs with the token introspection endpoint")
 	flagSet.String("oidc-groups-claim", providers.OIDCGroupsClaim, "which OIDC claim contains the user groups")
 	flagSet.String("oidc-email-claim", providers.OIDCEmailClaim, "which OIDC claim contains the user's email")
 	flagSet.String("login-url", "", "Authentication endpoint")
@@ -553,6 +640,7 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 	flagSet.String("profile-url", "", "Profile access endpoint")
 	flagSet.String("resource", "", "The resource that is protected (Azure AD only)")
 	flagSet.String("validate-url", "", "Access token validation endpoint")
+	flagSet.String("logout-url", "", "Template of the provider logout URL to redirect to on sign out, may use {{.IDToken}}, {{.PostLogoutRedirectURI}} and {{.ClientID}}")
 	flagSet.String("scope", "", "OAuth scope specification")
 	flagSet.String("prompt", "", "OIDC prompt")
 	flagSet.String("approval-prompt", "force", "OAuth approval_prompt")
@@ -561,6 +649,7 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 	flagSet.String("jwt-key", "", "private key in PEM format used to sign JWT, so that you can say something like -jwt-key=\"${OAUTH2_PROXY_JWT_KEY}\": required by login.gov")
 	flagSet.String("jwt-key-file", "", "path to the private key file in PEM format used to sign the JWT so that you can say something like -jwt-key-file=/etc/ssl/private/jwt_signing_key.pem: required by login.gov")
 	flagSet.String("pubjwk-url", "", "JWK pubkey access endpoint: required by login.gov")
+	flagSet.String("code-challenge-method", "", "use PKCE code challenges with the specified method. Either 'plain' or 'S256'")
 
 	flagSet.String("user-id-claim", providers.OIDCEmailClaim, "(DEPRECATED for `oidc-email-claim`) which claim contains the user ID")
 	flagSet.StringSlice("allowed-group", []string{}, "restrict logins to members of this group (may be given multiple times)")
@@ -613,21 +702,25 @@ func (l *LegacyProvider) convert() (Providers, error) {
 	providers := Providers{}
 
 	provider := Provider{
-		ClientID:          l.ClientID,
-		ClientSecret:      l.ClientSecret,
-		ClientSecretFile:  l.ClientSecretFile,
-		Type:              l.ProviderType,
-		CAFiles:           l.ProviderCAFiles,
-		LoginURL:          l.LoginURL,
-		RedeemURL:         l.RedeemURL,
-		ProfileURL:        l.ProfileURL,
-		ProtectedResource: l.ProtectedResource,
-		ValidateURL:       l.ValidateURL,
-		Scope:             l.Scope,
-		Prompt:            l.Prompt,
-		ApprovalPrompt:    l.ApprovalPrompt,
-		AllowedGroups:     l.AllowedGroups,
-		AcrValues:         l.AcrValues,
+		ClientID:           l.ClientID,
+		ClientSecret:       l.ClientSecret,
+		ClientSecretFile:   l.ClientSecretFile,
+		ClientSecretSource: secretSource("", l.ClientSecretEnv),
+		Type:               l.ProviderType,
+		CAFiles:            l.ProviderCAFiles,
+		LoginURL:           l.LoginURL,
+		RedeemURL:          l.RedeemURL,
+		ProfileURL:         l.ProfileURL,
+		ProtectedResource:  l.ProtectedResource,
+		ValidateURL:        l.ValidateURL,
+		LogoutURL:          l.LogoutURL,
+		Scope:              l.Scope,
+		Prompt:             l.Prompt,
+		ApprovalPrompt:     l.ApprovalPrompt,
+		AllowedGroups:      l.AllowedGroups,
+		AcrValues:          l.AcrValues,
+
+		CodeChallengeMethod: l.CodeChallengeMethod,
 	}
 
 	// This part is out of the switch section for all providers that support OIDC
@@ -638,6 +731,9 @@ func (l *LegacyProvider) convert() (Providers, error) {
 		InsecureSkipNonce:              l.InsecureOIDCSkipNonce,
 		SkipDiscovery:                  l.SkipOIDCDiscovery,
 		JwksURL:                        l.OIDCJwksURL,
+		EndSessionURL:                  l.OIDCEndSessionURL,
+		IntrospectionURL:               l.OIDCIntrospectionURL,
+		IntrospectBearerTokens:         l.OIDCIntrospectBearerTokens,
 		UserIDClaim:                    l.UserIDClaim,
 		EmailClaim:                     l.OIDCEmailClaim,
 		GroupsClaim:                    l.OIDCGroupsClaim,
@@ -652,11 +748,12 @@ func (l *LegacyProvider) convert() (Providers, error) {
 	switch provider.Type {
 	case "github":
 		provider.GitHubConfig = GitHubOptions{
-			Org:   l.GitHubOrg,
-			Team:  l.GitHubTeam,
-			Repo:  l.GitHubRepo,
-			Token: l.GitHubToken,
-			Users: l.GitHubUsers,
+			Org:         l.GitHubOrg,
+			Team:        l.GitHubTeam,
+			Repo:        l.GitHubRepo,
+			Token:       l.GitHubToken,
+			TokenSource: secretSource(l.GitHubTokenFile, l.GitHubTokenEnv),
+			Users:       l.GitHubUsers,
 		}
 	case "keycloak-oidc":
 		provider.KeycloakConfig = KeycloakOptions{
@@ -24,6 +24,13 @@ var _ = Describe("Legacy Options", func() {
 			legacyOpts.LegacyUpstreams.Upstreams = []string{"http://foo.bar/baz", "file:///var/lib/website#/bar", "static://204"}
 			legacyOpts.LegacyProvider.ClientID = "oauth-proxy"
 
+			// Set secret files to test their conversion to secret sources
+			legacyOpts.LegacySecrets.CookieSecretFile = "/secrets/cookie-secret"
+			legacyOpts.LegacySecrets.CookiePreviousSecretFiles = []string{"/secrets/previous-cookie-secret"}
+			legacyOpts.LegacySecrets.RedisPasswordFile = "/secrets/redis-password"
+			legacyOpts.LegacySecrets.CookiePreviousSecretEnvs = []string{"PREVIOUS_COOKIE_SECRET"}
+			legacyOpts.LegacySecrets.SQLConnectionURLEnv = "SQL_CONNECTION_URL"
+
 			truth := true
 			staticCode := 204
 			opts.UpstreamServers = Upstreams{
@@ -115,6 +122,13 @@ var _ = Describe("Legacy Options", func() {
 			opts.Providers[0].ID = "google=oauth-proxy"
 			opts.Providers[0].OIDCConfig.InsecureSkipNonce = true
 
+			opts.Secrets = Secrets{
+				CookieSecret:          &SecretSource{FromFile: "/secrets/cookie-secret"},
+				PreviousCookieSecrets: []SecretSource{{FromFile: "/secrets/previous-cookie-secret"}, {FromEnv: "PREVIOUS_COOKIE_SECRET"}},
+				RedisPassword:         &SecretSource{FromFile: "/secrets/redis-password"},
+				SQLConnectionURL:      &SecretSource{FromEnv: "SQL_CONNECTION_URL"},
+			}
+
 			converted, err := legacyOpts.ToOptions()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(converted).To(Equal(opts))
@@ -55,6 +55,7 @@ var _ = Describe("Load", func() {
 			Templates:          templatesDefaults(),
 			SkipAuthPreflight:  false,
 			Logging:            loggingDefaults(),
+			LDAP:               ldapDefaults(),
 		},
 	}
 
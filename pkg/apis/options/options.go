@@ -3,6 +3,7 @@ package options
 import (
 	"crypto"
 	"net/url"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
@@ -29,15 +30,21 @@ type Options struct {
 	RawRedirectURL     string   `flag:"redirect-url" cfg:"redirect_url"`
 
 	AuthenticatedEmailsFile string   `flag:"authenticated-emails-file" cfg:"authenticated_emails_file"`
+	APIKeysFile             string   `flag:"api-keys-file" cfg:"api_keys_file"`
 	EmailDomains            []string `flag:"email-domain" cfg:"email_domains"`
 	WhitelistDomains        []string `flag:"whitelist-domain" cfg:"whitelist_domains"`
 	HtpasswdFile            string   `flag:"htpasswd-file" cfg:"htpasswd_file"`
 	HtpasswdUserGroups      []string `flag:"htpasswd-user-group" cfg:"htpasswd_user_groups"`
+	HtpasswdRejectWeak      bool     `flag:"htpasswd-reject-weak" cfg:"htpasswd_reject_weak"`
+	HtpasswdRehashFile      string   `flag:"htpasswd-rehash-file" cfg:"htpasswd_rehash_file"`
+	AdminEmails             []string `flag:"admin-email" cfg:"admin_emails"`
+	AdminGroups             []string `flag:"admin-group" cfg:"admin_groups"`
 
 	Cookie    Cookie         `cfg:",squash"`
 	Session   SessionOptions `cfg:",squash"`
 	Logging   Logging        `cfg:",squash"`
 	Templates Templates      `cfg:",squash"`
+	LDAP      LDAP           `cfg:",squash"`
 
 	// Not used in the legacy config, name not allowed to match an external key (upstreams)
 	// TODO(JoelSpeed): Rename when legacy config is removed
@@ -51,6 +58,9 @@ type Options struct {
 
 	Providers Providers `cfg:",internal"`
 
+	JWTBearer JWTBearer `cfg:",internal"`
+	Secrets   Secrets   `cfg:",internal"`
+
 	SkipAuthRegex         []string `flag:"skip-auth-regex" cfg:"skip_auth_regex"`
 	SkipAuthRoutes        []string `flag:"skip-auth-route" cfg:"skip_auth_routes"`
 	SkipJwtBearerTokens   bool     `flag:"skip-jwt-bearer-tokens" cfg:"skip_jwt_bearer_tokens"`
@@ -67,29 +77,38 @@ type Options struct {
 
 	// internal values that are set after config validation
 	redirectURL        *url.URL
-	provider           providers.Provider
+	providers          []providers.Provider
 	signatureData      *SignatureData
-	oidcVerifier       *oidc.IDTokenVerifier
 	jwtBearerVerifiers []*oidc.IDTokenVerifier
 	realClientIPParser ipapi.RealClientIPParser
 }
 
 // Options for Getting internal values
 func (o *Options) GetRedirectURL() *url.URL                        { return o.redirectURL }
-func (o *Options) GetProvider() providers.Provider                 { return o.provider }
+func (o *Options) GetProviders() []providers.Provider              { return o.providers }
 func (o *Options) GetSignatureData() *SignatureData                { return o.signatureData }
-func (o *Options) GetOIDCVerifier() *oidc.IDTokenVerifier          { return o.oidcVerifier }
 func (o *Options) GetJWTBearerVerifiers() []*oidc.IDTokenVerifier  { return o.jwtBearerVerifiers }
 func (o *Options) GetRealClientIPParser() ipapi.RealClientIPParser { return o.realClientIPParser }
 
+// GetProvider returns the default provider, this is the first configured
+// provider.
+func (o *Options) GetProvider() providers.Provider {
+	if len(o.providers) == 0 {
+		return nil
+	}
+	return o.providers[0]
+}
+
 // Options for Setting internal values
 func (o *Options) SetRedirectURL(s *url.URL)                        { o.redirectURL = s }
-func (o *Options) SetProvider(s providers.Provider)                 { o.provider = s }
+func (o *Options) SetProviders(s []providers.Provider)              { o.providers = s }
 func (o *Options) SetSignatureData(s *SignatureData)                { o.signatureData = s }
-func (o *Options) SetOIDCVerifier(s *oidc.IDTokenVerifier)          { o.oidcVerifier = s }
 func (o *Options) SetJWTBearerVerifiers(s []*oidc.IDTokenVerifier)  { o.jwtBearerVerifiers = s }
 func (o *Options) SetRealClientIPParser(s ipapi.RealClientIPParser) { o.realClientIPParser = s }
 
+// SetProvider replaces all configured providers with the single provider given.
+func (o *Options) SetProvider(s providers.Provider) { o.providers = []providers.Provider{s} }
+
 // NewOptions constructs a new Options with defaulted values
 func NewOptions() *Options {
 	return &Options{
@@ -103,6 +122,7 @@ func NewOptions() *Options {
 		Templates:          templatesDefaults(),
 		SkipAuthPreflight:  false,
 		Logging:            loggingDefaults(),
+		LDAP:               ldapDefaults(),
 	}
 }
 
@@ -126,14 +146,24 @@ func NewFlagSet() *pflag.FlagSet {
 	flagSet.StringSlice("email-domain", []string{}, "authenticate emails with the specified domain (may be given multiple times). Use * to authenticate any email")
 	flagSet.StringSlice("whitelist-domain", []string{}, "allowed domains for redirection after authentication. Prefix domain with a . to allow subdomains (eg .example.com)")
 	flagSet.String("authenticated-emails-file", "", "authenticate against emails via file (one per line)")
+	flagSet.String("api-keys-file", "", "authenticate machine clients with the hashed API keys in this file, sent in an X-API-Key or bearer Authorization header")
 	flagSet.String("htpasswd-file", "", "additionally authenticate against a htpasswd file. Entries must be created with \"htpasswd -B\" for bcrypt encryption")
+	flagSet.Bool("htpasswd-reject-weak", false, "reject htpasswd entries hashed with a weak scheme (SHA1 or Apache MD5) instead of warning about them")
+	flagSet.String("htpasswd-rehash-file", "", "write bcrypt entries for htpasswd users who log in with a weak password hash to this file")
 	flagSet.StringSlice("htpasswd-user-group", []string{}, "the groups to be set on sessions for htpasswd users (may be given multiple times)")
+	flagSet.StringSlice("admin-email", []string{}, "emails of the users allowed to list and revoke sessions through the admin API (may be given multiple times)")
+	flagSet.StringSlice("admin-group", []string{}, "groups allowed to list and revoke sessions through the admin API (may be given multiple times)")
 	flagSet.String("proxy-prefix", "/oauth2", "the url root path that this proxy should be nested under (e.g. /<oauth2>/sign_in)")
 	flagSet.String("ping-path", "/ping", "the ping endpoint that can be used for basic health checks")
 	flagSet.String("ping-user-agent", "", "special User-Agent that will be used for basic health checks")
 	flagSet.String("session-store-type", "cookie", "the session storage provider to use")
+	flagSet.Duration("session-idle-timeout", time.Duration(0), "end sessions without requests for this duration, regardless of refreshes; 0 to disable")
+	flagSet.Duration("session-max-lifetime", time.Duration(0), "end sessions this long after the user signed in, regardless of refreshes; 0 to disable")
+	flagSet.Int("session-max-per-user", 0, "maximum number of concurrent sessions of a user in a persistent session store; 0 for no limit")
+	flagSet.String("session-limit-policy", RejectSessionLimitPolicy, "policy when a user would exceed session-max-per-user: \"reject\" the new sign in or \"evict-oldest\" session")
 	flagSet.Bool("session-cookie-minimal", false, "strip OAuth tokens from cookie session stores if they aren't needed (cookie session store only)")
 	flagSet.String("redis-connection-url", "", "URL of redis server for redis session storage (eg: redis://HOST[:PORT])")
+	flagSet.String("redis-username", "", "Redis username for ACL authentication. Applicable for all Redis configurations. Will override any username set in `--redis-connection-url`")
 	flagSet.String("redis-password", "", "Redis password. Applicable for all Redis configurations. Will override any password set in `--redis-connection-url`")
 	flagSet.Bool("redis-use-sentinel", false, "Connect to redis via sentinels. Must set --redis-sentinel-master-name and --redis-sentinel-connection-urls to use this feature")
 	flagSet.String("redis-sentinel-password", "", "Redis sentinel password. Used only for sentinel connection; any redis node passwords need to use `--redis-password`")
@@ -143,6 +173,14 @@ func NewFlagSet() *pflag.FlagSet {
 	flagSet.StringSlice("redis-sentinel-connection-urls", []string{}, "List of Redis sentinel connection URLs (eg redis://HOST[:PORT]). Used in conjunction with --redis-use-sentinel")
 	flagSet.Bool("redis-use-cluster", false, "Connect to redis cluster. Must set --redis-cluster-connection-urls to use this feature")
 	flagSet.StringSlice("redis-cluster-connection-urls", []string{}, "List of Redis cluster connection URLs (eg redis://HOST[:PORT]). Used in conjunction with --redis-use-cluster")
+	flagSet.Bool("redis-read-from-replicas", false, "Load sessions from the Redis replicas. Writes and locks stay on the primary. Used in conjunction with --redis-use-sentinel or --redis-use-cluster")
+	flagSet.Bool("redis-route-by-latency", false, "Load sessions from the Redis cluster node with the lowest latency. Used in conjunction with --redis-use-cluster and --redis-read-from-replicas")
+	flagSet.String("sql-driver", "", "Database driver for sql session storage: one of postgres, mysql or sqlite3")
+	flagSet.String("sql-connection-url", "", "Connection URL (DSN) of the database for sql session storage, in the format expected by the sql-driver")
+	flagSet.String("sql-table-prefix", "oauth2_proxy", "Prefix of the tables created for sql session storage")
+	flagSet.Duration("sql-cleanup-interval", time.Duration(5)*time.Minute, "Interval between removing expired sessions from sql session storage. Disabled when 0")
+	flagSet.Int("memory-max-sessions", 10000, "Maximum number of sessions kept by memory session storage. The least recently used sessions are removed first")
+	flagSet.Duration("memory-cleanup-interval", time.Duration(1)*time.Minute, "Interval between removing expired sessions from memory session storage. Disabled when 0")
 
 	flagSet.String("signature-key", "", "GAP-Signature request signature key (algorithm:secretkey)")
 	flagSet.Bool("gcp-healthchecks", false, "Enable GCP/GKE healthcheck endpoints")
@@ -150,6 +188,7 @@ func NewFlagSet() *pflag.FlagSet {
 	flagSet.AddFlagSet(cookieFlagSet())
 	flagSet.AddFlagSet(loggingFlagSet())
 	flagSet.AddFlagSet(templatesFlagSet())
+	flagSet.AddFlagSet(ldapFlagSet())
 
 	return flagSet
 }
@@ -16,6 +16,14 @@ type Provider struct {
 	// ClientSecretFile is the name of the file
 	// containing the OAuth Client Secret, it will be used if ClientSecret is not set.
 	ClientSecretFile string `json:"clientSecretFile,omitempty"`
+	// ClientSecretSource loads the OAuth Client Secret from a value, an
+	// environment variable or a file, it replaces ClientSecret and ClientSecretFile.
+	// A client secret loaded from a file is read again on each use.
+	ClientSecretSource *SecretSource `json:"clientSecretSource,omitempty"`
+	// ClientAuthentication configures how the client authenticates to the
+	// token endpoint when redeeming codes and refreshing sessions.
+	// The client secret is used when no method is set.
+	ClientAuthentication ClientAuthentication `json:"clientAuthentication,omitempty"`
 
 	// KeycloakConfig holds all configurations for Keycloak provider.
 	KeycloakConfig KeycloakOptions `json:"keycloakConfig,omitempty"`
@@ -36,6 +44,8 @@ type Provider struct {
 	OIDCConfig OIDCOptions `json:"oidcConfig,omitempty"`
 	// LoginGovConfig holds all configurations for LoginGov provider.
 	LoginGovConfig LoginGovOptions `json:"loginGovConfig,omitempty"`
+	// SAMLConfig holds all configurations for SAML provider.
+	SAMLConfig SAMLOptions `json:"samlConfig,omitempty"`
 
 	// ID should be a unique identifier for the provider.
 	// This value is required for all providers.
@@ -61,6 +71,11 @@ type Provider struct {
 	ProtectedResource string `json:"resource,omitempty"`
 	// ValidateURL is the access token validation endpoint
 	ValidateURL string `json:"validateURL,omitempty"`
+	// LogoutURL is a template for the URL users are redirected to on sign out
+	// to end their session at the provider. It is a Go template that may use
+	// {{.IDToken}}, {{.PostLogoutRedirectURI}} and {{.ClientID}}.
+	// When not set, OIDC providers use the discovered end session endpoint.
+	LogoutURL string `json:"logoutURL,omitempty"`
 	// Scope is the OAuth scope specification
 	Scope string `json:"scope,omitempty"`
 	// Prompt is OIDC prompt
@@ -73,6 +88,35 @@ type Provider struct {
 
 	// AcrValues is a string of acr values
 	AcrValues string `json:"acrValues,omitempty"`
+
+	// CodeChallengeMethod enables PKCE for the authorization code flow with
+	// the given code challenge method, either S256 or plain.
+	// PKCE is disabled when it is not set.
+	// A client secret is not required when PKCE is enabled.
+	CodeChallengeMethod string `json:"codeChallengeMethod,omitempty"`
+}
+
+// ClientAuthentication configures the authentication of the client to the
+// token endpoint of the provider.
+type ClientAuthentication struct {
+	// Method is the client authentication method.
+	// Either `private_key_jwt` (RFC 7523) or `tls_client_auth` (RFC 8705).
+	// The client secret is used when it is not set.
+	Method string `json:"method,omitempty"`
+	// PrivateKey is the PEM encoded RSA or EC private key signing the client
+	// assertions of the `private_key_jwt` method.
+	PrivateKey *SecretSource `json:"privateKey,omitempty"`
+	// PrivateKeyID is set as the `kid` header of the client assertions.
+	PrivateKeyID string `json:"privateKeyID,omitempty"`
+	// SigningAlgorithm is the JWT algorithm signing the client assertions.
+	// Defaults to RS256 for RSA keys and ES256, ES384 or ES512 for EC keys
+	// depending on their curve.
+	SigningAlgorithm string `json:"signingAlgorithm,omitempty"`
+	// Certificate is the PEM encoded client certificate presented to the
+	// token endpoint with the `tls_client_auth` method.
+	Certificate *SecretSource `json:"certificate,omitempty"`
+	// CertificateKey is the PEM encoded private key of the client certificate.
+	CertificateKey *SecretSource `json:"certificateKey,omitempty"`
 }
 
 type KeycloakOptions struct {
@@ -112,6 +156,9 @@ type GitHubOptions struct {
 	// Token is the token to use when verifying repository collaborators
 	// it must have push access to the repository
 	Token string `json:"token,omitempty"`
+	// TokenSource loads the token from a value, an environment variable or
+	// a file, it replaces Token
+	TokenSource *SecretSource `json:"tokenSource,omitempty"`
 	// Users allows users with these usernames to login
 	// even if they do not belong to the specified org and team or collaborators
 	Users []string `json:"users,omitempty"`
@@ -155,6 +202,16 @@ type OIDCOptions struct {
 	// JwksURL is the OpenID Connect JWKS URL
 	// eg: https://www.googleapis.com/oauth2/v3/certs
 	JwksURL string `json:"jwksURL,omitempty"`
+	// EndSessionURL is the OpenID Connect end session endpoint used to log
+	// users out of the provider on sign out. It is discovered when not set.
+	EndSessionURL string `json:"endSessionURL,omitempty"`
+	// IntrospectionURL is the OAuth 2.0 token introspection endpoint (RFC 7662)
+	// used to verify opaque bearer tokens. It is discovered when not set.
+	IntrospectionURL string `json:"introspectionURL,omitempty"`
+	// IntrospectBearerTokens verifies bearer tokens that are not JWTs with the
+	// introspection endpoint when skip-jwt-bearer-tokens is set.
+	// default set to 'false'
+	IntrospectBearerTokens bool `json:"introspectBearerTokens,omitempty"`
 	// EmailClaim indicates which claim contains the user email,
 	// default set to 'email'
 	EmailClaim string `json:"emailClaim,omitempty"`
@@ -175,6 +232,41 @@ type LoginGovOptions struct {
 	PubJWKURL string `json:"pubjwkURL,omitempty"`
 }
 
+// SAMLOptions configures the proxy as a SAML 2.0 service provider
+type SAMLOptions struct {
+	// EntityID is the entity ID of the proxy as a SAML service provider.
+	// Assertions must have it as their audience.
+	EntityID string `json:"entityID,omitempty"`
+	// IDPMetadataURL is the URL of the metadata of the identity provider.
+	// The signatures of the assertions are validated against its certificates.
+	IDPMetadataURL string `json:"idpMetadataURL,omitempty"`
+	// IDPMetadataFile is the path to the metadata of the identity provider,
+	// it is used instead of IDPMetadataURL
+	IDPMetadataFile string `json:"idpMetadataFile,omitempty"`
+	// Binding is the binding of the authentication requests,
+	// either `redirect` (HTTP-Redirect) or `post` (HTTP-POST).
+	// Defaults to `redirect`.
+	Binding string `json:"binding,omitempty"`
+	// Certificate is the PEM encoded certificate of the service provider,
+	// published in its metadata
+	Certificate *SecretSource `json:"certificate,omitempty"`
+	// PrivateKey is the PEM encoded RSA private key of the certificate.
+	// When set, authentication requests are signed and encrypted assertions
+	// are decrypted with it.
+	PrivateKey *SecretSource `json:"privateKey,omitempty"`
+	// EmailAttribute is the name or friendly name of the attribute holding
+	// the email of the user. The NameID is the email when it has the
+	// emailAddress format and the attribute is missing.
+	// Defaults to `email`.
+	EmailAttribute string `json:"emailAttribute,omitempty"`
+	// UserAttribute is the name or friendly name of the attribute holding
+	// the user name. Defaults to the NameID when not set.
+	UserAttribute string `json:"userAttribute,omitempty"`
+	// GroupsAttribute is the name or friendly name of the attribute holding
+	// the groups of the user. Defaults to `groups`.
+	GroupsAttribute string `json:"groupsAttribute,omitempty"`
+}
+
 func providerDefaults() Providers {
 	providers := Providers{
 		{
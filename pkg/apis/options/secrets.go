@@ -0,0 +1,49 @@
+package options
+
+// Secrets configures where the secrets of the proxy are loaded from.
+// A secret loaded from a source replaces the corresponding option.
+// Secrets loaded from files are read again whenever the files change, so
+// that rotated secrets are applied without a restart.
+type Secrets struct {
+	// CookieSecret is the source of the seed string for secure cookies.
+	CookieSecret *SecretSource `json:"cookieSecret,omitempty"`
+
+	// PreviousCookieSecrets are the sources of previous cookie secrets.
+	// They are still accepted when decoding cookies while the cookie secret
+	// is rotated.
+	PreviousCookieSecrets []SecretSource `json:"previousCookieSecrets,omitempty"`
+
+	// SignatureKey is the source of the GAP-Signature request signature key,
+	// given as algorithm:secretkey.
+	SignatureKey *SecretSource `json:"signatureKey,omitempty"`
+
+	// RedisPassword is the source of the password of the Redis session store.
+	RedisPassword *SecretSource `json:"redisPassword,omitempty"`
+
+	// RedisSentinelPassword is the source of the password of the Redis
+	// sentinels.
+	RedisSentinelPassword *SecretSource `json:"redisSentinelPassword,omitempty"`
+
+	// SQLConnectionURL is the source of the connection URL (DSN) of the sql
+	// session store, which usually holds the password of the database.
+	SQLConnectionURL *SecretSource `json:"sqlConnectionURL,omitempty"`
+
+	// LDAPBindPassword is the source of the password of the LDAP bind DN.
+	LDAPBindPassword *SecretSource `json:"ldapBindPassword,omitempty"`
+}
+
+// Files returns the files the secrets are loaded from
+func (s Secrets) Files() []string {
+	sources := []*SecretSource{s.CookieSecret, s.SignatureKey, s.RedisPassword, s.RedisSentinelPassword, s.SQLConnectionURL, s.LDAPBindPassword}
+	for i := range s.PreviousCookieSecrets {
+		sources = append(sources, &s.PreviousCookieSecrets[i])
+	}
+
+	files := []string{}
+	for _, source := range sources {
+		if source != nil && source.FromFile != "" {
+			files = append(files, source.FromFile)
+		}
+	}
+	return files
+}
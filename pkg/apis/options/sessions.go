@@ -1,10 +1,20 @@
 package options
 
+import "time"
+
 // SessionOptions contains configuration options for the SessionStore providers.
 type SessionOptions struct {
 	Type   string             `flag:"session-store-type" cfg:"session_store_type"`
 	Cookie CookieStoreOptions `cfg:",squash"`
 	Redis  RedisStoreOptions  `cfg:",squash"`
+	SQL    SQLStoreOptions    `cfg:",squash"`
+	Memory MemoryStoreOptions `cfg:",squash"`
+
+	IdleTimeout time.Duration `flag:"session-idle-timeout" cfg:"session_idle_timeout"`
+	MaxLifetime time.Duration `flag:"session-max-lifetime" cfg:"session_max_lifetime"`
+
+	MaxPerUser  int    `flag:"session-max-per-user" cfg:"session_max_per_user"`
+	LimitPolicy string `flag:"session-limit-policy" cfg:"session_limit_policy"`
 }
 
 // CookieSessionStoreType is used to indicate the CookieSessionStore should be
@@ -15,6 +25,23 @@ var CookieSessionStoreType = "cookie"
 // used for storing sessions.
 var RedisSessionStoreType = "redis"
 
+// SQLSessionStoreType is used to indicate the SQLSessionStore should be
+// used for storing sessions.
+var SQLSessionStoreType = "sql"
+
+// MemorySessionStoreType is used to indicate the MemorySessionStore should be
+// used for storing sessions.
+var MemorySessionStoreType = "memory"
+
+// RejectSessionLimitPolicy is used to indicate that a new sign in is rejected
+// once a user has reached the maximum number of sessions.
+var RejectSessionLimitPolicy = "reject"
+
+// EvictOldestSessionLimitPolicy is used to indicate that the oldest sessions of
+// a user are revoked to make room for a new sign in once the user has reached
+// the maximum number of sessions.
+var EvictOldestSessionLimitPolicy = "evict-oldest"
+
 // CookieStoreOptions contains configuration options for the CookieSessionStore.
 type CookieStoreOptions struct {
 	Minimal bool `flag:"session-cookie-minimal" cfg:"session_cookie_minimal"`
@@ -23,6 +50,7 @@ type CookieStoreOptions struct {
 // RedisStoreOptions contains configuration options for the RedisSessionStore.
 type RedisStoreOptions struct {
 	ConnectionURL          string   `flag:"redis-connection-url" cfg:"redis_connection_url"`
+	Username               string   `flag:"redis-username" cfg:"redis_username"`
 	Password               string   `flag:"redis-password" cfg:"redis_password"`
 	UseSentinel            bool     `flag:"redis-use-sentinel" cfg:"redis_use_sentinel"`
 	SentinelPassword       string   `flag:"redis-sentinel-password" cfg:"redis_sentinel_password"`
@@ -32,13 +60,38 @@ type RedisStoreOptions struct {
 	ClusterConnectionURLs  []string `flag:"redis-cluster-connection-urls" cfg:"redis_cluster_connection_urls"`
 	CAPath                 string   `flag:"redis-ca-path" cfg:"redis_ca_path"`
 	InsecureSkipTLSVerify  bool     `flag:"redis-insecure-skip-tls-verify" cfg:"redis_insecure_skip_tls_verify"`
+	ReadFromReplicas       bool     `flag:"redis-read-from-replicas" cfg:"redis_read_from_replicas"`
+	RouteByLatency         bool     `flag:"redis-route-by-latency" cfg:"redis_route_by_latency"`
+}
+
+// SQLStoreOptions contains configuration options for the SQLSessionStore.
+type SQLStoreOptions struct {
+	Driver          string        `flag:"sql-driver" cfg:"sql_driver"`
+	ConnectionURL   string        `flag:"sql-connection-url" cfg:"sql_connection_url"`
+	TablePrefix     string        `flag:"sql-table-prefix" cfg:"sql_table_prefix"`
+	CleanupInterval time.Duration `flag:"sql-cleanup-interval" cfg:"sql_cleanup_interval"`
+}
+
+// MemoryStoreOptions contains configuration options for the MemorySessionStore.
+type MemoryStoreOptions struct {
+	MaxSessions     int           `flag:"memory-max-sessions" cfg:"memory_max_sessions"`
+	CleanupInterval time.Duration `flag:"memory-cleanup-interval" cfg:"memory_cleanup_interval"`
 }
 
 func sessionOptionsDefaults() SessionOptions {
 	return SessionOptions{
-		Type: CookieSessionStoreType,
+		Type:        CookieSessionStoreType,
+		LimitPolicy: RejectSessionLimitPolicy,
 		Cookie: CookieStoreOptions{
 			Minimal: false,
 		},
+		SQL: SQLStoreOptions{
+			TablePrefix:     "oauth2_proxy",
+			CleanupInterval: time.Duration(5) * time.Minute,
+		},
+		Memory: MemoryStoreOptions{
+			MaxSessions:     10000,
+			CleanupInterval: time.Duration(1) * time.Minute,
+		},
 	}
 }
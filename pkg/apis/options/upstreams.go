@@ -76,4 +76,9 @@ type Upstream struct {
 	// ProxyWebSockets enables proxying of websockets to upstream servers
 	// Defaults to true.
 	ProxyWebSockets *bool `json:"proxyWebSockets,omitempty"`
+
+	// Authorization attaches authorization rules to the upstream.
+	// Rules match requests by path and method and allow or deny them based on
+	// the groups, email, user and ID token claims of the session.
+	Authorization *UpstreamAuthorization `json:"authorization,omitempty"`
 }
@@ -14,6 +14,67 @@ type SessionStore interface {
 	Clear(rw http.ResponseWriter, req *http.Request) error
 }
 
+// UserSessionStore is a SessionStore that keeps an index of the sessions of
+// each user, so that they can be listed and revoked without the session cookie
+type UserSessionStore interface {
+	SessionStore
+
+	// ListUserSessions returns the active sessions indexed under the key,
+	// ordered from the oldest to the newest session
+	ListUserSessions(ctx context.Context, key IndexKey) ([]UserSession, error)
+	// RevokeUserSession removes the session with the given ID, if it is indexed
+	// under the key. Otherwise it will return ErrSessionNotFound
+	RevokeUserSession(ctx context.Context, key IndexKey, id string) error
+	// RevokeUserSessions removes all sessions indexed under the key and
+	// returns how many sessions were removed
+	RevokeUserSessions(ctx context.Context, key IndexKey) (int, error)
+}
+
+type primaryReadKey struct{}
+
+// WithPrimaryRead marks the loads made with the context as needing the latest
+// saved value, like the reload of a session once its lock is obtained.
+// Stores that load sessions from replicas load them from their primary
+// instead.
+func WithPrimaryRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadKey{}, true)
+}
+
+// IsPrimaryRead returns whether the loads made with the context need the
+// latest saved value
+func IsPrimaryRead(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadKey{}).(bool)
+	return primary
+}
+
+// Attributes of the SessionState that sessions are indexed by
+const (
+	EmailIndex     = "email"
+	UserIndex      = "user"
+	SubjectIndex   = "sub"
+	SessionIDIndex = "sid"
+)
+
+// IndexKey identifies the sessions that share the same value of an indexed
+// SessionState attribute
+type IndexKey struct {
+	Attribute string
+	Value     string
+	// ProviderID scopes the index to the sessions of a single provider, for
+	// attributes such as the subject that are only unique per provider
+	ProviderID string
+}
+
+// UserSession describes a session held in a UserSessionStore
+type UserSession struct {
+	// ID is the ticket ID the session is stored under, it can not be used to
+	// decrypt the session
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+var ErrTooManySessions = errors.New("maximum number of sessions reached")
 var ErrLockNotObtained = errors.New("lock: not obtained")
 var ErrNotLocked = errors.New("tried to release not existing lock")
 
@@ -19,6 +19,12 @@ type SessionState struct {
 	CreatedAt *time.Time `msgpack:"ca,omitempty"`
 	ExpiresOn *time.Time `msgpack:"eo,omitempty"`
 
+	// SignedInAt is when the user signed in, it is kept when the session is
+	// refreshed. LastActivityAt is the time of the last recorded request
+	// with the session.
+	SignedInAt     *time.Time `msgpack:"sa,omitempty"`
+	LastActivityAt *time.Time `msgpack:"la,omitempty"`
+
 	AccessToken  string `msgpack:"at,omitempty"`
 	IDToken      string `msgpack:"it,omitempty"`
 	RefreshToken string `msgpack:"rt,omitempty"`
@@ -30,6 +36,28 @@ type SessionState struct {
 	Groups            []string `msgpack:"g,omitempty"`
 	PreferredUsername string   `msgpack:"pu,omitempty"`
 
+	// Scopes are the scopes granted to the access token of the session
+	Scopes []string `msgpack:"sc,omitempty"`
+
+	// ProviderID is the ID of the provider that issued the session
+	ProviderID string `msgpack:"pi,omitempty"`
+
+	// Subject and SessionID are the `sub` and `sid` claims of the ID Token.
+	// They identify the session at the provider for back-channel logout.
+	Subject   string `msgpack:"sb,omitempty"`
+	SessionID string `msgpack:"si,omitempty"`
+
+	// Acr and AuthTime are the `acr` and `auth_time` claims of the ID Token,
+	// the authentication context class and time of the authentication of the
+	// user with the provider.
+	Acr      string     `msgpack:"ac,omitempty"`
+	AuthTime *time.Time `msgpack:"au,omitempty"`
+
+	// IntrospectionClaims are the claims of the introspection response of an
+	// opaque bearer token. Bearer sessions are never stored, so they are not
+	// serialized.
+	IntrospectionClaims map[string]interface{} `msgpack:"-"`
+
 	// Internal helpers, not serialized
 	Clock clock.Clock `msgpack:"-"`
 	Lock  Lock        `msgpack:"-"`
@@ -69,6 +97,12 @@ func (s *SessionState) CreatedAtNow() {
 	s.CreatedAt = &now
 }
 
+// SignedInAtNow sets a SessionState's SignedInAt to now
+func (s *SessionState) SignedInAtNow() {
+	now := s.Clock.Now()
+	s.SignedInAt = &now
+}
+
 // SetExpiresOn sets an expiration
 func (s *SessionState) SetExpiresOn(exp time.Time) {
 	s.ExpiresOn = &exp
@@ -92,6 +126,14 @@ func (s *SessionState) IsExpired() bool {
 	return false
 }
 
+// ExpiresWithin checks whether the session expires within the duration
+func (s *SessionState) ExpiresWithin(d time.Duration) bool {
+	if s.ExpiresOn != nil && !s.ExpiresOn.IsZero() && !s.ExpiresOn.After(s.Clock.Now().Add(d)) {
+		return true
+	}
+	return false
+}
+
 // Age returns the age of a session
 func (s *SessionState) Age() time.Duration {
 	if s.CreatedAt != nil && !s.CreatedAt.IsZero() {
@@ -100,6 +142,56 @@ func (s *SessionState) Age() time.Duration {
 	return 0
 }
 
+// IdleTimeoutRemaining returns the time left until the session times out
+// after being idle for the timeout. Idle time is counted from the last
+// recorded activity, or else from when the user signed in.
+func (s *SessionState) IdleTimeoutRemaining(timeout time.Duration) time.Duration {
+	last := s.LastActivityAt
+	if last == nil || last.IsZero() {
+		last = s.signedInAt()
+	}
+	if last == nil {
+		return timeout
+	}
+	return last.Add(timeout).Sub(s.Clock.Now())
+}
+
+// MaxLifetimeRemaining returns the time left until the session reaches the
+// maximum lifetime since the user signed in, regardless of refreshes
+func (s *SessionState) MaxLifetimeRemaining(lifetime time.Duration) time.Duration {
+	signedIn := s.signedInAt()
+	if signedIn == nil {
+		return lifetime
+	}
+	return signedIn.Add(lifetime).Sub(s.Clock.Now())
+}
+
+// AuthenticatedWithin returns whether the user authenticated with the provider
+// within the duration. Sessions without an authentication time were
+// authenticated when the user signed in.
+func (s *SessionState) AuthenticatedWithin(d time.Duration) bool {
+	authTime := s.AuthTime
+	if authTime == nil || authTime.IsZero() {
+		authTime = s.signedInAt()
+	}
+	if authTime == nil {
+		return false
+	}
+	return !s.Clock.Now().After(authTime.Add(d))
+}
+
+// signedInAt returns when the user signed in. Sessions saved before the
+// sign in time was recorded fall back to the time they were created.
+func (s *SessionState) signedInAt() *time.Time {
+	if s.SignedInAt != nil && !s.SignedInAt.IsZero() {
+		return s.SignedInAt
+	}
+	if s.CreatedAt != nil && !s.CreatedAt.IsZero() {
+		return s.CreatedAt
+	}
+	return nil
+}
+
 // String constructs a summary of the session state
 func (s *SessionState) String() string {
 	o := fmt.Sprintf("Session{email:%s user:%s PreferredUsername:%s", s.Email, s.User, s.PreferredUsername)
@@ -121,6 +213,9 @@ func (s *SessionState) String() string {
 	if len(s.Groups) > 0 {
 		o += fmt.Sprintf(" groups:%v", s.Groups)
 	}
+	if s.ProviderID != "" {
+		o += fmt.Sprintf(" provider:%s", s.ProviderID)
+	}
 	return o + "}"
 }
 
@@ -125,6 +125,16 @@ func TestString(t *testing.T) {
 			},
 			expected: "Session{email:email@email.email user:some.user PreferredUsername:preferred.user refresh_token:true}",
 		},
+		{
+			name: "With a provider ID",
+			sessionState: &SessionState{
+				Email:             "email@email.email",
+				User:              "some.user",
+				PreferredUsername: "preferred.user",
+				ProviderID:        "provider-a",
+			},
+			expected: "Session{email:email@email.email user:some.user PreferredUsername:preferred.user provider:provider-a}",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -146,6 +156,18 @@ func TestIsExpired(t *testing.T) {
 	assert.Equal(t, false, s.IsExpired())
 }
 
+func TestExpiresWithin(t *testing.T) {
+	s := &SessionState{ExpiresOn: timePtr(time.Now().Add(time.Duration(1) * time.Minute))}
+	assert.Equal(t, true, s.ExpiresWithin(time.Duration(2)*time.Minute))
+	assert.Equal(t, false, s.ExpiresWithin(time.Duration(30)*time.Second))
+
+	s = &SessionState{ExpiresOn: timePtr(time.Now().Add(time.Duration(-1) * time.Minute))}
+	assert.Equal(t, true, s.ExpiresWithin(0))
+
+	s = &SessionState{}
+	assert.Equal(t, false, s.ExpiresWithin(time.Duration(1)*time.Hour))
+}
+
 func TestAge(t *testing.T) {
 	ss := &SessionState{}
 
@@ -157,6 +179,52 @@ func TestAge(t *testing.T) {
 	assert.Equal(t, time.Hour, ss.Age().Round(time.Minute))
 }
 
+func TestIdleTimeoutRemaining(t *testing.T) {
+	ss := &SessionState{}
+
+	// No activity or sign in time so the full timeout remains
+	assert.Equal(t, 30*time.Minute, ss.IdleTimeoutRemaining(30*time.Minute))
+
+	// Idle time is counted from the sign in time without recorded activity
+	ss.SignedInAt = timePtr(time.Now().Add(-10 * time.Minute))
+	assert.Equal(t, 20*time.Minute, ss.IdleTimeoutRemaining(30*time.Minute).Round(time.Minute))
+
+	ss.LastActivityAt = timePtr(time.Now().Add(-5 * time.Minute))
+	assert.Equal(t, 25*time.Minute, ss.IdleTimeoutRemaining(30*time.Minute).Round(time.Minute))
+	assert.Equal(t, -time.Minute, ss.IdleTimeoutRemaining(4*time.Minute).Round(time.Minute))
+}
+
+func TestMaxLifetimeRemaining(t *testing.T) {
+	ss := &SessionState{}
+
+	// No sign in time so the full lifetime remains
+	assert.Equal(t, 12*time.Hour, ss.MaxLifetimeRemaining(12*time.Hour))
+
+	// Sessions without a sign in time fall back to the time they were created
+	ss.CreatedAt = timePtr(time.Now().Add(-1 * time.Hour))
+	assert.Equal(t, 11*time.Hour, ss.MaxLifetimeRemaining(12*time.Hour).Round(time.Minute))
+
+	// Refreshes don't extend the lifetime since the user signed in
+	ss.SignedInAt = timePtr(time.Now().Add(-2 * time.Hour))
+	assert.Equal(t, 10*time.Hour, ss.MaxLifetimeRemaining(12*time.Hour).Round(time.Minute))
+}
+
+func TestAuthenticatedWithin(t *testing.T) {
+	ss := &SessionState{}
+
+	// The authentication time is unknown
+	assert.False(t, ss.AuthenticatedWithin(time.Hour))
+
+	// Sessions without an authentication time fall back to the sign in time
+	ss.SignedInAt = timePtr(time.Now().Add(-30 * time.Minute))
+	assert.True(t, ss.AuthenticatedWithin(time.Hour))
+
+	// The user may have authenticated with the provider before signing in
+	ss.AuthTime = timePtr(time.Now().Add(-2 * time.Hour))
+	assert.False(t, ss.AuthenticatedWithin(time.Hour))
+	assert.True(t, ss.AuthenticatedWithin(3*time.Hour))
+}
+
 // TestEncodeAndDecodeSessionState encodes & decodes various session states
 // and confirms the operation is 1:1
 func TestEncodeAndDecodeSessionState(t *testing.T) {
@@ -224,6 +292,27 @@ func TestEncodeAndDecodeSessionState(t *testing.T) {
 			Nonce:             []byte("abcdef1234567890abcdef1234567890"),
 			Groups:            []string{"group-a", "group-b"},
 		},
+		"With provider ID": {
+			Email:        "username@example.com",
+			User:         "username",
+			AccessToken:  "AccessToken.12349871293847fdsaihf9238h4f91h8fr.1349f831y98fd7",
+			IDToken:      "IDToken.12349871293847fdsaihf9238h4f91h8fr.1349f831y98fd7",
+			CreatedAt:    &created,
+			ExpiresOn:    &expires,
+			RefreshToken: "RefreshToken.12349871293847fdsaihf9238h4f91h8fr.1349f831y98fd7",
+			ProviderID:   "provider-a",
+		},
+		"With subject and session ID": {
+			Email:        "username@example.com",
+			User:         "username",
+			AccessToken:  "AccessToken.12349871293847fdsaihf9238h4f91h8fr.1349f831y98fd7",
+			IDToken:      "IDToken.12349871293847fdsaihf9238h4f91h8fr.1349f831y98fd7",
+			CreatedAt:    &created,
+			ExpiresOn:    &expires,
+			RefreshToken: "RefreshToken.12349871293847fdsaihf9238h4f91h8fr.1349f831y98fd7",
+			Subject:      "248289761001",
+			SessionID:    "08a5019c-17e1-4977-8f42-65a12843ea02",
+		},
 	}
 
 	for _, secretSize := range []int{16, 24, 32} {
@@ -49,6 +49,11 @@ type Opts struct {
 	// ProviderName is the name of the provider that should be displayed on the login button.
 	ProviderName string
 
+	// Providers is the list of providers that a user may sign in with.
+	// A login button is displayed for each provider.
+	// If empty, a single button is displayed using the ProviderName.
+	Providers []SignInProvider
+
 	// SignInMessage is the messge displayed above the login button.
 	SignInMessage string
 
@@ -83,6 +88,7 @@ func NewWriter(opts Opts) (Writer, error) {
 		errorPageWriter:  errorPage,
 		proxyPrefix:      opts.ProxyPrefix,
 		providerName:     opts.ProviderName,
+		providers:        buildSignInProviders(opts),
 		signInMessage:    opts.SignInMessage,
 		footer:           opts.Footer,
 		version:          opts.Version,
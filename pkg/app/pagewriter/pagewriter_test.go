@@ -62,6 +62,34 @@ var _ = Describe("Writer", func() {
 				body, err := ioutil.ReadAll(recorder.Result().Body)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(string(body)).To(HavePrefix("\n<!DOCTYPE html>"))
+				Expect(string(body)).To(ContainSubstring("Sign in with &lt;ProviderName&gt;"))
+				Expect(string(body)).ToNot(ContainSubstring(`name="provider"`))
+			})
+		})
+
+		Context("With multiple providers", func() {
+			BeforeEach(func() {
+				opts.Providers = []SignInProvider{
+					{ID: "provider-a", Name: "Provider A"},
+					{ID: "provider-b", Name: "Provider B"},
+				}
+
+				var err error
+				writer, err = NewWriter(opts)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("Writes a sign in button for each provider", func() {
+				recorder := httptest.NewRecorder()
+				writer.WriteSignInPage(recorder, request, "/redirect")
+
+				body, err := ioutil.ReadAll(recorder.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring("Sign in with Provider A"))
+				Expect(string(body)).To(ContainSubstring(`<input type="hidden" name="provider" value="provider-a">`))
+				Expect(string(body)).To(ContainSubstring("Sign in with Provider B"))
+				Expect(string(body)).To(ContainSubstring(`<input type="hidden" name="provider" value="provider-b">`))
+				Expect(string(body)).ToNot(ContainSubstring("&lt;ProviderName&gt;"))
 			})
 		})
 
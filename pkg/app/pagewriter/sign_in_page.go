@@ -34,6 +34,9 @@ type signInPageWriter struct {
 	// ProviderName is the name of the provider that should be displayed on the login button.
 	providerName string
 
+	// Providers are the providers that should each be displayed with a login button.
+	providers []SignInProvider
+
 	// SignInMessage is the messge displayed above the login button.
 	signInMessage string
 
@@ -52,6 +55,15 @@ type signInPageWriter struct {
 	logoData string
 }
 
+// SignInProvider describes a provider that a user may choose to sign in with.
+type SignInProvider struct {
+	// ID is the provider ID passed to the start endpoint to select the provider.
+	ID string
+
+	// Name is the name of the provider that should be displayed on the login button.
+	Name string
+}
+
 // WriteSignInPage writes the sign-in page to the given response writer.
 // It uses the redirectURL to be able to set the final destination for the user post login.
 func (s *signInPageWriter) WriteSignInPage(rw http.ResponseWriter, req *http.Request, redirectURL string) {
@@ -59,6 +71,7 @@ func (s *signInPageWriter) WriteSignInPage(rw http.ResponseWriter, req *http.Req
 	/* #nosec G203 */
 	t := struct {
 		ProviderName  string
+		Providers     []SignInProvider
 		SignInMessage template.HTML
 		CustomLogin   bool
 		Redirect      string
@@ -68,6 +81,7 @@ func (s *signInPageWriter) WriteSignInPage(rw http.ResponseWriter, req *http.Req
 		LogoData      template.HTML
 	}{
 		ProviderName:  s.providerName,
+		Providers:     s.providers,
 		SignInMessage: template.HTML(s.signInMessage),
 		CustomLogin:   s.displayLoginForm,
 		Redirect:      redirectURL,
@@ -90,6 +104,16 @@ func (s *signInPageWriter) WriteSignInPage(rw http.ResponseWriter, req *http.Req
 	}
 }
 
+// buildSignInProviders returns the providers to display on the sign-in page.
+// When no providers are configured, a single provider is built from the
+// provider name so that existing configurations render a single button.
+func buildSignInProviders(opts Opts) []SignInProvider {
+	if len(opts.Providers) > 0 {
+		return opts.Providers
+	}
+	return []SignInProvider{{Name: opts.ProviderName}}
+}
+
 // loadCustomLogo loads the logo file from the path and encodes it to an HTML
 // entity. If no custom logo is provided, the OAuth2 Proxy Icon is used instead.
 func loadCustomLogo(logoPath string) (string, error) {
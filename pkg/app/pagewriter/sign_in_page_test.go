@@ -30,7 +30,7 @@ var _ = Describe("SignIn Page", func() {
 				template: errorTmpl,
 			}
 
-			tmpl, err := template.New("").Parse("{{.ProxyPrefix}} {{.ProviderName}} {{.SignInMessage}} {{.Footer}} {{.Version}} {{.Redirect}} {{.CustomLogin}} {{.LogoData}}")
+			tmpl, err := template.New("").Parse("{{.ProxyPrefix}} {{.ProviderName}} {{range .Providers}}{{.ID}}={{.Name}} {{end}}{{.SignInMessage}} {{.Footer}} {{.Version}} {{.Redirect}} {{.CustomLogin}} {{.LogoData}}")
 			Expect(err).ToNot(HaveOccurred())
 
 			signInPage = &signInPageWriter{
@@ -43,6 +43,10 @@ var _ = Describe("SignIn Page", func() {
 				version:          "v0.0.0-test",
 				displayLoginForm: true,
 				logoData:         "Logo Data",
+				providers: []SignInProvider{
+					{ID: "provider-a", Name: "Provider A"},
+					{ID: "provider-b", Name: "Provider B"},
+				},
 			}
 
 			request = httptest.NewRequest("", "http://127.0.0.1/", nil)
@@ -58,7 +62,7 @@ var _ = Describe("SignIn Page", func() {
 
 				body, err := ioutil.ReadAll(recorder.Result().Body)
 				Expect(err).ToNot(HaveOccurred())
-				Expect(string(body)).To(Equal("/prefix/ My Provider Sign In Here Custom Footer Text v0.0.0-test /redirect true Logo Data"))
+				Expect(string(body)).To(Equal("/prefix/ My Provider provider-a=Provider A provider-b=Provider B Sign In Here Custom Footer Text v0.0.0-test /redirect true Logo Data"))
 			})
 
 			It("Writes an error if the template can't be rendered", func() {
@@ -44,6 +44,7 @@ var _ = Describe("Templates", func() {
 				// For default sign_in template
 				SignInMessage string
 				ProviderName  string
+				Providers     []SignInProvider
 				CustomLogin   bool
 				LogoData      string
 
@@ -62,6 +63,7 @@ var _ = Describe("Templates", func() {
 
 				SignInMessage: "<sign-in-message>",
 				ProviderName:  "<provider-name>",
+				Providers:     []SignInProvider{{ID: "<provider-id>", Name: "<provider-name>"}},
 				CustomLogin:   false,
 				LogoData:      "<logo>",
 
@@ -0,0 +1,192 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/watcher"
+)
+
+// keysFile is the structure of an API keys file
+type keysFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// Key is an API key and the identity it maps to.
+// Only the hex encoded SHA-256 hash of the key is stored.
+type Key struct {
+	// SHA256 is the hex encoded SHA-256 hash of the key
+	SHA256 string `json:"sha256"`
+
+	// User, Email and Groups are set on the sessions of requests using the key
+	User   string   `json:"user"`
+	Email  string   `json:"email,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+
+	// ExpiresAt is the time after which the key is rejected
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// AllowedRoutes restricts the key to the routes matching one of the
+	// `[method=]path regex` entries. All routes are allowed when empty.
+	AllowedRoutes []string `json:"allowedRoutes,omitempty"`
+
+	routes []route
+}
+
+// route is a method and path regex a key is allowed to access
+type route struct {
+	method    string
+	pathRegex *regexp.Regexp
+}
+
+// Store holds the API keys loaded from a file, indexed by their hash
+type Store struct {
+	keys map[string]*Key
+	rwm  sync.RWMutex
+
+	// done stops watching the API keys file when closed
+	done      chan bool
+	closeOnce sync.Once
+}
+
+// NewFileStore loads the API keys from the file at the path given.
+// The file is watched for changes and reloaded when it is updated until the
+// store is closed. If the updated file cannot be loaded, the previous keys
+// are kept.
+func NewFileStore(path string) (*Store, error) {
+	s := &Store{
+		keys: make(map[string]*Key),
+		done: make(chan bool),
+	}
+
+	if err := s.loadFile(path); err != nil {
+		return nil, err
+	}
+
+	if err := watcher.WatchFileForUpdates(path, s.done, func() {
+		if err := s.loadFile(path); err != nil {
+			logger.Errorf("%v: no changes were made to the current API keys", err)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("could not watch API keys file: %v", err)
+	}
+
+	return s, nil
+}
+
+// Close stops watching the API keys file for changes
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// loadFile reads the API keys file at the path given and swaps its keys
+// into the Store
+func (s *Store) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("could not read API keys file: %v", err)
+	}
+
+	keys, err := parseKeys(data)
+	if err != nil {
+		return fmt.Errorf("could not load API keys file: %v", err)
+	}
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	s.keys = keys
+	return nil
+}
+
+// parseKeys parses and validates the keys of an API keys file
+func parseKeys(data []byte) (map[string]*Key, error) {
+	file := &keysFile{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*Key, len(file.Keys))
+	for i := range file.Keys {
+		key := &file.Keys[i]
+
+		hash := strings.ToLower(key.SHA256)
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("key %d: sha256 must be a hex encoded SHA-256 hash", i)
+		}
+		if _, ok := keys[hash]; ok {
+			return nil, fmt.Errorf("key %d: duplicate key", i)
+		}
+		if key.User == "" && key.Email == "" {
+			return nil, fmt.Errorf("key %d: user or email is required", i)
+		}
+
+		for _, methodPath := range key.AllowedRoutes {
+			r, err := parseRoute(methodPath)
+			if err != nil {
+				return nil, fmt.Errorf("key %d: %v", i, err)
+			}
+			key.routes = append(key.routes, r)
+		}
+
+		keys[hash] = key
+	}
+	return keys, nil
+}
+
+// parseRoute parses a `[method=]path regex` route
+func parseRoute(methodPath string) (route, error) {
+	var method, path string
+	parts := strings.SplitN(methodPath, "=", 2)
+	if len(parts) == 1 {
+		path = parts[0]
+	} else {
+		method = strings.ToUpper(parts[0])
+		path = parts[1]
+	}
+
+	pathRegex, err := regexp.Compile(path)
+	if err != nil {
+		return route{}, fmt.Errorf("invalid allowed route %q: %v", methodPath, err)
+	}
+	return route{method: method, pathRegex: pathRegex}, nil
+}
+
+// Lookup returns the Key matching the API key given, or nil if there is no
+// such key
+func (s *Store) Lookup(apiKey string) *Key {
+	hash := sha256.Sum256([]byte(apiKey))
+
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	return s.keys[hex.EncodeToString(hash[:])]
+}
+
+// IsExpired checks whether the key expired at the time given
+func (k *Key) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// IsAllowed checks whether the key may be used for the method and path of
+// a request
+func (k *Key) IsAllowed(method, path string) bool {
+	if len(k.routes) == 0 {
+		return true
+	}
+	for _, r := range k.routes {
+		if (r.method == "" || method == r.method) && r.pathRegex.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	ciKey      = "ci-0d4e9b1a7c2f4e8b"
+	monitorKey = "monitor-6f1c3a9e2b7d"
+)
+
+func hashKey(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(hash[:])
+}
+
+var _ = Describe("API Key Suite", func() {
+	Context("parseKeys", func() {
+		It("parses keys with their identity, expiry and routes", func() {
+			keys, err := parseKeys([]byte(fmt.Sprintf(`
+keys:
+- sha256: %s
+  user: ci
+  email: ci@example.com
+  groups:
+  - deployers
+  expiresAt: 2030-01-01T00:00:00Z
+  allowedRoutes:
+  - POST=^/api/deploy
+  - ^/api/status$
+`, hashKey(ciKey))))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys).To(HaveLen(1))
+
+			key := keys[hashKey(ciKey)]
+			Expect(key).ToNot(BeNil())
+			Expect(key.User).To(Equal("ci"))
+			Expect(key.Email).To(Equal("ci@example.com"))
+			Expect(key.Groups).To(Equal([]string{"deployers"}))
+			Expect(*key.ExpiresAt).To(Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+			Expect(key.routes).To(HaveLen(2))
+			Expect(key.routes[0].method).To(Equal("POST"))
+			Expect(key.routes[1].method).To(BeEmpty())
+		})
+
+		It("accepts upper case hashes", func() {
+			keys, err := parseKeys([]byte(fmt.Sprintf("keys:\n- sha256: %X\n  user: ci\n", sha256.Sum256([]byte(ciKey)))))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys).To(HaveKey(hashKey(ciKey)))
+		})
+
+		DescribeTable("rejects invalid files",
+			func(data string, expectedError string) {
+				_, err := parseKeys([]byte(data))
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			},
+			Entry("with an invalid hash",
+				"keys:\n- sha256: abcdef\n  user: ci\n",
+				"key 0: sha256 must be a hex encoded SHA-256 hash"),
+			Entry("with a plain text key",
+				fmt.Sprintf("keys:\n- sha256: %s\n  user: ci\n", ciKey),
+				"key 0: sha256 must be a hex encoded SHA-256 hash"),
+			Entry("with a duplicate key",
+				fmt.Sprintf("keys:\n- sha256: %s\n  user: ci\n- sha256: %s\n  user: monitor\n", hashKey(ciKey), hashKey(ciKey)),
+				"key 1: duplicate key"),
+			Entry("without a user or email",
+				fmt.Sprintf("keys:\n- sha256: %s\n  groups: [deployers]\n", hashKey(ciKey)),
+				"key 0: user or email is required"),
+			Entry("with an invalid route",
+				fmt.Sprintf("keys:\n- sha256: %s\n  user: ci\n  allowedRoutes: [\"GET=(\"]\n", hashKey(ciKey)),
+				"key 0: invalid allowed route \"GET=(\""),
+			Entry("with invalid YAML",
+				"keys: {",
+				"error converting YAML to JSON"),
+		)
+	})
+
+	Context("Key", func() {
+		It("expires at its expiry time", func() {
+			expiresAt := time.Now()
+			key := &Key{ExpiresAt: &expiresAt}
+
+			Expect(key.IsExpired(expiresAt.Add(-time.Second))).To(BeFalse())
+			Expect(key.IsExpired(expiresAt)).To(BeTrue())
+			Expect((&Key{}).IsExpired(expiresAt)).To(BeFalse())
+		})
+
+		DescribeTable("IsAllowed",
+			func(allowedRoutes []string, method, path string, expected bool) {
+				key := &Key{}
+				for _, methodPath := range allowedRoutes {
+					r, err := parseRoute(methodPath)
+					Expect(err).ToNot(HaveOccurred())
+					key.routes = append(key.routes, r)
+				}
+
+				Expect(key.IsAllowed(method, path)).To(Equal(expected))
+			},
+			Entry("without routes", nil, "DELETE", "/anything", true),
+			Entry("with a matching path", []string{"^/api/status$"}, "GET", "/api/status", true),
+			Entry("with a matching method and path", []string{"post=^/api/deploy"}, "POST", "/api/deploy/app", true),
+			Entry("with a different method", []string{"POST=^/api/deploy"}, "GET", "/api/deploy", false),
+			Entry("with a different path", []string{"^/api/status$", "POST=^/api/deploy"}, "GET", "/admin", false),
+		)
+	})
+
+	Context("with a watched file", func() {
+		var dir, filePath string
+		var store *Store
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "oauth2-proxy-apikey-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			filePath = filepath.Join(dir, "api-keys.yaml")
+			Expect(ioutil.WriteFile(filePath, []byte(fmt.Sprintf("keys:\n- sha256: %s\n  user: ci\n", hashKey(ciKey))), 0600)).To(Succeed())
+
+			store, err = NewFileStore(filePath)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(store.Close()).To(Succeed())
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("looks up keys by their plain text value", func() {
+			key := store.Lookup(ciKey)
+			Expect(key).ToNot(BeNil())
+			Expect(key.User).To(Equal("ci"))
+
+			Expect(store.Lookup(hashKey(ciKey))).To(BeNil())
+			Expect(store.Lookup(monitorKey)).To(BeNil())
+		})
+
+		It("reloads the keys when the file changes", func() {
+			Expect(ioutil.WriteFile(filePath, []byte(fmt.Sprintf("keys:\n- sha256: %s\n  user: monitor\n", hashKey(monitorKey))), 0600)).To(Succeed())
+
+			Eventually(func() *Key {
+				return store.Lookup(monitorKey)
+			}, 5*time.Second, 10*time.Millisecond).ShouldNot(BeNil())
+			Expect(store.Lookup(ciKey)).To(BeNil())
+		})
+
+		It("keeps the previous keys when the file is invalid", func() {
+			Expect(ioutil.WriteFile(filePath, []byte(fmt.Sprintf("keys:\n- sha256: %s\n", hashKey(monitorKey))), 0600)).To(Succeed())
+
+			Consistently(func() *Key {
+				return store.Lookup(ciKey)
+			}, 500*time.Millisecond, 10*time.Millisecond).ShouldNot(BeNil())
+			Expect(store.Lookup(monitorKey)).To(BeNil())
+		})
+
+		It("stops reloading the keys once closed", func() {
+			Expect(store.Close()).To(Succeed())
+			Expect(store.done).To(BeClosed())
+			Expect(ioutil.WriteFile(filePath, []byte(fmt.Sprintf("keys:\n- sha256: %s\n  user: monitor\n", hashKey(monitorKey))), 0600)).To(Succeed())
+
+			Consistently(func() *Key {
+				return store.Lookup(ciKey)
+			}, 500*time.Millisecond, 10*time.Millisecond).ShouldNot(BeNil())
+		})
+
+		It("returns an error when the file cannot be read", func() {
+			_, err := NewFileStore(filepath.Join(dir, "missing.yaml"))
+			Expect(err).To(MatchError(ContainSubstring("could not read API keys file")))
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package basic
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// argon2idPass is used to identify argon2id passwords in the
+// htpasswdMap users. It holds the parameters of the PHC string
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type argon2idPass struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2idPass parses an argon2id hash in the PHC string format
+func parseArgon2idPass(hash string) (argon2idPass, error) {
+	var p argon2idPass
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, fmt.Errorf("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, fmt.Errorf("malformed argon2id version: %v", err)
+	}
+	if version != argon2.Version {
+		return p, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, fmt.Errorf("malformed argon2id parameters: %v", err)
+	}
+	if p.time < 1 || p.threads < 1 {
+		return p, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, fmt.Errorf("malformed argon2id salt: %v", err)
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, fmt.Errorf("malformed argon2id key: %v", err)
+	}
+	if len(p.key) == 0 {
+		return p, fmt.Errorf("malformed argon2id key: empty key")
+	}
+	return p, nil
+}
+
+// verify derives the key of the password with the parameters of the hash and
+// compares it with the key of the hash
+func (p argon2idPass) verify(password string) bool {
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1
+}
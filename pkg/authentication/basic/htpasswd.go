@@ -8,15 +8,42 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 
+	"github.com/GehirnInc/crypt/apr1_crypt"
+	"github.com/GehirnInc/crypt/sha256_crypt"
+	"github.com/GehirnInc/crypt/sha512_crypt"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/watcher"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// HTPasswdOptions configures how the entries of an htpasswd file are
+// handled.
+type HTPasswdOptions struct {
+	// RejectWeakHashes ignores entries hashed with a weak scheme
+	// (SHA1 or Apache MD5) instead of only warning about them.
+	RejectWeakHashes bool
+
+	// RehashFile, when set, receives a bcrypt entry for each user that
+	// logs in successfully with a password hashed with a weak scheme.
+	RehashFile string
+}
+
 // htpasswdMap represents the structure of an htpasswd file.
-// Passwords must be generated with -B for bcrypt or -s for SHA1.
+// Passwords must be generated with -B for bcrypt or -s for SHA1, or with
+// another tool for SHA-crypt and argon2id.
 type htpasswdMap struct {
 	users map[string]interface{}
+	rwm   sync.RWMutex
+
+	rejectWeakHashes bool
+	rehash           *rehashFile
+
+	// done stops watching the htpasswd file when closed
+	done      chan bool
+	closeOnce sync.Once
 }
 
 // bcryptPass is used to identify bcrypt passwords in the
@@ -27,9 +54,99 @@ type bcryptPass string
 // htpasswdMap users.
 type sha1Pass string
 
+// apr1Pass is used to identify Apache MD5 passwords in the
+// htpasswdMap users.
+type apr1Pass string
+
+// sha256CryptPass is used to identify SHA-256-crypt passwords in the
+// htpasswdMap users.
+type sha256CryptPass string
+
+// sha512CryptPass is used to identify SHA-512-crypt passwords in the
+// htpasswdMap users.
+type sha512CryptPass string
+
 // NewHTPasswdValidator constructs an httpasswd based validator from the file
 // at the path given.
-func NewHTPasswdValidator(path string) (Validator, error) {
+// The file is watched for changes and reloaded when it is updated until the
+// validator is closed. If the updated file cannot be read or has no entries,
+// the previous entries are kept.
+func NewHTPasswdValidator(path string, opts HTPasswdOptions) (Validator, error) {
+	h := &htpasswdMap{
+		users:            make(map[string]interface{}),
+		rejectWeakHashes: opts.RejectWeakHashes,
+		done:             make(chan bool),
+	}
+	if err := h.loadHTPasswdFile(path); err != nil {
+		return nil, err
+	}
+
+	if err := watcher.WatchFileForUpdates(path, h.done, func() {
+		select {
+		case <-h.done:
+			// Events received before the watcher stopped are ignored once closed
+			return
+		default:
+		}
+		if err := h.reloadHTPasswdFile(path); err != nil {
+			logger.Errorf("%v: no changes were made to the current htpasswd map", err)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("could not watch htpasswd file: %v", err)
+	}
+
+	if opts.RehashFile != "" {
+		h.rehash = newRehashFile(opts.RehashFile)
+	}
+	return h, nil
+}
+
+// Close stops watching the htpasswd file for changes, and waits for the
+// pending rehashed entries to be written
+func (h *htpasswdMap) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+	if h.rehash != nil {
+		return h.rehash.Close()
+	}
+	return nil
+}
+
+// loadHTPasswdFile reads the htpasswd file at the path given and swaps its
+// entries into the htpasswdMap.
+func (h *htpasswdMap) loadHTPasswdFile(path string) error {
+	loaded, err := h.readHTPasswdFile(path)
+	if err != nil {
+		return err
+	}
+
+	h.rwm.Lock()
+	defer h.rwm.Unlock()
+	h.users = loaded.users
+	return nil
+}
+
+// reloadHTPasswdFile reads the htpasswd file after it was updated.
+// A file without entries is most likely being rewritten, so it is rejected
+// rather than locking out all users until the next update.
+func (h *htpasswdMap) reloadHTPasswdFile(path string) error {
+	loaded, err := h.readHTPasswdFile(path)
+	if err != nil {
+		return err
+	}
+	if len(loaded.users) == 0 {
+		return fmt.Errorf("htpasswd file %s has no valid entries", path)
+	}
+
+	h.rwm.Lock()
+	defer h.rwm.Unlock()
+	h.users = loaded.users
+	return nil
+}
+
+// readHTPasswdFile reads the entries of the htpasswd file at the path given.
+func (h *htpasswdMap) readHTPasswdFile(path string) (*htpasswdMap, error) {
 	// We allow HTPasswd location via config options
 	r, err := os.Open(path) // #nosec G304
 	if err != nil {
@@ -38,14 +155,15 @@ func NewHTPasswdValidator(path string) (Validator, error) {
 	defer func(c io.Closer) {
 		cerr := c.Close()
 		if cerr != nil {
-			logger.Fatalf("error closing the htpasswd file: %v", cerr)
+			logger.Errorf("error closing the htpasswd file: %v", cerr)
 		}
 	}(r)
-	return newHtpasswd(r)
+
+	return newHtpasswd(r, h.rejectWeakHashes)
 }
 
 // newHtpasswd consctructs an htpasswd from an io.Reader (an opened file).
-func newHtpasswd(file io.Reader) (*htpasswdMap, error) {
+func newHtpasswd(file io.Reader, rejectWeakHashes bool) (*htpasswdMap, error) {
 	csvReader := csv.NewReader(file)
 	csvReader.Comma = ':'
 	csvReader.Comment = '#'
@@ -56,40 +174,98 @@ func newHtpasswd(file io.Reader) (*htpasswdMap, error) {
 		return nil, fmt.Errorf("could not read htpasswd file: %v", err)
 	}
 
-	return createHtpasswdMap(records)
+	return createHtpasswdMap(records, rejectWeakHashes)
 }
 
-// createHtasswdMap constructs an htpasswdMap from the given records
-func createHtpasswdMap(records [][]string) (*htpasswdMap, error) {
+// createHtasswdMap constructs an htpasswdMap from the given records.
+// Entries hashed with a weak scheme are logged, and skipped when
+// rejectWeakHashes is set.
+func createHtpasswdMap(records [][]string, rejectWeakHashes bool) (*htpasswdMap, error) {
 	h := &htpasswdMap{users: make(map[string]interface{})}
 	for _, record := range records {
-		user, realPassword := record[0], record[1]
-		shaPrefix := realPassword[:5]
-		if shaPrefix == "{SHA}" {
-			h.users[user] = sha1Pass(realPassword[5:])
-			continue
+		if len(record) < 2 {
+			return nil, fmt.Errorf("could not read htpasswd file: malformed entry %q", strings.Join(record, ":"))
 		}
+		user, realPassword := record[0], record[1]
 
-		bcryptPrefix := realPassword[:4]
-		if bcryptPrefix == "$2a$" || bcryptPrefix == "$2b$" || bcryptPrefix == "$2x$" || bcryptPrefix == "$2y$" {
-			h.users[user] = bcryptPass(realPassword)
+		pass, err := parseHtpasswdPassword(realPassword)
+		if err != nil {
+			// TODO(JoelSpeed): In the next breaking release, make this return an error.
+			logger.Errorf("Invalid htpasswd entry for %s. %v", user, err)
 			continue
 		}
 
-		// Password is neither sha1 or bcrypt
-		// TODO(JoelSpeed): In the next breaking release, make this return an error.
-		logger.Errorf("Invalid htpasswd entry for %s. Must be a SHA or bcrypt entry.", user)
+		if scheme := weakScheme(pass); scheme != "" {
+			if rejectWeakHashes {
+				logger.Errorf("Rejected htpasswd entry for %s. The %s scheme is weak, use bcrypt, SHA-crypt or argon2id instead.", user, scheme)
+				continue
+			}
+			logger.Printf("WARNING: htpasswd entry for %s uses the weak %s scheme, use bcrypt, SHA-crypt or argon2id instead", user, scheme)
+		}
+		h.users[user] = pass
 	}
 	return h, nil
 }
 
-// Validate checks a users password against the htpasswd entries
+// parseHtpasswdPassword identifies the scheme of a hashed password from
+// its prefix.
+func parseHtpasswdPassword(realPassword string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(realPassword, "{SHA}"):
+		return sha1Pass(realPassword[5:]), nil
+	case strings.HasPrefix(realPassword, "$2a$"), strings.HasPrefix(realPassword, "$2b$"),
+		strings.HasPrefix(realPassword, "$2x$"), strings.HasPrefix(realPassword, "$2y$"):
+		return bcryptPass(realPassword), nil
+	case strings.HasPrefix(realPassword, apr1_crypt.MagicPrefix):
+		return apr1Pass(realPassword), nil
+	case strings.HasPrefix(realPassword, sha256_crypt.MagicPrefix):
+		return sha256CryptPass(realPassword), nil
+	case strings.HasPrefix(realPassword, sha512_crypt.MagicPrefix):
+		return sha512CryptPass(realPassword), nil
+	case strings.HasPrefix(realPassword, argon2idPrefix):
+		return parseArgon2idPass(realPassword)
+	default:
+		return nil, fmt.Errorf("must be a SHA, bcrypt, apr1, SHA-crypt or argon2id entry")
+	}
+}
+
+// weakScheme returns the name of the scheme of the password if it is
+// considered weak, or an empty string otherwise.
+func weakScheme(realPassword interface{}) string {
+	switch realPassword.(type) {
+	case sha1Pass:
+		return "SHA1"
+	case apr1Pass:
+		return "Apache MD5"
+	default:
+		return ""
+	}
+}
+
+// Validate checks a users password against the htpasswd entries.
+// Users with a weak password hash are queued to be rehashed after a successful
+// login when a rehash file is configured.
 func (h *htpasswdMap) Validate(user string, password string) bool {
+	h.rwm.RLock()
 	realPassword, exists := h.users[user]
+	h.rwm.RUnlock()
 	if !exists {
 		return false
 	}
 
+	if !validatePassword(realPassword, password) {
+		return false
+	}
+
+	if h.rehash != nil && weakScheme(realPassword) != "" {
+		h.rehash.Queue(user, password)
+	}
+	return true
+}
+
+// validatePassword checks a password against a hashed password parsed from
+// the htpasswd file.
+func validatePassword(realPassword interface{}, password string) bool {
 	switch rp := realPassword.(type) {
 	case sha1Pass:
 		// We support SHA1 HTPasswd entries
@@ -101,6 +277,14 @@ func (h *htpasswdMap) Validate(user string, password string) bool {
 		return string(rp) == base64.StdEncoding.EncodeToString(d.Sum(nil))
 	case bcryptPass:
 		return bcrypt.CompareHashAndPassword([]byte(rp), []byte(password)) == nil
+	case apr1Pass:
+		return apr1_crypt.New().Verify(string(rp), []byte(password)) == nil
+	case sha256CryptPass:
+		return sha256_crypt.New().Verify(string(rp), []byte(password)) == nil
+	case sha512CryptPass:
+		return sha512_crypt.New().Verify(string(rp), []byte(password)) == nil
+	case argon2idPass:
+		return rp.verify(password)
 	default:
 		return false
 	}
@@ -1,6 +1,12 @@
 package basic
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -12,8 +18,18 @@ const (
 	user1Password = "UsErOn3P455"
 	user2         = "user2"
 	user2Password = "us3r2P455W0Rd!"
+
+	adminEntry = "admin:{SHA}gXQeRH0bcaCfhAk2gOLm1uaePMA=\n"
+	user1Entry = "user1:{SHA}Dvs/L78raajL4jEAHPkwflQXJzI=\n"
 )
 
+// closeValidator stops watching the htpasswd file of the validator
+func closeValidator(validator Validator) {
+	if validator != nil {
+		Expect(validator.(*htpasswdMap).Close()).To(Succeed())
+	}
+}
+
 var _ = Describe("HTPasswd Suite", func() {
 	Context("with an HTPassword Validator", func() {
 		assertHtpasswdMapFromFile := func(filePath string) {
@@ -22,13 +38,17 @@ var _ = Describe("HTPasswd Suite", func() {
 
 			BeforeEach(func() {
 				var validator Validator
-				validator, err = NewHTPasswdValidator(filePath)
+				validator, err = NewHTPasswdValidator(filePath, HTPasswdOptions{})
 
 				var ok bool
 				htpasswd, ok = validator.(*htpasswdMap)
 				Expect(ok).To(BeTrue())
 			})
 
+			AfterEach(func() {
+				closeValidator(htpasswd)
+			})
+
 			It("does not return an error", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
@@ -74,13 +94,25 @@ var _ = Describe("HTPasswd Suite", func() {
 				assertHtpasswdMapFromFile(filePath)
 			})
 
+			Context("with apr1 and SHA-crypt entries", func() {
+				const filePath = "./test/htpasswd-crypt.txt"
+
+				assertHtpasswdMapFromFile(filePath)
+			})
+
+			Context("with argon2id entries", func() {
+				const filePath = "./test/htpasswd-argon2id.txt"
+
+				assertHtpasswdMapFromFile(filePath)
+			})
+
 			Context("with a non existent file", func() {
 				const filePath = "./test/htpasswd-doesnt-exist.txt"
 				var validator Validator
 				var err error
 
 				BeforeEach(func() {
-					validator, err = NewHTPasswdValidator(filePath)
+					validator, err = NewHTPasswdValidator(filePath, HTPasswdOptions{})
 				})
 
 				It("returns an error", func() {
@@ -92,5 +124,148 @@ var _ = Describe("HTPasswd Suite", func() {
 				})
 			})
 		})
+
+		Context("with weak entries", func() {
+			It("loads the weak entries by default", func() {
+				validator, err := NewHTPasswdValidator("./test/htpasswd-mixed.txt", HTPasswdOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				defer closeValidator(validator)
+				Expect(validator.(*htpasswdMap).users).To(HaveLen(3))
+			})
+
+			It("rejects the weak entries when configured", func() {
+				validator, err := NewHTPasswdValidator("./test/htpasswd-crypt.txt", HTPasswdOptions{RejectWeakHashes: true})
+				Expect(err).ToNot(HaveOccurred())
+				defer closeValidator(validator)
+
+				htpasswd := validator.(*htpasswdMap)
+				Expect(htpasswd.users).To(HaveLen(2))
+				Expect(htpasswd.Validate(adminUser, adminPassword)).To(BeFalse())
+				Expect(htpasswd.Validate(user1, user1Password)).To(BeTrue())
+				Expect(htpasswd.Validate(user2, user2Password)).To(BeTrue())
+			})
+		})
+
+		Context("with a rehash file", func() {
+			var dir, rehashPath string
+			var htpasswd *htpasswdMap
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "oauth2-proxy-htpasswd-rehash-test")
+				Expect(err).ToNot(HaveOccurred())
+
+				rehashPath = filepath.Join(dir, "htpasswd-rehashed.txt")
+				validator, err := NewHTPasswdValidator("./test/htpasswd-mixed.txt", HTPasswdOptions{RehashFile: rehashPath})
+				Expect(err).ToNot(HaveOccurred())
+				htpasswd = validator.(*htpasswdMap)
+			})
+
+			AfterEach(func() {
+				closeValidator(htpasswd)
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("writes a bcrypt entry for users with a weak hash after a successful login", func() {
+				Expect(htpasswd.Validate(adminUser, adminPassword)).To(BeTrue())
+				Expect(htpasswd.Validate(user1, user1Password)).To(BeTrue())
+				// Close waits for the entries rehashed in the background
+				Expect(htpasswd.Close()).To(Succeed())
+
+				rehashed, err := NewHTPasswdValidator(rehashPath, HTPasswdOptions{RejectWeakHashes: true})
+				Expect(err).ToNot(HaveOccurred())
+				defer closeValidator(rehashed)
+				Expect(rehashed.(*htpasswdMap).users).To(HaveLen(1))
+				Expect(rehashed.(*htpasswdMap).users[user1]).To(BeAssignableToTypeOf(bcryptPass("")))
+				Expect(rehashed.Validate(user1, user1Password)).To(BeTrue())
+			})
+
+			It("doesn't write an entry after a failed login", func() {
+				Expect(htpasswd.Validate(user1, "BHEdgbtr")).To(BeFalse())
+				Expect(htpasswd.Close()).To(Succeed())
+
+				_, err := os.Stat(rehashPath)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			It("keeps the entries of other users", func() {
+				Expect(ioutil.WriteFile(rehashPath, []byte(user1Entry+adminEntry), 0600)).To(Succeed())
+				Expect(htpasswd.Validate(user1, user1Password)).To(BeTrue())
+				Expect(htpasswd.Close()).To(Succeed())
+
+				content, err := ioutil.ReadFile(rehashPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(content)).To(HavePrefix(adminEntry + "user1:$2a$"))
+				Expect(strings.Count(string(content), "\n")).To(Equal(2))
+			})
+		})
+
+		Context("with a watched file", func() {
+			var dir, filePath string
+			var htpasswd *htpasswdMap
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "oauth2-proxy-htpasswd-test")
+				Expect(err).ToNot(HaveOccurred())
+
+				filePath = filepath.Join(dir, "htpasswd.txt")
+				Expect(ioutil.WriteFile(filePath, []byte(adminEntry), 0600)).To(Succeed())
+
+				validator, err := NewHTPasswdValidator(filePath, HTPasswdOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				htpasswd = validator.(*htpasswdMap)
+				Expect(htpasswd.Validate(adminUser, adminPassword)).To(BeTrue())
+			})
+
+			AfterEach(func() {
+				closeValidator(htpasswd)
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("reloads the entries when the file changes", func() {
+				Expect(ioutil.WriteFile(filePath, []byte(user1Entry), 0600)).To(Succeed())
+
+				Eventually(func() bool {
+					return htpasswd.Validate(user1, user1Password)
+				}, 5*time.Second, 10*time.Millisecond).Should(BeTrue())
+				Expect(htpasswd.Validate(adminUser, adminPassword)).To(BeFalse())
+			})
+
+			It("keeps the previous entries when the file cannot be read", func() {
+				Expect(ioutil.WriteFile(filePath, []byte(user1Entry+"user2\n"), 0600)).To(Succeed())
+
+				Consistently(func() bool {
+					return htpasswd.Validate(adminUser, adminPassword)
+				}, 500*time.Millisecond, 10*time.Millisecond).Should(BeTrue())
+				Expect(htpasswd.Validate(user1, user1Password)).To(BeFalse())
+			})
+
+			It("keeps the previous entries when the file is emptied", func() {
+				Expect(ioutil.WriteFile(filePath, []byte{}, 0600)).To(Succeed())
+
+				Consistently(func() bool {
+					return htpasswd.Validate(adminUser, adminPassword)
+				}, 500*time.Millisecond, 10*time.Millisecond).Should(BeTrue())
+				Expect(htpasswd.reloadHTPasswdFile(filePath)).To(MatchError("htpasswd file " + filePath + " has no valid entries"))
+			})
+
+			It("stops reloading the file once closed", func() {
+				Expect(htpasswd.Close()).To(Succeed())
+				Expect(htpasswd.done).To(BeClosed())
+				Expect(ioutil.WriteFile(filePath, []byte(user1Entry), 0600)).To(Succeed())
+
+				Consistently(func() bool {
+					return htpasswd.Validate(adminUser, adminPassword)
+				}, 500*time.Millisecond, 10*time.Millisecond).Should(BeTrue())
+			})
+
+			It("returns an error when loading an invalid file", func() {
+				Expect(ioutil.WriteFile(filePath, []byte("user1\n"), 0600)).To(Succeed())
+
+				Expect(htpasswd.loadHTPasswdFile(filePath)).To(MatchError("could not read htpasswd file: malformed entry \"user1\""))
+				Expect(htpasswd.Validate(adminUser, adminPassword)).To(BeTrue())
+			})
+		})
 	})
 })
@@ -0,0 +1,229 @@
+package basic
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// ldapMatchingRuleInChain is the Active Directory LDAP_MATCHING_RULE_IN_CHAIN
+// rule, which matches the groups a user is a direct or nested member of.
+const ldapMatchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// ldapValidator validates credentials against an LDAP directory.
+// The user is searched for with the bind DN, and the credentials are
+// validated by binding as the user found.
+type ldapValidator struct {
+	userBaseDN    string
+	userAttribute string
+	userFilter    string
+	groupBaseDN   string
+	nestedGroups  bool
+	timeLimit     int
+
+	pool  *ldapPool
+	cache *ldapCache
+}
+
+// NewLDAPValidator constructs a GroupValidator that validates credentials
+// against the LDAP directory configured in the options.
+// Connections are only opened when credentials are validated.
+func NewLDAPValidator(opts options.LDAP) (GroupValidator, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: opts.InsecureSkipVerify, // #nosec G402 -- opt-in
+		MinVersion:         tls.VersionTLS12,
+	}
+	if opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read LDAP CA file: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in LDAP CA file %s", opts.CAFile)
+		}
+	}
+
+	groupBaseDN := opts.GroupBaseDN
+	if groupBaseDN == "" {
+		groupBaseDN = opts.UserBaseDN
+	}
+
+	v := &ldapValidator{
+		userBaseDN:    opts.UserBaseDN,
+		userAttribute: opts.UserAttribute,
+		userFilter:    opts.UserFilter,
+		groupBaseDN:   groupBaseDN,
+		nestedGroups:  opts.NestedGroups,
+		timeLimit:     int(opts.Timeout.Seconds()),
+		pool: &ldapPool{
+			url:          opts.URL,
+			startTLS:     opts.StartTLS,
+			tlsConfig:    tlsConfig,
+			bindDN:       opts.BindDN,
+			bindPassword: opts.BindPassword,
+			timeout:      opts.Timeout,
+			idle:         make(chan *ldap.Conn, opts.PoolSize),
+		},
+	}
+	if opts.CacheTTL > 0 {
+		v.cache, err = newLDAPCache(opts.CacheTTL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Validate checks a users password against the LDAP directory
+func (v *ldapValidator) Validate(user, password string) bool {
+	_, valid := v.ValidateGroups(user, password)
+	return valid
+}
+
+// ValidateGroups checks a users password against the LDAP directory and
+// returns the names of the groups of the user
+func (v *ldapValidator) ValidateGroups(user, password string) ([]string, bool) {
+	// An empty password would be an unauthenticated bind, which most
+	// servers accept for any DN
+	if user == "" || password == "" {
+		return nil, false
+	}
+
+	if v.cache != nil {
+		if groups, ok := v.cache.Get(user, password); ok {
+			return groups, true
+		}
+	}
+
+	groups, valid, err := v.authenticate(user, password)
+	if ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		// Pooled connections may have been closed by the server, retry once
+		// with a new connection
+		groups, valid, err = v.authenticate(user, password)
+	}
+	if err != nil {
+		logger.Errorf("Error validating LDAP credentials for %s: %v", user, err)
+		return nil, false
+	}
+
+	if valid && v.cache != nil {
+		v.cache.Set(user, password, groups)
+	}
+	return groups, valid
+}
+
+// Close closes the pooled connections to the LDAP directory
+func (v *ldapValidator) Close() error {
+	return v.pool.Close()
+}
+
+// authenticate searches for the user and their groups, and binds as the
+// user to check the password
+func (v *ldapValidator) authenticate(user, password string) ([]string, bool, error) {
+	conn, err := v.pool.Get()
+	if err != nil {
+		return nil, false, err
+	}
+
+	groups, valid, err := v.authenticateWith(conn, user, password)
+	if err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	v.pool.Put(conn)
+	return groups, valid, nil
+}
+
+func (v *ldapValidator) authenticateWith(conn *ldap.Conn, user, password string) ([]string, bool, error) {
+	entry, err := v.searchUser(conn, user)
+	if err != nil || entry == nil {
+		return nil, false, err
+	}
+
+	groups, err := v.searchGroups(conn, entry)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("could not bind as %s: %v", entry.DN, err)
+	}
+	return groups, true, nil
+}
+
+// searchUser returns the entry of the user, or nil if there is no single
+// entry matching the username
+func (v *ldapValidator) searchUser(conn *ldap.Conn, user string) (*ldap.Entry, error) {
+	filter := fmt.Sprintf("(&%s(%s=%s))", v.userFilter, v.userAttribute, ldap.EscapeFilter(user))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		v.userBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, v.timeLimit, false,
+		filter, []string{"memberOf"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("could not search for user: %v", err)
+	}
+
+	switch len(res.Entries) {
+	case 0:
+		return nil, nil
+	case 1:
+		return res.Entries[0], nil
+	default:
+		logger.Errorf("Found %d LDAP entries for %s, the user filter must match a single entry", len(res.Entries), user)
+		return nil, nil
+	}
+}
+
+// searchGroups returns the names of the groups of the user, either from the
+// memberOf attribute of the user, or from a search for the nested groups
+func (v *ldapValidator) searchGroups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	if !v.nestedGroups {
+		return ldapGroupNames(entry.GetEqualFoldAttributeValues("memberOf")), nil
+	}
+
+	filter := fmt.Sprintf("(member:%s:=%s)", ldapMatchingRuleInChain, ldap.EscapeFilter(entry.DN))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		v.groupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, v.timeLimit, false,
+		filter, []string{"1.1"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("could not search for groups: %v", err)
+	}
+
+	dns := make([]string, 0, len(res.Entries))
+	for _, group := range res.Entries {
+		dns = append(dns, group.DN)
+	}
+	return ldapGroupNames(dns), nil
+}
+
+// ldapGroupNames returns the value of the first RDN of each group DN,
+// e.g. "admins" for "cn=admins,ou=groups,dc=example,dc=com"
+func ldapGroupNames(dns []string) []string {
+	groups := make([]string, 0, len(dns))
+	for _, dn := range dns {
+		parsed, err := ldap.ParseDN(dn)
+		if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+			groups = append(groups, dn)
+			continue
+		}
+		groups = append(groups, parsed.RDNs[0].Attributes[0].Value)
+	}
+	return groups
+}
@@ -0,0 +1,59 @@
+package basic
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+// ldapCacheMaxEntries is the number of validated credentials kept in memory
+const ldapCacheMaxEntries = 10000
+
+// ldapCache caches successful validations and the groups of the user.
+// Entries are keyed by an HMAC of the credentials so that passwords are not
+// kept in memory.
+type ldapCache struct {
+	ttl     time.Duration
+	key     []byte
+	entries *cache.Cache
+}
+
+func newLDAPCache(ttl time.Duration) (*ldapCache, error) {
+	key, err := encryption.Nonce()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate LDAP cache key: %v", err)
+	}
+	return &ldapCache{
+		ttl:     ttl,
+		key:     key,
+		entries: cache.New(ldapCacheMaxEntries),
+	}, nil
+}
+
+// Get returns the groups cached for the credentials if they are cached and
+// have not expired
+func (c *ldapCache) Get(user, password string) ([]string, bool) {
+	groups, ok := c.entries.Get(c.cacheKey(user, password))
+	if !ok {
+		return nil, false
+	}
+	return groups.([]string), true
+}
+
+// Set caches the groups for the credentials for the TTL of the cache
+func (c *ldapCache) Set(user, password string, groups []string) {
+	c.entries.Set(c.cacheKey(user, password), groups, c.entries.Clock.Now().Add(c.ttl))
+}
+
+func (c *ldapCache) cacheKey(user, password string) string {
+	mac := hmac.New(sha256.New, c.key)
+	_, _ = mac.Write([]byte(user))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
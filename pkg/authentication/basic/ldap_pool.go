@@ -0,0 +1,119 @@
+package basic
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapPool keeps idle LDAP connections bound with the bind DN so that they
+// can be reused across validations
+type ldapPool struct {
+	url          string
+	startTLS     bool
+	tlsConfig    *tls.Config
+	bindDN       string
+	bindPassword string
+	timeout      time.Duration
+
+	idle chan *ldap.Conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Get returns an idle connection, or opens a new one if there is none
+func (p *ldapPool) Get() (*ldap.Conn, error) {
+	for {
+		select {
+		case conn := <-p.idle:
+			if conn.IsClosing() {
+				continue
+			}
+			return conn, nil
+		default:
+			return p.dial()
+		}
+	}
+}
+
+// Put binds the connection with the bind DN again and keeps it for reuse.
+// The connection is closed if the pool is full or the bind fails.
+func (p *ldapPool) Put(conn *ldap.Conn) {
+	if err := p.bind(conn); err != nil {
+		conn.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		conn.Close()
+		return
+	}
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Close closes the idle connections. Connections in use are closed when
+// they are put back.
+func (p *ldapPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *ldapPool) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(p.url,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.timeout}),
+		ldap.DialWithTLSConfig(p.tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.timeout)
+
+	if p.startTLS {
+		if err := conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not start TLS: %v", err)
+		}
+	}
+
+	if err := p.bind(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// bind binds the connection with the bind DN, or anonymously if there is no
+// bind DN
+func (p *ldapPool) bind(conn *ldap.Conn) error {
+	if p.bindDN == "" {
+		if err := conn.UnauthenticatedBind(""); err != nil {
+			return fmt.Errorf("could not bind anonymously: %v", err)
+		}
+		return nil
+	}
+
+	if err := conn.Bind(p.bindDN, p.bindPassword); err != nil {
+		return fmt.Errorf("could not bind as %s: %v", p.bindDN, err)
+	}
+	return nil
+}
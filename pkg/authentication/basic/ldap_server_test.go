@@ -0,0 +1,344 @@
+package basic
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/gomega"
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// testLDAPEntry is an entry held by the testLDAPServer.
+// Attribute names are lower case.
+type testLDAPEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// testLDAPServer is a minimal in-process LDAP server.
+// It supports simple binds, searches with and, or, not, equality, presence
+// and LDAP_MATCHING_RULE_IN_CHAIN filters, StartTLS and LDAPS.
+// Searches are only allowed for the searchDN.
+type testLDAPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	searchDN  string
+	entries   []testLDAPEntry
+
+	mu          sync.Mutex
+	connections int
+	binds       int
+	conns       []net.Conn
+}
+
+// newTestLDAPServer starts a server listening on a random local port.
+// The listener serves TLS directly when ldaps is set.
+func newTestLDAPServer(tlsConfig *tls.Config, ldaps bool, searchDN string, entries []testLDAPEntry) *testLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	if ldaps {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	s := &testLDAPServer{
+		listener:  listener,
+		tlsConfig: tlsConfig,
+		searchDN:  searchDN,
+		entries:   entries,
+	}
+	go s.accept()
+	return s
+}
+
+// Addr returns the host:port of the server
+func (s *testLDAPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes all connections
+func (s *testLDAPServer) Close() {
+	_ = s.listener.Close()
+	s.CloseConnections()
+}
+
+// CloseConnections closes all open connections, as a server restart would
+func (s *testLDAPServer) CloseConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+// Connections returns the number of connections accepted
+func (s *testLDAPServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// Binds returns the number of bind requests received
+func (s *testLDAPServer) Binds() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binds
+}
+
+func (s *testLDAPServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.connections++
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, code := s.bind(packetString(op.Children[1]), packetString(op.Children[2]))
+			boundDN = dn
+			writePacket(conn, testLDAPResponse(messageID, ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			if !strings.EqualFold(boundDN, s.searchDN) {
+				writePacket(conn, testLDAPResponse(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			for _, entry := range s.search(packetString(op.Children[0]), op.Children[6]) {
+				writePacket(conn, testLDAPSearchEntry(messageID, entry))
+			}
+			writePacket(conn, testLDAPResponse(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationExtendedRequest:
+			if packetString(op.Children[0]) != startTLSOID {
+				writePacket(conn, testLDAPResponse(messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+				continue
+			}
+			writePacket(conn, testLDAPResponse(messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess))
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+
+		default:
+			// Unbind and any unsupported operation end the connection
+			return
+		}
+	}
+}
+
+// bind returns the DN bound as and the result code of the bind
+func (s *testLDAPServer) bind(dn, password string) (string, uint16) {
+	s.mu.Lock()
+	s.binds++
+	s.mu.Unlock()
+
+	if dn == "" && password == "" {
+		return "", ldap.LDAPResultSuccess
+	}
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.dn, dn) && entry.password != "" && entry.password == password {
+			return entry.dn, ldap.LDAPResultSuccess
+		}
+	}
+	return "", ldap.LDAPResultInvalidCredentials
+}
+
+func (s *testLDAPServer) search(baseDN string, filter *ber.Packet) []testLDAPEntry {
+	results := []testLDAPEntry{}
+	for _, entry := range s.entries {
+		dn := strings.ToLower(entry.dn)
+		base := strings.ToLower(baseDN)
+		if (dn == base || strings.HasSuffix(dn, ","+base)) && s.match(filter, entry) {
+			results = append(results, entry)
+		}
+	}
+	return results
+}
+
+func (s *testLDAPServer) match(filter *ber.Packet, entry testLDAPEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !s.match(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if s.match(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !s.match(filter.Children[0], entry)
+	case ldap.FilterPresent:
+		return len(entry.attributes[strings.ToLower(packetString(filter))]) > 0
+	case ldap.FilterEqualityMatch:
+		return hasValue(entry.attributes[strings.ToLower(packetString(filter.Children[0]))], packetString(filter.Children[1]))
+	case ldap.FilterExtensibleMatch:
+		var rule, attribute, value string
+		for _, child := range filter.Children {
+			switch child.Tag {
+			case ldap.MatchingRuleAssertionMatchingRule:
+				rule = packetString(child)
+			case ldap.MatchingRuleAssertionType:
+				attribute = strings.ToLower(packetString(child))
+			case ldap.MatchingRuleAssertionMatchValue:
+				value = packetString(child)
+			}
+		}
+		if rule != ldapMatchingRuleInChain || attribute != "member" {
+			return false
+		}
+		return s.memberInChain(entry, value, map[string]bool{})
+	default:
+		return false
+	}
+}
+
+// memberInChain checks if the member DN is a direct member of the group
+// entry, or a member of one of its member groups
+func (s *testLDAPServer) memberInChain(group testLDAPEntry, member string, visited map[string]bool) bool {
+	if visited[strings.ToLower(group.dn)] {
+		return false
+	}
+	visited[strings.ToLower(group.dn)] = true
+
+	for _, dn := range group.attributes["member"] {
+		if strings.EqualFold(dn, member) {
+			return true
+		}
+		for _, entry := range s.entries {
+			if strings.EqualFold(entry.dn, dn) && s.memberInChain(entry, member, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasValue(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func packetString(p *ber.Packet) string {
+	return p.Data.String()
+}
+
+func writePacket(conn net.Conn, p *ber.Packet) {
+	_, _ = conn.Write(p.Bytes())
+}
+
+func testLDAPEnvelope(messageID int64, op *ber.Packet) *ber.Packet {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	envelope.AppendChild(op)
+	return envelope
+}
+
+func testLDAPResponse(messageID int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return testLDAPEnvelope(messageID, op)
+}
+
+func testLDAPSearchEntry(messageID int64, entry testLDAPEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "Object Name"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return testLDAPEnvelope(messageID, op)
+}
+
+// newTestLDAPCertificate generates a self-signed certificate for 127.0.0.1
+// and returns the server TLS config with the PEM encoded certificate
+func newTestLDAPCertificate() (*tls.Config, []byte) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).ToNot(HaveOccurred())
+
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	Expect(err).ToNot(HaveOccurred())
+
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{"OAuth2 Proxy Test Suite"},
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	Expect(err).ToNot(HaveOccurred())
+
+	certOut := bytes.NewBuffer(nil)
+	Expect(pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: certBytes})).To(Succeed())
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{certBytes},
+			PrivateKey:  priv,
+		}},
+		MinVersion: tls.VersionTLS12,
+	}, certOut.Bytes()
+}
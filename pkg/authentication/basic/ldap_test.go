@@ -0,0 +1,338 @@
+package basic
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	ldapBindDN       = "cn=service,dc=example,dc=com"
+	ldapBindPassword = "s3rv1c3P455"
+	ldapUserBaseDN   = "ou=users,dc=example,dc=com"
+	ldapGroupBaseDN  = "ou=groups,dc=example,dc=com"
+)
+
+var _ = Describe("LDAP Suite", func() {
+	var tlsConfig *tls.Config
+	var dir, caFile string
+
+	entries := []testLDAPEntry{
+		{
+			dn:       ldapBindDN,
+			password: ldapBindPassword,
+		},
+		{
+			dn:       "uid=admin,ou=users,dc=example,dc=com",
+			password: adminPassword,
+			attributes: map[string][]string{
+				"objectclass": {"person"},
+				"uid":         {adminUser},
+				"memberof":    {"cn=developers,ou=groups,dc=example,dc=com", "cn=admins,ou=groups,dc=example,dc=com"},
+			},
+		},
+		{
+			dn:       "uid=user1,ou=users,dc=example,dc=com",
+			password: user1Password,
+			attributes: map[string][]string{
+				"objectclass": {"person"},
+				"uid":         {user1},
+			},
+		},
+		{
+			dn:       "uid=user2,ou=devices,dc=example,dc=com",
+			password: user2Password,
+			attributes: map[string][]string{
+				"objectclass": {"device"},
+				"uid":         {user2},
+			},
+		},
+		{
+			dn: "cn=developers,ou=groups,dc=example,dc=com",
+			attributes: map[string][]string{
+				"member": {"uid=admin,ou=users,dc=example,dc=com"},
+			},
+		},
+		{
+			dn: "cn=admins,ou=groups,dc=example,dc=com",
+			attributes: map[string][]string{
+				"member": {"uid=admin,ou=users,dc=example,dc=com"},
+			},
+		},
+		{
+			dn: "cn=engineering,ou=groups,dc=example,dc=com",
+			attributes: map[string][]string{
+				"member": {"cn=developers,ou=groups,dc=example,dc=com", "uid=user1,ou=users,dc=example,dc=com"},
+			},
+		},
+		{
+			dn: "cn=staff,ou=groups,dc=example,dc=com",
+			attributes: map[string][]string{
+				"member": {"cn=engineering,ou=groups,dc=example,dc=com"},
+			},
+		},
+	}
+
+	BeforeEach(func() {
+		var certPEM []byte
+		tlsConfig, certPEM = newTestLDAPCertificate()
+
+		var err error
+		dir, err = ioutil.TempDir("", "oauth2-proxy-ldap-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		caFile = filepath.Join(dir, "ca.pem")
+		Expect(ioutil.WriteFile(caFile, certPEM, 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	ldapOptions := func(url string) options.LDAP {
+		return options.LDAP{
+			URL:           url,
+			BindDN:        ldapBindDN,
+			BindPassword:  ldapBindPassword,
+			UserBaseDN:    ldapUserBaseDN,
+			UserAttribute: "uid",
+			UserFilter:    "(objectClass=person)",
+			GroupBaseDN:   ldapGroupBaseDN,
+			PoolSize:      2,
+			Timeout:       5 * time.Second,
+		}
+	}
+
+	Context("with an LDAP server", func() {
+		var server *testLDAPServer
+		var opts options.LDAP
+
+		BeforeEach(func() {
+			server = newTestLDAPServer(tlsConfig, false, ldapBindDN, entries)
+
+			opts = ldapOptions("ldap://" + server.Addr())
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		Context("with the memberOf attribute", func() {
+			var validator GroupValidator
+
+			BeforeEach(func() {
+				var err error
+				validator, err = NewLDAPValidator(opts)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("accepts the correct password and returns the groups of the user", func() {
+				groups, valid := validator.ValidateGroups(adminUser, adminPassword)
+				Expect(valid).To(BeTrue())
+				Expect(groups).To(Equal([]string{"developers", "admins"}))
+
+				Expect(validator.Validate(user1, user1Password)).To(BeTrue())
+			})
+
+			It("rejects an incorrect password", func() {
+				groups, valid := validator.ValidateGroups(adminUser, user1Password)
+				Expect(valid).To(BeFalse())
+				Expect(groups).To(BeNil())
+			})
+
+			It("rejects an empty password", func() {
+				Expect(validator.Validate(adminUser, "")).To(BeFalse())
+			})
+
+			It("rejects a non existent user", func() {
+				Expect(validator.Validate("ADMIN2", adminPassword)).To(BeFalse())
+			})
+
+			It("rejects a user that doesn't match the user filter", func() {
+				Expect(validator.Validate(user2, user2Password)).To(BeFalse())
+			})
+
+			It("escapes the username in the search filter", func() {
+				Expect(validator.Validate("*", adminPassword)).To(BeFalse())
+				Expect(validator.Validate("admin)(uid=*", adminPassword)).To(BeFalse())
+			})
+
+			It("reuses pooled connections", func() {
+				for i := 0; i < 3; i++ {
+					Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+					Expect(validator.Validate(user1, "BHEdgbtr")).To(BeFalse())
+				}
+				Expect(server.Connections()).To(Equal(1))
+			})
+
+			It("closes the pooled connections once closed", func() {
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				pool := validator.(*ldapValidator).pool
+				Expect(pool.idle).To(HaveLen(1))
+
+				Expect(validator.(io.Closer).Close()).To(Succeed())
+				Expect(pool.idle).To(BeEmpty())
+
+				// Connections opened afterwards are not kept
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				Expect(pool.idle).To(BeEmpty())
+			})
+
+			It("reconnects when the pooled connections were closed", func() {
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				server.CloseConnections()
+
+				Eventually(func() bool {
+					return validator.Validate(adminUser, adminPassword)
+				}, 5*time.Second, 10*time.Millisecond).Should(BeTrue())
+			})
+		})
+
+		Context("with nested groups", func() {
+			It("returns the direct and nested groups of the user", func() {
+				opts.NestedGroups = true
+				validator, err := NewLDAPValidator(opts)
+				Expect(err).ToNot(HaveOccurred())
+
+				groups, valid := validator.ValidateGroups(adminUser, adminPassword)
+				Expect(valid).To(BeTrue())
+				Expect(groups).To(ConsistOf("developers", "admins", "engineering", "staff"))
+
+				groups, valid = validator.ValidateGroups(user1, user1Password)
+				Expect(valid).To(BeTrue())
+				Expect(groups).To(ConsistOf("engineering", "staff"))
+			})
+		})
+
+		Context("with an invalid bind password", func() {
+			It("rejects all users", func() {
+				opts.BindPassword = "invalid"
+				validator, err := NewLDAPValidator(opts)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeFalse())
+			})
+		})
+
+		Context("with a cache", func() {
+			var validator *ldapValidator
+
+			BeforeEach(func() {
+				opts.CacheTTL = time.Minute
+				v, err := NewLDAPValidator(opts)
+				Expect(err).ToNot(HaveOccurred())
+
+				validator = v.(*ldapValidator)
+				validator.cache.entries.Clock.Set(time.Now())
+			})
+
+			It("doesn't query the server for cached credentials", func() {
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				binds := server.Binds()
+
+				groups, valid := validator.ValidateGroups(adminUser, adminPassword)
+				Expect(valid).To(BeTrue())
+				Expect(groups).To(ConsistOf("developers", "admins"))
+				Expect(server.Binds()).To(Equal(binds))
+			})
+
+			It("doesn't cache rejected credentials", func() {
+				Expect(validator.Validate(adminUser, user1Password)).To(BeFalse())
+				binds := server.Binds()
+
+				Expect(validator.Validate(adminUser, user1Password)).To(BeFalse())
+				Expect(server.Binds()).To(BeNumerically(">", binds))
+			})
+
+			It("doesn't use cached credentials for a different password", func() {
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				Expect(validator.Validate(adminUser, user1Password)).To(BeFalse())
+			})
+
+			It("queries the server again once the cache expired", func() {
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				binds := server.Binds()
+
+				Expect(validator.cache.entries.Clock.Add(2 * time.Minute)).To(Succeed())
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				Expect(server.Binds()).To(BeNumerically(">", binds))
+			})
+		})
+
+		Context("with StartTLS", func() {
+			BeforeEach(func() {
+				opts.StartTLS = true
+			})
+
+			It("validates credentials when the server certificate is trusted", func() {
+				opts.CAFile = caFile
+				validator, err := NewLDAPValidator(opts)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+			})
+
+			It("rejects credentials when the server certificate is not trusted", func() {
+				validator, err := NewLDAPValidator(opts)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeFalse())
+			})
+		})
+	})
+
+	Context("with an LDAPS server", func() {
+		var server *testLDAPServer
+		var opts options.LDAP
+
+		BeforeEach(func() {
+			server = newTestLDAPServer(tlsConfig, true, ldapBindDN, entries)
+
+			opts = ldapOptions("ldaps://" + server.Addr())
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("validates credentials when the server certificate is trusted", func() {
+			opts.CAFile = caFile
+			validator, err := NewLDAPValidator(opts)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+		})
+
+		It("validates credentials when verification is skipped", func() {
+			opts.InsecureSkipVerify = true
+			validator, err := NewLDAPValidator(opts)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+		})
+
+		It("rejects credentials when the server certificate is not trusted", func() {
+			validator, err := NewLDAPValidator(opts)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(validator.Validate(adminUser, adminPassword)).To(BeFalse())
+		})
+	})
+
+	Context("with an invalid CA file", func() {
+		It("returns an error", func() {
+			opts := ldapOptions("ldaps://127.0.0.1:636")
+			opts.CAFile = "./test/htpasswd-sha1.txt"
+
+			_, err := NewLDAPValidator(opts)
+			Expect(err).To(MatchError("no certificates found in LDAP CA file ./test/htpasswd-sha1.txt"))
+		})
+	})
+})
@@ -0,0 +1,161 @@
+package basic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// rehashQueueSize bounds the logins waiting to be rehashed
+const rehashQueueSize = 100
+
+// rehashFile collects bcrypt entries for users who logged in with a password
+// hashed with a weak scheme, so that they can be merged back into the
+// htpasswd file.
+// Passwords are hashed and written by a background goroutine so that logins
+// don't wait for bcrypt or the file to be rewritten.
+type rehashFile struct {
+	path  string
+	queue chan rehashRequest
+	// done is closed once the queued passwords have been written
+	done chan struct{}
+
+	mu sync.Mutex
+	// queued holds the users already queued by this process
+	queued map[string]bool
+	closed bool
+}
+
+type rehashRequest struct {
+	user     string
+	password string
+}
+
+func newRehashFile(path string) *rehashFile {
+	r := &rehashFile{
+		path:   path,
+		queue:  make(chan rehashRequest, rehashQueueSize),
+		done:   make(chan struct{}),
+		queued: make(map[string]bool),
+	}
+	go r.run()
+	return r
+}
+
+// Queue schedules the password of the user to be rehashed.
+// Each user is only rehashed once per process. Logins are not queued while
+// the queue is full, the user is rehashed on a later login instead.
+func (r *rehashFile) Queue(user, password string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed || r.queued[user] {
+		return
+	}
+	select {
+	case r.queue <- rehashRequest{user: user, password: password}:
+		r.queued[user] = true
+	default:
+	}
+}
+
+// Close stops queueing logins and waits for the queued passwords to be
+// written
+func (r *rehashFile) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	<-r.done
+	return nil
+}
+
+func (r *rehashFile) run() {
+	defer close(r.done)
+
+	for req := range r.queue {
+		if err := r.rehash(req.user, req.password); err != nil {
+			logger.Errorf("error rehashing the htpasswd entry for %s: %v", req.user, err)
+
+			// Try again on the next login of the user
+			r.mu.Lock()
+			delete(r.queued, req.user)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// rehash hashes the password with bcrypt and writes the entry for the user to
+// the file, replacing any previous entry for the user
+func (r *rehashFile) rehash(user, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %v", err)
+	}
+
+	entries, err := r.readEntries(user)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, fmt.Sprintf("%s:%s", user, hash))
+
+	if err := r.write(entries); err != nil {
+		return err
+	}
+	logger.Printf("Wrote a bcrypt htpasswd entry for %s to %s", user, r.path)
+	return nil
+}
+
+// readEntries returns the lines of the file except the entry of the user
+func (r *rehashFile) readEntries(user string) ([]string, error) {
+	content, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read htpasswd rehash file: %v", err)
+	}
+
+	entries := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || strings.HasPrefix(line, user+":") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries, nil
+}
+
+// write replaces the file with the entries
+func (r *rehashFile) write(entries []string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), "."+filepath.Base(r.path))
+	if err != nil {
+		return fmt.Errorf("could not create htpasswd rehash file: %v", err)
+	}
+	defer func() {
+		// The temporary file no longer exists once it has been renamed
+		_ = os.Remove(tmp.Name())
+	}()
+
+	_, err = tmp.WriteString(strings.Join(entries, "\n") + "\n")
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write htpasswd rehash file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("could not write htpasswd rehash file: %v", err)
+	}
+	return nil
+}
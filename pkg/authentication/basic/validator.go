@@ -5,3 +5,10 @@ package basic
 type Validator interface {
 	Validate(user, password string) bool
 }
+
+// GroupValidator is a Validator that also resolves the groups of the user
+// when their credentials are valid.
+type GroupValidator interface {
+	Validator
+	ValidateGroups(user, password string) ([]string, bool)
+}
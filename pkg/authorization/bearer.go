@@ -0,0 +1,181 @@
+package authorization
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// InsufficientScopeError is returned when a bearer token does not meet the
+// bearer token rules for a request
+type InsufficientScopeError struct {
+	// Scopes are the scopes required for the request
+	Scopes []string
+
+	// Reason describes the rule the token does not meet
+	Reason string
+}
+
+// Error describes the rule the token does not meet
+func (e *InsufficientScopeError) Error() string {
+	return "insufficient scope: " + e.Reason
+}
+
+// WWWAuthenticate returns the challenge of the WWW-Authenticate header of
+// the response rejecting the request (RFC 6750). The error description may
+// not contain double quotes or backslashes, so these are replaced.
+func (e *InsufficientScopeError) WWWAuthenticate() string {
+	description := strings.NewReplacer(`"`, "'", `\`, "/").Replace(e.Reason)
+	challenge := fmt.Sprintf("Bearer error=\"insufficient_scope\", error_description=\"%s\"", description)
+	if len(e.Scopes) > 0 {
+		challenge += fmt.Sprintf(", scope=%q", strings.Join(e.Scopes, " "))
+	}
+	return challenge
+}
+
+// BearerRules checks the claims of bearer tokens against the required
+// claims, the maximum token age and the scopes and claims required per route.
+type BearerRules struct {
+	maxAge time.Duration
+	claims []options.ClaimRequirement
+	routes []*bearerRoute
+}
+
+// bearerRoute is a compiled options.JWTBearerRoute
+type bearerRoute struct {
+	path    *regexp.Regexp
+	methods []string
+	scopes  []string
+	claims  []options.ClaimRequirement
+}
+
+// NewBearerRules compiles the bearer token rules of the options.
+// It returns nil when no rules are configured.
+func NewBearerRules(opts options.JWTBearer) (*BearerRules, error) {
+	if opts.MaxAge == nil && len(opts.Claims) == 0 && len(opts.Routes) == 0 {
+		return nil, nil
+	}
+
+	r := &BearerRules{
+		maxAge: opts.MaxAge.Duration(),
+		claims: opts.Claims,
+	}
+	for i, routeOpts := range opts.Routes {
+		route := &bearerRoute{
+			methods: routeOpts.Methods,
+			scopes:  routeOpts.Scopes,
+			claims:  routeOpts.Claims,
+		}
+		if routeOpts.Path != "" {
+			path, err := regexp.Compile(routeOpts.Path)
+			if err != nil {
+				return nil, fmt.Errorf("bearer token route %d has invalid path %q: %v", i, routeOpts.Path, err)
+			}
+			route.path = path
+		}
+		r.routes = append(r.routes, route)
+	}
+	return r, nil
+}
+
+// CheckSession checks the claims of the bearer token a session was loaded
+// from against the rules for the request
+func (r *BearerRules) CheckSession(method, path string, s *sessions.SessionState, now time.Time) error {
+	claims, err := TokenClaims(s.AccessToken)
+	if err != nil {
+		// Opaque tokens have no claims of their own, use the introspected ones
+		claims = introspectedClaims(s)
+	}
+	return r.Check(method, path, claims, now)
+}
+
+// introspectedClaims returns the claims of the introspection response of an
+// opaque bearer token, or rebuilds them from the session when they were not
+// kept.
+func introspectedClaims(s *sessions.SessionState) map[string]interface{} {
+	if s.IntrospectionClaims != nil {
+		return s.IntrospectionClaims
+	}
+	claims := map[string]interface{}{
+		"sub":   s.User,
+		"email": s.Email,
+		"scope": strings.Join(s.Scopes, " "),
+	}
+	if s.PreferredUsername != "" {
+		claims["username"] = s.PreferredUsername
+	}
+	if s.CreatedAt != nil {
+		claims["iat"] = float64(s.CreatedAt.Unix())
+	}
+	return claims
+}
+
+// Check returns an *InsufficientScopeError when the claims of a bearer token
+// do not meet the rules for the request
+func (r *BearerRules) Check(method, path string, claims map[string]interface{}, now time.Time) error {
+	if r.maxAge > 0 {
+		iat, ok := claims["iat"].(float64)
+		if !ok {
+			return &InsufficientScopeError{Reason: "token has no iat claim"}
+		}
+		if now.Sub(time.Unix(int64(iat), 0)) > r.maxAge {
+			return &InsufficientScopeError{Reason: fmt.Sprintf("token is older than %s", r.maxAge)}
+		}
+	}
+
+	if err := meetsClaimRequirements(r.claims, claims); err != nil {
+		return &InsufficientScopeError{Reason: err.Error()}
+	}
+
+	granted := tokenScopes(claims)
+	required := []string{}
+	var reason string
+	for _, route := range r.routes {
+		if !route.matches(method, path) {
+			continue
+		}
+		required = append(required, route.scopes...)
+		if reason != "" {
+			continue
+		}
+		if err := meetsClaimRequirements(route.claims, claims); err != nil {
+			reason = err.Error()
+		}
+		for _, scope := range route.scopes {
+			if reason == "" && !contains(granted, scope) {
+				reason = fmt.Sprintf("missing scope %q", scope)
+			}
+		}
+	}
+	if reason != "" {
+		return &InsufficientScopeError{Scopes: required, Reason: reason}
+	}
+	return nil
+}
+
+func (r *bearerRoute) matches(method, path string) bool {
+	if r.path != nil && !r.path.MatchString(path) {
+		return false
+	}
+	return len(r.methods) == 0 || containsFold(r.methods, method)
+}
+
+// tokenScopes returns the scopes granted in the space separated `scope`
+// claim (RFC 8693) or the `scp` claim, which some providers set as a list
+func tokenScopes(claims map[string]interface{}) []string {
+	scopes := []string{}
+	for _, claim := range []string{"scope", "scp"} {
+		value, ok := claims[claim]
+		if !ok || value == nil {
+			continue
+		}
+		for _, v := range claimValues(value) {
+			scopes = append(scopes, strings.Fields(v)...)
+		}
+	}
+	return scopes
+}
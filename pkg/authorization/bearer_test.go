@@ -0,0 +1,130 @@
+package authorization
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BearerRules", func() {
+	now := time.Unix(1600000000, 0)
+	maxAge := options.Duration(time.Hour)
+
+	jwtBearer := options.JWTBearer{
+		MaxAge: &maxAge,
+		Claims: []options.ClaimRequirement{
+			{Claim: "azp", Values: []string{"frontend", "cli"}},
+		},
+		Routes: []options.JWTBearerRoute{
+			{
+				Path:   "^/api/",
+				Scopes: []string{"api"},
+			},
+			{
+				Path:    "^/api/articles",
+				Methods: []string{http.MethodPost, http.MethodDelete},
+				Scopes:  []string{"articles:write"},
+			},
+			{
+				Path:   "^/api/admin",
+				Claims: []options.ClaimRequirement{{Claim: "roles", Values: []string{"admin"}}},
+			},
+		},
+	}
+
+	type checkTableInput struct {
+		method        string
+		path          string
+		claims        map[string]interface{}
+		expectedError error
+	}
+
+	DescribeTable("Check",
+		func(in checkTableInput) {
+			rules, err := NewBearerRules(jwtBearer)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = rules.Check(in.method, in.path, in.claims, now)
+			if in.expectedError != nil {
+				Expect(err).To(Equal(in.expectedError))
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		},
+		Entry("with no route matching", checkTableInput{
+			method: http.MethodGet,
+			path:   "/home",
+			claims: map[string]interface{}{"azp": "cli", "iat": float64(now.Unix())},
+		}),
+		Entry("with a token older than the maximum age", checkTableInput{
+			method:        http.MethodGet,
+			path:          "/home",
+			claims:        map[string]interface{}{"azp": "cli", "iat": float64(now.Add(-2 * time.Hour).Unix())},
+			expectedError: &InsufficientScopeError{Reason: "token is older than 1h0m0s"},
+		}),
+		Entry("with no iat claim", checkTableInput{
+			method:        http.MethodGet,
+			path:          "/home",
+			claims:        map[string]interface{}{"azp": "cli"},
+			expectedError: &InsufficientScopeError{Reason: "token has no iat claim"},
+		}),
+		Entry("with a required claim value missing", checkTableInput{
+			method:        http.MethodGet,
+			path:          "/home",
+			claims:        map[string]interface{}{"azp": "batch", "iat": float64(now.Unix())},
+			expectedError: &InsufficientScopeError{Reason: "claim \"azp\" has none of the required values"},
+		}),
+		Entry("with the scope claim granting the route scopes", checkTableInput{
+			method: http.MethodPost,
+			path:   "/api/articles",
+			claims: map[string]interface{}{"azp": "cli", "iat": float64(now.Unix()), "scope": "openid api articles:write"},
+		}),
+		Entry("with the scp claim granting the route scopes", checkTableInput{
+			method: http.MethodDelete,
+			path:   "/api/articles/1",
+			claims: map[string]interface{}{"azp": "cli", "iat": float64(now.Unix()), "scp": []interface{}{"api", "articles:write"}},
+		}),
+		Entry("with a scope of a matching route missing", checkTableInput{
+			method: http.MethodPost,
+			path:   "/api/articles",
+			claims: map[string]interface{}{"azp": "cli", "iat": float64(now.Unix()), "scope": "api"},
+			expectedError: &InsufficientScopeError{
+				Scopes: []string{"api", "articles:write"},
+				Reason: "missing scope \"articles:write\"",
+			},
+		}),
+		Entry("with the method of a route not matching", checkTableInput{
+			method: http.MethodGet,
+			path:   "/api/articles",
+			claims: map[string]interface{}{"azp": "cli", "iat": float64(now.Unix()), "scope": "api"},
+		}),
+		Entry("with a claim of a matching route missing", checkTableInput{
+			method: http.MethodGet,
+			path:   "/api/admin/users",
+			claims: map[string]interface{}{"azp": "cli", "iat": float64(now.Unix()), "scope": "api"},
+			expectedError: &InsufficientScopeError{
+				Scopes: []string{"api"},
+				Reason: "missing claim \"roles\"",
+			},
+		}),
+	)
+
+	It("returns no rules when none are configured", func() {
+		Expect(NewBearerRules(options.JWTBearer{})).To(BeNil())
+	})
+
+	It("rejects routes with an invalid path", func() {
+		_, err := NewBearerRules(options.JWTBearer{Routes: []options.JWTBearerRoute{{Path: "^/api/(public"}}})
+		Expect(err).To(MatchError("bearer token route 0 has invalid path \"^/api/(public\": error parsing regexp: missing closing ): `^/api/(public`"))
+	})
+
+	It("renders the WWW-Authenticate challenge", func() {
+		err := &InsufficientScopeError{Scopes: []string{"api", "articles:write"}, Reason: "missing scope \"articles:write\""}
+		Expect(err.WWWAuthenticate()).To(Equal("Bearer error=\"insufficient_scope\", error_description=\"missing scope 'articles:write'\", scope=\"api articles:write\""))
+		Expect(err.Error()).To(Equal("insufficient scope: missing scope \"articles:write\""))
+	})
+})
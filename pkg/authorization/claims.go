@@ -0,0 +1,73 @@
+package authorization
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// matchesClaims checks the ID token of the session meets all claim
+// requirements. Sessions without an ID token never match.
+func matchesClaims(requirements []options.ClaimRequirement, s *sessions.SessionState) bool {
+	claims, err := TokenClaims(s.IDToken)
+	if err != nil {
+		return false
+	}
+	return meetsClaimRequirements(requirements, claims) == nil
+}
+
+// meetsClaimRequirements checks the claims meet all requirements, and
+// describes the first requirement they don't meet
+func meetsClaimRequirements(requirements []options.ClaimRequirement, claims map[string]interface{}) error {
+	for _, requirement := range requirements {
+		value, ok := claims[requirement.Claim]
+		if !ok || value == nil {
+			return fmt.Errorf("missing claim %q", requirement.Claim)
+		}
+		if len(requirement.Values) > 0 && !containsAny(requirement.Values, claimValues(value)) {
+			return fmt.Errorf("claim %q has none of the required values", requirement.Claim)
+		}
+	}
+	return nil
+}
+
+// TokenClaims decodes the payload of a JWT such as the ID token.
+// The token was verified when the session was created so its signature is
+// not checked again.
+func TokenClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id_token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode id_token payload: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse id_token claims: %v", err)
+	}
+	return claims, nil
+}
+
+// claimValues converts a claim to the list of strings it is matched against
+func claimValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,246 @@
+package authorization
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/upstream"
+)
+
+// Decision is the outcome of evaluating the authorization rules for a request.
+type Decision struct {
+	// Allowed is true when the request may proceed.
+	Allowed bool
+
+	// UpstreamID is the upstream whose rules were evaluated.
+	// It is empty when no upstream serves the request path.
+	UpstreamID string
+
+	// RuleID identifies the rule that made the decision.
+	// It is empty when the default policy of the upstream applied.
+	RuleID string
+
+	// StepUp is set when the rules allow the request, but the session does
+	// not meet the authentication requirements of the upstream.
+	StepUp *StepUpRequiredError
+}
+
+// String describes the decision for the logs.
+func (d Decision) String() string {
+	rule := "default policy"
+	if d.RuleID != "" {
+		rule = fmt.Sprintf("rule %q", d.RuleID)
+	}
+	return fmt.Sprintf("%s of upstream %q", rule, d.UpstreamID)
+}
+
+// Engine evaluates the authorization rules configured for the upstreams.
+type Engine interface {
+	Authorize(method, path string, s *sessions.SessionState) Decision
+}
+
+// NewEngine constructs an Engine for the authorization rules of the
+// upstreams.
+func NewEngine(upstreams options.Upstreams) (Engine, error) {
+	matcher, err := upstream.NewMatcher(upstreams)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &engine{
+		matcher:  matcher,
+		policies: make(map[string]*upstreamPolicy),
+	}
+	for _, upstreamOpts := range upstreams {
+		if upstreamOpts.Authorization == nil {
+			continue
+		}
+		policy, err := newUpstreamPolicy(*upstreamOpts.Authorization)
+		if err != nil {
+			return nil, fmt.Errorf("invalid authorization rules for upstream %q: %v", upstreamOpts.ID, err)
+		}
+		e.policies[upstreamOpts.ID] = policy
+	}
+	return e, nil
+}
+
+// engine implements the Engine interface
+type engine struct {
+	matcher  *upstream.Matcher
+	policies map[string]*upstreamPolicy
+}
+
+// Authorize evaluates the rules of the upstream serving the path.
+// Requests to upstreams without rules are allowed.
+func (e *engine) Authorize(method, path string, s *sessions.SessionState) Decision {
+	upstreamID, ok := e.matcher.Match(path)
+	if !ok {
+		return Decision{Allowed: true}
+	}
+
+	policy, ok := e.policies[upstreamID]
+	if !ok {
+		return Decision{Allowed: true, UpstreamID: upstreamID}
+	}
+
+	decision := policy.authorize(method, path, s)
+	decision.UpstreamID = upstreamID
+	if decision.Allowed {
+		if params := StepUpParams(policy.authentication, s); params != nil {
+			decision.Allowed = false
+			decision.StepUp = &StepUpRequiredError{Requirements: policy.authentication, Params: params}
+		}
+	}
+	return decision
+}
+
+// upstreamPolicy holds the compiled rules of an upstream
+type upstreamPolicy struct {
+	rules          []*rule
+	defaultPolicy  options.AuthorizationPolicy
+	authentication *options.AuthenticationRequirements
+}
+
+func newUpstreamPolicy(opts options.UpstreamAuthorization) (*upstreamPolicy, error) {
+	policy := &upstreamPolicy{
+		defaultPolicy:  opts.DefaultPolicy,
+		authentication: opts.Authentication,
+	}
+	if policy.defaultPolicy == "" {
+		policy.defaultPolicy = options.AllowPolicy
+	}
+
+	for i, ruleOpts := range opts.Rules {
+		r, err := newRule(strconv.Itoa(i), ruleOpts)
+		if err != nil {
+			return nil, err
+		}
+		policy.rules = append(policy.rules, r)
+	}
+	return policy, nil
+}
+
+// authorize applies the first matching rule, or the default policy when no
+// rule matches
+func (p *upstreamPolicy) authorize(method, path string, s *sessions.SessionState) Decision {
+	for _, r := range p.rules {
+		if r.matches(method, path, s) {
+			return Decision{Allowed: r.policy == options.AllowPolicy, RuleID: r.id}
+		}
+	}
+	return Decision{Allowed: p.defaultPolicy == options.AllowPolicy}
+}
+
+// rule is a compiled options.AuthorizationRule
+type rule struct {
+	id           string
+	policy       options.AuthorizationPolicy
+	path         *regexp.Regexp
+	methods      []string
+	groups       []string
+	emails       []string
+	emailDomains []string
+	users        []string
+	claims       []options.ClaimRequirement
+}
+
+func newRule(defaultID string, opts options.AuthorizationRule) (*rule, error) {
+	r := &rule{
+		id:           opts.ID,
+		policy:       opts.Policy,
+		methods:      opts.Methods,
+		groups:       opts.Groups,
+		emails:       opts.Emails,
+		emailDomains: opts.EmailDomains,
+		users:        opts.Users,
+		claims:       opts.Claims,
+	}
+	if r.id == "" {
+		r.id = defaultID
+	}
+
+	switch r.policy {
+	case options.AllowPolicy, options.DenyPolicy:
+	default:
+		return nil, fmt.Errorf("rule %q has unknown policy %q", r.id, r.policy)
+	}
+
+	if opts.Path != "" {
+		path, err := regexp.Compile(opts.Path)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q has invalid path %q: %v", r.id, opts.Path, err)
+		}
+		r.path = path
+	}
+	return r, nil
+}
+
+// matches checks the request and the session meet all conditions of the rule
+func (r *rule) matches(method, path string, s *sessions.SessionState) bool {
+	if r.path != nil && !r.path.MatchString(path) {
+		return false
+	}
+	if len(r.methods) > 0 && !containsFold(r.methods, method) {
+		return false
+	}
+	if len(r.groups) > 0 && !containsAny(r.groups, s.Groups) {
+		return false
+	}
+	if len(r.emails) > 0 && !containsFold(r.emails, s.Email) {
+		return false
+	}
+	if len(r.emailDomains) > 0 && !hasEmailDomain(r.emailDomains, s.Email) {
+		return false
+	}
+	if len(r.users) > 0 && !contains(r.users, s.User) {
+		return false
+	}
+	if len(r.claims) > 0 && !matchesClaims(r.claims, s) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if contains(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEmailDomain(domains []string, email string) bool {
+	if email == "" {
+		return false
+	}
+	email = strings.ToLower(email)
+	for _, domain := range domains {
+		if strings.HasSuffix(email, "@"+strings.ToLower(domain)) {
+			return true
+		}
+	}
+	return false
+}
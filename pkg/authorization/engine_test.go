@@ -0,0 +1,201 @@
+package authorization
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+func newTestIDToken(claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	Expect(err).ToNot(HaveOccurred())
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+var _ = Describe("Engine", func() {
+	upstreams := options.Upstreams{
+		{ID: "app", Path: "/"},
+		{
+			ID:   "admin",
+			Path: "/admin/",
+			Authorization: &options.UpstreamAuthorization{
+				Rules: []options.AuthorizationRule{
+					{
+						ID:           "ops",
+						Policy:       options.AllowPolicy,
+						Groups:       []string{"ops"},
+						EmailDomains: []string{"corp.com"},
+					},
+				},
+				DefaultPolicy: options.DenyPolicy,
+			},
+		},
+		{
+			ID:   "api",
+			Path: "/api/",
+			Authorization: &options.UpstreamAuthorization{
+				Rules: []options.AuthorizationRule{
+					{
+						ID:      "public",
+						Policy:  options.AllowPolicy,
+						Path:    "^/api/public",
+						Methods: []string{http.MethodGet},
+					},
+					{
+						ID:     "blocked-user",
+						Policy: options.DenyPolicy,
+						Users:  []string{"mallory"},
+					},
+					{
+						ID:     "writers",
+						Policy: options.AllowPolicy,
+						Claims: []options.ClaimRequirement{
+							{Claim: "roles", Values: []string{"writer"}},
+							{Claim: "email_verified", Values: []string{"true"}},
+						},
+					},
+					{
+						Policy:  options.DenyPolicy,
+						Methods: []string{http.MethodPost, http.MethodDelete},
+					},
+					{
+						ID:     "john",
+						Policy: options.AllowPolicy,
+						Emails: []string{"john@example.com"},
+					},
+				},
+				DefaultPolicy: options.DenyPolicy,
+			},
+		},
+	}
+
+	type authorizeTableInput struct {
+		method           string
+		path             string
+		session          *sessions.SessionState
+		expectedDecision Decision
+	}
+
+	DescribeTable("Authorize",
+		func(in authorizeTableInput) {
+			engine, err := NewEngine(upstreams)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(engine.Authorize(in.method, in.path, in.session)).To(Equal(in.expectedDecision))
+		},
+		Entry("with an upstream without rules", authorizeTableInput{
+			method:           http.MethodGet,
+			path:             "/home",
+			session:          &sessions.SessionState{Email: "john@example.com"},
+			expectedDecision: Decision{Allowed: true, UpstreamID: "app"},
+		}),
+		Entry("with all conditions of a rule matching", authorizeTableInput{
+			method:           http.MethodGet,
+			path:             "/admin/users",
+			session:          &sessions.SessionState{Email: "jane@Corp.com", Groups: []string{"dev", "ops"}},
+			expectedDecision: Decision{Allowed: true, UpstreamID: "admin", RuleID: "ops"},
+		}),
+		Entry("with a single condition of a rule not matching", authorizeTableInput{
+			method:           http.MethodGet,
+			path:             "/admin/users",
+			session:          &sessions.SessionState{Email: "jane@example.com", Groups: []string{"ops"}},
+			expectedDecision: Decision{Allowed: false, UpstreamID: "admin"},
+		}),
+		Entry("with a path and method rule matching", authorizeTableInput{
+			method:           http.MethodGet,
+			path:             "/api/public/status",
+			session:          &sessions.SessionState{User: "mallory"},
+			expectedDecision: Decision{Allowed: true, UpstreamID: "api", RuleID: "public"},
+		}),
+		Entry("with the method of a rule not matching", authorizeTableInput{
+			method:           http.MethodPost,
+			path:             "/api/public/status",
+			session:          &sessions.SessionState{User: "mallory"},
+			expectedDecision: Decision{Allowed: false, UpstreamID: "api", RuleID: "blocked-user"},
+		}),
+		Entry("with ID token claims matching", authorizeTableInput{
+			method: http.MethodPost,
+			path:   "/api/articles",
+			session: &sessions.SessionState{
+				User:    "jane",
+				IDToken: newTestIDToken(map[string]interface{}{"roles": []string{"reader", "writer"}, "email_verified": true}),
+			},
+			expectedDecision: Decision{Allowed: true, UpstreamID: "api", RuleID: "writers"},
+		}),
+		Entry("with ID token claims not matching", authorizeTableInput{
+			method: http.MethodPost,
+			path:   "/api/articles",
+			session: &sessions.SessionState{
+				User:    "jane",
+				IDToken: newTestIDToken(map[string]interface{}{"roles": []string{"reader"}, "email_verified": true}),
+			},
+			expectedDecision: Decision{Allowed: false, UpstreamID: "api", RuleID: "3"},
+		}),
+		Entry("with a claim requirement and no ID token", authorizeTableInput{
+			method:           http.MethodDelete,
+			path:             "/api/articles",
+			session:          &sessions.SessionState{User: "jane"},
+			expectedDecision: Decision{Allowed: false, UpstreamID: "api", RuleID: "3"},
+		}),
+		Entry("with an email rule matching", authorizeTableInput{
+			method:           http.MethodGet,
+			path:             "/api/articles",
+			session:          &sessions.SessionState{Email: "John@example.com"},
+			expectedDecision: Decision{Allowed: true, UpstreamID: "api", RuleID: "john"},
+		}),
+		Entry("with no rule matching", authorizeTableInput{
+			method:           http.MethodGet,
+			path:             "/api/articles",
+			session:          &sessions.SessionState{Email: "jane@example.com"},
+			expectedDecision: Decision{Allowed: false, UpstreamID: "api"},
+		}),
+	)
+
+	type newEngineTableInput struct {
+		authorization *options.UpstreamAuthorization
+		expectedError string
+	}
+
+	DescribeTable("NewEngine",
+		func(in newEngineTableInput) {
+			_, err := NewEngine(options.Upstreams{
+				{ID: "app", Path: "/"},
+				{ID: "api", Path: "/api/", Authorization: in.authorization},
+			})
+			if in.expectedError != "" {
+				Expect(err).To(MatchError(in.expectedError))
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		},
+		Entry("with valid rules", newEngineTableInput{
+			authorization: upstreams[2].Authorization,
+		}),
+		Entry("without rules", newEngineTableInput{
+			authorization: nil,
+		}),
+		Entry("with an unknown policy", newEngineTableInput{
+			authorization: &options.UpstreamAuthorization{
+				Rules: []options.AuthorizationRule{{Policy: "maybe"}},
+			},
+			expectedError: "invalid authorization rules for upstream \"api\": rule \"0\" has unknown policy \"maybe\"",
+		}),
+		Entry("with an invalid path", newEngineTableInput{
+			authorization: &options.UpstreamAuthorization{
+				Rules: []options.AuthorizationRule{{ID: "bad", Policy: options.AllowPolicy, Path: "^/api/(public"}},
+			},
+			expectedError: "invalid authorization rules for upstream \"api\": rule \"bad\" has invalid path \"^/api/(public\": error parsing regexp: missing closing ): `^/api/(public`",
+		}),
+	)
+
+	It("renders decisions for the logs", func() {
+		Expect(Decision{UpstreamID: "api", RuleID: "public"}.String()).To(Equal("rule \"public\" of upstream \"api\""))
+		Expect(Decision{UpstreamID: "api"}.String()).To(Equal("default policy of upstream \"api\""))
+	})
+})
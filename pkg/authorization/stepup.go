@@ -0,0 +1,53 @@
+package authorization
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// StepUpRequiredError is returned when a session does not meet the
+// authentication requirements of the upstream serving a request
+type StepUpRequiredError struct {
+	// Requirements are the authentication requirements of the upstream
+	Requirements *options.AuthenticationRequirements
+
+	// Params are the login URL parameters requesting the required
+	// authentication from the provider
+	Params url.Values
+}
+
+// Error describes the authentication the session is missing
+func (e *StepUpRequiredError) Error() string {
+	return "step-up authentication required: " + e.Params.Encode()
+}
+
+// StepUpParams returns the login URL parameters that request the
+// authentication required by the requirements from the provider.
+// It returns nil when the session meets the requirements.
+func StepUpParams(requirements *options.AuthenticationRequirements, s *sessions.SessionState) url.Values {
+	if requirements == nil {
+		return nil
+	}
+
+	params := url.Values{}
+	if len(requirements.AcrValues) > 0 && !contains(requirements.AcrValues, s.Acr) {
+		params.Set("acr_values", strings.Join(requirements.AcrValues, " "))
+	}
+	if requirements.MaxAge != nil {
+		maxAge := requirements.MaxAge.Duration()
+		if !s.AuthenticatedWithin(maxAge) {
+			params.Set("max_age", strconv.FormatInt(int64(maxAge/time.Second), 10))
+			params.Set("prompt", "login")
+		}
+	}
+
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
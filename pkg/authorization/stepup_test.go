@@ -0,0 +1,124 @@
+package authorization
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Step-up authentication", func() {
+	maxAge := options.Duration(5 * time.Minute)
+	requirements := &options.AuthenticationRequirements{
+		AcrValues: []string{"silver", "gold"},
+		MaxAge:    &maxAge,
+	}
+
+	sessionWith := func(acr string, authenticatedAgo time.Duration) *sessions.SessionState {
+		authTime := time.Now().Add(-authenticatedAgo)
+		return &sessions.SessionState{Email: "john@example.com", Acr: acr, AuthTime: &authTime}
+	}
+
+	type stepUpParamsTableInput struct {
+		requirements   *options.AuthenticationRequirements
+		session        *sessions.SessionState
+		expectedParams url.Values
+	}
+
+	DescribeTable("StepUpParams",
+		func(in stepUpParamsTableInput) {
+			Expect(StepUpParams(in.requirements, in.session)).To(Equal(in.expectedParams))
+		},
+		Entry("without requirements", stepUpParamsTableInput{
+			requirements:   nil,
+			session:        &sessions.SessionState{},
+			expectedParams: nil,
+		}),
+		Entry("with a session meeting the requirements", stepUpParamsTableInput{
+			requirements:   requirements,
+			session:        sessionWith("gold", time.Minute),
+			expectedParams: nil,
+		}),
+		Entry("with a session with another acr", stepUpParamsTableInput{
+			requirements: requirements,
+			session:      sessionWith("bronze", time.Minute),
+			expectedParams: url.Values{
+				"acr_values": []string{"silver gold"},
+			},
+		}),
+		Entry("with a session authenticated too long ago", stepUpParamsTableInput{
+			requirements: requirements,
+			session:      sessionWith("silver", time.Hour),
+			expectedParams: url.Values{
+				"max_age": []string{"300"},
+				"prompt":  []string{"login"},
+			},
+		}),
+		Entry("with a session without acr or authentication time", stepUpParamsTableInput{
+			requirements: requirements,
+			session:      &sessions.SessionState{},
+			expectedParams: url.Values{
+				"acr_values": []string{"silver gold"},
+				"max_age":    []string{"300"},
+				"prompt":     []string{"login"},
+			},
+		}),
+	)
+
+	Context("with authentication requirements on an upstream", func() {
+		var engine Engine
+
+		BeforeEach(func() {
+			upstreams := options.Upstreams{
+				{ID: "app", Path: "/"},
+				{
+					ID:   "admin",
+					Path: "/admin/",
+					Authorization: &options.UpstreamAuthorization{
+						Rules: []options.AuthorizationRule{
+							{ID: "corp", Policy: options.AllowPolicy, EmailDomains: []string{"example.com"}},
+						},
+						DefaultPolicy:  options.DenyPolicy,
+						Authentication: requirements,
+					},
+				},
+			}
+
+			var err error
+			engine, err = NewEngine(upstreams)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("allows sessions meeting the requirements", func() {
+			decision := engine.Authorize(http.MethodGet, "/admin/users", sessionWith("gold", time.Minute))
+			Expect(decision).To(Equal(Decision{Allowed: true, UpstreamID: "admin", RuleID: "corp"}))
+		})
+
+		It("requires a step-up of sessions not meeting the requirements", func() {
+			decision := engine.Authorize(http.MethodGet, "/admin/users", sessionWith("gold", time.Hour))
+			Expect(decision.Allowed).To(BeFalse())
+			Expect(decision.StepUp).To(Equal(&StepUpRequiredError{
+				Requirements: requirements,
+				Params:       url.Values{"max_age": []string{"300"}, "prompt": []string{"login"}},
+			}))
+			Expect(decision.StepUp.Error()).To(Equal("step-up authentication required: max_age=300&prompt=login"))
+		})
+
+		It("does not step up sessions the rules deny", func() {
+			session := sessionWith("bronze", time.Hour)
+			session.Email = "mallory@example.org"
+			decision := engine.Authorize(http.MethodGet, "/admin/users", session)
+			Expect(decision).To(Equal(Decision{Allowed: false, UpstreamID: "admin"}))
+		})
+
+		It("does not apply the requirements to other upstreams", func() {
+			decision := engine.Authorize(http.MethodGet, "/home", sessionWith("bronze", time.Hour))
+			Expect(decision).To(Equal(Decision{Allowed: true, UpstreamID: "app"}))
+		})
+	})
+})
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+)
+
+// Cache is a bounded in memory cache of values that expire.
+// Once it holds maxEntries values, the least recently used value is evicted
+// to make room for a new one.
+type Cache struct {
+	Clock clock.Clock
+
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds the entries ordered from most to least recently used
+	lru *list.List
+}
+
+type entry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// New creates an empty cache holding at most maxEntries values
+func New(maxEntries int) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// Get returns the value cached for the key if it has not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if !c.Clock.Now().Before(e.expiresAt) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return e.value, true
+}
+
+// Set caches the value for the key until expiresAt
+func (c *Cache) Set(key string, value interface{}, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	if !c.Clock.Now().Before(expiresAt) {
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Len returns the number of cached values, including the expired values that
+// have not been evicted yet
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*entry).key)
+}
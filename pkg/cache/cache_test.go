@@ -0,0 +1,72 @@
+package cache_test
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var c *cache.Cache
+	var now time.Time
+
+	BeforeEach(func() {
+		c = cache.New(3)
+		now = time.Now()
+		c.Clock.Set(now)
+	})
+
+	get := func(key string) interface{} {
+		value, ok := c.Get(key)
+		Expect(ok).To(BeTrue())
+		return value
+	}
+
+	It("returns cached values until they expire", func() {
+		c.Set("a", 1, now.Add(time.Minute))
+
+		Expect(get("a")).To(Equal(1))
+		_, ok := c.Get("b")
+		Expect(ok).To(BeFalse())
+
+		Expect(c.Clock.Add(time.Minute)).To(Succeed())
+		_, ok = c.Get("a")
+		Expect(ok).To(BeFalse())
+		Expect(c.Len()).To(Equal(0))
+	})
+
+	It("replaces the value of a key", func() {
+		c.Set("a", 1, now.Add(time.Minute))
+		c.Set("a", 2, now.Add(time.Minute))
+
+		Expect(get("a")).To(Equal(2))
+		Expect(c.Len()).To(Equal(1))
+	})
+
+	It("doesn't cache values that have already expired", func() {
+		c.Set("a", 1, now.Add(time.Minute))
+		c.Set("a", 2, now)
+
+		_, ok := c.Get("a")
+		Expect(ok).To(BeFalse())
+		Expect(c.Len()).To(Equal(0))
+	})
+
+	It("evicts the least recently used value once full", func() {
+		c.Set("a", 1, now.Add(time.Minute))
+		c.Set("b", 2, now.Add(time.Minute))
+		c.Set("c", 3, now.Add(time.Minute))
+		Expect(get("a")).To(Equal(1))
+
+		c.Set("d", 4, now.Add(time.Minute))
+
+		Expect(c.Len()).To(Equal(3))
+		_, ok := c.Get("b")
+		Expect(ok).To(BeFalse())
+		Expect(get("a")).To(Equal(1))
+		Expect(get("c")).To(Equal(3))
+		Expect(get("d")).To(Equal(4))
+	})
+})
@@ -11,8 +11,9 @@ import (
 )
 
 const (
-	csrfState = "1234asdf1234asdf1234asdf"
-	csrfNonce = "0987lkjh0987lkjh0987lkjh"
+	csrfState        = "1234asdf1234asdf1234asdf"
+	csrfNonce        = "0987lkjh0987lkjh0987lkjh"
+	csrfCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
 
 	cookieName   = "cookie_test_12345"
 	cookieSecret = "3q48hmFH30FJ2HfJF0239UFJCVcl3kj3"
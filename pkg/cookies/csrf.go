@@ -23,6 +23,19 @@ type CSRF interface {
 
 	SetSessionNonce(s *sessions.SessionState)
 
+	SetProviderID(string)
+	GetProviderID() string
+	CheckProviderID(string) bool
+
+	SetRedirect(string)
+	GetRedirect() string
+
+	SetCodeVerifier(string)
+	GetCodeVerifier() string
+
+	SetStepUp(*options.AuthenticationRequirements)
+	GetStepUp() *options.AuthenticationRequirements
+
 	SetCookie(http.ResponseWriter, *http.Request) (*http.Cookie, error)
 	ClearCookie(http.ResponseWriter, *http.Request)
 }
@@ -38,6 +51,24 @@ type csrf struct {
 	// is used to mitigate replay attacks.
 	OIDCNonce []byte `msgpack:"n,omitempty"`
 
+	// ProviderID holds the ID of the provider the authentication was started
+	// with. The provider selected by the state of the callback must match it.
+	ProviderID string `msgpack:"p,omitempty"`
+
+	// Redirect holds the application redirect of flows whose state cannot
+	// carry it, like the size limited SAML relay state.
+	Redirect string `msgpack:"r,omitempty"`
+
+	// CodeVerifier holds the PKCE code verifier whose code challenge was sent
+	// in the initial authentication request. It is sent with the code to the
+	// IdP when redeeming it.
+	CodeVerifier string `msgpack:"cv,omitempty"`
+
+	// StepUp holds the authentication requirements of the upstream that a
+	// step-up authentication was started for. The session created in the
+	// callback must meet them.
+	StepUp *options.AuthenticationRequirements `msgpack:"su,omitempty"`
+
 	cookieOpts *options.Cookie
 	time       clock.Clock
 }
@@ -97,6 +128,57 @@ func (c *csrf) SetSessionNonce(s *sessions.SessionState) {
 	s.Nonce = c.OIDCNonce
 }
 
+// SetProviderID sets the ID of the provider the authentication is started with
+func (c *csrf) SetProviderID(providerID string) {
+	c.ProviderID = providerID
+}
+
+// GetProviderID returns the ID of the provider the authentication was started
+// with
+func (c *csrf) GetProviderID() string {
+	return c.ProviderID
+}
+
+// CheckProviderID compares the provider ID of the CSRF against the provider ID
+// of a callback
+func (c *csrf) CheckProviderID(providerID string) bool {
+	return c.ProviderID == providerID
+}
+
+// SetRedirect sets the application redirect to return to after the
+// authentication
+func (c *csrf) SetRedirect(redirect string) {
+	c.Redirect = redirect
+}
+
+// GetRedirect returns the application redirect to return to after the
+// authentication
+func (c *csrf) GetRedirect() string {
+	return c.Redirect
+}
+
+// SetCodeVerifier sets the PKCE code verifier to redeem the code with
+func (c *csrf) SetCodeVerifier(codeVerifier string) {
+	c.CodeVerifier = codeVerifier
+}
+
+// GetCodeVerifier returns the PKCE code verifier, or an empty string if PKCE
+// was not used
+func (c *csrf) GetCodeVerifier() string {
+	return c.CodeVerifier
+}
+
+// SetStepUp sets the authentication requirements of a step-up authentication
+func (c *csrf) SetStepUp(requirements *options.AuthenticationRequirements) {
+	c.StepUp = requirements
+}
+
+// GetStepUp returns the authentication requirements of the step-up
+// authentication, or nil if the authentication was not a step-up
+func (c *csrf) GetStepUp() *options.AuthenticationRequirements {
+	return c.StepUp
+}
+
 // SetCookie encodes the CSRF to a signed cookie and sets it on the ResponseWriter
 func (c *csrf) SetCookie(rw http.ResponseWriter, req *http.Request) (*http.Cookie, error) {
 	encoded, err := c.encodeCookie()
@@ -137,7 +219,7 @@ func (c *csrf) encodeCookie() (string, error) {
 		return "", fmt.Errorf("error marshalling CSRF to msgpack: %v", err)
 	}
 
-	encrypted, err := encrypt(packed, c.cookieOpts)
+	encrypted, err := encrypt(packed, c.cookieOpts.Secret)
 	if err != nil {
 		return "", err
 	}
@@ -148,12 +230,13 @@ func (c *csrf) encodeCookie() (string, error) {
 // decodeCSRFCookie validates the signature then decrypts and decodes a CSRF
 // cookie into a CSRF struct
 func decodeCSRFCookie(cookie *http.Cookie, opts *options.Cookie) (*csrf, error) {
-	val, _, ok := encryption.Validate(cookie, opts.Secret, opts.Expire)
+	val, _, index, ok := encryption.ValidateAny(cookie, opts.Secrets(), opts.Expire)
 	if !ok {
 		return nil, errors.New("CSRF cookie failed validation")
 	}
 
-	decrypted, err := decrypt(val, opts)
+	// The CSRF cookie is encrypted with the secret it was signed with
+	decrypted, err := decrypt(val, opts.Secrets()[index])
 	if err != nil {
 		return nil, err
 	}
@@ -178,22 +261,22 @@ func csrfCookieName(opts *options.Cookie) string {
 	return fmt.Sprintf("%v_csrf", opts.Name)
 }
 
-func encrypt(data []byte, opts *options.Cookie) ([]byte, error) {
-	cipher, err := makeCipher(opts)
+func encrypt(data []byte, secret string) ([]byte, error) {
+	cipher, err := makeCipher(secret)
 	if err != nil {
 		return nil, err
 	}
 	return cipher.Encrypt(data)
 }
 
-func decrypt(data []byte, opts *options.Cookie) ([]byte, error) {
-	cipher, err := makeCipher(opts)
+func decrypt(data []byte, secret string) ([]byte, error) {
+	cipher, err := makeCipher(secret)
 	if err != nil {
 		return nil, err
 	}
 	return cipher.Decrypt(data)
 }
 
-func makeCipher(opts *options.Cookie) (encryption.Cipher, error) {
-	return encryption.NewCFBCipher(encryption.SecretBytes(opts.Secret))
+func makeCipher(secret string) (encryption.Cipher, error) {
+	return encryption.NewCFBCipher(encryption.SecretBytes(secret))
 }
@@ -101,6 +101,78 @@ var _ = Describe("CSRF Cookie Tests", func() {
 			Expect(decoded).ToNot(BeNil())
 			Expect(decoded.OAuthState).To(Equal([]byte(csrfState)))
 			Expect(decoded.OIDCNonce).To(Equal([]byte(csrfNonce)))
+			Expect(decoded.GetCodeVerifier()).To(BeEmpty())
+		})
+
+		It("encodes and decodes the code verifier", func() {
+			publicCSRF.SetCodeVerifier(csrfCodeVerifier)
+
+			encoded, err := privateCSRF.encodeCookie()
+			Expect(err).ToNot(HaveOccurred())
+
+			cookie := &http.Cookie{
+				Name:  privateCSRF.cookieName(),
+				Value: encoded,
+			}
+			decoded, err := decodeCSRFCookie(cookie, cookieOpts)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(decoded.GetCodeVerifier()).To(Equal(csrfCodeVerifier))
+		})
+
+		It("encodes and decodes the provider ID", func() {
+			publicCSRF.SetProviderID("providerB")
+
+			encoded, err := privateCSRF.encodeCookie()
+			Expect(err).ToNot(HaveOccurred())
+
+			cookie := &http.Cookie{
+				Name:  privateCSRF.cookieName(),
+				Value: encoded,
+			}
+			decoded, err := decodeCSRFCookie(cookie, cookieOpts)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(decoded.GetProviderID()).To(Equal("providerB"))
+			Expect(decoded.CheckProviderID("providerB")).To(BeTrue())
+			Expect(decoded.CheckProviderID("providerA")).To(BeFalse())
+		})
+
+		It("encodes and decodes the application redirect", func() {
+			publicCSRF.SetRedirect("/app?foo=bar")
+
+			encoded, err := privateCSRF.encodeCookie()
+			Expect(err).ToNot(HaveOccurred())
+
+			cookie := &http.Cookie{
+				Name:  privateCSRF.cookieName(),
+				Value: encoded,
+			}
+			decoded, err := decodeCSRFCookie(cookie, cookieOpts)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(decoded.GetRedirect()).To(Equal("/app?foo=bar"))
+		})
+
+		It("encodes and decodes the step-up requirements", func() {
+			maxAge := options.Duration(5 * time.Minute)
+			requirements := &options.AuthenticationRequirements{
+				AcrValues: []string{"silver", "gold"},
+				MaxAge:    &maxAge,
+			}
+			publicCSRF.SetStepUp(requirements)
+
+			encoded, err := privateCSRF.encodeCookie()
+			Expect(err).ToNot(HaveOccurred())
+
+			cookie := &http.Cookie{
+				Name:  privateCSRF.cookieName(),
+				Value: encoded,
+			}
+			decoded, err := decodeCSRFCookie(cookie, cookieOpts)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(decoded.GetStepUp()).To(Equal(requirements))
 		})
 
 		It("signs the encoded cookie value", func() {
@@ -115,6 +187,29 @@ var _ = Describe("CSRF Cookie Tests", func() {
 			_, _, valid := encryption.Validate(cookie, cookieOpts.Secret, cookieOpts.Expire)
 			Expect(valid).To(BeTrue())
 		})
+
+		It("decodes cookies encoded with a previous secret", func() {
+			privateCSRF.OAuthState = []byte(csrfState)
+
+			encoded, err := privateCSRF.encodeCookie()
+			Expect(err).ToNot(HaveOccurred())
+
+			cookie := &http.Cookie{
+				Name:  privateCSRF.cookieName(),
+				Value: encoded,
+			}
+
+			rotated := *cookieOpts
+			rotated.Secret = "0123456789abcdefghijklmnopqrstuv"
+			rotated.PreviousSecrets = []string{cookieOpts.Secret}
+			decoded, err := decodeCSRFCookie(cookie, &rotated)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded.OAuthState).To(Equal([]byte(csrfState)))
+
+			rotated.PreviousSecrets = nil
+			_, err = decodeCSRFCookie(cookie, &rotated)
+			Expect(err).To(MatchError("CSRF cookie failed validation"))
+		})
 	})
 
 	Context("Cookie Management", func() {
@@ -0,0 +1,41 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+const (
+	// CodeChallengeMethodPlain uses the code verifier as the code challenge
+	CodeChallengeMethodPlain = "plain"
+
+	// CodeChallengeMethodS256 uses the SHA-256 hash of the code verifier as
+	// the code challenge
+	CodeChallengeMethodS256 = "S256"
+)
+
+// GenerateCodeVerifier generates a random PKCE code verifier.
+// See https://tools.ietf.org/html/rfc7636#section-4.1
+func GenerateCodeVerifier() (string, error) {
+	b, err := Nonce()
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GenerateCodeChallenge derives the PKCE code challenge of a code verifier
+// with the given method.
+// See https://tools.ietf.org/html/rfc7636#section-4.2
+func GenerateCodeChallenge(method, codeVerifier string) (string, error) {
+	switch method {
+	case CodeChallengeMethodPlain:
+		return codeVerifier, nil
+	case CodeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(codeVerifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+	default:
+		return "", fmt.Errorf("unknown code challenge method %q", method)
+	}
+}
@@ -0,0 +1,34 @@
+package encryption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCodeVerifier(t *testing.T) {
+	verifier, err := GenerateCodeVerifier()
+	assert.NoError(t, err)
+	assert.Len(t, verifier, 43)
+	assert.Regexp(t, "^[A-Za-z0-9_-]+$", verifier)
+
+	other, err := GenerateCodeVerifier()
+	assert.NoError(t, err)
+	assert.NotEqual(t, verifier, other)
+}
+
+func TestGenerateCodeChallenge(t *testing.T) {
+	// Example from https://tools.ietf.org/html/rfc7636#appendix-B
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	challenge, err := GenerateCodeChallenge(CodeChallengeMethodS256, verifier)
+	assert.NoError(t, err)
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", challenge)
+
+	challenge, err = GenerateCodeChallenge(CodeChallengeMethodPlain, verifier)
+	assert.NoError(t, err)
+	assert.Equal(t, verifier, challenge)
+
+	_, err = GenerateCodeChallenge("S512", verifier)
+	assert.EqualError(t, err, "unknown code challenge method \"S512\"")
+}
@@ -63,6 +63,18 @@ func Validate(cookie *http.Cookie, seed string, expiration time.Duration) (value
 	return
 }
 
+// ValidateAny ensures a cookie is properly signed with any of the seeds.
+// It also returns the index of the seed the cookie was signed with, so that
+// values encrypted with a rotated secret can be decrypted.
+func ValidateAny(cookie *http.Cookie, seeds []string, expiration time.Duration) (value []byte, t time.Time, index int, ok bool) {
+	for i, seed := range seeds {
+		if value, t, ok = Validate(cookie, seed, expiration); ok {
+			return value, t, i, true
+		}
+	}
+	return nil, time.Time{}, -1, false
+}
+
 // SignedValue returns a cookie that is signed and can later be checked with Validate
 func SignedValue(seed string, key string, value []byte, now time.Time) (string, error) {
 	encodedValue := base64.URLEncoding.EncodeToString(value)
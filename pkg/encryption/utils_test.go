@@ -7,7 +7,9 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -100,3 +102,22 @@ func TestSignAndValidate(t *testing.T) {
 	assert.False(t, checkSignature(sha256sig, seed, key, "tampered", epoch))
 	assert.False(t, checkSignature(sha1sig, seed, key, "tampered", epoch))
 }
+
+func TestValidateAny(t *testing.T) {
+	previous := "0123456789abcdef"
+	current := "fedcba9876543210"
+	value := []byte("I am soooo encoded")
+
+	signed, err := SignedValue(previous, "cookie-name", value, time.Now())
+	assert.NoError(t, err)
+	cookie := &http.Cookie{Name: "cookie-name", Value: signed}
+
+	validated, _, index, ok := ValidateAny(cookie, []string{current, previous}, time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, 1, index)
+	assert.Equal(t, value, validated)
+
+	_, _, index, ok = ValidateAny(cookie, []string{current}, time.Hour)
+	assert.False(t, ok)
+	assert.Equal(t, -1, index)
+}
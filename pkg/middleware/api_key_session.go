@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/justinas/alice"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authentication/apikey"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
+)
+
+// apiKeyHeader is the header machine clients may send their API key in
+// instead of a bearer Authorization header
+const apiKeyHeader = "X-API-Key"
+
+// NewAPIKeySessionLoader creates a new middleware that loads sessions for the
+// API keys of machine clients held by the store.
+func NewAPIKeySessionLoader(store *apikey.Store) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return loadAPIKeySession(store, next)
+	}
+}
+
+// loadAPIKeySession attempts to load a session from an API key stored in an
+// X-API-Key header or a bearer Authorization header within the request.
+// If no known API key is found, no session will be loaded and the request
+// will be passed to the next handler, so that bearer JWTs can still be
+// loaded by a later handler.
+// If a session was loaded by a previous handler, it will not be replaced.
+func loadAPIKeySession(store *apikey.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		scope := middlewareapi.GetRequestScope(req)
+		// If scope is nil, this will panic.
+		// A scope should always be injected before this handler is called.
+		if scope.Session != nil {
+			// The session was already loaded, pass to the next handler
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		// Add the session to the scope if it was found
+		scope.Session = getAPIKeySession(store, req)
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// getAPIKeySession creates a session for the identity of the API key in the
+// request if the key is known, has not expired and is allowed for the route.
+func getAPIKeySession(store *apikey.Store, req *http.Request) *sessionsapi.SessionState {
+	apiKey := req.Header.Get(apiKeyHeader)
+	fromAPIKeyHeader := apiKey != ""
+	if !fromAPIKeyHeader {
+		tokenType, token, err := splitAuthHeader(req.Header.Get("Authorization"))
+		if err != nil || tokenType != "Bearer" {
+			return nil
+		}
+		apiKey = token
+	}
+
+	key := store.Lookup(apiKey)
+	if key == nil {
+		// Bearer tokens that are not API keys may be JWTs
+		if fromAPIKeyHeader {
+			logger.PrintAuthf("", req, logger.AuthFailure, "Invalid authentication via API key: unknown key")
+		}
+		return nil
+	}
+
+	user := key.User
+	if user == "" {
+		user = key.Email
+	}
+
+	now := time.Now()
+	if key.IsExpired(now) {
+		logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via API key: key expired at %s", key.ExpiresAt)
+		return nil
+	}
+	// Auth requests are checked against the route of the original request,
+	// any other request against its own route
+	method, path := requestutil.GetAuthorizationRoute(req)
+	if !key.IsAllowed(method, path) {
+		logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via API key: route %s %s not allowed", method, path)
+		return nil
+	}
+
+	logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via API key")
+	return &sessionsapi.SessionState{
+		User:      user,
+		Email:     key.Email,
+		Groups:    key.Groups,
+		CreatedAt: &now,
+		ExpiresOn: key.ExpiresAt,
+	}
+}
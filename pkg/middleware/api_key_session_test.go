@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authentication/apikey"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	ciAPIKey      = "ci-0d4e9b1a7c2f4e8b"
+	expiredAPIKey = "expired-5b8e2d7c1a9f"
+)
+
+var _ = Describe("API Key Session Suite", func() {
+	Context("APIKeySessionLoader", func() {
+		var dir string
+		var store *apikey.Store
+		expiresAt := time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "oauth2-proxy-api-key-session-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			hashKey := func(apiKey string) string {
+				hash := sha256.Sum256([]byte(apiKey))
+				return hex.EncodeToString(hash[:])
+			}
+			filePath := filepath.Join(dir, "api-keys.yaml")
+			Expect(ioutil.WriteFile(filePath, []byte(fmt.Sprintf(`
+keys:
+- sha256: %s
+  user: ci
+  email: ci@example.com
+  groups: [deployers]
+  expiresAt: 2999-01-01T00:00:00Z
+  allowedRoutes: ["POST=^/api/deploy", "^/api/status$"]
+- sha256: %s
+  email: expired@example.com
+  expiresAt: 2020-01-01T00:00:00Z
+`, hashKey(ciAPIKey), hashKey(expiredAPIKey))), 0600)).To(Succeed())
+
+			store, err = apikey.NewFileStore(filePath)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(store.Close()).To(Succeed())
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		type apiKeySessionLoaderTableInput struct {
+			method              string
+			path                string
+			apiKeyHeader        string
+			authorizationHeader string
+			authRequest         bool
+			reverseProxy        bool
+			forwardedMethod     string
+			forwardedURI        string
+			existingSession     *sessionsapi.SessionState
+			expectedSession     *sessionsapi.SessionState
+		}
+
+		DescribeTable("with an API key",
+			func(in apiKeySessionLoaderTableInput) {
+				scope := &middlewareapi.RequestScope{
+					AuthRequest:  in.authRequest,
+					ReverseProxy: in.reverseProxy,
+					Session:      in.existingSession,
+				}
+
+				req := httptest.NewRequest(in.method, in.path, nil)
+				if in.apiKeyHeader != "" {
+					req.Header.Set("X-API-Key", in.apiKeyHeader)
+				}
+				if in.authorizationHeader != "" {
+					req.Header.Set("Authorization", in.authorizationHeader)
+				}
+				if in.forwardedMethod != "" {
+					req.Header.Set("X-Forwarded-Method", in.forwardedMethod)
+				}
+				if in.forwardedURI != "" {
+					req.Header.Set("X-Forwarded-Uri", in.forwardedURI)
+				}
+				req = middlewareapi.AddRequestScope(req, scope)
+
+				// Create the handler with a next handler that will capture the session
+				// from the scope
+				var gotSession *sessionsapi.SessionState
+				handler := NewAPIKeySessionLoader(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					gotSession = middlewareapi.GetRequestScope(r).Session
+				}))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+
+				if in.expectedSession == nil || in.existingSession != nil {
+					Expect(gotSession).To(Equal(in.expectedSession))
+					return
+				}
+				Expect(gotSession).ToNot(BeNil())
+				Expect(gotSession.CreatedAt).ToNot(BeNil())
+				gotSession.CreatedAt = nil
+				Expect(gotSession).To(Equal(in.expectedSession))
+			},
+			Entry("without an API key", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/api/status",
+				expectedSession: nil,
+			}),
+			Entry("with a valid key in the X-API-Key header", apiKeySessionLoaderTableInput{
+				method:       "GET",
+				path:         "/api/status",
+				apiKeyHeader: ciAPIKey,
+				expectedSession: &sessionsapi.SessionState{
+					User:      "ci",
+					Email:     "ci@example.com",
+					Groups:    []string{"deployers"},
+					ExpiresOn: &expiresAt,
+				},
+			}),
+			Entry("with a valid key as a bearer token", apiKeySessionLoaderTableInput{
+				method:              "POST",
+				path:                "/api/deploy/app",
+				authorizationHeader: "Bearer " + ciAPIKey,
+				expectedSession: &sessionsapi.SessionState{
+					User:      "ci",
+					Email:     "ci@example.com",
+					Groups:    []string{"deployers"},
+					ExpiresOn: &expiresAt,
+				},
+			}),
+			Entry("with a valid key for a route that is not allowed", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/api/deploy/app",
+				apiKeyHeader:    ciAPIKey,
+				expectedSession: nil,
+			}),
+			Entry("with a valid key for the original route of an auth request", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/oauth2/auth",
+				apiKeyHeader:    ciAPIKey,
+				authRequest:     true,
+				forwardedMethod: "POST",
+				forwardedURI:    "/api/deploy/app?version=2",
+				expectedSession: &sessionsapi.SessionState{
+					User:      "ci",
+					Email:     "ci@example.com",
+					Groups:    []string{"deployers"},
+					ExpiresOn: &expiresAt,
+				},
+			}),
+			Entry("with a valid key for an original route of an auth request that is not allowed", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/oauth2/auth",
+				apiKeyHeader:    ciAPIKey,
+				authRequest:     true,
+				forwardedURI:    "/admin",
+				expectedSession: nil,
+			}),
+			Entry("with a forwarded route that is not trusted", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/admin",
+				apiKeyHeader:    ciAPIKey,
+				forwardedURI:    "/api/status",
+				expectedSession: nil,
+			}),
+			Entry("with a forwarded route of a proxied request", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/admin",
+				apiKeyHeader:    ciAPIKey,
+				reverseProxy:    true,
+				forwardedURI:    "/api/status",
+				expectedSession: nil,
+			}),
+			Entry("with an expired key", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/api/status",
+				apiKeyHeader:    expiredAPIKey,
+				expectedSession: nil,
+			}),
+			Entry("with an unknown key", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/api/status",
+				apiKeyHeader:    "unknown",
+				expectedSession: nil,
+			}),
+			Entry("with an unknown bearer token", apiKeySessionLoaderTableInput{
+				method:              "GET",
+				path:                "/api/status",
+				authorizationHeader: "Bearer eyJhbGciOiJSUzI1NiJ9.e30.c2ln",
+				expectedSession:     nil,
+			}),
+			Entry("with basic auth", apiKeySessionLoaderTableInput{
+				method:              "GET",
+				path:                "/api/status",
+				authorizationHeader: "Basic YWRtaW46QWRtMW4xc3RyJHQwcg==",
+				expectedSession:     nil,
+			}),
+			Entry("with an existing session", apiKeySessionLoaderTableInput{
+				method:          "GET",
+				path:            "/api/status",
+				apiKeyHeader:    ciAPIKey,
+				existingSession: &sessionsapi.SessionState{User: "user"},
+				expectedSession: &sessionsapi.SessionState{User: "user"},
+			}),
+		)
+	})
+})
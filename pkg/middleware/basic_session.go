@@ -72,10 +72,20 @@ func getBasicSession(validator basic.Validator, sessionGroups []string, req *htt
 		return nil, err
 	}
 
-	if validator.Validate(user, password) {
+	// Validators that resolve the groups of the user replace the static
+	// session groups
+	groups := sessionGroups
+	var valid bool
+	if groupValidator, ok := validator.(basic.GroupValidator); ok {
+		groups, valid = groupValidator.ValidateGroups(user, password)
+	} else {
+		valid = validator.Validate(user, password)
+	}
+
+	if valid {
 		logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via basic auth and HTpasswd File")
 
-		return &sessionsapi.SessionState{User: user, Groups: sessionGroups}, nil
+		return &sessionsapi.SessionState{User: user, Groups: groups}, nil
 	}
 
 	logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via basic auth: not in Htpasswd File")
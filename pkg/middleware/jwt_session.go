@@ -5,29 +5,66 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/justinas/alice"
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 	k8serrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 const jwtRegexFormat = `^ey[IJ][a-zA-Z0-9_-]*\.ey[IJ][a-zA-Z0-9_-]*\.[a-zA-Z0-9_-]+$`
 
 func NewJwtSessionLoader(sessionLoaders []middlewareapi.TokenToSessionFunc) alice.Constructor {
+	return NewJwtSessionLoaderWithOptions(&JwtSessionLoaderOptions{
+		SessionLoaders: sessionLoaders,
+	})
+}
+
+// JwtSessionLoaderOptions contains all of the requirements to construct
+// a JWT session loader.
+type JwtSessionLoaderOptions struct {
+	// SessionLoaders verify JWT bearer tokens
+	SessionLoaders []middlewareapi.TokenToSessionFunc
+
+	// IntrospectionLoaders verify opaque bearer tokens, and JWTs
+	// that none of the SessionLoaders could verify
+	IntrospectionLoaders []middlewareapi.TokenToSessionFunc
+
+	// Rules are the claims, scopes and maximum age required of verified
+	// bearer tokens. Optional.
+	Rules BearerTokenRules
+}
+
+// BearerTokenRules checks the bearer token a session was loaded from
+// against the requirements for the request.
+type BearerTokenRules interface {
+	CheckSession(method, path string, session *sessionsapi.SessionState, now time.Time) error
+}
+
+// NewJwtSessionLoaderWithOptions creates a JWT session loader that also
+// accepts opaque bearer tokens when introspection loaders are configured
+// and checks verified tokens against the bearer token rules.
+func NewJwtSessionLoaderWithOptions(opts *JwtSessionLoaderOptions) alice.Constructor {
 	js := &jwtSessionLoader{
-		jwtRegex:       regexp.MustCompile(jwtRegexFormat),
-		sessionLoaders: sessionLoaders,
+		jwtRegex:             regexp.MustCompile(jwtRegexFormat),
+		sessionLoaders:       opts.SessionLoaders,
+		introspectionLoaders: opts.IntrospectionLoaders,
+		rules:                opts.Rules,
 	}
 	return js.loadSession
 }
 
 // jwtSessionLoader is responsible for loading sessions from JWTs in
-// Authorization headers.
+// Authorization headers, and from opaque bearer tokens when introspection
+// loaders are configured.
 type jwtSessionLoader struct {
-	jwtRegex       *regexp.Regexp
-	sessionLoaders []middlewareapi.TokenToSessionFunc
+	jwtRegex             *regexp.Regexp
+	sessionLoaders       []middlewareapi.TokenToSessionFunc
+	introspectionLoaders []middlewareapi.TokenToSessionFunc
+	rules                BearerTokenRules
 }
 
 // loadSession attempts to load a session from a JWT stored in an Authorization
@@ -51,6 +88,16 @@ func (j *jwtSessionLoader) loadSession(next http.Handler) http.Handler {
 			logger.Errorf("Error retrieving session from token in Authorization header: %v", err)
 		}
 
+		if session != nil && j.rules != nil {
+			method, path := requestutil.GetAuthorizationRoute(req)
+			err := j.rules.CheckSession(method, path, session, time.Now())
+			if err != nil {
+				logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via bearer token: %v", err)
+				scope.BearerTokenError = err
+				session = nil
+			}
+		}
+
 		// Add the session to the scope if it was found
 		scope.Session = session
 		next.ServeHTTP(rw, req)
@@ -71,9 +118,15 @@ func (j *jwtSessionLoader) getJwtSession(req *http.Request) (*sessionsapi.Sessio
 		return nil, err
 	}
 
+	loaders := j.introspectionLoaders
+	if j.jwtRegex.MatchString(token) {
+		// JWTs may also be access tokens that can only be introspected
+		loaders = append(append([]middlewareapi.TokenToSessionFunc{}, j.sessionLoaders...), j.introspectionLoaders...)
+	}
+
 	// This leading error message only occurs if all session loaders fail
 	errs := []error{errors.New("unable to verify bearer token")}
-	for _, loader := range j.sessionLoaders {
+	for _, loader := range loaders {
 		session, err := loader(req.Context(), token)
 		if err != nil {
 			errs = append(errs, err)
@@ -97,6 +150,11 @@ func (j *jwtSessionLoader) findTokenFromHeader(header string) (string, error) {
 		return token, nil
 	}
 
+	if tokenType == "Bearer" && len(j.introspectionLoaders) > 0 && token != "" {
+		// Opaque bearer tokens can only be verified by introspection
+		return token, nil
+	}
+
 	if tokenType == "Basic" {
 		// Check if we have a Bearer token masquerading in Basic
 		return j.getBasicToken(token)
@@ -16,7 +16,9 @@ import (
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/golang-jwt/jwt"
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authorization"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -165,6 +167,263 @@ Nnc3a3lGVWFCNUMxQnNJcnJMTWxka1dFaHluYmI4Ongtb2F1dGgtYmFzaWM=`
 
 	})
 
+	Context("JwtSessionLoader with introspection", func() {
+		const opaqueToken = "2YotnFZFEjr1zCsicMWpAA"
+		introspectedSession := &sessionsapi.SessionState{
+			AccessToken: opaqueToken,
+			User:        "introspected",
+		}
+
+		type introspectionTableInput struct {
+			authorizationHeader string
+			expectedSession     *sessionsapi.SessionState
+			expectedCalls       int
+		}
+
+		DescribeTable("with an authorization header",
+			func(in introspectionTableInput) {
+				verifier := oidc.NewVerifier(
+					"https://issuer.example.com",
+					noOpKeySet{},
+					&oidc.Config{
+						ClientID:        "https://test.myapp.com",
+						SkipExpiryCheck: true,
+					},
+				).Verify
+
+				calls := 0
+				introspect := func(_ context.Context, token string) (*sessionsapi.SessionState, error) {
+					calls++
+					if token != opaqueToken {
+						return nil, errors.New("bearer token is not active")
+					}
+					return introspectedSession, nil
+				}
+
+				req := httptest.NewRequest("", "/", nil)
+				req.Header.Set("Authorization", in.authorizationHeader)
+				req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+
+				var gotSession *sessionsapi.SessionState
+				handler := NewJwtSessionLoaderWithOptions(&JwtSessionLoaderOptions{
+					SessionLoaders:       []middlewareapi.TokenToSessionFunc{middlewareapi.CreateTokenToSessionFunc(verifier)},
+					IntrospectionLoaders: []middlewareapi.TokenToSessionFunc{introspect},
+				})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					gotSession = middlewareapi.GetRequestScope(r).Session
+				}))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+
+				Expect(gotSession).To(Equal(in.expectedSession))
+				Expect(calls).To(Equal(in.expectedCalls))
+			},
+			Entry("Bearer <opaqueToken>", introspectionTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", opaqueToken),
+				expectedSession:     introspectedSession,
+				expectedCalls:       1,
+			}),
+			Entry("Bearer <inactiveToken>", introspectionTableInput{
+				authorizationHeader: "Bearer inactive",
+				expectedSession:     nil,
+				expectedCalls:       1,
+			}),
+			Entry("Bearer <verifiedToken>", introspectionTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", verifiedToken),
+				expectedSession:     verifiedSession,
+				expectedCalls:       0,
+			}),
+			Entry("Bearer <nonVerifiedToken>", introspectionTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", validToken),
+				expectedSession:     nil,
+				expectedCalls:       1,
+			}),
+			Entry("Basic Base64(any-user:any-password)", introspectionTableInput{
+				authorizationHeader: "Basic YW55LXVzZXI6YW55LXBhc3N3b3Jk",
+				expectedSession:     nil,
+				expectedCalls:       0,
+			}),
+		)
+	})
+
+	Context("JwtSessionLoader with bearer token rules", func() {
+		const opaqueToken = "2YotnFZFEjr1zCsicMWpAA"
+		introspectedAt := time.Now()
+		maxAge := options.Duration(time.Hour)
+		introspectedSession := &sessionsapi.SessionState{
+			AccessToken: opaqueToken,
+			User:        "introspected",
+			Scopes:      []string{"read"},
+			CreatedAt:   &introspectedAt,
+			IntrospectionClaims: map[string]interface{}{
+				"active":    true,
+				"sub":       "introspected",
+				"scope":     "read",
+				"client_id": "reporting",
+				"iat":       float64(introspectedAt.Unix()),
+			},
+		}
+
+		type rulesTableInput struct {
+			authorizationHeader string
+			method              string
+			path                string
+			authRequest         bool
+			reverseProxy        bool
+			forwardedMethod     string
+			forwardedURI        string
+			jwtBearer           options.JWTBearer
+			expectedSession     *sessionsapi.SessionState
+			expectedError       error
+		}
+
+		DescribeTable("with an authorization header",
+			func(in rulesTableInput) {
+				verifier := oidc.NewVerifier(
+					"https://issuer.example.com",
+					noOpKeySet{},
+					&oidc.Config{
+						ClientID:        "https://test.myapp.com",
+						SkipExpiryCheck: true,
+					},
+				).Verify
+				introspect := func(_ context.Context, token string) (*sessionsapi.SessionState, error) {
+					return introspectedSession, nil
+				}
+
+				rules, err := authorization.NewBearerRules(in.jwtBearer)
+				Expect(err).ToNot(HaveOccurred())
+
+				path := in.path
+				if path == "" {
+					path = "/api/articles"
+				}
+				req := httptest.NewRequest(in.method, path, nil)
+				req.Header.Set("Authorization", in.authorizationHeader)
+				if in.forwardedMethod != "" {
+					req.Header.Set("X-Forwarded-Method", in.forwardedMethod)
+				}
+				if in.forwardedURI != "" {
+					req.Header.Set("X-Forwarded-Uri", in.forwardedURI)
+				}
+				req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{
+					AuthRequest:  in.authRequest,
+					ReverseProxy: in.reverseProxy,
+				})
+
+				var gotScope *middlewareapi.RequestScope
+				handler := NewJwtSessionLoaderWithOptions(&JwtSessionLoaderOptions{
+					SessionLoaders:       []middlewareapi.TokenToSessionFunc{middlewareapi.CreateTokenToSessionFunc(verifier)},
+					IntrospectionLoaders: []middlewareapi.TokenToSessionFunc{introspect},
+					Rules:                rules,
+				})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					gotScope = middlewareapi.GetRequestScope(r)
+				}))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+
+				Expect(gotScope.Session).To(Equal(in.expectedSession))
+				if in.expectedError != nil {
+					Expect(gotScope.BearerTokenError).To(Equal(in.expectedError))
+				} else {
+					Expect(gotScope.BearerTokenError).ToNot(HaveOccurred())
+				}
+			},
+			Entry("JWT meeting the required claims", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", verifiedToken),
+				method:              http.MethodGet,
+				jwtBearer: options.JWTBearer{
+					Claims: []options.ClaimRequirement{{Claim: "email", Values: []string{"john@example.com"}}},
+				},
+				expectedSession: verifiedSession,
+			}),
+			Entry("JWT older than the maximum age", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", verifiedToken),
+				method:              http.MethodGet,
+				jwtBearer:           options.JWTBearer{MaxAge: &maxAge},
+				expectedSession:     nil,
+				expectedError:       &authorization.InsufficientScopeError{Reason: "token is older than 1h0m0s"},
+			}),
+			Entry("JWT without the scopes of the route", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", verifiedToken),
+				method:              http.MethodGet,
+				jwtBearer: options.JWTBearer{
+					Routes: []options.JWTBearerRoute{{Path: "^/api/", Scopes: []string{"read"}}},
+				},
+				expectedSession: nil,
+				expectedError: &authorization.InsufficientScopeError{
+					Scopes: []string{"read"},
+					Reason: "missing scope \"read\"",
+				},
+			}),
+			Entry("opaque token with the scopes of the route", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", opaqueToken),
+				method:              http.MethodGet,
+				jwtBearer: options.JWTBearer{
+					MaxAge: &maxAge,
+					Routes: []options.JWTBearerRoute{{Path: "^/api/", Scopes: []string{"read"}}},
+				},
+				expectedSession: introspectedSession,
+			}),
+			Entry("opaque token without the scopes of the route method", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", opaqueToken),
+				method:              http.MethodPost,
+				jwtBearer: options.JWTBearer{
+					Routes: []options.JWTBearerRoute{{Path: "^/api/", Methods: []string{http.MethodPost}, Scopes: []string{"write"}}},
+				},
+				expectedSession: nil,
+				expectedError: &authorization.InsufficientScopeError{
+					Scopes: []string{"write"},
+					Reason: "missing scope \"write\"",
+				},
+			}),
+			Entry("proxied request checked against its own route", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", opaqueToken),
+				method:              http.MethodPost,
+				reverseProxy:        true,
+				forwardedMethod:     http.MethodGet,
+				forwardedURI:        "/public",
+				jwtBearer: options.JWTBearer{
+					Routes: []options.JWTBearerRoute{{Path: "^/api/", Methods: []string{http.MethodPost}, Scopes: []string{"write"}}},
+				},
+				expectedSession: nil,
+				expectedError: &authorization.InsufficientScopeError{
+					Scopes: []string{"write"},
+					Reason: "missing scope \"write\"",
+				},
+			}),
+			Entry("opaque token meeting a required introspected claim", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", opaqueToken),
+				method:              http.MethodGet,
+				jwtBearer: options.JWTBearer{
+					Claims: []options.ClaimRequirement{{Claim: "client_id", Values: []string{"reporting"}}},
+				},
+				expectedSession: introspectedSession,
+			}),
+			Entry("opaque token not meeting a required introspected claim", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", opaqueToken),
+				method:              http.MethodGet,
+				jwtBearer: options.JWTBearer{
+					Claims: []options.ClaimRequirement{{Claim: "client_id", Values: []string{"billing"}}},
+				},
+				expectedSession: nil,
+				expectedError:   &authorization.InsufficientScopeError{Reason: "claim \"client_id\" has none of the required values"},
+			}),
+			Entry("auth request checked against the route of the original request", rulesTableInput{
+				authorizationHeader: fmt.Sprintf("Bearer %s", opaqueToken),
+				method:              http.MethodGet,
+				path:                "/oauth2/auth",
+				authRequest:         true,
+				forwardedURI:        "/admin/users",
+				jwtBearer: options.JWTBearer{
+					Routes: []options.JWTBearerRoute{{Path: "^/admin/", Scopes: []string{"admin"}}},
+				},
+				expectedSession: nil,
+				expectedError: &authorization.InsufficientScopeError{
+					Scopes: []string{"admin"},
+					Reason: "missing scope \"admin\"",
+				},
+			}),
+		)
+	})
+
 	Context("getJWTSession", func() {
 		var j *jwtSessionLoader
 		const nonVerifiedToken = validToken
@@ -120,3 +120,72 @@ func registerRequestsLatencyHistogram(registerer prometheus.Registerer) *prometh
 
 	return histogram
 }
+
+// registerSessionRefreshLockWaitHistogram registers
+// 'oauth2_proxy_session_refresh_lock_wait_seconds'
+// This keeps tally of the time requests waited for a concurrent refresh of
+// their session, bucketed by whether the wait ended in time
+func registerSessionRefreshLockWaitHistogram(registerer prometheus.Registerer) *prometheus.HistogramVec {
+	histogram := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "oauth2_proxy_session_refresh_lock_wait_seconds",
+			Help:    "A histogram of the time waited for the session lock before refreshing a session.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"result"},
+	)
+
+	if err := registerer.Register(histogram); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			histogram = are.ExistingCollector.(*prometheus.HistogramVec)
+		} else {
+			panic(err)
+		}
+	}
+
+	return histogram
+}
+
+// registerSessionRefreshesSharedCounter registers
+// 'oauth2_proxy_session_refreshes_shared_total'
+// This keeps a tally of the requests that used a session refreshed by a
+// concurrent request instead of refreshing it themselves
+func registerSessionRefreshesSharedCounter(registerer prometheus.Registerer) prometheus.Counter {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "oauth2_proxy_session_refreshes_shared_total",
+		Help: "Total number of session refreshes skipped as a concurrent request refreshed the session.",
+	})
+
+	if err := registerer.Register(counter); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			counter = are.ExistingCollector.(prometheus.Counter)
+		} else {
+			panic(err)
+		}
+	}
+
+	return counter
+}
+
+// registerSessionRefreshesCounter registers 'oauth2_proxy_session_refreshes_total'
+// This keeps a tally of the session refreshes bucketed by why the session
+// needed refreshing and the outcome of the refresh
+func registerSessionRefreshesCounter(registerer prometheus.Registerer) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oauth2_proxy_session_refreshes_total",
+			Help: "Total number of session refreshes by reason and result.",
+		},
+		[]string{"reason", "result"},
+	)
+
+	if err := registerer.Register(counter); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			counter = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			panic(err)
+		}
+	}
+
+	return counter
+}
@@ -31,3 +31,16 @@ func genRequestID(req *http.Request, idHeader string) string {
 	}
 	return uuid.New().String()
 }
+
+// NewAuthRequestScope marks the requests it serves as auth requests in the
+// request scope. It must be chained after NewScope.
+func NewAuthRequestScope() alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if scope := middlewareapi.GetRequestScope(req); scope != nil {
+				scope.AuthRequest = true
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
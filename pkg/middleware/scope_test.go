@@ -115,6 +115,25 @@ var _ = Describe("Scope Suite", func() {
 			})
 		})
 	})
+
+	Context("NewAuthRequestScope", func() {
+		It("marks the request scope as an auth request", func() {
+			request, err := http.NewRequest("", "http://127.0.0.1/oauth2/auth", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			var scope *middlewareapi.RequestScope
+			handler := NewScope(false, testRequestHeader)(NewAuthRequestScope()(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					scope = middlewareapi.GetRequestScope(r)
+					w.WriteHeader(200)
+				})))
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(scope).ToNot(BeNil())
+			Expect(scope.AuthRequest).To(BeTrue())
+			Expect(scope.ReverseProxy).To(BeFalse())
+		})
+	})
 })
 
 type mockRand struct{}
@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,6 +14,44 @@ import (
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	lockWaitObtained = "obtained"
+	lockWaitTimeout  = "timeout"
+	lockWaitError    = "error"
+
+	refreshReasonExpiry = "expiry"
+	refreshReasonPeriod = "period"
+
+	refreshResultSuccess = "success"
+	refreshResultShared  = "shared"
+	refreshResultError   = "error"
+)
+
+var (
+	// sessionRefreshLockDuration is how long the session lock is held for
+	// while a request refreshes the session
+	sessionRefreshLockDuration = 10 * time.Second
+
+	// sessionRefreshLockTimeout is how long a request waits for a concurrent
+	// refresh of the session before giving up on refreshing it
+	sessionRefreshLockTimeout = 10 * time.Second
+
+	// sessionRefreshRetryPeriod is the interval between attempts to obtain
+	// the session lock
+	sessionRefreshRetryPeriod = 50 * time.Millisecond
+
+	// sessionActivityInterval is the longest interval between the writes
+	// of the last activity of a session to the session store. Shorter idle
+	// timeouts write the activity every tenth of the timeout.
+	sessionActivityInterval = time.Minute
+
+	sessionRefreshLockWaits = registerSessionRefreshLockWaitHistogram(prometheus.DefaultRegisterer)
+	sessionRefreshesShared  = registerSessionRefreshesSharedCounter(prometheus.DefaultRegisterer)
+	sessionRefreshes        = registerSessionRefreshesCounter(prometheus.DefaultRegisterer)
 )
 
 // StoredSessionLoaderOptions contains all of the requirements to construct
@@ -31,6 +71,23 @@ type StoredSessionLoaderOptions struct {
 	// If the sesssion is older than `RefreshPeriod` but the provider doesn't
 	// refresh it, we must re-validate using this validation.
 	ValidateSession func(context.Context, *sessionsapi.SessionState) bool
+
+	// Refresh sessions when their access token expires within this duration,
+	// regardless of the refresh period.
+	// Expiry based refreshing is disabled when 0.
+	RefreshBeforeExpiry time.Duration
+
+	// End sessions without requests for this duration, and sessions older
+	// than the maximum lifetime since the user signed in, regardless of
+	// refreshes.
+	// The limits are disabled when 0.
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+
+	// IgnoreActivity reports requests that are not recorded as activity of
+	// the session, like polling the remaining session time.
+	// Optional, all requests are recorded when nil.
+	IgnoreActivity func(*http.Request) bool
 }
 
 // NewStoredSessionLoader creates a new storedSessionLoader which loads
@@ -43,6 +100,12 @@ func NewStoredSessionLoader(opts *StoredSessionLoaderOptions) alice.Constructor
 		refreshPeriod:    opts.RefreshPeriod,
 		sessionRefresher: opts.RefreshSession,
 		sessionValidator: opts.ValidateSession,
+
+		refreshBeforeExpiry: opts.RefreshBeforeExpiry,
+
+		idleTimeout:    opts.IdleTimeout,
+		maxLifetime:    opts.MaxLifetime,
+		ignoreActivity: opts.IgnoreActivity,
 	}
 	return ss.loadSession
 }
@@ -54,6 +117,16 @@ type storedSessionLoader struct {
 	refreshPeriod    time.Duration
 	sessionRefresher func(context.Context, *sessionsapi.SessionState) (bool, error)
 	sessionValidator func(context.Context, *sessionsapi.SessionState) bool
+
+	refreshBeforeExpiry time.Duration
+
+	idleTimeout    time.Duration
+	maxLifetime    time.Duration
+	ignoreActivity func(*http.Request) bool
+
+	// refreshes shares the refreshes of sessions without a session lock
+	// between the concurrent requests of this instance
+	refreshes singleflight.Group
 }
 
 // loadSession attempts to load a session as identified by the request cookies.
@@ -83,6 +156,7 @@ func (s *storedSessionLoader) loadSession(next http.Handler) http.Handler {
 
 		// Add the session to the scope if it was found
 		scope.Session = session
+		scope.StoredSession = session != nil
 		next.ServeHTTP(rw, req)
 	})
 }
@@ -99,25 +173,117 @@ func (s *storedSessionLoader) getValidatedSession(rw http.ResponseWriter, req *h
 		return nil, nil
 	}
 
+	err = s.validateSessionLifetime(session)
+	if err != nil {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Session ended: %v", err)
+		return nil, err
+	}
+
 	err = s.refreshSessionIfNeeded(rw, req, session)
 	if err != nil {
 		return nil, fmt.Errorf("error refreshing access token for session (%s): %v", session, err)
 	}
 
+	s.recordActivity(rw, req, session)
 	return session, nil
 }
 
+// validateSessionLifetime checks that the session was not idle for longer
+// than the idle timeout, and that the user signed in less than the maximum
+// lifetime ago
+func (s *storedSessionLoader) validateSessionLifetime(session *sessionsapi.SessionState) error {
+	if s.idleTimeout > time.Duration(0) && session.IdleTimeoutRemaining(s.idleTimeout) <= 0 {
+		return fmt.Errorf("session was idle for longer than %s", s.idleTimeout)
+	}
+	if s.maxLifetime > time.Duration(0) && session.MaxLifetimeRemaining(s.maxLifetime) <= 0 {
+		return fmt.Errorf("session reached its maximum lifetime of %s", s.maxLifetime)
+	}
+	return nil
+}
+
+// recordActivity saves the time of the request as the last activity of the
+// session when the idle timeout is enabled.
+// Writes are throttled to one per activity interval, so the recorded
+// activity is at most that interval older than the last request.
+// Sessions that can be locked are only written while holding the session
+// lock, if another request holds it the activity is recorded later.
+func (s *storedSessionLoader) recordActivity(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) {
+	if s.idleTimeout <= time.Duration(0) || (s.ignoreActivity != nil && s.ignoreActivity(req)) {
+		return
+	}
+	if last := session.LastActivityAt; last != nil && session.Clock.Since(*last) < s.activityInterval() {
+		return
+	}
+
+	_, noOpLock := session.Lock.(*sessionsapi.NoOpLock)
+	if lock := session.Lock; lock != nil && !noOpLock {
+		if err := lock.Obtain(req.Context(), sessionRefreshLockDuration); err != nil {
+			if !errors.Is(err, sessionsapi.ErrLockNotObtained) {
+				logger.Errorf("Unable to obtain session lock to record activity: %v", err)
+			}
+			return
+		}
+		defer func() {
+			if err := lock.Release(req.Context()); err != nil {
+				logger.Errorf("Unable to release session lock: %v", err)
+			}
+		}()
+
+		// Keep the changes of concurrent requests, like refreshed tokens
+		reloaded, err := s.store.Load(primaryRead(req))
+		if err != nil || reloaded == nil {
+			logger.Errorf("Unable to reload session to record activity: %v", err)
+			return
+		}
+		*session = *reloaded
+	}
+
+	now := session.Clock.Now()
+	session.LastActivityAt = &now
+	if err := s.store.Save(rw, req, session); err != nil {
+		logger.PrintAuthf(session.Email, req, logger.AuthError, "error saving session activity: %v", err)
+	}
+}
+
+// activityInterval returns the interval between the writes of the last
+// activity of sessions
+func (s *storedSessionLoader) activityInterval() time.Duration {
+	if interval := s.idleTimeout / 10; interval < sessionActivityInterval {
+		return interval
+	}
+	return sessionActivityInterval
+}
+
 // refreshSessionIfNeeded will attempt to refresh a session if the session
-// is older than the refresh period.
+// is older than the refresh period, or its access token is about to expire.
+// Only a single request refreshes the session at a time, concurrent requests
+// wait for the refresh and continue with the refreshed session.
 // Success or fail, we will then validate the session.
 func (s *storedSessionLoader) refreshSessionIfNeeded(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) error {
-	if s.refreshPeriod <= time.Duration(0) || session.Age() < s.refreshPeriod {
+	reason := s.refreshReason(session)
+	if reason == "" {
 		// Refresh is disabled or the session is not old enough, do nothing
 		return nil
 	}
 
-	logger.Printf("Refreshing session - User: %s; SessionAge: %s", session.User, session.Age())
-	err := s.refreshSession(rw, req, session)
+	_, noOpLock := session.Lock.(*sessionsapi.NoOpLock)
+	locked := session.Lock != nil && !noOpLock
+
+	var shared bool
+	var err error
+	if locked {
+		shared, err = s.refreshSessionLocked(rw, req, session)
+	} else {
+		// The session store can't lock sessions, only share the refresh
+		// between the requests of this instance
+		shared, err = s.refreshSessionShared(rw, req, session)
+	}
+	sessionRefreshes.WithLabelValues(reason, refreshResult(shared, err)).Inc()
+
+	if locked && shared && err == nil {
+		// A concurrent request refreshed and validated the session
+		return nil
+	}
 	if err != nil {
 		// If a preemptive refresh fails, we still keep the session
 		// if validateSession succeeds.
@@ -128,12 +294,190 @@ func (s *storedSessionLoader) refreshSessionIfNeeded(rw http.ResponseWriter, req
 	return s.validateSession(req.Context(), session)
 }
 
+// refreshReason returns why the session needs refreshing, or an empty string
+// if it doesn't.
+// Sessions are refreshed when their access token expires within the
+// refreshBeforeExpiry duration, or when they are older than the refresh
+// period.
+// Expiry is only considered for sessions with a refresh token, as other
+// sessions can't extend the lifetime of their access token.
+func (s *storedSessionLoader) refreshReason(session *sessionsapi.SessionState) string {
+	if s.refreshBeforeExpiry > time.Duration(0) && session.RefreshToken != "" && session.ExpiresWithin(s.refreshBeforeExpiry) {
+		return refreshReasonExpiry
+	}
+	if s.refreshPeriod > time.Duration(0) && session.Age() >= s.refreshPeriod {
+		return refreshReasonPeriod
+	}
+	return ""
+}
+
+// refreshResult returns the outcome of a refresh for the refreshes metric
+func refreshResult(shared bool, err error) string {
+	switch {
+	case err != nil:
+		return refreshResultError
+	case shared:
+		return refreshResultShared
+	default:
+		return refreshResultSuccess
+	}
+}
+
+// refreshSessionLocked refreshes the session while holding the session lock.
+// Once the lock is obtained the session is reloaded from the store, if a
+// concurrent request refreshed it in the meantime the reloaded session is
+// used instead and true is returned.
+func (s *storedSessionLoader) refreshSessionLocked(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) (bool, error) {
+	lock := session.Lock
+	if err := s.obtainSessionLock(req.Context(), lock); err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := lock.Release(req.Context()); err != nil {
+			logger.Errorf("Unable to release session lock: %v", err)
+		}
+	}()
+
+	reloaded, err := s.store.Load(primaryRead(req))
+	if err != nil {
+		return false, fmt.Errorf("error reloading session: %v", err)
+	}
+	if reloaded == nil {
+		return false, errors.New("error reloading session: session not found")
+	}
+	*session = *reloaded
+
+	if s.refreshReason(session) == "" {
+		sessionRefreshesShared.Inc()
+		return true, nil
+	}
+
+	logger.Printf("Refreshing session - User: %s; SessionAge: %s", session.User, session.Age())
+	return false, s.refreshSession(rw, req, session)
+}
+
+// primaryRead returns the request to reload the session with once its lock is
+// obtained. The reload must see the changes saved by the previous holder of
+// the lock, which may not be on the replicas of the store yet.
+func primaryRead(req *http.Request) *http.Request {
+	return req.WithContext(sessionsapi.WithPrimaryRead(req.Context()))
+}
+
+// obtainSessionLock waits until the lock is obtained, or gives up once the
+// refresh lock timeout has passed
+func (s *storedSessionLoader) obtainSessionLock(ctx context.Context, lock sessionsapi.Lock) error {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, sessionRefreshLockTimeout)
+	defer cancel()
+
+	for {
+		err := lock.Obtain(ctx, sessionRefreshLockDuration)
+		switch {
+		case err == nil:
+			sessionRefreshLockWaits.WithLabelValues(lockWaitObtained).Observe(time.Since(start).Seconds())
+			return nil
+		case !errors.Is(err, sessionsapi.ErrLockNotObtained):
+			sessionRefreshLockWaits.WithLabelValues(lockWaitError).Observe(time.Since(start).Seconds())
+			return fmt.Errorf("error obtaining session lock: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			sessionRefreshLockWaits.WithLabelValues(lockWaitTimeout).Observe(time.Since(start).Seconds())
+			return fmt.Errorf("timed out after %s waiting for session lock", sessionRefreshLockTimeout)
+		case <-time.After(sessionRefreshRetryPeriod):
+		}
+	}
+}
+
+// refreshSessionShared refreshes sessions that can't be locked in the store,
+// like cookie sessions.
+// Concurrent requests for the same session in this instance wait for a single
+// refresh of a copy of the session, then each request saves the refreshed
+// session in its own response. True is returned when the refresh was made by
+// another request.
+func (s *storedSessionLoader) refreshSessionShared(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) (bool, error) {
+	start := time.Now()
+	leader := false
+	result := s.refreshes.DoChan(refreshKey(session), func() (interface{}, error) {
+		leader = true
+		refreshing := *session
+		logger.Printf("Refreshing session - User: %s; SessionAge: %s", refreshing.User, refreshing.Age())
+		refreshed, err := s.refreshTokens(req.Context(), &refreshing)
+		if err != nil || !refreshed {
+			return nil, err
+		}
+		return &refreshing, nil
+	})
+
+	timer := time.NewTimer(sessionRefreshLockTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-result:
+		shared := res.Shared && !leader
+		if shared {
+			sessionRefreshLockWaits.WithLabelValues(lockWaitObtained).Observe(time.Since(start).Seconds())
+		}
+		if res.Err != nil {
+			return false, res.Err
+		}
+		refreshed, _ := res.Val.(*sessionsapi.SessionState)
+		if refreshed == nil {
+			// Session not refreshed, nothing to persist
+			return false, nil
+		}
+
+		// The refreshed session is shared by the waiting requests, so it is
+		// only ever copied
+		*session = *refreshed
+		if err := s.saveSession(rw, req, session); err != nil {
+			return false, err
+		}
+		if shared {
+			sessionRefreshesShared.Inc()
+		}
+		return shared, nil
+	case <-timer.C:
+		sessionRefreshLockWaits.WithLabelValues(lockWaitTimeout).Observe(time.Since(start).Seconds())
+		return false, fmt.Errorf("timed out after %s waiting for session refresh", sessionRefreshLockTimeout)
+	}
+}
+
+// refreshKey identifies the concurrent requests that hold the same session
+func refreshKey(session *sessionsapi.SessionState) string {
+	var createdAt int64
+	if session.CreatedAt != nil {
+		createdAt = session.CreatedAt.UnixNano()
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%d",
+		session.Email, session.User, session.AccessToken, session.RefreshToken, createdAt)))
+	return hex.EncodeToString(hash[:])
+}
+
 // refreshSession attempts to refresh the session with the provider
 // and will save the session if it was updated.
 func (s *storedSessionLoader) refreshSession(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) error {
-	refreshed, err := s.sessionRefresher(req.Context(), session)
+	refreshed, err := s.refreshTokens(req.Context(), session)
+	if err != nil {
+		return err
+	}
+
+	// Session not refreshed, nothing to persist.
+	if !refreshed {
+		return nil
+	}
+
+	// Because the session was refreshed, make sure to save it
+	return s.saveSession(rw, req, session)
+}
+
+// refreshTokens refreshes the tokens of the session with the provider and
+// reports whether the session changed and needs saving.
+func (s *storedSessionLoader) refreshTokens(ctx context.Context, session *sessionsapi.SessionState) (bool, error) {
+	refreshed, err := s.sessionRefresher(ctx, session)
 	if err != nil && !errors.Is(err, providers.ErrNotImplemented) {
-		return fmt.Errorf("error refreshing tokens: %v", err)
+		return false, fmt.Errorf("error refreshing tokens: %v", err)
 	}
 
 	// HACK:
@@ -146,18 +490,17 @@ func (s *storedSessionLoader) refreshSession(rw http.ResponseWriter, req *http.R
 		refreshed = true
 	}
 
-	// Session not refreshed, nothing to persist.
-	if !refreshed {
-		return nil
+	if refreshed {
+		// If we refreshed, update the `CreatedAt` time to reset the refresh timer
+		// (In case underlying provider implementations forget)
+		session.CreatedAtNow()
 	}
+	return refreshed, nil
+}
 
-	// If we refreshed, update the `CreatedAt` time to reset the refresh timer
-	// (In case underlying provider implementations forget)
-	session.CreatedAtNow()
-
-	// Because the session was refreshed, make sure to save it
-	err = s.store.Save(rw, req, session)
-	if err != nil {
+// saveSession saves the refreshed session in the response
+func (s *storedSessionLoader) saveSession(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) error {
+	if err := s.store.Save(rw, req, session); err != nil {
 		logger.PrintAuthf(session.Email, req, logger.AuthError, "error saving session: %v", err)
 		return fmt.Errorf("error saving session: %v", err)
 	}
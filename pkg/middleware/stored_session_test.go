@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"time"
 
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
@@ -15,6 +16,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 var _ = Describe("Stored Session Suite", func() {
@@ -130,12 +132,16 @@ var _ = Describe("Stored Session Suite", func() {
 				// Create the handler with a next handler that will capture the session
 				// from the scope
 				var gotSession *sessionsapi.SessionState
+				var gotStoredSession bool
 				handler := NewStoredSessionLoader(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					gotSession = middlewareapi.GetRequestScope(r).Session
+					gotStoredSession = middlewareapi.GetRequestScope(r).StoredSession
 				}))
 				handler.ServeHTTP(rw, req)
 
 				Expect(gotSession).To(Equal(in.expectedSession))
+				// Sessions loaded by previous handlers are not stored sessions
+				Expect(gotStoredSession).To(Equal(in.existingSession == nil && in.expectedSession != nil))
 			},
 			Entry("with no cookie", storedSessionLoaderTableInput{
 				requestHeaders:  http.Header{},
@@ -275,10 +281,13 @@ var _ = Describe("Stored Session Suite", func() {
 			expectedErr     error
 			expectRefreshed bool
 			expectValidated bool
+
+			refreshBeforeExpiry time.Duration
 		}
 
 		createdPast := time.Now().Add(-5 * time.Minute)
 		createdFuture := time.Now().Add(5 * time.Minute)
+		expiresSoon := time.Now().Add(30 * time.Second)
 
 		DescribeTable("with a session",
 			func(in refreshSessionIfNeededTableInput) {
@@ -286,8 +295,9 @@ var _ = Describe("Stored Session Suite", func() {
 				validated := false
 
 				s := &storedSessionLoader{
-					refreshPeriod: in.refreshPeriod,
-					store:         &fakeSessionStore{},
+					refreshPeriod:       in.refreshPeriod,
+					refreshBeforeExpiry: in.refreshBeforeExpiry,
+					store:               &fakeSessionStore{},
 					sessionRefresher: func(_ context.Context, ss *sessionsapi.SessionState) (bool, error) {
 						refreshed = true
 						switch ss.RefreshToken {
@@ -400,7 +410,276 @@ var _ = Describe("Stored Session Suite", func() {
 				expectRefreshed: true,
 				expectValidated: true,
 			}),
+			Entry("when the access token expires within the refresh skew", refreshSessionIfNeededTableInput{
+				refreshPeriod:       1 * time.Hour,
+				refreshBeforeExpiry: 1 * time.Minute,
+				session: &sessionsapi.SessionState{
+					RefreshToken: refresh,
+					CreatedAt:    &createdPast,
+					ExpiresOn:    &expiresSoon,
+				},
+				expectedErr:     nil,
+				expectRefreshed: true,
+				expectValidated: true,
+			}),
+			Entry("when the access token doesn't expire within the refresh skew", refreshSessionIfNeededTableInput{
+				refreshPeriod:       1 * time.Hour,
+				refreshBeforeExpiry: 1 * time.Minute,
+				session: &sessionsapi.SessionState{
+					RefreshToken: refresh,
+					CreatedAt:    &createdPast,
+					ExpiresOn:    &createdFuture,
+				},
+				expectedErr:     nil,
+				expectRefreshed: false,
+				expectValidated: false,
+			}),
+			Entry("when the access token doesn't expire within the refresh skew, but the session needs refreshing", refreshSessionIfNeededTableInput{
+				refreshPeriod:       1 * time.Minute,
+				refreshBeforeExpiry: 1 * time.Minute,
+				session: &sessionsapi.SessionState{
+					RefreshToken: refresh,
+					CreatedAt:    &createdPast,
+					ExpiresOn:    &createdFuture,
+				},
+				expectedErr:     nil,
+				expectRefreshed: true,
+				expectValidated: true,
+			}),
+			Entry("when the access token expires within the refresh skew, but there is no refresh token", refreshSessionIfNeededTableInput{
+				refreshPeriod:       time.Duration(0),
+				refreshBeforeExpiry: 1 * time.Minute,
+				session: &sessionsapi.SessionState{
+					CreatedAt: &createdPast,
+					ExpiresOn: &expiresSoon,
+				},
+				expectedErr:     nil,
+				expectRefreshed: false,
+				expectValidated: false,
+			}),
 		)
+
+		It("counts the refreshes by reason and result", func() {
+			s := &storedSessionLoader{
+				refreshPeriod:       1 * time.Hour,
+				refreshBeforeExpiry: 1 * time.Minute,
+				store:               &fakeSessionStore{},
+				sessionRefresher: func(_ context.Context, ss *sessionsapi.SessionState) (bool, error) {
+					if ss.RefreshToken != refresh {
+						return false, errors.New("error refreshing session")
+					}
+					return true, nil
+				},
+				sessionValidator: func(_ context.Context, _ *sessionsapi.SessionState) bool {
+					return true
+				},
+			}
+			expirySuccess := testutil.ToFloat64(sessionRefreshes.WithLabelValues(refreshReasonExpiry, refreshResultSuccess))
+			expiryError := testutil.ToFloat64(sessionRefreshes.WithLabelValues(refreshReasonExpiry, refreshResultError))
+
+			req := httptest.NewRequest("", "/", nil)
+			Expect(s.refreshSessionIfNeeded(nil, req, &sessionsapi.SessionState{
+				RefreshToken: refresh,
+				CreatedAt:    &createdPast,
+				ExpiresOn:    &expiresSoon,
+			})).To(Succeed())
+			Expect(s.refreshSessionIfNeeded(nil, req, &sessionsapi.SessionState{
+				RefreshToken: "RefreshError",
+				CreatedAt:    &createdPast,
+				ExpiresOn:    &expiresSoon,
+			})).To(Succeed())
+
+			Expect(testutil.ToFloat64(sessionRefreshes.WithLabelValues(refreshReasonExpiry, refreshResultSuccess)) - expirySuccess).To(Equal(float64(1)))
+			Expect(testutil.ToFloat64(sessionRefreshes.WithLabelValues(refreshReasonExpiry, refreshResultError)) - expiryError).To(Equal(float64(1)))
+		})
+	})
+
+	Context("refreshSessionIfNeeded with a session lock", func() {
+		var s *storedSessionLoader
+		var lock *fakeLock
+		var stored *sessionsapi.SessionState
+		var refreshes, validations, saves, primaryReads int
+
+		createdPast := time.Now().Add(-5 * time.Minute)
+		createdNow := time.Now()
+
+		BeforeEach(func() {
+			refreshes, validations, saves, primaryReads = 0, 0, 0, 0
+			lock = &fakeLock{}
+			stored = &sessionsapi.SessionState{
+				RefreshToken: refresh,
+				CreatedAt:    &createdPast,
+			}
+
+			s = &storedSessionLoader{
+				refreshPeriod: 1 * time.Minute,
+				store: &fakeSessionStore{
+					LoadFunc: func(req *http.Request) (*sessionsapi.SessionState, error) {
+						if sessionsapi.IsPrimaryRead(req.Context()) {
+							primaryReads++
+						}
+						loaded := *stored
+						loaded.Lock = &fakeLock{}
+						return &loaded, nil
+					},
+					SaveFunc: func(_ http.ResponseWriter, _ *http.Request, _ *sessionsapi.SessionState) error {
+						saves++
+						return nil
+					},
+				},
+				sessionRefresher: func(_ context.Context, ss *sessionsapi.SessionState) (bool, error) {
+					refreshes++
+					ss.RefreshToken = "Refreshed"
+					return true, nil
+				},
+				sessionValidator: func(_ context.Context, _ *sessionsapi.SessionState) bool {
+					validations++
+					return true
+				},
+			}
+		})
+
+		newSession := func() *sessionsapi.SessionState {
+			return &sessionsapi.SessionState{
+				RefreshToken: refresh,
+				CreatedAt:    &createdPast,
+				Lock:         lock,
+			}
+		}
+
+		It("refreshes the reloaded session while holding the lock", func() {
+			session := newSession()
+			req := httptest.NewRequest("", "/", nil)
+			Expect(s.refreshSessionIfNeeded(nil, req, session)).To(Succeed())
+
+			Expect(refreshes).To(Equal(1))
+			Expect(saves).To(Equal(1))
+			Expect(validations).To(Equal(1))
+			Expect(session.RefreshToken).To(Equal("Refreshed"))
+			Expect(lock.obtained).To(Equal(1))
+			Expect(lock.held).To(BeFalse())
+			Expect(primaryReads).To(Equal(1))
+		})
+
+		It("uses the session refreshed by a concurrent request", func() {
+			lock.failures = 3
+			stored = &sessionsapi.SessionState{
+				RefreshToken: "Refreshed",
+				CreatedAt:    &createdNow,
+			}
+			shared := testutil.ToFloat64(sessionRefreshesShared)
+
+			session := newSession()
+			req := httptest.NewRequest("", "/", nil)
+			Expect(s.refreshSessionIfNeeded(nil, req, session)).To(Succeed())
+
+			Expect(refreshes).To(Equal(0))
+			Expect(saves).To(Equal(0))
+			Expect(validations).To(Equal(0))
+			Expect(session.RefreshToken).To(Equal("Refreshed"))
+			Expect(lock.held).To(BeFalse())
+			Expect(primaryReads).To(Equal(1))
+			Expect(testutil.ToFloat64(sessionRefreshesShared) - shared).To(Equal(float64(1)))
+		})
+
+		Context("when the lock is not released in time", func() {
+			var timeout time.Duration
+
+			BeforeEach(func() {
+				timeout = sessionRefreshLockTimeout
+				sessionRefreshLockTimeout = 100 * time.Millisecond
+				lock.failures = -1
+			})
+
+			AfterEach(func() {
+				sessionRefreshLockTimeout = timeout
+			})
+
+			It("validates the session without refreshing it", func() {
+				session := newSession()
+				req := httptest.NewRequest("", "/", nil)
+				Expect(s.refreshSessionIfNeeded(nil, req, session)).To(Succeed())
+
+				Expect(refreshes).To(Equal(0))
+				Expect(saves).To(Equal(0))
+				Expect(validations).To(Equal(1))
+				Expect(session.RefreshToken).To(Equal(refresh))
+			})
+		})
+
+		It("validates the session when the lock can't be obtained", func() {
+			lock.err = errors.New("connection refused")
+
+			session := newSession()
+			req := httptest.NewRequest("", "/", nil)
+			Expect(s.refreshSessionIfNeeded(nil, req, session)).To(Succeed())
+
+			Expect(refreshes).To(Equal(0))
+			Expect(validations).To(Equal(1))
+		})
+	})
+
+	Context("refreshSessionIfNeeded without a session lock", func() {
+		It("refreshes concurrent requests for the same session once", func() {
+			createdPast := time.Now().Add(-5 * time.Minute)
+
+			var mu sync.Mutex
+			refreshes := 0
+			saves := map[http.ResponseWriter]*sessionsapi.SessionState{}
+			s := &storedSessionLoader{
+				refreshPeriod: 1 * time.Minute,
+				store: &fakeSessionStore{
+					SaveFunc: func(rw http.ResponseWriter, _ *http.Request, ss *sessionsapi.SessionState) error {
+						mu.Lock()
+						defer mu.Unlock()
+						saves[rw] = ss
+						return nil
+					},
+				},
+				sessionRefresher: func(_ context.Context, ss *sessionsapi.SessionState) (bool, error) {
+					mu.Lock()
+					refreshes++
+					mu.Unlock()
+
+					// Give the concurrent requests time to wait for the refresh
+					time.Sleep(200 * time.Millisecond)
+					ss.RefreshToken = "Refreshed"
+					return true, nil
+				},
+				sessionValidator: func(_ context.Context, _ *sessionsapi.SessionState) bool {
+					return true
+				},
+			}
+
+			const requests = 5
+			sessions := make([]*sessionsapi.SessionState, requests)
+			rws := make([]http.ResponseWriter, requests)
+			errs := make([]error, requests)
+			var wg sync.WaitGroup
+			for i := range sessions {
+				sessions[i] = &sessionsapi.SessionState{
+					RefreshToken: refresh,
+					CreatedAt:    &createdPast,
+				}
+				rws[i] = httptest.NewRecorder()
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					req := httptest.NewRequest("", "/", nil)
+					errs[i] = s.refreshSessionIfNeeded(rws[i], req, sessions[i])
+				}(i)
+			}
+			wg.Wait()
+
+			Expect(refreshes).To(Equal(1))
+			Expect(saves).To(HaveLen(requests))
+			for i := range sessions {
+				Expect(errs[i]).ToNot(HaveOccurred())
+				Expect(sessions[i].RefreshToken).To(Equal("Refreshed"))
+				// Each request saves its own session in its own response
+				Expect(saves[rws[i]]).To(BeIdenticalTo(sessions[i]))
+			}
+		})
 	})
 
 	Context("refreshSession", func() {
@@ -537,8 +816,215 @@ var _ = Describe("Stored Session Suite", func() {
 			})
 		})
 	})
+
+	Context("validateSessionLifetime", func() {
+		now := time.Now()
+		signedIn := now.Add(-2 * time.Hour)
+		active := now.Add(-10 * time.Minute)
+
+		BeforeEach(func() {
+			clock.Set(now)
+		})
+
+		AfterEach(func() {
+			clock.Reset()
+		})
+
+		type validateSessionLifetimeTableInput struct {
+			idleTimeout time.Duration
+			maxLifetime time.Duration
+			session     *sessionsapi.SessionState
+			expectedErr error
+		}
+
+		DescribeTable("with a session",
+			func(in validateSessionLifetimeTableInput) {
+				s := &storedSessionLoader{
+					idleTimeout: in.idleTimeout,
+					maxLifetime: in.maxLifetime,
+				}
+				err := s.validateSessionLifetime(in.session)
+				if in.expectedErr != nil {
+					Expect(err).To(MatchError(in.expectedErr.Error()))
+				} else {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			},
+			Entry("without limits", validateSessionLifetimeTableInput{
+				session: &sessionsapi.SessionState{SignedInAt: &signedIn, LastActivityAt: &active},
+			}),
+			Entry("within the limits", validateSessionLifetimeTableInput{
+				idleTimeout: 30 * time.Minute,
+				maxLifetime: 12 * time.Hour,
+				session:     &sessionsapi.SessionState{SignedInAt: &signedIn, LastActivityAt: &active},
+			}),
+			Entry("idle for longer than the idle timeout", validateSessionLifetimeTableInput{
+				idleTimeout: 5 * time.Minute,
+				session:     &sessionsapi.SessionState{SignedInAt: &signedIn, LastActivityAt: &active},
+				expectedErr: errors.New("session was idle for longer than 5m0s"),
+			}),
+			Entry("idle since signing in", validateSessionLifetimeTableInput{
+				idleTimeout: 30 * time.Minute,
+				session:     &sessionsapi.SessionState{SignedInAt: &signedIn},
+				expectedErr: errors.New("session was idle for longer than 30m0s"),
+			}),
+			Entry("older than the maximum lifetime", validateSessionLifetimeTableInput{
+				maxLifetime: time.Hour,
+				session:     &sessionsapi.SessionState{SignedInAt: &signedIn, LastActivityAt: &active},
+				expectedErr: errors.New("session reached its maximum lifetime of 1h0m0s"),
+			}),
+			Entry("created before the maximum lifetime without a sign in time", validateSessionLifetimeTableInput{
+				maxLifetime: time.Hour,
+				session:     &sessionsapi.SessionState{CreatedAt: &signedIn},
+				expectedErr: errors.New("session reached its maximum lifetime of 1h0m0s"),
+			}),
+		)
+	})
+
+	Context("recordActivity", func() {
+		now := time.Now()
+		recent := now.Add(-10 * time.Second)
+		past := now.Add(-5 * time.Minute)
+
+		var s *storedSessionLoader
+		var stored *sessionsapi.SessionState
+		var saved []*sessionsapi.SessionState
+
+		BeforeEach(func() {
+			clock.Set(now)
+			saved = nil
+			stored = &sessionsapi.SessionState{
+				RefreshToken:   "Stored",
+				LastActivityAt: &past,
+			}
+			s = &storedSessionLoader{
+				idleTimeout: 30 * time.Minute,
+				store: &fakeSessionStore{
+					LoadFunc: func(_ *http.Request) (*sessionsapi.SessionState, error) {
+						loaded := *stored
+						return &loaded, nil
+					},
+					SaveFunc: func(_ http.ResponseWriter, _ *http.Request, ss *sessionsapi.SessionState) error {
+						copied := *ss
+						saved = append(saved, &copied)
+						return nil
+					},
+				},
+				ignoreActivity: func(req *http.Request) bool {
+					return req.URL.Path == "/oauth2/userinfo"
+				},
+			}
+		})
+
+		AfterEach(func() {
+			clock.Reset()
+		})
+
+		It("saves the activity once the activity interval passed", func() {
+			session := &sessionsapi.SessionState{LastActivityAt: &past}
+			s.recordActivity(nil, httptest.NewRequest("", "/", nil), session)
+
+			Expect(saved).To(HaveLen(1))
+			Expect(*saved[0].LastActivityAt).To(Equal(now))
+			Expect(*session.LastActivityAt).To(Equal(now))
+		})
+
+		It("saves the activity of sessions without recorded activity", func() {
+			s.recordActivity(nil, httptest.NewRequest("", "/", nil), &sessionsapi.SessionState{})
+
+			Expect(saved).To(HaveLen(1))
+			Expect(*saved[0].LastActivityAt).To(Equal(now))
+		})
+
+		It("throttles the writes within the activity interval", func() {
+			s.recordActivity(nil, httptest.NewRequest("", "/", nil), &sessionsapi.SessionState{LastActivityAt: &recent})
+
+			Expect(saved).To(BeEmpty())
+		})
+
+		It("writes the activity every tenth of short idle timeouts", func() {
+			s.idleTimeout = 90 * time.Second
+			s.recordActivity(nil, httptest.NewRequest("", "/", nil), &sessionsapi.SessionState{LastActivityAt: &recent})
+
+			Expect(saved).To(HaveLen(1))
+		})
+
+		It("does not record ignored requests", func() {
+			s.recordActivity(nil, httptest.NewRequest("", "/oauth2/userinfo", nil), &sessionsapi.SessionState{LastActivityAt: &past})
+
+			Expect(saved).To(BeEmpty())
+		})
+
+		It("does not record activity without an idle timeout", func() {
+			s.idleTimeout = 0
+			s.recordActivity(nil, httptest.NewRequest("", "/", nil), &sessionsapi.SessionState{LastActivityAt: &past})
+
+			Expect(saved).To(BeEmpty())
+		})
+
+		It("saves the reloaded session while holding the session lock", func() {
+			lock := &fakeLock{}
+			session := &sessionsapi.SessionState{RefreshToken: "Loaded", LastActivityAt: &past, Lock: lock}
+			s.recordActivity(nil, httptest.NewRequest("", "/", nil), session)
+
+			Expect(saved).To(HaveLen(1))
+			Expect(saved[0].RefreshToken).To(Equal("Stored"))
+			Expect(*saved[0].LastActivityAt).To(Equal(now))
+			Expect(lock.obtained).To(Equal(1))
+			Expect(lock.held).To(BeFalse())
+		})
+
+		It("skips the write when another request holds the session lock", func() {
+			lock := &fakeLock{failures: -1}
+			session := &sessionsapi.SessionState{LastActivityAt: &past, Lock: lock}
+			s.recordActivity(nil, httptest.NewRequest("", "/", nil), session)
+
+			Expect(saved).To(BeEmpty())
+		})
+	})
 })
 
+// fakeLock fails to be obtained the first failures times, or on every
+// attempt when failures is negative
+type fakeLock struct {
+	failures int
+	err      error
+	obtained int
+	held     bool
+}
+
+func (l *fakeLock) Obtain(_ context.Context, _ time.Duration) error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.failures != 0 {
+		l.failures--
+		return sessionsapi.ErrLockNotObtained
+	}
+	l.obtained++
+	l.held = true
+	return nil
+}
+
+func (l *fakeLock) Peek(_ context.Context) (bool, error) {
+	return l.held, nil
+}
+
+func (l *fakeLock) Refresh(_ context.Context, _ time.Duration) error {
+	if !l.held {
+		return sessionsapi.ErrNotLocked
+	}
+	return nil
+}
+
+func (l *fakeLock) Release(_ context.Context) error {
+	if !l.held {
+		return sessionsapi.ErrNotLocked
+	}
+	l.held = false
+	return nil
+}
+
 type fakeSessionStore struct {
 	SaveFunc  func(http.ResponseWriter, *http.Request, *sessionsapi.SessionState) error
 	LoadFunc  func(req *http.Request) (*sessionsapi.SessionState, error)
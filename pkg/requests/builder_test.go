@@ -13,6 +13,18 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// headerTransport sets a header on the requests it sends
+type headerTransport struct {
+	key   string
+	value string
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(t.key, t.value)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
 var _ = Describe("Builder suite", func() {
 	var b Builder
 	getBuilder := func() Builder { return b }
@@ -65,6 +77,24 @@ var _ = Describe("Builder suite", func() {
 		})
 	})
 
+	Context("with a client", func() {
+		header := baseHeaders.Clone()
+		header.Set("X-Client", "custom")
+
+		BeforeEach(func() {
+			b = b.WithClient(&http.Client{
+				Transport: headerTransport{key: "X-Client", value: "custom"},
+			})
+		})
+
+		assertSuccessfulRequest(getBuilder, testHTTPRequest{
+			Method:     "GET",
+			Header:     header,
+			Body:       []byte{},
+			RequestURI: "/json/path",
+		})
+	})
+
 	Context("with a body", func() {
 		const body = "{\"some\": \"body\"}"
 		header := baseHeaders.Clone()
@@ -2,14 +2,16 @@ package util
 
 import (
 	"net/http"
+	"net/url"
 
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 )
 
 const (
-	XForwardedProto = "X-Forwarded-Proto"
-	XForwardedHost  = "X-Forwarded-Host"
-	XForwardedURI   = "X-Forwarded-Uri"
+	XForwardedProto  = "X-Forwarded-Proto"
+	XForwardedHost   = "X-Forwarded-Host"
+	XForwardedURI    = "X-Forwarded-Uri"
+	XForwardedMethod = "X-Forwarded-Method"
 )
 
 // GetRequestProto returns the request scheme or X-Forwarded-Proto if present
@@ -43,6 +45,27 @@ func GetRequestURI(req *http.Request) string {
 	return uri
 }
 
+// GetAuthorizationRoute returns the method and path a request is authorized
+// for. Auth requests are authorized for the original request in the
+// X-Forwarded-Method and X-Forwarded-Uri headers. Any other request, even when
+// proxied, is authorized for its own method and path, as it is routed to the
+// upstream on them.
+func GetAuthorizationRoute(req *http.Request) (string, string) {
+	if !IsAuthRequest(req) {
+		return req.Method, req.URL.Path
+	}
+
+	method := req.Header.Get(XForwardedMethod)
+	if method == "" {
+		method = req.Method
+	}
+	path := req.URL.Path
+	if uri, err := url.ParseRequestURI(req.Header.Get(XForwardedURI)); err == nil {
+		path = uri.Path
+	}
+	return method, path
+}
+
 // IsProxied determines if a request was from a proxy based on the RequestScope
 // ReverseProxy tracker.
 func IsProxied(req *http.Request) bool {
@@ -53,6 +76,16 @@ func IsProxied(req *http.Request) bool {
 	return scope.ReverseProxy
 }
 
+// IsAuthRequest determines if a request is an auth request made on behalf of
+// another proxy based on the RequestScope AuthRequest tracker.
+func IsAuthRequest(req *http.Request) bool {
+	scope := middlewareapi.GetRequestScope(req)
+	if scope == nil {
+		return false
+	}
+	return scope.AuthRequest
+}
+
 func IsForwardedRequest(req *http.Request) bool {
 	return IsProxied(req) &&
 		req.Host != GetRequestHost(req)
@@ -127,5 +127,58 @@ var _ = Describe("Util Suite", func() {
 				Expect(util.GetRequestURI(req)).To(Equal("/some/other/path"))
 			})
 		})
+
+		Context("IsAuthRequest is true", func() {
+			BeforeEach(func() {
+				req = middleware.AddRequestScope(req, &middleware.RequestScope{
+					AuthRequest: true,
+				})
+			})
+
+			It("ignores X-Forwarded-Uri and returns the URI", func() {
+				req.Header.Add("X-Forwarded-Uri", "/some/other/path")
+				Expect(util.GetRequestURI(req)).To(Equal(uri))
+			})
+		})
+	})
+
+	Context("GetAuthorizationRoute", func() {
+		Context("IsProxied is true", func() {
+			BeforeEach(func() {
+				req = middleware.AddRequestScope(req, &middleware.RequestScope{
+					ReverseProxy: true,
+				})
+			})
+
+			It("ignores the X-Forwarded-Method and X-Forwarded-Uri", func() {
+				req.Header.Add("X-Forwarded-Method", http.MethodPost)
+				req.Header.Add("X-Forwarded-Uri", "/some/other/path")
+				method, path := util.GetAuthorizationRoute(req)
+				Expect(method).To(Equal(http.MethodGet))
+				Expect(path).To(Equal(uri))
+			})
+		})
+
+		Context("IsAuthRequest is true", func() {
+			BeforeEach(func() {
+				req = middleware.AddRequestScope(req, &middleware.RequestScope{
+					AuthRequest: true,
+				})
+			})
+
+			It("returns the request method and path if the headers are not present", func() {
+				method, path := util.GetAuthorizationRoute(req)
+				Expect(method).To(Equal(http.MethodGet))
+				Expect(path).To(Equal(uri))
+			})
+
+			It("returns the X-Forwarded-Method and the path of the X-Forwarded-Uri", func() {
+				req.Header.Add("X-Forwarded-Method", http.MethodPost)
+				req.Header.Add("X-Forwarded-Uri", "/some/other/path?foo=bar")
+				method, path := util.GetAuthorizationRoute(req)
+				Expect(method).To(Equal(http.MethodPost))
+				Expect(path).To(Equal("/some/other/path"))
+			})
+		})
 	})
 })
@@ -30,6 +30,10 @@ type SessionStore struct {
 	Cookie       *options.Cookie
 	CookieCipher encryption.Cipher
 	Minimal      bool
+
+	// previousCiphers decrypt sessions encrypted with the previous cookie
+	// secrets, in the same order
+	previousCiphers []encryption.Cipher
 }
 
 // Save takes a sessions.SessionState and stores the information from it
@@ -38,6 +42,9 @@ func (s *SessionStore) Save(rw http.ResponseWriter, req *http.Request, ss *sessi
 	if ss.CreatedAt == nil || ss.CreatedAt.IsZero() {
 		ss.CreatedAtNow()
 	}
+	if ss.SignedInAt == nil || ss.SignedInAt.IsZero() {
+		ss.SignedInAtNow()
+	}
 	value, err := s.cookieForSession(ss)
 	if err != nil {
 		return err
@@ -53,12 +60,19 @@ func (s *SessionStore) Load(req *http.Request) (*sessions.SessionState, error) {
 		// always http.ErrNoCookie
 		return nil, fmt.Errorf("cookie %q not present", s.Cookie.Name)
 	}
-	val, _, ok := encryption.Validate(c, s.Cookie.Secret, s.Cookie.Expire)
+	val, _, index, ok := encryption.ValidateAny(c, s.Cookie.Secrets(), s.Cookie.Expire)
 	if !ok {
 		return nil, errors.New("cookie signature not valid")
 	}
 
-	session, err := sessions.DecodeSessionState(val, s.CookieCipher, true)
+	// Sessions signed with a previous secret were also encrypted with it.
+	// They are encrypted with the current secret when next saved.
+	cipher := s.CookieCipher
+	if index > 0 {
+		cipher = s.previousCiphers[index-1]
+	}
+
+	session, err := sessions.DecodeSessionState(val, cipher, true)
 	if err != nil {
 		return nil, err
 	}
@@ -145,10 +159,20 @@ func NewCookieSessionStore(opts *options.SessionOptions, cookieOpts *options.Coo
 		return nil, fmt.Errorf("error initialising cipher: %v", err)
 	}
 
+	previousCiphers := make([]encryption.Cipher, 0, len(cookieOpts.PreviousSecrets))
+	for _, secret := range cookieOpts.PreviousSecrets {
+		previousCipher, err := encryption.NewCFBCipher(encryption.SecretBytes(secret))
+		if err != nil {
+			return nil, fmt.Errorf("error initialising cipher for previous cookie secret: %v", err)
+		}
+		previousCiphers = append(previousCiphers, previousCipher)
+	}
+
 	return &SessionStore{
-		CookieCipher: cipher,
-		Cookie:       cookieOpts,
-		Minimal:      opts.Cookie.Minimal,
+		CookieCipher:    cipher,
+		Cookie:          cookieOpts,
+		Minimal:         opts.Cookie.Minimal,
+		previousCiphers: previousCiphers,
 	}, nil
 }
 
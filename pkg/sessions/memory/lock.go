@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+const LockSuffix = "lock"
+
+// lockEntry is a lock held in the store, the token identifies the holder
+type lockEntry struct {
+	token     string
+	expiresAt time.Time
+}
+
+// Lock is a sessions.Lock held in the memory of the process.
+// It only excludes concurrent refreshes within a single OAuth2 Proxy
+// instance.
+type Lock struct {
+	store *SessionStore
+	key   string
+	token string
+}
+
+// NewLock instantiate a new lock instance. This will not yet apply a lock in the store.
+// For that you have to call Obtain(ctx context.Context, expiration time.Duration)
+func NewLock(store *SessionStore, key string) sessions.Lock {
+	return &Lock{
+		store: store,
+		key:   key,
+	}
+}
+
+// Obtain obtains a lock in the store for the configured key.
+func (l *Lock) Obtain(_ context.Context, expiration time.Duration) error {
+	nonce, err := encryption.Nonce()
+	if err != nil {
+		return fmt.Errorf("error generating lock token: %v", err)
+	}
+	token := hex.EncodeToString(nonce)
+
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	if l.store.heldLock(l.lockKey()) != nil {
+		return sessions.ErrLockNotObtained
+	}
+	l.store.locks[l.lockKey()] = &lockEntry{
+		token:     token,
+		expiresAt: l.store.Clock.Now().Add(expiration),
+	}
+	l.token = token
+	return nil
+}
+
+// Refresh refreshes an already existing lock.
+func (l *Lock) Refresh(_ context.Context, expiration time.Duration) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	lock := l.held()
+	if lock == nil {
+		return sessions.ErrNotLocked
+	}
+	lock.expiresAt = l.store.Clock.Now().Add(expiration)
+	return nil
+}
+
+// Peek returns true, if the lock is still applied.
+func (l *Lock) Peek(_ context.Context) (bool, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	return l.store.heldLock(l.lockKey()) != nil, nil
+}
+
+// Release releases the lock in the store.
+func (l *Lock) Release(_ context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	if l.held() == nil {
+		l.token = ""
+		return sessions.ErrNotLocked
+	}
+	delete(l.store.locks, l.lockKey())
+	l.token = ""
+	return nil
+}
+
+// held returns the lock entry if it was obtained by this Lock and is still
+// applied.
+// The caller must hold the store mutex.
+func (l *Lock) held() *lockEntry {
+	if l.token == "" {
+		return nil
+	}
+	lock := l.store.heldLock(l.lockKey())
+	if lock == nil || lock.token != l.token {
+		return nil
+	}
+	return lock
+}
+
+func (l *Lock) lockKey() string {
+	return fmt.Sprintf("%s.%s", l.key, LockSuffix)
+}
+
+// heldLock returns the lock entry for the key if it has not expired.
+// The caller must hold the store mutex.
+func (store *SessionStore) heldLock(key string) *lockEntry {
+	lock, ok := store.locks[key]
+	if !ok {
+		return nil
+	}
+	if !store.Clock.Now().Before(lock.expiresAt) {
+		delete(store.locks, key)
+		return nil
+	}
+	return lock
+}
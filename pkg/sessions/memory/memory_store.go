@@ -0,0 +1,259 @@
+package memory
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+)
+
+// SessionStore is an implementation of the persistence.Store
+// interface that stores sessions in the memory of the process.
+// Once MaxSessions sessions are stored, the least recently used session is
+// removed to make room for a new one.
+type SessionStore struct {
+	Clock clock.Clock
+
+	maxSessions int
+
+	mu       sync.Mutex
+	sessions map[string]*list.Element
+	// lru holds the sessions ordered from most to least recently used
+	lru     *list.List
+	locks   map[string]*lockEntry
+	indexes map[string]*index
+
+	// done stops the periodic cleanup when closed
+	done chan struct{}
+}
+
+// entry is a session stored with its expiry time
+type entry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// index is a set of keys and their creation times with an expiry time
+type index struct {
+	keys      map[string]time.Time
+	expiresAt time.Time
+}
+
+// NewMemorySessionStore initialises a new instance of the SessionStore and
+// wraps it in a persistence.Manager
+func NewMemorySessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	store := NewMemoryStore(opts.Memory)
+
+	if opts.Memory.CleanupInterval > 0 {
+		store.done = make(chan struct{})
+		go store.runCleanup(opts.Memory.CleanupInterval, store.done)
+	}
+	return persistence.NewManager(store, opts, cookieOpts), nil
+}
+
+// NewMemoryStore creates an empty SessionStore holding at most
+// opts.MaxSessions sessions
+func NewMemoryStore(opts options.MemoryStoreOptions) *SessionStore {
+	return &SessionStore{
+		maxSessions: opts.MaxSessions,
+		sessions:    map[string]*list.Element{},
+		lru:         list.New(),
+		locks:       map[string]*lockEntry{},
+		indexes:     map[string]*index{},
+	}
+}
+
+// Save stores the value of the session under the key until it expires.
+// The least recently used sessions are removed when the store is full.
+func (store *SessionStore) Save(_ context.Context, key string, value []byte, exp time.Duration) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	e := &entry{
+		key:       key,
+		value:     value,
+		expiresAt: store.Clock.Now().Add(exp),
+	}
+	if elem, ok := store.sessions[key]; ok {
+		elem.Value = e
+		store.lru.MoveToFront(elem)
+		return nil
+	}
+
+	store.sessions[key] = store.lru.PushFront(e)
+	for store.maxSessions > 0 && store.lru.Len() > store.maxSessions {
+		store.remove(store.lru.Back())
+	}
+	return nil
+}
+
+// Load returns the value of the session stored under the key and marks the
+// session as recently used
+func (store *SessionStore) Load(_ context.Context, key string) ([]byte, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	elem, ok := store.sessions[key]
+	if !ok {
+		return nil, fmt.Errorf("error loading memory session %q: %w", key, sessions.ErrSessionNotFound)
+	}
+	e := elem.Value.(*entry)
+	if !store.Clock.Now().Before(e.expiresAt) {
+		store.remove(elem)
+		return nil, fmt.Errorf("error loading memory session %q: %w", key, sessions.ErrSessionNotFound)
+	}
+
+	store.lru.MoveToFront(elem)
+	return e.value, nil
+}
+
+// Clear removes the session stored under the key
+func (store *SessionStore) Clear(_ context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if elem, ok := store.sessions[key]; ok {
+		store.remove(elem)
+	}
+	return nil
+}
+
+// Lock creates a lock object for sessions.SessionState
+func (store *SessionStore) Lock(key string) sessions.Lock {
+	return NewLock(store, key)
+}
+
+// AddToIndex records the key in the index with its creation time and
+// extends the expiration of the whole index
+func (store *SessionStore) AddToIndex(_ context.Context, name string, key string, createdAt time.Time, exp time.Duration) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	idx := store.loadIndex(name)
+	if idx == nil {
+		idx = &index{keys: map[string]time.Time{}}
+		store.indexes[name] = idx
+	}
+	idx.keys[key] = createdAt
+	idx.expiresAt = store.Clock.Now().Add(exp)
+	return nil
+}
+
+// RemoveFromIndex removes the key from the index
+func (store *SessionStore) RemoveFromIndex(_ context.Context, name string, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if idx := store.loadIndex(name); idx != nil {
+		delete(idx.keys, key)
+		if len(idx.keys) == 0 {
+			delete(store.indexes, name)
+		}
+	}
+	return nil
+}
+
+// LoadIndex returns a copy of the keys and creation times recorded in the
+// index
+func (store *SessionStore) LoadIndex(_ context.Context, name string) (map[string]time.Time, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	keys := map[string]time.Time{}
+	if idx := store.loadIndex(name); idx != nil {
+		for key, createdAt := range idx.keys {
+			keys[key] = createdAt
+		}
+	}
+	return keys, nil
+}
+
+// Len returns the number of sessions held by the store, including expired
+// sessions that were not yet removed
+func (store *SessionStore) Len() int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.lru.Len()
+}
+
+// Cleanup removes all expired sessions, locks and indexes from the store
+func (store *SessionStore) Cleanup() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.Clock.Now()
+	for elem := store.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if !now.Before(elem.Value.(*entry).expiresAt) {
+			store.remove(elem)
+		}
+		elem = prev
+	}
+	for key, lock := range store.locks {
+		if !now.Before(lock.expiresAt) {
+			delete(store.locks, key)
+		}
+	}
+	for name, idx := range store.indexes {
+		if !now.Before(idx.expiresAt) {
+			delete(store.indexes, name)
+		}
+	}
+}
+
+// Close stops the periodic cleanup
+func (store *SessionStore) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.done != nil {
+		close(store.done)
+		store.done = nil
+	}
+	return nil
+}
+
+// runCleanup periodically removes expired sessions and locks until done is
+// closed
+func (store *SessionStore) runCleanup(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			store.Cleanup()
+		case <-done:
+			return
+		}
+	}
+}
+
+// remove deletes the session of the list element.
+// The caller must hold the store mutex.
+func (store *SessionStore) remove(elem *list.Element) {
+	store.lru.Remove(elem)
+	delete(store.sessions, elem.Value.(*entry).key)
+}
+
+// loadIndex returns the index if it exists and has not expired.
+// The caller must hold the store mutex.
+func (store *SessionStore) loadIndex(name string) *index {
+	idx, ok := store.indexes[name]
+	if !ok {
+		return nil
+	}
+	if !store.Clock.Now().Before(idx.expiresAt) {
+		delete(store.indexes, name)
+		return nil
+	}
+	return idx
+}
@@ -0,0 +1,171 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSessionStore(t *testing.T) {
+	logger.SetOutput(GinkgoWriter)
+	logger.SetErrOutput(GinkgoWriter)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Memory SessionStore")
+}
+
+var _ = Describe("Memory SessionStore Tests", func() {
+	var store *SessionStore
+
+	AfterEach(func() {
+		store = nil
+	})
+
+	tests.RunSessionStoreTests(
+		func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+			if store != nil {
+				// Session stores created within a test share their sessions,
+				// as they would when backed by redis or a database
+				return persistence.NewManager(store, opts, cookieOpts), nil
+			}
+
+			opts.Type = options.MemorySessionStoreType
+			opts.Memory = options.MemoryStoreOptions{
+				MaxSessions: 100,
+			}
+
+			ss, err := NewMemorySessionStore(opts, cookieOpts)
+			if err != nil {
+				return nil, err
+			}
+
+			// Capture the store so that we can mock the time
+			store = ss.(*persistence.Manager).Store.(*SessionStore)
+			store.Clock.Set(time.Now())
+			return ss, nil
+		},
+		func(d time.Duration) error {
+			return store.Clock.Add(d)
+		},
+	)
+
+	Context("with a maximum number of sessions", func() {
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			store = NewMemoryStore(options.MemoryStoreOptions{MaxSessions: 2})
+			store.Clock.Set(time.Now())
+
+			Expect(store.Save(ctx, "first", []byte("first"), time.Hour)).To(Succeed())
+			Expect(store.Save(ctx, "second", []byte("second"), time.Hour)).To(Succeed())
+		})
+
+		It("removes the least recently saved session when full", func() {
+			Expect(store.Save(ctx, "third", []byte("third"), time.Hour)).To(Succeed())
+			Expect(store.Len()).To(Equal(2))
+
+			_, err := store.Load(ctx, "first")
+			Expect(err).To(MatchError("error loading memory session \"first\": session not found"))
+			Expect(store.Load(ctx, "second")).To(Equal([]byte("second")))
+			Expect(store.Load(ctx, "third")).To(Equal([]byte("third")))
+		})
+
+		It("keeps sessions that were recently loaded", func() {
+			Expect(store.Load(ctx, "first")).To(Equal([]byte("first")))
+			Expect(store.Save(ctx, "third", []byte("third"), time.Hour)).To(Succeed())
+
+			_, err := store.Load(ctx, "second")
+			Expect(err).To(HaveOccurred())
+			Expect(store.Load(ctx, "first")).To(Equal([]byte("first")))
+		})
+
+		It("doesn't remove sessions when an existing session is saved again", func() {
+			Expect(store.Save(ctx, "first", []byte("updated"), time.Hour)).To(Succeed())
+			Expect(store.Len()).To(Equal(2))
+
+			Expect(store.Load(ctx, "first")).To(Equal([]byte("updated")))
+			Expect(store.Load(ctx, "second")).To(Equal([]byte("second")))
+		})
+	})
+
+	Context("Cleanup", func() {
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			store = NewMemoryStore(options.MemoryStoreOptions{MaxSessions: 10})
+			store.Clock.Set(time.Now())
+
+			Expect(store.Save(ctx, "short", []byte("short"), time.Minute)).To(Succeed())
+			Expect(store.Save(ctx, "long", []byte("long"), time.Hour)).To(Succeed())
+			Expect(store.Lock("short").Obtain(ctx, time.Minute)).To(Succeed())
+			Expect(store.AddToIndex(ctx, "index", "short", time.Now(), time.Minute)).To(Succeed())
+		})
+
+		It("removes only expired sessions, locks and indexes", func() {
+			Expect(store.Clock.Add(2 * time.Minute)).To(Succeed())
+			store.Cleanup()
+
+			Expect(store.Len()).To(Equal(1))
+			Expect(store.locks).To(BeEmpty())
+			Expect(store.indexes).To(BeEmpty())
+			Expect(store.Load(ctx, "long")).To(Equal([]byte("long")))
+		})
+	})
+
+	Context("Close", func() {
+		It("stops the cleanup", func() {
+			opts := &options.SessionOptions{
+				Memory: options.MemoryStoreOptions{MaxSessions: 10, CleanupInterval: time.Millisecond},
+			}
+			ss, err := NewMemorySessionStore(opts, &options.Cookie{})
+			Expect(err).ToNot(HaveOccurred())
+			memoryStore := ss.(*persistence.Manager).Store.(*SessionStore)
+			done := memoryStore.done
+
+			Expect(ss.(*persistence.Manager).Close()).To(Succeed())
+			Expect(done).To(BeClosed())
+			Expect(memoryStore.Close()).To(Succeed())
+		})
+	})
+
+	Context("Lock", func() {
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			store = NewMemoryStore(options.MemoryStoreOptions{MaxSessions: 10})
+			store.Clock.Set(time.Now())
+		})
+
+		It("can only be obtained by a single holder", func() {
+			first := store.Lock("key")
+			second := store.Lock("key")
+
+			Expect(first.Obtain(ctx, time.Minute)).To(Succeed())
+			Expect(second.Obtain(ctx, time.Minute)).To(Equal(sessionsapi.ErrLockNotObtained))
+			Expect(second.Release(ctx)).To(Equal(sessionsapi.ErrNotLocked))
+
+			Expect(first.Release(ctx)).To(Succeed())
+			Expect(second.Obtain(ctx, time.Minute)).To(Succeed())
+		})
+
+		It("can be obtained once the previous lock expired", func() {
+			first := store.Lock("key")
+			second := store.Lock("key")
+
+			Expect(first.Obtain(ctx, time.Minute)).To(Succeed())
+			Expect(store.Clock.Add(2 * time.Minute)).To(Succeed())
+			Expect(second.Obtain(ctx, time.Minute)).To(Succeed())
+
+			Expect(first.Refresh(ctx, time.Minute)).To(Equal(sessionsapi.ErrNotLocked))
+			Expect(first.Release(ctx)).To(Equal(sessionsapi.ErrNotLocked))
+		})
+	})
+})
@@ -0,0 +1,58 @@
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// indexKeys returns the keys of all indexes a session should be recorded in
+func indexKeys(s *sessions.SessionState) []sessions.IndexKey {
+	keys := []sessions.IndexKey{}
+	if s.Email != "" {
+		keys = append(keys, sessions.IndexKey{Attribute: sessions.EmailIndex, Value: s.Email})
+	}
+	if s.User != "" {
+		keys = append(keys, sessions.IndexKey{Attribute: sessions.UserIndex, Value: s.User})
+	}
+	if s.Subject != "" {
+		keys = append(keys, sessions.IndexKey{Attribute: sessions.SubjectIndex, Value: s.Subject, ProviderID: s.ProviderID})
+	}
+	if s.SessionID != "" {
+		keys = append(keys, sessions.IndexKey{Attribute: sessions.SessionIDIndex, Value: s.SessionID, ProviderID: s.ProviderID})
+	}
+	if key, ok := userIndexKey(s); ok && key.ProviderID != "" {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// userIndexKey returns the key of the index that identifies the user of the
+// session within its provider, preferring the user over the email address.
+// The sessions of a user are limited per provider, as the same user name
+// may belong to different users at different providers.
+func userIndexKey(s *sessions.SessionState) (sessions.IndexKey, bool) {
+	switch {
+	case s.User != "":
+		return sessions.IndexKey{Attribute: sessions.UserIndex, Value: s.User, ProviderID: s.ProviderID}, true
+	case s.Email != "":
+		return sessions.IndexKey{Attribute: sessions.EmailIndex, Value: s.Email, ProviderID: s.ProviderID}, true
+	default:
+		return sessions.IndexKey{}, false
+	}
+}
+
+// indexName returns the name an index is stored under in the Store.
+// The value is hashed so that the name has a bounded length and doesn't leak
+// the identity of the user. Indexes scoped to a provider include its ID.
+func indexName(cookieOpts *options.Cookie, key sessions.IndexKey) string {
+	hash := sha256.Sum256([]byte(key.Value))
+	if key.ProviderID != "" {
+		return fmt.Sprintf("%s-index-%s-%s-%s", cookieOpts.Name, url.QueryEscape(key.ProviderID), key.Attribute, hex.EncodeToString(hash[:]))
+	}
+	return fmt.Sprintf("%s-index-%s-%s", cookieOpts.Name, key.Attribute, hex.EncodeToString(hash[:]))
+}
@@ -12,7 +12,17 @@ import (
 // for session ticket + encryption details.
 type Store interface {
 	Save(context.Context, string, []byte, time.Duration) error
+	// Load returns the value saved under the key, or an error wrapping
+	// sessions.ErrSessionNotFound if there is none or it has expired
 	Load(context.Context, string) ([]byte, error)
 	Clear(context.Context, string) error
 	Lock(key string) sessions.Lock
+
+	// AddToIndex records the key with its creation time in the index and
+	// extends the expiration of the whole index
+	AddToIndex(ctx context.Context, index string, key string, createdAt time.Time, exp time.Duration) error
+	// RemoveFromIndex removes the key from the index
+	RemoveFromIndex(ctx context.Context, index string, key string) error
+	// LoadIndex returns all keys recorded in the index with their creation time
+	LoadIndex(ctx context.Context, index string) (map[string]time.Time, error)
 }
@@ -1,12 +1,17 @@
 package persistence
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 )
 
 // Manager wraps a Store and handles the implementation details of the
@@ -14,27 +19,82 @@ import (
 type Manager struct {
 	Store   Store
 	Options *options.Cookie
+
+	// MaxPerUser is the maximum number of sessions of a user, 0 for no limit
+	MaxPerUser int
+	// LimitPolicy decides what happens when a user with MaxPerUser sessions
+	// signs in again
+	LimitPolicy string
 }
 
+var _ sessions.UserSessionStore = (*Manager)(nil)
+
+var (
+	// userSessionsLockDuration is how long the sessions of a user are locked
+	// while a new session is checked against the limit and saved
+	userSessionsLockDuration = 5 * time.Second
+
+	// userSessionsLockTimeout is how long a sign in waits for a concurrent
+	// sign in of the same user before failing
+	userSessionsLockTimeout = 5 * time.Second
+
+	// userSessionsRetryPeriod is the interval between attempts to obtain the
+	// lock on the sessions of a user
+	userSessionsRetryPeriod = 20 * time.Millisecond
+)
+
 // NewManager creates a Manager that can wrap a Store and manage the
 // sessions.SessionStore implementation details
-func NewManager(store Store, cookieOpts *options.Cookie) *Manager {
+func NewManager(store Store, opts *options.SessionOptions, cookieOpts *options.Cookie) *Manager {
 	return &Manager{
-		Store:   store,
-		Options: cookieOpts,
+		Store:       store,
+		Options:     cookieOpts,
+		MaxPerUser:  opts.MaxPerUser,
+		LimitPolicy: opts.LimitPolicy,
 	}
 }
 
+// Close releases the connections and background goroutines of the Store, if
+// it holds any
+func (m *Manager) Close() error {
+	if closer, ok := m.Store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 // Save saves a session in a persistent Store. Save will generate (or reuse an
 // existing) ticket which manages unique per session encryption & retrieval
-// from the persistent data store.
+// from the persistent data store. The ticket of the request is only reused
+// for the same user at the same provider.
 func (m *Manager) Save(rw http.ResponseWriter, req *http.Request, s *sessions.SessionState) error {
 	if s.CreatedAt == nil || s.CreatedAt.IsZero() {
 		s.CreatedAtNow()
 	}
+	if s.SignedInAt == nil || s.SignedInAt.IsZero() {
+		s.SignedInAtNow()
+	}
 
 	tckt, err := decodeTicketFromRequest(req, m.Options)
-	if err != nil {
+	reuse := false
+	if err == nil {
+		reuse, err = m.replaceTicketSession(req.Context(), tckt, s)
+		if err != nil {
+			return err
+		}
+	}
+	if !reuse {
+		// The limit is checked and the new session indexed under the lock,
+		// so that concurrent sign ins of the user can't exceed it
+		unlock, err := m.lockUserSessions(req.Context(), s)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if err := m.limitUserSessions(req, s); err != nil {
+			return err
+		}
 		tckt, err = newTicket(m.Options)
 		if err != nil {
 			return fmt.Errorf("error creating a session ticket: %v", err)
@@ -48,6 +108,10 @@ func (m *Manager) Save(rw http.ResponseWriter, req *http.Request, s *sessions.Se
 		return err
 	}
 
+	if err := m.indexSession(req.Context(), tckt.id, s); err != nil {
+		return err
+	}
+
 	return tckt.setCookie(rw, req, s)
 }
 
@@ -86,7 +150,235 @@ func (m *Manager) Clear(rw http.ResponseWriter, req *http.Request) error {
 	}
 
 	tckt.clearCookie(rw, req)
-	return tckt.clearSession(func(key string) error {
+
+	// The session is needed to know which indexes it has to be removed from
+	s, loadErr := tckt.loadSession(
+		func(key string) ([]byte, error) {
+			return m.Store.Load(sessions.WithPrimaryRead(req.Context()), key)
+		},
+		m.Store.Lock,
+	)
+
+	err = tckt.clearSession(func(key string) error {
 		return m.Store.Clear(req.Context(), key)
 	})
+	if err != nil || loadErr != nil {
+		return err
+	}
+	return m.unindexSession(req.Context(), tckt.id, s)
+}
+
+// ListUserSessions returns the sessions recorded in the index for the key.
+// Sessions that have expired but are still in the index are skipped, any
+// other error loading them fails the listing. The sessions are loaded with
+// primary reads, so that recently revoked sessions are not listed.
+func (m *Manager) ListUserSessions(ctx context.Context, key sessions.IndexKey) ([]sessions.UserSession, error) {
+	ctx = sessions.WithPrimaryRead(ctx)
+	index, err := m.Store.LoadIndex(ctx, indexName(m.Options, key))
+	if err != nil {
+		return nil, fmt.Errorf("error loading session index: %v", err)
+	}
+
+	userSessions := make([]sessions.UserSession, 0, len(index))
+	for id, createdAt := range index {
+		if _, err := m.Store.Load(ctx, id); err != nil {
+			if errors.Is(err, sessions.ErrSessionNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("error loading indexed session: %v", err)
+		}
+		userSessions = append(userSessions, sessions.UserSession{
+			ID:        id,
+			CreatedAt: createdAt,
+		})
+	}
+
+	sort.Slice(userSessions, func(i, j int) bool {
+		if userSessions[i].CreatedAt.Equal(userSessions[j].CreatedAt) {
+			return userSessions[i].ID < userSessions[j].ID
+		}
+		return userSessions[i].CreatedAt.Before(userSessions[j].CreatedAt)
+	})
+	return userSessions, nil
+}
+
+// RevokeUserSession clears the session with the ID from the Store, provided it
+// is recorded in the index for the key.
+func (m *Manager) RevokeUserSession(ctx context.Context, key sessions.IndexKey, id string) error {
+	name := indexName(m.Options, key)
+	index, err := m.Store.LoadIndex(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error loading session index: %v", err)
+	}
+	if _, ok := index[id]; !ok {
+		return sessions.ErrSessionNotFound
+	}
+	return m.revokeSession(ctx, name, id)
+}
+
+// RevokeUserSessions clears all sessions recorded in the index for the key
+// from the Store. It returns the number of active sessions that were cleared.
+func (m *Manager) RevokeUserSessions(ctx context.Context, key sessions.IndexKey) (int, error) {
+	ctx = sessions.WithPrimaryRead(ctx)
+	name := indexName(m.Options, key)
+	index, err := m.Store.LoadIndex(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("error loading session index: %v", err)
+	}
+
+	revoked := 0
+	for id := range index {
+		if _, err := m.Store.Load(ctx, id); err == nil {
+			revoked++
+		}
+		if err := m.revokeSession(ctx, name, id); err != nil {
+			return revoked, err
+		}
+	}
+	return revoked, nil
+}
+
+// limitUserSessions makes room for a new session of the user when the user
+// already has MaxPerUser sessions. Depending on the LimitPolicy it either
+// returns sessions.ErrTooManySessions or revokes the oldest sessions.
+func (m *Manager) limitUserSessions(req *http.Request, s *sessions.SessionState) error {
+	key, ok := userIndexKey(s)
+	if m.MaxPerUser <= 0 || !ok {
+		return nil
+	}
+
+	userSessions, err := m.ListUserSessions(req.Context(), key)
+	if err != nil {
+		return err
+	}
+	excess := len(userSessions) - m.MaxPerUser + 1
+	if excess <= 0 {
+		return nil
+	}
+	if m.LimitPolicy != options.EvictOldestSessionLimitPolicy {
+		return sessions.ErrTooManySessions
+	}
+
+	name := indexName(m.Options, key)
+	for _, userSession := range userSessions[:excess] {
+		if err := m.revokeSession(req.Context(), name, userSession.ID); err != nil {
+			return err
+		}
+		logger.PrintAuthf(key.Value, req, logger.AuthSuccess, "Evicted session %s of %s %q created at %s: maximum of %d sessions reached",
+			userSession.ID, key.Attribute, key.Value, userSession.CreatedAt, m.MaxPerUser)
+	}
+	return nil
+}
+
+// lockUserSessions locks the sessions of the user of the session when their
+// number is limited, waiting for concurrent sign ins of the user. The
+// returned func releases the lock.
+func (m *Manager) lockUserSessions(ctx context.Context, s *sessions.SessionState) (func(), error) {
+	key, ok := userIndexKey(s)
+	if m.MaxPerUser <= 0 || !ok {
+		return func() {}, nil
+	}
+
+	lock := m.Store.Lock(indexName(m.Options, key))
+	ctx, cancel := context.WithTimeout(ctx, userSessionsLockTimeout)
+	defer cancel()
+	for {
+		err := lock.Obtain(ctx, userSessionsLockDuration)
+		switch {
+		case err == nil:
+			return func() {
+				if err := lock.Release(context.Background()); err != nil && !errors.Is(err, sessions.ErrNotLocked) {
+					logger.Errorf("Error releasing the lock on the sessions of %s %q: %v", key.Attribute, key.Value, err)
+				}
+			}, nil
+		case !errors.Is(err, sessions.ErrLockNotObtained):
+			return nil, fmt.Errorf("error locking the sessions of the user: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out after %s waiting for the lock on the sessions of the user", userSessionsLockTimeout)
+		case <-time.After(userSessionsRetryPeriod):
+		}
+	}
+}
+
+// replaceTicketSession prepares replacing the session saved under the ticket
+// of the request and returns whether the ticket can be reused for the new
+// session. It is reused for a session of the same user at the same provider,
+// and removed from the indexes the new session is not recorded in.
+// The session of another user, like one left in a stale cookie, is revoked
+// so that its indexes don't point at the new session, which gets a ticket of
+// its own and is checked against the limit of its user.
+func (m *Manager) replaceTicketSession(ctx context.Context, tckt *ticket, s *sessions.SessionState) (bool, error) {
+	ctx = sessions.WithPrimaryRead(ctx)
+	previous, err := tckt.loadSession(
+		func(key string) ([]byte, error) {
+			return m.Store.Load(ctx, key)
+		},
+		m.Store.Lock,
+	)
+	if err != nil {
+		// The previous session expired or can't be decoded, the new session
+		// replaces it like a new sign in
+		return false, nil
+	}
+
+	previousUser, _ := userIndexKey(previous)
+	user, _ := userIndexKey(s)
+	if previousUser != user {
+		err := tckt.clearSession(func(key string) error {
+			return m.Store.Clear(ctx, key)
+		})
+		if err != nil {
+			return false, fmt.Errorf("error clearing the previous session: %v", err)
+		}
+		return false, m.unindexSession(ctx, tckt.id, previous)
+	}
+
+	keys := make(map[sessions.IndexKey]struct{})
+	for _, key := range indexKeys(s) {
+		keys[key] = struct{}{}
+	}
+	for _, key := range indexKeys(previous) {
+		if _, ok := keys[key]; ok {
+			continue
+		}
+		if err := m.Store.RemoveFromIndex(ctx, indexName(m.Options, key), tckt.id); err != nil {
+			return false, fmt.Errorf("error removing session from index: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// revokeSession clears the session from the Store and removes it from the index
+func (m *Manager) revokeSession(ctx context.Context, index string, id string) error {
+	if err := m.Store.Clear(ctx, id); err != nil {
+		return fmt.Errorf("error revoking session: %v", err)
+	}
+	if err := m.Store.RemoveFromIndex(ctx, index, id); err != nil {
+		return fmt.Errorf("error removing session from index: %v", err)
+	}
+	return nil
+}
+
+// indexSession records the ticket ID in the indexes for the session
+func (m *Manager) indexSession(ctx context.Context, id string, s *sessions.SessionState) error {
+	for _, key := range indexKeys(s) {
+		err := m.Store.AddToIndex(ctx, indexName(m.Options, key), id, *s.CreatedAt, m.Options.Expire)
+		if err != nil {
+			return fmt.Errorf("error indexing session: %v", err)
+		}
+	}
+	return nil
+}
+
+// unindexSession removes the ticket ID from the indexes for the session
+func (m *Manager) unindexSession(ctx context.Context, id string, s *sessions.SessionState) error {
+	for _, key := range indexKeys(s) {
+		if err := m.Store.RemoveFromIndex(ctx, indexName(m.Options, key), id); err != nil {
+			return fmt.Errorf("error removing session from index: %v", err)
+		}
+	}
+	return nil
 }
@@ -1,12 +1,16 @@
 package persistence
 
 import (
+	"context"
+	"errors"
+	"net/http/httptest"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Persistence Manager Tests", func() {
@@ -15,11 +19,92 @@ var _ = Describe("Persistence Manager Tests", func() {
 		ms = tests.NewMockStore()
 	})
 	tests.RunSessionStoreTests(
-		func(_ *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
-			return NewManager(ms, cookieOpts), nil
+		func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+			return NewManager(ms, opts, cookieOpts), nil
 		},
 		func(d time.Duration) error {
 			ms.FastForward(d)
 			return nil
 		})
 })
+
+// limitTestStore is a MockStore whose loads can fail and whose locks can be
+// held by another sign in. It counts the loads that may be served by replicas.
+type limitTestStore struct {
+	*tests.MockStore
+	loadErr      error
+	locked       bool
+	replicaLoads int
+}
+
+func (s *limitTestStore) Load(ctx context.Context, key string) ([]byte, error) {
+	if !sessionsapi.IsPrimaryRead(ctx) {
+		s.replicaLoads++
+	}
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	return s.MockStore.Load(ctx, key)
+}
+
+func (s *limitTestStore) Lock(key string) sessionsapi.Lock {
+	if s.locked {
+		return heldLock{}
+	}
+	return s.MockStore.Lock(key)
+}
+
+// heldLock is a lock held by someone else
+type heldLock struct{}
+
+func (heldLock) Obtain(context.Context, time.Duration) error  { return sessionsapi.ErrLockNotObtained }
+func (heldLock) Peek(context.Context) (bool, error)           { return true, nil }
+func (heldLock) Refresh(context.Context, time.Duration) error { return sessionsapi.ErrNotLocked }
+func (heldLock) Release(context.Context) error                { return sessionsapi.ErrNotLocked }
+
+var _ = Describe("Manager with a limit on the sessions per user", func() {
+	var store *limitTestStore
+	var manager *Manager
+
+	signIn := func() error {
+		session := &sessionsapi.SessionState{User: "john.doe", Email: "john.doe@example.com"}
+		return manager.Save(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil), session)
+	}
+
+	BeforeEach(func() {
+		store = &limitTestStore{MockStore: tests.NewMockStore()}
+		manager = NewManager(store, &options.SessionOptions{
+			MaxPerUser:  2,
+			LimitPolicy: options.RejectSessionLimitPolicy,
+		}, &options.Cookie{
+			Name:   "_oauth2_proxy",
+			Secret: "0123456789abcdefghijklmnopqrstuv",
+			Expire: time.Hour,
+		})
+		Expect(signIn()).To(Succeed())
+	})
+
+	It("checks the limit against the sessions loaded with primary reads", func() {
+		Expect(signIn()).To(Succeed())
+		Expect(signIn()).To(MatchError(sessionsapi.ErrTooManySessions))
+		Expect(store.replicaLoads).To(BeZero())
+	})
+
+	It("fails sign ins when the sessions of the user can't be loaded", func() {
+		store.loadErr = errors.New("connection refused")
+
+		Expect(signIn()).To(MatchError("error loading indexed session: connection refused"))
+	})
+
+	It("fails sign ins while a concurrent sign in of the user holds the lock", func() {
+		timeout := userSessionsLockTimeout
+		userSessionsLockTimeout = 50 * time.Millisecond
+		defer func() { userSessionsLockTimeout = timeout }()
+		store.locked = true
+
+		Expect(signIn()).To(MatchError("timed out after 50ms waiting for the lock on the sessions of the user"))
+
+		store.locked = false
+		Expect(signIn()).To(Succeed())
+	})
+})
@@ -100,7 +100,9 @@ func decodeTicketFromRequest(req *http.Request, cookieOpts *options.Cookie) (*ti
 	}
 
 	// An existing cookie exists, try to retrieve the ticket
-	val, _, ok := encryption.Validate(requestCookie, cookieOpts.Secret, cookieOpts.Expire)
+	// Tickets signed with a previous secret are signed with the current
+	// secret when the session is next saved
+	val, _, _, ok := encryption.ValidateAny(requestCookie, cookieOpts.Secrets(), cookieOpts.Expire)
 	if !ok {
 		return nil, fmt.Errorf("session ticket cookie failed validation: %v", err)
 	}
@@ -11,9 +11,16 @@ import (
 // Client is wrapper interface for redis.Client and redis.ClusterClient.
 type Client interface {
 	Get(ctx context.Context, key string) ([]byte, error)
+	// GetPrimary loads the key from the primary, even when Get loads it
+	// from the replicas
+	GetPrimary(ctx context.Context, key string) ([]byte, error)
 	Lock(key string) sessions.Lock
 	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
 	Del(ctx context.Context, key string) error
+	HSet(ctx context.Context, key string, field string, value string) error
+	HDel(ctx context.Context, key string, field string) error
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	Expire(ctx context.Context, key string, expiration time.Duration) error
 }
 
 var _ Client = (*client)(nil)
@@ -32,6 +39,10 @@ func (c *client) Get(ctx context.Context, key string) ([]byte, error) {
 	return c.Client.Get(ctx, key).Bytes()
 }
 
+func (c *client) GetPrimary(ctx context.Context, key string) ([]byte, error) {
+	return c.Get(ctx, key)
+}
+
 func (c *client) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
 	return c.Client.Set(ctx, key, value, expiration).Err()
 }
@@ -40,6 +51,22 @@ func (c *client) Del(ctx context.Context, key string) error {
 	return c.Client.Del(ctx, key).Err()
 }
 
+func (c *client) HSet(ctx context.Context, key string, field string, value string) error {
+	return c.Client.HSet(ctx, key, field, value).Err()
+}
+
+func (c *client) HDel(ctx context.Context, key string, field string) error {
+	return c.Client.HDel(ctx, key, field).Err()
+}
+
+func (c *client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.Client.HGetAll(ctx, key).Result()
+}
+
+func (c *client) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return c.Client.Expire(ctx, key, expiration).Err()
+}
+
 func (c *client) Lock(key string) sessions.Lock {
 	return NewLock(c.Client, key)
 }
@@ -60,6 +87,10 @@ func (c *clusterClient) Get(ctx context.Context, key string) ([]byte, error) {
 	return c.ClusterClient.Get(ctx, key).Bytes()
 }
 
+func (c *clusterClient) GetPrimary(ctx context.Context, key string) ([]byte, error) {
+	return c.Get(ctx, key)
+}
+
 func (c *clusterClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
 	return c.ClusterClient.Set(ctx, key, value, expiration).Err()
 }
@@ -68,6 +99,22 @@ func (c *clusterClient) Del(ctx context.Context, key string) error {
 	return c.ClusterClient.Del(ctx, key).Err()
 }
 
+func (c *clusterClient) HSet(ctx context.Context, key string, field string, value string) error {
+	return c.ClusterClient.HSet(ctx, key, field, value).Err()
+}
+
+func (c *clusterClient) HDel(ctx context.Context, key string, field string) error {
+	return c.ClusterClient.HDel(ctx, key, field).Err()
+}
+
+func (c *clusterClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.ClusterClient.HGetAll(ctx, key).Result()
+}
+
+func (c *clusterClient) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return c.ClusterClient.Expire(ctx, key, expiration).Err()
+}
+
 func (c *clusterClient) Lock(key string) sessions.Lock {
 	return NewLock(c.ClusterClient, key)
 }
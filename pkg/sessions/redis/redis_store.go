@@ -3,8 +3,10 @@ package redis
 import (
 	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -31,7 +33,7 @@ func NewRedisSessionStore(opts *options.SessionOptions, cookieOpts *options.Cook
 	rs := &SessionStore{
 		Client: client,
 	}
-	return persistence.NewManager(rs, cookieOpts), nil
+	return persistence.NewManager(rs, opts, cookieOpts), nil
 }
 
 // Save takes a sessions.SessionState and stores the information from it
@@ -45,9 +47,17 @@ func (store *SessionStore) Save(ctx context.Context, key string, value []byte, e
 }
 
 // Load reads sessions.SessionState information from a persistence
-// cookie within the HTTP request object
+// cookie within the HTTP request object.
+// Loads with a primary read context skip the replicas.
 func (store *SessionStore) Load(ctx context.Context, key string) ([]byte, error) {
-	value, err := store.Client.Get(ctx, key)
+	get := store.Client.Get
+	if sessions.IsPrimaryRead(ctx) {
+		get = store.Client.GetPrimary
+	}
+	value, err := get(ctx, key)
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("error loading redis session %q: %w", key, sessions.ErrSessionNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error loading redis session: %v", err)
 	}
@@ -69,6 +79,52 @@ func (store *SessionStore) Lock(key string) sessions.Lock {
 	return store.Client.Lock(key)
 }
 
+// AddToIndex records the key in a redis hash with its creation time and
+// extends the expiration of the hash
+func (store *SessionStore) AddToIndex(ctx context.Context, index string, key string, createdAt time.Time, exp time.Duration) error {
+	err := store.Client.HSet(ctx, index, key, strconv.FormatInt(createdAt.UnixNano(), 10))
+	if err != nil {
+		return fmt.Errorf("error adding session to redis index: %v", err)
+	}
+	err = store.Client.Expire(ctx, index, exp)
+	if err != nil {
+		return fmt.Errorf("error setting expiration of redis index: %v", err)
+	}
+	return nil
+}
+
+// RemoveFromIndex removes the key from the redis hash of the index
+func (store *SessionStore) RemoveFromIndex(ctx context.Context, index string, key string) error {
+	err := store.Client.HDel(ctx, index, key)
+	if err != nil {
+		return fmt.Errorf("error removing session from redis index: %v", err)
+	}
+	return nil
+}
+
+// LoadIndex returns the keys and creation times in the redis hash of the index
+func (store *SessionStore) LoadIndex(ctx context.Context, index string) (map[string]time.Time, error) {
+	fields, err := store.Client.HGetAll(ctx, index)
+	if err != nil {
+		return nil, fmt.Errorf("error loading redis index: %v", err)
+	}
+
+	keys := make(map[string]time.Time, len(fields))
+	for key, value := range fields {
+		createdAt, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing creation time of %q in redis index: %v", key, err)
+		}
+		keys[key] = time.Unix(0, createdAt)
+	}
+	return keys, nil
+}
+
+// Close closes the connections to redis
+func (store *SessionStore) Close() error {
+	return closeClient(store.Client)
+}
+
 // NewRedisClient makes a redis.Client (either standalone, sentinel aware, or
 // redis cluster)
 func NewRedisClient(opts options.RedisStoreOptions) (Client, error) {
@@ -81,6 +137,9 @@ func NewRedisClient(opts options.RedisStoreOptions) (Client, error) {
 	if opts.UseCluster {
 		return buildClusterClient(opts)
 	}
+	if opts.ReadFromReplicas {
+		return nil, fmt.Errorf("option redis-read-from-replicas requires redis-use-sentinel or redis-use-cluster")
+	}
 
 	return buildStandaloneClient(opts)
 }
@@ -92,13 +151,22 @@ func buildSentinelClient(opts options.RedisStoreOptions) (Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not parse redis urls: %v", err)
 	}
-	client := redis.NewFailoverClient(&redis.FailoverOptions{
+	failoverOpts := &redis.FailoverOptions{
 		MasterName:       opts.SentinelMasterName,
 		SentinelAddrs:    addrs,
 		SentinelPassword: opts.SentinelPassword,
+		Username:         opts.Username,
 		Password:         opts.Password,
-	})
-	return newClient(client), nil
+	}
+	client := newClient(redis.NewFailoverClient(failoverOpts))
+	if !opts.ReadFromReplicas {
+		return client, nil
+	}
+
+	replicaOpts := *failoverOpts
+	replicaOpts.SlaveOnly = true
+	replica := newClient(redis.NewFailoverClient(&replicaOpts))
+	return newReplicaReadClient(client, replica), nil
 }
 
 // buildClusterClient makes a redis.Client that is Redis Cluster aware
@@ -107,11 +175,21 @@ func buildClusterClient(opts options.RedisStoreOptions) (Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not parse redis urls: %v", err)
 	}
-	client := redis.NewClusterClient(&redis.ClusterOptions{
+	clusterOpts := &redis.ClusterOptions{
 		Addrs:    addrs,
+		Username: opts.Username,
 		Password: opts.Password,
-	})
-	return newClusterClient(client), nil
+	}
+	client := newClusterClient(redis.NewClusterClient(clusterOpts))
+	if !opts.ReadFromReplicas {
+		return client, nil
+	}
+
+	replicaOpts := *clusterOpts
+	replicaOpts.ReadOnly = true
+	replicaOpts.RouteByLatency = opts.RouteByLatency
+	replica := newClusterClient(redis.NewClusterClient(&replicaOpts))
+	return newReplicaReadClient(client, replica), nil
 }
 
 // buildStandaloneClient makes a redis.Client that connects to a simple
@@ -122,6 +200,9 @@ func buildStandaloneClient(opts options.RedisStoreOptions) (Client, error) {
 		return nil, fmt.Errorf("unable to parse redis url: %s", err)
 	}
 
+	if opts.Username != "" {
+		opt.Username = opts.Username
+	}
 	if opts.Password != "" {
 		opt.Password = opts.Password
 	}
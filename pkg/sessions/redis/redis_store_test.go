@@ -142,6 +142,62 @@ var _ = Describe("Redis SessionStore Tests", func() {
 		)
 	})
 
+	Context("with sentinel and replica reads", func() {
+		var ms *minisentinel.Sentinel
+
+		BeforeEach(func() {
+			ms = minisentinel.NewSentinel(mr)
+			Expect(ms.Start()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			ms.Close()
+		})
+
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				// minisentinel reports the primary as the replica
+				sentinelAddr := "redis://" + ms.Addr()
+				opts.Type = options.RedisSessionStoreType
+				opts.Redis.SentinelConnectionURLs = []string{sentinelAddr}
+				opts.Redis.UseSentinel = true
+				opts.Redis.SentinelMasterName = ms.MasterInfo().Name
+				opts.Redis.ReadFromReplicas = true
+
+				// Capture the session store so that we can close the client
+				var err error
+				ss, err = NewRedisSessionStore(opts, cookieOpts)
+				return ss, err
+			},
+			func(d time.Duration) error {
+				mr.FastForward(d)
+				return nil
+			},
+		)
+	})
+
+	Context("with cluster and replica reads", func() {
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				clusterAddr := "redis://" + mr.Addr()
+				opts.Type = options.RedisSessionStoreType
+				opts.Redis.ClusterConnectionURLs = []string{clusterAddr}
+				opts.Redis.UseCluster = true
+				opts.Redis.ReadFromReplicas = true
+				opts.Redis.RouteByLatency = true
+
+				// Capture the session store so that we can close the client
+				var err error
+				ss, err = NewRedisSessionStore(opts, cookieOpts)
+				return ss, err
+			},
+			func(d time.Duration) error {
+				mr.FastForward(d)
+				return nil
+			},
+		)
+	})
+
 	Context("with a redis password", func() {
 		BeforeEach(func() {
 			mr.RequireAuth(redisPassword)
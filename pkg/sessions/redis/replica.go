@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	replicaReadHit   = "hit"
+	replicaReadMiss  = "miss"
+	replicaReadError = "error"
+)
+
+var _ Client = (*replicaReadClient)(nil)
+
+// replicaReadClient loads keys from the replicas and sends every other
+// command to the primary.
+// Replication is asynchronous so keys missing on the replicas are loaded
+// from the primary, which also serves reads when the replicas fail. Keys that
+// were changed or deleted recently may still have their previous value on
+// the replicas, reads that need the latest value use GetPrimary.
+type replicaReadClient struct {
+	Client
+	replica Client
+	reads   *prometheus.CounterVec
+}
+
+func newReplicaReadClient(primary, replica Client) Client {
+	return &replicaReadClient{
+		Client:  primary,
+		replica: replica,
+		reads:   registerReplicaReadsCounter(prometheus.DefaultRegisterer),
+	}
+}
+
+func (c *replicaReadClient) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.replica.Get(ctx, key)
+	switch {
+	case err == nil:
+		c.reads.WithLabelValues(replicaReadHit).Inc()
+		return value, nil
+	case errors.Is(err, redis.Nil):
+		c.reads.WithLabelValues(replicaReadMiss).Inc()
+	default:
+		c.reads.WithLabelValues(replicaReadError).Inc()
+		logger.Errorf("error loading key from redis replica, falling back to primary: %v", err)
+	}
+	return c.Client.Get(ctx, key)
+}
+
+// GetPrimary loads the key from the primary without trying the replicas
+func (c *replicaReadClient) GetPrimary(ctx context.Context, key string) ([]byte, error) {
+	return c.Client.Get(ctx, key)
+}
+
+// Close closes the connections to the primary and the replicas
+func (c *replicaReadClient) Close() error {
+	replicaErr := closeClient(c.replica)
+	if err := closeClient(c.Client); err != nil {
+		return err
+	}
+	return replicaErr
+}
+
+func closeClient(c Client) error {
+	if closer, ok := c.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// registerReplicaReadsCounter registers 'oauth2_proxy_redis_replica_reads_total'
+// This keeps a tally of the session loads sent to the redis replicas bucketed
+// by their result. Misses and errors are loaded again from the primary.
+func registerReplicaReadsCounter(registerer prometheus.Registerer) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oauth2_proxy_redis_replica_reads_total",
+			Help: "Total number of session loads from redis replicas by result.",
+		},
+		[]string{"result"},
+	)
+
+	if err := registerer.Register(counter); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			counter = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			panic(err)
+		}
+	}
+
+	return counter
+}
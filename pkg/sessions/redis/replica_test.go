@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/Bose/minisentinel"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Redis Client Tests", func() {
+	var primary, replica *miniredis.Miniredis
+	var ms *minisentinel.Sentinel
+
+	BeforeEach(func() {
+		var err error
+		primary, err = miniredis.Run()
+		Expect(err).ToNot(HaveOccurred())
+		replica, err = miniredis.Run()
+		Expect(err).ToNot(HaveOccurred())
+
+		ms = minisentinel.NewSentinel(primary)
+		Expect(ms.Start()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		ms.Close()
+		replica.Close()
+		primary.Close()
+	})
+
+	Context("with replica reads", func() {
+		var client Client
+		reads := registerReplicaReadsCounter(prometheus.DefaultRegisterer)
+
+		BeforeEach(func() {
+			client = newReplicaReadClient(
+				newClient(redis.NewClient(&redis.Options{Addr: primary.Addr()})),
+				newClient(redis.NewClient(&redis.Options{Addr: replica.Addr(), MaxRetries: -1})),
+			)
+		})
+
+		AfterEach(func() {
+			Expect(client.(*replicaReadClient).Close()).To(Succeed())
+		})
+
+		It("loads replicated keys from the replicas", func() {
+			Expect(replica.Set("key", "replica")).To(Succeed())
+			Expect(primary.Set("key", "primary")).To(Succeed())
+			hits := testutil.ToFloat64(reads.WithLabelValues(replicaReadHit))
+
+			value, err := client.Get(context.Background(), "key")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(value)).To(Equal("replica"))
+			Expect(testutil.ToFloat64(reads.WithLabelValues(replicaReadHit))).To(Equal(hits + 1))
+		})
+
+		It("loads keys missing on the replicas from the primary", func() {
+			Expect(primary.Set("key", "primary")).To(Succeed())
+			misses := testutil.ToFloat64(reads.WithLabelValues(replicaReadMiss))
+
+			value, err := client.Get(context.Background(), "key")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(value)).To(Equal("primary"))
+			Expect(testutil.ToFloat64(reads.WithLabelValues(replicaReadMiss))).To(Equal(misses + 1))
+		})
+
+		It("loads keys from the primary when the replicas fail", func() {
+			Expect(primary.Set("key", "primary")).To(Succeed())
+			replica.Close()
+			errors := testutil.ToFloat64(reads.WithLabelValues(replicaReadError))
+
+			value, err := client.Get(context.Background(), "key")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(value)).To(Equal("primary"))
+			Expect(testutil.ToFloat64(reads.WithLabelValues(replicaReadError))).To(Equal(errors + 1))
+		})
+
+		It("loads keys from the primary with GetPrimary", func() {
+			Expect(replica.Set("key", "stale")).To(Succeed())
+			Expect(primary.Set("key", "primary")).To(Succeed())
+			hits := testutil.ToFloat64(reads.WithLabelValues(replicaReadHit))
+
+			value, err := client.GetPrimary(context.Background(), "key")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(value)).To(Equal("primary"))
+			Expect(testutil.ToFloat64(reads.WithLabelValues(replicaReadHit))).To(Equal(hits))
+		})
+
+		It("writes to the primary", func() {
+			Expect(client.Set(context.Background(), "key", []byte("value"), time.Minute)).To(Succeed())
+			Expect(primary.Get("key")).To(Equal("value"))
+			Expect(replica.Exists("key")).To(BeFalse())
+
+			Expect(client.Del(context.Background(), "key")).To(Succeed())
+			Expect(primary.Exists("key")).To(BeFalse())
+		})
+	})
+
+	type usernameTableInput struct {
+		opts             func() options.RedisStoreOptions
+		expectedUsername string
+	}
+
+	DescribeTable("with an ACL username",
+		func(in usernameTableInput) {
+			c, err := NewRedisClient(in.opts())
+			Expect(err).ToNot(HaveOccurred())
+
+			switch c := c.(type) {
+			case *client:
+				Expect(c.Client.Options().Username).To(Equal(in.expectedUsername))
+				Expect(c.Close()).To(Succeed())
+			case *clusterClient:
+				Expect(c.ClusterClient.Options().Username).To(Equal(in.expectedUsername))
+				Expect(c.Close()).To(Succeed())
+			case *replicaReadClient:
+				Expect(c.Client.(*clusterClient).ClusterClient.Options().Username).To(Equal(in.expectedUsername))
+				Expect(c.replica.(*clusterClient).ClusterClient.Options().Username).To(Equal(in.expectedUsername))
+				Expect(c.Close()).To(Succeed())
+			default:
+				Fail("unexpected client type")
+			}
+		},
+		Entry("standalone", usernameTableInput{
+			opts: func() options.RedisStoreOptions {
+				return options.RedisStoreOptions{
+					ConnectionURL: "redis://" + primary.Addr(),
+					Username:      "oauth2-proxy",
+				}
+			},
+			expectedUsername: "oauth2-proxy",
+		}),
+		Entry("standalone with a username in the URL", usernameTableInput{
+			opts: func() options.RedisStoreOptions {
+				return options.RedisStoreOptions{
+					ConnectionURL: "redis://url-user:password@" + primary.Addr(),
+				}
+			},
+			expectedUsername: "url-user",
+		}),
+		Entry("standalone overriding the username in the URL", usernameTableInput{
+			opts: func() options.RedisStoreOptions {
+				return options.RedisStoreOptions{
+					ConnectionURL: "redis://url-user:password@" + primary.Addr(),
+					Username:      "oauth2-proxy",
+				}
+			},
+			expectedUsername: "oauth2-proxy",
+		}),
+		Entry("sentinel", usernameTableInput{
+			opts: func() options.RedisStoreOptions {
+				return options.RedisStoreOptions{
+					UseSentinel:            true,
+					SentinelConnectionURLs: []string{"redis://" + ms.Addr()},
+					SentinelMasterName:     ms.MasterInfo().Name,
+					Username:               "oauth2-proxy",
+				}
+			},
+			expectedUsername: "oauth2-proxy",
+		}),
+		Entry("cluster with replica reads", usernameTableInput{
+			opts: func() options.RedisStoreOptions {
+				return options.RedisStoreOptions{
+					UseCluster:            true,
+					ClusterConnectionURLs: []string{"redis://" + primary.Addr()},
+					Username:              "oauth2-proxy",
+					ReadFromReplicas:      true,
+				}
+			},
+			expectedUsername: "oauth2-proxy",
+		}),
+	)
+
+	It("requires sentinel or cluster for replica reads", func() {
+		_, err := NewRedisClient(options.RedisStoreOptions{
+			ConnectionURL:    "redis://" + primary.Addr(),
+			ReadFromReplicas: true,
+		})
+		Expect(err).To(MatchError("option redis-read-from-replicas requires redis-use-sentinel or redis-use-cluster"))
+	})
+})
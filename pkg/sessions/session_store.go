@@ -6,7 +6,10 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/memory"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/sql"
 )
 
 // NewSessionStore creates a SessionStore from the provided configuration
@@ -16,7 +19,22 @@ func NewSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (
 		return cookie.NewCookieSessionStore(opts, cookieOpts)
 	case options.RedisSessionStoreType:
 		return redis.NewRedisSessionStore(opts, cookieOpts)
+	case options.SQLSessionStoreType:
+		return sql.NewSQLSessionStore(opts, cookieOpts)
+	case options.MemorySessionStoreType:
+		return memory.NewMemorySessionStore(opts, cookieOpts)
 	default:
 		return nil, fmt.Errorf("unknown session store type '%s'", opts.Type)
 	}
 }
+
+// WithCookieOptions creates a SessionStore that uses the cookie options in place
+// of those of the store, for example after the cookie secret was rotated.
+// Persistent stores keep their sessions, only the tickets in the cookies are
+// encrypted with the cookie secret.
+func WithCookieOptions(store sessions.SessionStore, opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	if manager, ok := store.(*persistence.Manager); ok {
+		return persistence.NewManager(manager.Store, opts, cookieOpts), nil
+	}
+	return NewSessionStore(opts, cookieOpts)
+}
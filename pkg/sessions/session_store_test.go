@@ -10,8 +10,10 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions"
 	sessionscookie "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/memory"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/sql"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -76,6 +78,36 @@ var _ = Describe("NewSessionStore", func() {
 		})
 	})
 
+	Context("with type 'sql'", func() {
+		BeforeEach(func() {
+			opts.Type = options.SQLSessionStoreType
+			opts.SQL.Driver = sql.SQLiteDriver
+			opts.SQL.ConnectionURL = "file::memory:"
+			opts.SQL.TablePrefix = "oauth2_proxy"
+		})
+
+		It("creates a persistence.Manager that wraps a sql.SessionStore", func() {
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss).To(BeAssignableToTypeOf(&persistence.Manager{}))
+			Expect(ss.(*persistence.Manager).Store).To(BeAssignableToTypeOf(&sql.SessionStore{}))
+		})
+	})
+
+	Context("with type 'memory'", func() {
+		BeforeEach(func() {
+			opts.Type = options.MemorySessionStoreType
+			opts.Memory.MaxSessions = 100
+		})
+
+		It("creates a persistence.Manager that wraps a memory.SessionStore", func() {
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss).To(BeAssignableToTypeOf(&persistence.Manager{}))
+			Expect(ss.(*persistence.Manager).Store).To(BeAssignableToTypeOf(&memory.SessionStore{}))
+		})
+	})
+
 	Context("with an invalid type", func() {
 		BeforeEach(func() {
 			opts.Type = "invalid-type"
@@ -89,3 +121,47 @@ var _ = Describe("NewSessionStore", func() {
 		})
 	})
 })
+
+var _ = Describe("WithCookieOptions", func() {
+	var opts *options.SessionOptions
+	var cookieOpts *options.Cookie
+
+	BeforeEach(func() {
+		opts = &options.SessionOptions{}
+		cookieOpts = &options.Cookie{
+			Name:   "_oauth2_proxy",
+			Secret: "0123456789abcdef0123456789abcdef",
+			Path:   "/",
+			Expire: time.Duration(168) * time.Hour,
+		}
+	})
+
+	It("keeps the store of a persistence.Manager", func() {
+		opts.Type = options.MemorySessionStoreType
+		opts.Memory.MaxSessions = 100
+		ss, err := sessions.NewSessionStore(opts, cookieOpts)
+		Expect(err).NotTo(HaveOccurred())
+
+		rotated := *cookieOpts
+		rotated.Secret = "fedcba9876543210fedcba9876543210"
+		rotated.PreviousSecrets = []string{cookieOpts.Secret}
+		rotatedSS, err := sessions.WithCookieOptions(ss, opts, &rotated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rotatedSS).To(BeAssignableToTypeOf(&persistence.Manager{}))
+		Expect(rotatedSS.(*persistence.Manager).Store).To(BeIdenticalTo(ss.(*persistence.Manager).Store))
+		Expect(rotatedSS.(*persistence.Manager).Options).To(BeIdenticalTo(&rotated))
+	})
+
+	It("creates a new cookie.SessionStore", func() {
+		opts.Type = options.CookieSessionStoreType
+		ss, err := sessions.NewSessionStore(opts, cookieOpts)
+		Expect(err).NotTo(HaveOccurred())
+
+		rotated := *cookieOpts
+		rotated.Secret = "fedcba9876543210fedcba9876543210"
+		rotatedSS, err := sessions.WithCookieOptions(ss, opts, &rotated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rotatedSS).To(BeAssignableToTypeOf(&sessionscookie.SessionStore{}))
+		Expect(rotatedSS).ToNot(BeIdenticalTo(ss))
+	})
+})
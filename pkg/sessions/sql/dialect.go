@@ -0,0 +1,93 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// PostgresDriver is the driver name for PostgreSQL databases
+	PostgresDriver = "postgres"
+
+	// MySQLDriver is the driver name for MySQL databases
+	MySQLDriver = "mysql"
+
+	// SQLiteDriver is the driver name for SQLite databases
+	SQLiteDriver = "sqlite3"
+)
+
+// dialect captures the differences in SQL syntax between the supported
+// database drivers.
+type dialect struct {
+	// placeholder returns the bind parameter for the n-th (1 indexed)
+	// argument of a query.
+	placeholder func(n int) string
+
+	// keyType is the column type used for session and lock keys.
+	keyType string
+
+	// valueType is the column type used for encrypted session values.
+	valueType string
+
+	// upsertSuffix is appended to an INSERT statement to turn it into an
+	// update when a row with the same primary key already exists.
+	upsertSuffix func(key string, columns ...string) string
+}
+
+var dialects = map[string]*dialect{
+	PostgresDriver: {
+		placeholder:  func(n int) string { return fmt.Sprintf("$%d", n) },
+		keyType:      "VARCHAR(255)",
+		valueType:    "BYTEA",
+		upsertSuffix: onConflictUpdate,
+	},
+	MySQLDriver: {
+		placeholder:  func(int) string { return "?" },
+		keyType:      "VARCHAR(255)",
+		valueType:    "MEDIUMBLOB",
+		upsertSuffix: onDuplicateKeyUpdate,
+	},
+	SQLiteDriver: {
+		placeholder:  func(int) string { return "?" },
+		keyType:      "TEXT",
+		valueType:    "BLOB",
+		upsertSuffix: onConflictUpdate,
+	},
+}
+
+// getDialect returns the dialect for the given driver name
+func getDialect(driver string) (*dialect, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sql driver %q: supported drivers are %s, %s and %s",
+			driver, PostgresDriver, MySQLDriver, SQLiteDriver)
+	}
+	return d, nil
+}
+
+// placeholders returns the bind parameters for a query with count arguments
+func (d *dialect) placeholders(count int) string {
+	params := make([]string, 0, count)
+	for i := 1; i <= count; i++ {
+		params = append(params, d.placeholder(i))
+	}
+	return strings.Join(params, ", ")
+}
+
+// onConflictUpdate is the upsert syntax used by PostgreSQL and SQLite
+func onConflictUpdate(key string, columns ...string) string {
+	updates := make([]string, 0, len(columns))
+	for _, column := range columns {
+		updates = append(updates, fmt.Sprintf("%s = excluded.%s", column, column))
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", key, strings.Join(updates, ", "))
+}
+
+// onDuplicateKeyUpdate is the upsert syntax used by MySQL
+func onDuplicateKeyUpdate(_ string, columns ...string) string {
+	updates := make([]string, 0, len(columns))
+	for _, column := range columns {
+		updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", column, column))
+	}
+	return fmt.Sprintf(" ON DUPLICATE KEY UPDATE %s", strings.Join(updates, ", "))
+}
@@ -0,0 +1,147 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+const LockSuffix = "lock"
+
+// Lock is a sessions.Lock backed by a row in the locks table.
+// The primary key on the lock key guarantees only a single holder can insert
+// the row, the random token identifies the holder for refreshes and releases.
+type Lock struct {
+	store *SessionStore
+	key   string
+	token string
+}
+
+// NewLock instantiate a new lock instance. This will not yet apply a lock in the database.
+// For that you have to call Obtain(ctx context.Context, expiration time.Duration)
+func NewLock(store *SessionStore, key string) sessions.Lock {
+	return &Lock{
+		store: store,
+		key:   key,
+	}
+}
+
+// Obtain obtains a lock in the database for the configured key.
+func (l *Lock) Obtain(ctx context.Context, expiration time.Duration) error {
+	nonce, err := encryption.Nonce()
+	if err != nil {
+		return fmt.Errorf("error generating lock token: %v", err)
+	}
+	token := hex.EncodeToString(nonce)
+
+	// Remove a previous lock that has expired but was not yet cleaned up
+	_, err = l.store.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE lock_key = %s AND expires_at <= %s",
+		l.store.tables.locks, l.store.dialect.placeholder(1), l.store.dialect.placeholder(2)),
+		l.lockKey(), l.store.now())
+	if err != nil {
+		return err
+	}
+
+	_, err = l.store.DB.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (lock_key, token, expires_at) VALUES (%s)",
+		l.store.tables.locks, l.store.dialect.placeholders(3)),
+		l.lockKey(), token, l.store.expiry(expiration))
+	if err != nil {
+		// The insert fails on the primary key if the lock is already held
+		locked, perr := l.Peek(ctx)
+		if perr == nil && locked {
+			return sessions.ErrLockNotObtained
+		}
+		return err
+	}
+
+	l.token = token
+	return nil
+}
+
+// Refresh refreshes an already existing lock.
+func (l *Lock) Refresh(ctx context.Context, expiration time.Duration) error {
+	if l.token == "" {
+		return sessions.ErrNotLocked
+	}
+	result, err := l.store.DB.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET expires_at = %s WHERE lock_key = %s AND token = %s AND expires_at > %s",
+		l.store.tables.locks, l.store.dialect.placeholder(1), l.store.dialect.placeholder(2),
+		l.store.dialect.placeholder(3), l.store.dialect.placeholder(4)),
+		l.store.expiry(expiration), l.lockKey(), l.token, l.store.now())
+	if err != nil {
+		return err
+	}
+	err = requireRowAffected(result)
+	if err == sessions.ErrNotLocked {
+		// MySQL reports unchanged rows as unaffected, so double check the
+		// lock is still held if the expiry was unchanged.
+		held, herr := l.held(ctx)
+		if herr != nil {
+			return herr
+		}
+		if held {
+			return nil
+		}
+	}
+	return err
+}
+
+// Peek returns true, if the lock is still applied.
+func (l *Lock) Peek(ctx context.Context) (bool, error) {
+	var count int
+	err := l.store.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE lock_key = %s AND expires_at > %s",
+		l.store.tables.locks, l.store.dialect.placeholder(1), l.store.dialect.placeholder(2)),
+		l.lockKey(), l.store.now()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// held returns true if the lock row obtained by this Lock is still applied.
+func (l *Lock) held(ctx context.Context) (bool, error) {
+	var count int
+	err := l.store.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE lock_key = %s AND token = %s AND expires_at > %s",
+		l.store.tables.locks, l.store.dialect.placeholder(1), l.store.dialect.placeholder(2), l.store.dialect.placeholder(3)),
+		l.lockKey(), l.token, l.store.now()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Release releases the lock in the database.
+func (l *Lock) Release(ctx context.Context) error {
+	if l.token == "" {
+		return sessions.ErrNotLocked
+	}
+	result, err := l.store.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE lock_key = %s AND token = %s AND expires_at > %s",
+		l.store.tables.locks, l.store.dialect.placeholder(1), l.store.dialect.placeholder(2), l.store.dialect.placeholder(3)),
+		l.lockKey(), l.token, l.store.now())
+	if err != nil {
+		return err
+	}
+	l.token = ""
+	return requireRowAffected(result)
+}
+
+func (l *Lock) lockKey() string {
+	return fmt.Sprintf("%s.%s", l.key, LockSuffix)
+}
+
+// requireRowAffected returns sessions.ErrNotLocked when the statement did not
+// match the lock row held by this Lock
+func requireRowAffected(result dbsql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sessions.ErrNotLocked
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// tables holds the (prefixed) names of the tables used by the store
+type tables struct {
+	migrations string
+	sessions   string
+	locks      string
+	index      string
+}
+
+func newTables(prefix string) tables {
+	return tables{
+		migrations: prefix + "_schema_migrations",
+		sessions:   prefix + "_sessions",
+		locks:      prefix + "_session_locks",
+		index:      prefix + "_session_index",
+	}
+}
+
+// migration returns the statements that move the schema to the next version
+type migration func(d *dialect, t tables) []string
+
+// migrations are applied in order. The schema version is the index of the
+// migration plus one. Existing migrations must never be changed, new schema
+// changes must be appended as a new migration.
+var migrations = []migration{
+	// Version 1: sessions and locks tables
+	func(d *dialect, t tables) []string {
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+				session_key %s NOT NULL PRIMARY KEY,
+				value %s NOT NULL,
+				expires_at BIGINT NOT NULL
+			)`, t.sessions, d.keyType, d.valueType),
+			fmt.Sprintf("CREATE INDEX %s_expires_at ON %s (expires_at)", t.sessions, t.sessions),
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+				lock_key %s NOT NULL PRIMARY KEY,
+				token VARCHAR(64) NOT NULL,
+				expires_at BIGINT NOT NULL
+			)`, t.locks, d.keyType),
+		}
+	},
+	// Version 2: index of sessions per user
+	func(d *dialect, t tables) []string {
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+				index_key %s NOT NULL,
+				session_key %s NOT NULL,
+				created_at BIGINT NOT NULL,
+				expires_at BIGINT NOT NULL,
+				PRIMARY KEY (index_key, session_key)
+			)`, t.index, d.keyType, d.keyType),
+			fmt.Sprintf("CREATE INDEX %s_expires_at ON %s (expires_at)", t.index, t.index),
+		}
+	},
+}
+
+// migrate brings the database schema up to date with the latest migration.
+func migrate(ctx context.Context, db *dbsql.DB, d *dialect, t tables) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY)", t.migrations))
+	if err != nil {
+		return fmt.Errorf("error creating schema migrations table: %v", err)
+	}
+
+	current, err := schemaVersion(ctx, db, t)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		logger.Printf("Migrating sql session store schema to version %d", version)
+		if err := applyMigration(ctx, db, d, t, version); err != nil {
+			// Another instance may have applied the migration concurrently
+			if applied, verr := schemaVersion(ctx, db, t); verr == nil && applied >= version {
+				continue
+			}
+			return fmt.Errorf("error migrating sql session store schema to version %d: %v", version, err)
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the latest migration applied to the database
+func schemaVersion(ctx context.Context, db *dbsql.DB, t tables) (int, error) {
+	var version dbsql.NullInt64
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(version) FROM %s", t.migrations)).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("error reading schema version: %v", err)
+	}
+	return int(version.Int64), nil
+}
+
+// applyMigration runs a single migration and records its version in a
+// transaction. Note that MySQL implicitly commits schema changes so the
+// transaction only guarantees the version is recorded once.
+func applyMigration(ctx context.Context, db *dbsql.DB, d *dialect, t tables, version int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range migrations[version-1](d, t) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (version) VALUES (%s)", t.migrations, d.placeholder(1)), version)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,254 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	// Register the supported database drivers, SQLite is registered when
+	// built with cgo
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+)
+
+// SessionStore is an implementation of the persistence.Store
+// interface that stores sessions in a SQL database
+type SessionStore struct {
+	DB    *dbsql.DB
+	Clock clock.Clock
+
+	dialect *dialect
+	tables  tables
+	done    chan struct{}
+}
+
+// NewSQLSessionStore initialises a new instance of the SessionStore and wraps
+// it in a persistence.Manager
+func NewSQLSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	store, err := NewSQLStore(opts.SQL)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SQL.CleanupInterval > 0 {
+		store.done = make(chan struct{})
+		go store.runCleanup(opts.SQL.CleanupInterval, store.done)
+	}
+	return persistence.NewManager(store, opts, cookieOpts), nil
+}
+
+// NewSQLStore opens the database connection and migrates the schema to the
+// latest version
+func NewSQLStore(opts options.SQLStoreOptions) (*SessionStore, error) {
+	d, err := getDialect(opts.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := OpenDB(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SessionStore{
+		DB:      db,
+		dialect: d,
+		tables:  newTables(opts.TablePrefix),
+	}
+	if err := migrate(context.Background(), db, d, store.tables); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// OpenDB opens a connection pool to the database configured in the options
+func OpenDB(opts options.SQLStoreOptions) (*dbsql.DB, error) {
+	if _, err := getDialect(opts.Driver); err != nil {
+		return nil, err
+	}
+	if opts.Driver == SQLiteDriver && !sqliteAvailable {
+		return nil, fmt.Errorf("sql driver %q is not available: this binary was built without cgo", opts.Driver)
+	}
+
+	db, err := dbsql.Open(opts.Driver, opts.ConnectionURL)
+	if err != nil {
+		return nil, fmt.Errorf("error opening sql connection: %v", err)
+	}
+	if opts.Driver == SQLiteDriver {
+		// SQLite only supports a single writer at a time
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// Save takes a sessions.SessionState and stores the information from it
+// to the database, and adds a new persistence cookie on the HTTP response writer
+func (store *SessionStore) Save(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	query := fmt.Sprintf("INSERT INTO %s (session_key, value, expires_at) VALUES (%s)",
+		store.tables.sessions, store.dialect.placeholders(3)) +
+		store.dialect.upsertSuffix("session_key", "value", "expires_at")
+
+	_, err := store.DB.ExecContext(ctx, query, key, value, store.expiry(exp))
+	if err != nil {
+		return fmt.Errorf("error saving sql session: %v", err)
+	}
+	return nil
+}
+
+// Load reads sessions.SessionState information from a persistence
+// cookie within the HTTP request object
+func (store *SessionStore) Load(ctx context.Context, key string) ([]byte, error) {
+	query := fmt.Sprintf("SELECT value FROM %s WHERE session_key = %s AND expires_at > %s",
+		store.tables.sessions, store.dialect.placeholder(1), store.dialect.placeholder(2))
+
+	var value []byte
+	err := store.DB.QueryRowContext(ctx, query, key, store.now()).Scan(&value)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return nil, fmt.Errorf("error loading sql session %q: %w", key, sessions.ErrSessionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading sql session: %v", err)
+	}
+	return value, nil
+}
+
+// Clear clears any saved session information for a given persistence cookie
+// from the database, and then clears the session
+func (store *SessionStore) Clear(ctx context.Context, key string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE session_key = %s",
+		store.tables.sessions, store.dialect.placeholder(1))
+
+	_, err := store.DB.ExecContext(ctx, query, key)
+	if err != nil {
+		return fmt.Errorf("error clearing the session from sql: %v", err)
+	}
+	return nil
+}
+
+// Lock creates a lock object for sessions.SessionState
+func (store *SessionStore) Lock(key string) sessions.Lock {
+	return NewLock(store, key)
+}
+
+// AddToIndex records the key in the index table with its creation time and
+// extends the expiration of all rows of the index
+func (store *SessionStore) AddToIndex(ctx context.Context, index string, key string, createdAt time.Time, exp time.Duration) error {
+	tx, err := store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error adding session to sql index: %v", err)
+	}
+
+	expiresAt := store.expiry(exp)
+	query := fmt.Sprintf("INSERT INTO %s (index_key, session_key, created_at, expires_at) VALUES (%s)",
+		store.tables.index, store.dialect.placeholders(4)) +
+		store.dialect.upsertSuffix("index_key, session_key", "created_at", "expires_at")
+	if _, err := tx.ExecContext(ctx, query, index, key, createdAt.UnixNano(), expiresAt); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error adding session to sql index: %v", err)
+	}
+
+	query = fmt.Sprintf("UPDATE %s SET expires_at = %s WHERE index_key = %s",
+		store.tables.index, store.dialect.placeholder(1), store.dialect.placeholder(2))
+	if _, err := tx.ExecContext(ctx, query, expiresAt, index); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error setting expiration of sql index: %v", err)
+	}
+	return tx.Commit()
+}
+
+// RemoveFromIndex removes the key from the index table
+func (store *SessionStore) RemoveFromIndex(ctx context.Context, index string, key string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE index_key = %s AND session_key = %s",
+		store.tables.index, store.dialect.placeholder(1), store.dialect.placeholder(2))
+
+	_, err := store.DB.ExecContext(ctx, query, index, key)
+	if err != nil {
+		return fmt.Errorf("error removing session from sql index: %v", err)
+	}
+	return nil
+}
+
+// LoadIndex returns the keys and creation times of the unexpired rows of the
+// index
+func (store *SessionStore) LoadIndex(ctx context.Context, index string) (map[string]time.Time, error) {
+	query := fmt.Sprintf("SELECT session_key, created_at FROM %s WHERE index_key = %s AND expires_at > %s",
+		store.tables.index, store.dialect.placeholder(1), store.dialect.placeholder(2))
+
+	rows, err := store.DB.QueryContext(ctx, query, index, store.now())
+	if err != nil {
+		return nil, fmt.Errorf("error loading sql index: %v", err)
+	}
+	defer rows.Close()
+
+	keys := map[string]time.Time{}
+	for rows.Next() {
+		var key string
+		var createdAt int64
+		if err := rows.Scan(&key, &createdAt); err != nil {
+			return nil, fmt.Errorf("error loading sql index: %v", err)
+		}
+		keys[key] = time.Unix(0, createdAt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error loading sql index: %v", err)
+	}
+	return keys, nil
+}
+
+// Cleanup removes all expired sessions and locks from the database
+func (store *SessionStore) Cleanup(ctx context.Context) error {
+	for _, table := range []string{store.tables.sessions, store.tables.locks, store.tables.index} {
+		query := fmt.Sprintf("DELETE FROM %s WHERE expires_at <= %s", table, store.dialect.placeholder(1))
+		if _, err := store.DB.ExecContext(ctx, query, store.now()); err != nil {
+			return fmt.Errorf("error removing expired rows from %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// Close stops the periodic cleanup and closes the database connections
+func (store *SessionStore) Close() error {
+	if store.done != nil {
+		close(store.done)
+		store.done = nil
+	}
+	return store.DB.Close()
+}
+
+// runCleanup periodically removes expired sessions and locks until done is
+// closed
+func (store *SessionStore) runCleanup(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := store.Cleanup(context.Background()); err != nil {
+				logger.Errorf("Error cleaning up sql session store: %v", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// now returns the current time in milliseconds since the epoch, which is the
+// precision expiry times are stored with
+func (store *SessionStore) now() int64 {
+	return store.Clock.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// expiry returns the time in milliseconds since the epoch after the duration
+func (store *SessionStore) expiry(d time.Duration) int64 {
+	return store.Clock.Now().Add(d).UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,181 @@
+package sql
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSessionStore(t *testing.T) {
+	logger.SetOutput(GinkgoWriter)
+	logger.SetErrOutput(GinkgoWriter)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SQL SessionStore")
+}
+
+var _ = Describe("SQL SessionStore Tests", func() {
+	var dir string
+	var store *SessionStore
+
+	storeOptions := func() options.SQLStoreOptions {
+		return options.SQLStoreOptions{
+			Driver:        SQLiteDriver,
+			ConnectionURL: filepath.Join(dir, "sessions.db"),
+			TablePrefix:   "oauth2_proxy",
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "oauth2-proxy-sql-store")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if store != nil {
+			Expect(store.Close()).To(Succeed())
+			store = nil
+		}
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	tests.RunSessionStoreTests(
+		func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+			opts.Type = options.SQLSessionStoreType
+			opts.SQL = storeOptions()
+
+			ss, err := NewSQLSessionStore(opts, cookieOpts)
+			if err != nil {
+				return nil, err
+			}
+
+			// Capture the store so that we can close the database and mock the time
+			store = ss.(*persistence.Manager).Store.(*SessionStore)
+			store.Clock.Set(time.Now())
+			return ss, nil
+		},
+		func(d time.Duration) error {
+			return store.Clock.Add(d)
+		},
+	)
+
+	Context("NewSQLStore", func() {
+		It("migrates the schema to the latest version", func() {
+			var err error
+			store, err = NewSQLStore(storeOptions())
+			Expect(err).ToNot(HaveOccurred())
+
+			version, err := schemaVersion(context.Background(), store.DB, store.tables)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal(len(migrations)))
+		})
+
+		It("can be reopened on an existing schema", func() {
+			first, err := NewSQLStore(storeOptions())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(first.DB.Close()).To(Succeed())
+
+			store, err = NewSQLStore(storeOptions())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns an error with an unsupported driver", func() {
+			opts := storeOptions()
+			opts.Driver = "oracle"
+
+			_, err := NewSQLStore(opts)
+			Expect(err).To(MatchError("unsupported sql driver \"oracle\": supported drivers are postgres, mysql and sqlite3"))
+		})
+	})
+
+	Context("Cleanup", func() {
+		BeforeEach(func() {
+			var err error
+			store, err = NewSQLStore(storeOptions())
+			Expect(err).ToNot(HaveOccurred())
+			store.Clock.Set(time.Now())
+
+			ctx := context.Background()
+			Expect(store.Save(ctx, "short", []byte("short"), time.Minute)).To(Succeed())
+			Expect(store.Save(ctx, "long", []byte("long"), time.Hour)).To(Succeed())
+			Expect(store.Lock("short").Obtain(ctx, time.Minute)).To(Succeed())
+		})
+
+		It("removes only expired sessions and locks", func() {
+			Expect(store.Clock.Add(2 * time.Minute)).To(Succeed())
+			Expect(store.Cleanup(context.Background())).To(Succeed())
+
+			var sessions, locks int
+			Expect(store.DB.QueryRow("SELECT COUNT(*) FROM oauth2_proxy_sessions").Scan(&sessions)).To(Succeed())
+			Expect(store.DB.QueryRow("SELECT COUNT(*) FROM oauth2_proxy_session_locks").Scan(&locks)).To(Succeed())
+			Expect(sessions).To(Equal(1))
+			Expect(locks).To(Equal(0))
+
+			value, err := store.Load(context.Background(), "long")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("long")))
+		})
+	})
+
+	Context("Close", func() {
+		It("stops the cleanup and closes the database", func() {
+			opts := &options.SessionOptions{SQL: storeOptions()}
+			opts.SQL.CleanupInterval = time.Millisecond
+			ss, err := NewSQLSessionStore(opts, &options.Cookie{})
+			Expect(err).ToNot(HaveOccurred())
+			sqlStore := ss.(*persistence.Manager).Store.(*SessionStore)
+			done := sqlStore.done
+
+			Expect(ss.(*persistence.Manager).Close()).To(Succeed())
+			Expect(done).To(BeClosed())
+			Expect(sqlStore.DB.Ping()).ToNot(Succeed())
+		})
+	})
+
+	Context("Lock", func() {
+		BeforeEach(func() {
+			var err error
+			store, err = NewSQLStore(storeOptions())
+			Expect(err).ToNot(HaveOccurred())
+			store.Clock.Set(time.Now())
+		})
+
+		It("can only be obtained by a single holder", func() {
+			ctx := context.Background()
+			first := store.Lock("key")
+			second := store.Lock("key")
+
+			Expect(first.Obtain(ctx, time.Minute)).To(Succeed())
+			Expect(second.Obtain(ctx, time.Minute)).To(Equal(sessionsapi.ErrLockNotObtained))
+			Expect(second.Release(ctx)).To(Equal(sessionsapi.ErrNotLocked))
+
+			Expect(first.Release(ctx)).To(Succeed())
+			Expect(second.Obtain(ctx, time.Minute)).To(Succeed())
+		})
+
+		It("can be obtained once the previous lock expired", func() {
+			ctx := context.Background()
+			first := store.Lock("key")
+			second := store.Lock("key")
+
+			Expect(first.Obtain(ctx, time.Minute)).To(Succeed())
+			Expect(store.Clock.Add(2 * time.Minute)).To(Succeed())
+			Expect(second.Obtain(ctx, time.Minute)).To(Succeed())
+
+			Expect(first.Refresh(ctx, time.Minute)).To(Equal(sessionsapi.ErrNotLocked))
+			Expect(first.Release(ctx)).To(Equal(sessionsapi.ErrNotLocked))
+		})
+	})
+})
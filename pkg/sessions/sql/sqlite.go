@@ -0,0 +1,10 @@
+//go:build cgo
+// +build cgo
+
+package sql
+
+// Register the SQLite driver, it requires cgo
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteAvailable is true when the SQLite driver is built in
+const sqliteAvailable = true
@@ -0,0 +1,7 @@
+//go:build !cgo
+// +build !cgo
+
+package sql
+
+// sqliteAvailable is false as the SQLite driver can't be built without cgo
+const sqliteAvailable = false
@@ -14,11 +14,19 @@ type entry struct {
 	expiration time.Duration
 }
 
+// index is a MockStore index of keys to their creation times with an
+// expiration
+type index struct {
+	keys       map[string]time.Time
+	expiration time.Duration
+}
+
 // MockStore is a generic in-memory implementation of persistence.Store
 // for mocking in tests
 type MockStore struct {
 	cache     map[string]entry
 	lockCache map[string]*MockLock
+	indexes   map[string]*index
 	elapsed   time.Duration
 }
 
@@ -27,6 +35,7 @@ func NewMockStore() *MockStore {
 	return &MockStore{
 		cache:     map[string]entry{},
 		lockCache: map[string]*MockLock{},
+		indexes:   map[string]*index{},
 		elapsed:   0 * time.Second,
 	}
 }
@@ -45,7 +54,7 @@ func (s *MockStore) Load(_ context.Context, key string) ([]byte, error) {
 	entry, ok := s.cache[key]
 	if !ok || entry.expiration <= s.elapsed {
 		delete(s.cache, key)
-		return nil, fmt.Errorf("key not found: %s", key)
+		return nil, fmt.Errorf("key not found: %s: %w", key, sessions.ErrSessionNotFound)
 	}
 	return entry.data, nil
 }
@@ -65,6 +74,47 @@ func (s *MockStore) Lock(key string) sessions.Lock {
 	return lock
 }
 
+// AddToIndex records the key in the index and extends the index expiration
+func (s *MockStore) AddToIndex(_ context.Context, name string, key string, createdAt time.Time, exp time.Duration) error {
+	idx := s.loadIndex(name)
+	if idx == nil {
+		idx = &index{keys: map[string]time.Time{}}
+		s.indexes[name] = idx
+	}
+	idx.keys[key] = createdAt
+	idx.expiration = s.elapsed + exp
+	return nil
+}
+
+// RemoveFromIndex removes the key from the index
+func (s *MockStore) RemoveFromIndex(_ context.Context, name string, key string) error {
+	if idx := s.loadIndex(name); idx != nil {
+		delete(idx.keys, key)
+	}
+	return nil
+}
+
+// LoadIndex returns a copy of the keys recorded in the index
+func (s *MockStore) LoadIndex(_ context.Context, name string) (map[string]time.Time, error) {
+	keys := map[string]time.Time{}
+	if idx := s.loadIndex(name); idx != nil {
+		for key, createdAt := range idx.keys {
+			keys[key] = createdAt
+		}
+	}
+	return keys, nil
+}
+
+// loadIndex returns the index if it exists and has not expired
+func (s *MockStore) loadIndex(name string) *index {
+	idx, ok := s.indexes[name]
+	if !ok || idx.expiration <= s.elapsed {
+		delete(s.indexes, name)
+		return nil
+	}
+	return idx
+}
+
 // FastForward simulates the flow of time to test expirations
 func (s *MockStore) FastForward(duration time.Duration) {
 	for _, mockLock := range s.lockCache {
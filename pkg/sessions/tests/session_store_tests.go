@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"crypto/rand"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	cookiesapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
@@ -106,6 +108,7 @@ func RunSessionStoreTests(newSS NewSessionStoreFunc, persistentFastForward Persi
 			SessionStoreInterfaceTests(&input)
 			if persistentFastForward != nil {
 				PersistentSessionStoreInterfaceTests(&input)
+				UserSessionStoreInterfaceTests(&input)
 			}
 		})
 
@@ -131,8 +134,111 @@ func RunSessionStoreTests(newSS NewSessionStoreFunc, persistentFastForward Persi
 			SessionStoreInterfaceTests(&input)
 			if persistentFastForward != nil {
 				PersistentSessionStoreInterfaceTests(&input)
+				UserSessionStoreInterfaceTests(&input)
 			}
 		})
+
+		if persistentFastForward != nil {
+			Context("with a limit on the sessions per user", func() {
+				Context("rejecting new sessions", func() {
+					BeforeEach(func() {
+						opts.MaxPerUser = 2
+						opts.LimitPolicy = options.RejectSessionLimitPolicy
+
+						var err error
+						ss, err = newSS(opts, input.cookieOpts)
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					UserSessionLimitTests(&input, options.RejectSessionLimitPolicy)
+				})
+
+				Context("evicting the oldest sessions", func() {
+					BeforeEach(func() {
+						opts.MaxPerUser = 2
+						opts.LimitPolicy = options.EvictOldestSessionLimitPolicy
+
+						var err error
+						ss, err = newSS(opts, input.cookieOpts)
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					UserSessionLimitTests(&input, options.EvictOldestSessionLimitPolicy)
+				})
+			})
+		}
+
+		Context("with a rotated cookie secret", func() {
+			var previousSecret string
+
+			BeforeEach(func() {
+				By("saving a session with the previous secret")
+				previousSecret = string(cookieSecret)
+				previousStore, err := newSS(opts, input.cookieOpts)
+				Expect(err).ToNot(HaveOccurred())
+
+				resp := httptest.NewRecorder()
+				err = previousStore.Save(resp, httptest.NewRequest("GET", "http://example.com/", nil), input.session)
+				Expect(err).ToNot(HaveOccurred())
+				for _, cookie := range resp.Result().Cookies() {
+					input.request.AddCookie(cookie)
+				}
+
+				By("rotating the secret")
+				secret := make([]byte, 32)
+				_, err = rand.Read(secret)
+				Expect(err).ToNot(HaveOccurred())
+
+				rotated := *input.cookieOpts
+				rotated.Secret = string(secret)
+				rotated.PreviousSecrets = []string{previousSecret}
+				input.cookieOpts = &rotated
+
+				ss, err = newSS(opts, input.cookieOpts)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			RotatedSecretTests(&input, &previousSecret)
+		})
+	})
+}
+
+// RotatedSecretTests checks sessions saved with a previous cookie secret are
+// loaded and re-issued with the current secret.
+func RotatedSecretTests(in *testInput, previousSecret *string) {
+	Context("when Load is called", func() {
+		LoadSessionTests(in)
+	})
+
+	Context("when Save is called with the loaded session", func() {
+		BeforeEach(func() {
+			loadedSession, err := in.ss().Load(in.request)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = in.ss().Save(in.response, in.request, loadedSession)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("signs the cookie with the current secret", func() {
+			cookies := in.response.Result().Cookies()
+			Expect(cookies).To(HaveLen(1))
+
+			_, _, ok := encryption.Validate(cookies[0], in.cookieOpts.Secret, in.cookieOpts.Expire)
+			Expect(ok).To(BeTrue())
+			_, _, ok = encryption.Validate(cookies[0], *previousSecret, in.cookieOpts.Expire)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("when the previous secret is no longer accepted", func() {
+		BeforeEach(func() {
+			in.cookieOpts.PreviousSecrets = nil
+		})
+
+		It("fails to load the session", func() {
+			_, err := in.ss().Load(in.request)
+			Expect(err).To(HaveOccurred())
+		})
 	})
 }
 
@@ -360,6 +466,248 @@ func PersistentSessionStoreInterfaceTests(in *testInput) {
 	})
 }
 
+func UserSessionStoreInterfaceTests(in *testInput) {
+	Context("when sessions are indexed by user", func() {
+		var uss sessionsapi.UserSessionStore
+		var firstRequest, secondRequest, otherRequest *http.Request
+		ctx := context.Background()
+		byEmail := sessionsapi.IndexKey{Attribute: sessionsapi.EmailIndex, Value: "john.doe@example.com"}
+		byUser := sessionsapi.IndexKey{Attribute: sessionsapi.UserIndex, Value: "john.doe"}
+		otherEmail := sessionsapi.IndexKey{Attribute: sessionsapi.EmailIndex, Value: "jane.doe@example.com"}
+
+		saveSession := func(email string, createdAt time.Time) *http.Request {
+			session := *in.session
+			session.Email = email
+			session.CreatedAt = &createdAt
+
+			resp := httptest.NewRecorder()
+			// Evictions are logged with the request scope
+			saveReq := middlewareapi.AddRequestScope(httptest.NewRequest("GET", "http://example.com/", nil), &middlewareapi.RequestScope{})
+			err := in.ss().Save(resp, saveReq, &session)
+			Expect(err).ToNot(HaveOccurred())
+
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			for _, cookie := range resp.Result().Cookies() {
+				req.AddCookie(cookie)
+			}
+			return req
+		}
+
+		listIDs := func(key sessionsapi.IndexKey) []string {
+			userSessions, err := uss.ListUserSessions(ctx, key)
+			Expect(err).ToNot(HaveOccurred())
+
+			ids := []string{}
+			for _, userSession := range userSessions {
+				ids = append(ids, userSession.ID)
+			}
+			return ids
+		}
+
+		BeforeEach(func() {
+			var ok bool
+			uss, ok = in.ss().(sessionsapi.UserSessionStore)
+			Expect(ok).To(BeTrue())
+
+			now := time.Now()
+			firstRequest = saveSession(byEmail.Value, now.Add(-time.Hour))
+			secondRequest = saveSession(byEmail.Value, now)
+			otherRequest = saveSession(otherEmail.Value, now)
+		})
+
+		It("lists the sessions of the user from oldest to newest", func() {
+			userSessions, err := uss.ListUserSessions(ctx, byEmail)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(userSessions).To(HaveLen(2))
+			Expect(userSessions[0].CreatedAt.Before(userSessions[1].CreatedAt)).To(BeTrue())
+			Expect(userSessions[0].ID).ToNot(Equal(userSessions[1].ID))
+		})
+
+		It("lists the sessions by user and by email", func() {
+			Expect(listIDs(byUser)).To(HaveLen(3))
+			Expect(listIDs(byEmail)).To(HaveLen(2))
+			Expect(listIDs(otherEmail)).To(HaveLen(1))
+		})
+
+		It("lists the sessions by subject and session ID", func() {
+			session := *in.session
+			session.Subject = "248289761001"
+			session.SessionID = "08a5019c-17e1-4977-8f42-65a12843ea02"
+			Expect(in.ss().Save(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil), &session)).To(Succeed())
+
+			Expect(listIDs(sessionsapi.IndexKey{Attribute: sessionsapi.SubjectIndex, Value: session.Subject})).To(HaveLen(1))
+			Expect(listIDs(sessionsapi.IndexKey{Attribute: sessionsapi.SessionIDIndex, Value: session.SessionID})).To(HaveLen(1))
+		})
+
+		It("removes cleared sessions from the index", func() {
+			Expect(in.ss().Clear(httptest.NewRecorder(), firstRequest)).To(Succeed())
+			Expect(listIDs(byEmail)).To(HaveLen(1))
+		})
+
+		It("revokes a single session", func() {
+			ids := listIDs(byEmail)
+			Expect(uss.RevokeUserSession(ctx, byEmail, ids[0])).To(Succeed())
+
+			Expect(listIDs(byEmail)).To(ConsistOf(ids[1]))
+			_, err := in.ss().Load(firstRequest)
+			Expect(err).To(HaveOccurred())
+			_, err = in.ss().Load(secondRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not revoke a session of another user", func() {
+			ids := listIDs(otherEmail)
+			Expect(uss.RevokeUserSession(ctx, byEmail, ids[0])).To(Equal(sessionsapi.ErrSessionNotFound))
+
+			_, err := in.ss().Load(otherRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("revokes all sessions of the user", func() {
+			revoked, err := uss.RevokeUserSessions(ctx, byEmail)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(revoked).To(Equal(2))
+
+			Expect(listIDs(byEmail)).To(BeEmpty())
+			_, err = in.ss().Load(firstRequest)
+			Expect(err).To(HaveOccurred())
+			_, err = in.ss().Load(secondRequest)
+			Expect(err).To(HaveOccurred())
+			_, err = in.ss().Load(otherRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not reuse the ticket of a stale cookie for another user", func() {
+			session := *in.session
+			session.User = "jane"
+			session.Email = otherEmail.Value
+			resp := httptest.NewRecorder()
+			Expect(in.ss().Save(resp, firstRequest, &session)).To(Succeed())
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			for _, cookie := range resp.Result().Cookies() {
+				req.AddCookie(cookie)
+			}
+
+			Expect(listIDs(byEmail)).To(HaveLen(1))
+			revoked, err := uss.RevokeUserSessions(ctx, byEmail)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(revoked).To(Equal(1))
+			_, err = in.ss().Load(req)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = in.ss().Load(firstRequest)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("removes a reused ticket from the indexes of the previous session", func() {
+			session, err := in.ss().Load(firstRequest)
+			Expect(err).ToNot(HaveOccurred())
+			session.Email = otherEmail.Value
+			Expect(in.ss().Save(httptest.NewRecorder(), firstRequest, session)).To(Succeed())
+
+			Expect(listIDs(byEmail)).To(HaveLen(1))
+			Expect(listIDs(otherEmail)).To(HaveLen(2))
+			Expect(listIDs(byUser)).To(HaveLen(3))
+		})
+
+		Context("after the cookie expire period", func() {
+			BeforeEach(func() {
+				Expect(in.persistentFastForward(in.cookieOpts.Expire + time.Minute)).To(Succeed())
+			})
+
+			It("does not list the expired sessions", func() {
+				Expect(listIDs(byEmail)).To(BeEmpty())
+			})
+		})
+	})
+}
+
+// UserSessionLimitTests checks a store limited to 2 sessions per user applies
+// the limit policy when a third session is saved.
+func UserSessionLimitTests(in *testInput, policy string) {
+	Context("when a user signs in more often than the limit", func() {
+		var requests []*http.Request
+		var saveErr error
+
+		saveProviderSession := func(providerID, user string, createdAt time.Time) (*http.Request, error) {
+			session := *in.session
+			session.ProviderID = providerID
+			session.User = user
+			session.CreatedAt = &createdAt
+
+			resp := httptest.NewRecorder()
+			// Evictions are logged with the request scope
+			saveReq := middlewareapi.AddRequestScope(httptest.NewRequest("GET", "http://example.com/", nil), &middlewareapi.RequestScope{})
+			err := in.ss().Save(resp, saveReq, &session)
+
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			for _, cookie := range resp.Result().Cookies() {
+				req.AddCookie(cookie)
+			}
+			return req, err
+		}
+		saveSession := func(user string, createdAt time.Time) (*http.Request, error) {
+			return saveProviderSession(in.session.ProviderID, user, createdAt)
+		}
+
+		BeforeEach(func() {
+			requests = nil
+			now := time.Now()
+			for i := 2; i >= 0; i-- {
+				req, err := saveSession("john.doe", now.Add(-time.Duration(i)*time.Minute))
+				requests = append(requests, req)
+				saveErr = err
+			}
+		})
+
+		It("keeps at most the limit of sessions", func() {
+			uss, ok := in.ss().(sessionsapi.UserSessionStore)
+			Expect(ok).To(BeTrue())
+
+			userSessions, err := uss.ListUserSessions(context.Background(), sessionsapi.IndexKey{Attribute: sessionsapi.UserIndex, Value: "john.doe"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(userSessions).To(HaveLen(2))
+		})
+
+		It("does not limit the sessions of other users", func() {
+			_, err := saveSession("jane.doe", time.Now())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not limit the sessions of the user at other providers", func() {
+			_, err := saveProviderSession("other-provider", "john.doe", time.Now())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("saves existing sessions again", func() {
+			session, err := in.ss().Load(requests[1])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(in.ss().Save(httptest.NewRecorder(), requests[1], session)).To(Succeed())
+		})
+
+		if policy == options.EvictOldestSessionLimitPolicy {
+			It("evicts the oldest session", func() {
+				Expect(saveErr).ToNot(HaveOccurred())
+
+				_, err := in.ss().Load(requests[0])
+				Expect(err).To(HaveOccurred())
+				for _, req := range requests[1:] {
+					_, err := in.ss().Load(req)
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+		} else {
+			It("rejects the new session", func() {
+				Expect(saveErr).To(Equal(sessionsapi.ErrTooManySessions))
+
+				for _, req := range requests[:2] {
+					_, err := in.ss().Load(req)
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+		}
+	})
+}
+
 func SessionStoreInterfaceTests(in *testInput) {
 	Context("when Save is called", func() {
 		Context("with no existing session", func() {
@@ -483,16 +831,19 @@ func LoadSessionTests(in *testInput) {
 		l := *loadedSession
 		l.CreatedAt = nil
 		l.ExpiresOn = nil
+		l.SignedInAt = nil
 		l.Lock = &sessionsapi.NoOpLock{}
 		s := *in.session
 		s.CreatedAt = nil
 		s.ExpiresOn = nil
+		s.SignedInAt = nil
 		s.Lock = &sessionsapi.NoOpLock{}
 		Expect(l).To(Equal(s))
 
 		// Compare time.Time separately
 		Expect(loadedSession.CreatedAt.Equal(*in.session.CreatedAt)).To(BeTrue())
 		Expect(loadedSession.ExpiresOn.Equal(*in.session.ExpiresOn)).To(BeTrue())
+		Expect(loadedSession.SignedInAt.Equal(*in.session.SignedInAt)).To(BeTrue())
 
 	})
 }
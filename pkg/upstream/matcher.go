@@ -0,0 +1,63 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// Matcher finds the upstream that serves a request path.
+// Upstreams are matched with the same precedence as the upstream proxy.
+type Matcher struct {
+	serveMux *mux.Router
+}
+
+// NewMatcher creates a Matcher for the given upstreams.
+func NewMatcher(upstreams options.Upstreams) (*Matcher, error) {
+	m := &Matcher{
+		serveMux: mux.NewRouter(),
+	}
+
+	// Sort a copy as sorting is done in place
+	sorted := make(options.Upstreams, len(upstreams))
+	copy(sorted, upstreams)
+
+	for _, upstream := range sortByPathLongest(sorted) {
+		route := m.serveMux.NewRoute().Name(upstream.ID)
+		switch {
+		case upstream.RewriteTarget != "":
+			rewriteRegExp, err := regexp.Compile(upstream.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q for upstream %q: %v", upstream.Path, upstream.ID, err)
+			}
+			route.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+				return rewriteRegExp.MatchString(req.URL.Path)
+			})
+		case strings.HasSuffix(upstream.Path, "/"):
+			route.PathPrefix(upstream.Path)
+		default:
+			route.Path(upstream.Path)
+		}
+	}
+	return m, nil
+}
+
+// Match returns the ID of the upstream that serves the path.
+// It returns false when no upstream serves the path.
+func (m *Matcher) Match(path string) (string, bool) {
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: path},
+	}
+
+	match := &mux.RouteMatch{}
+	if !m.serveMux.Match(req, match) || match.Route == nil {
+		return "", false
+	}
+	return match.Route.GetName(), true
+}
@@ -0,0 +1,71 @@
+package upstream
+
+import (
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Matcher", func() {
+	upstreams := options.Upstreams{
+		{ID: "root", Path: "/"},
+		{ID: "api", Path: "/api/"},
+		{ID: "exact", Path: "/api/exact"},
+		{ID: "rewrite", Path: "^/rewrite/(.*)$", RewriteTarget: "/$1"},
+	}
+
+	type matchTableInput struct {
+		upstreams        options.Upstreams
+		path             string
+		expectedUpstream string
+		expectedMatch    bool
+	}
+
+	DescribeTable("Match",
+		func(in matchTableInput) {
+			matcher, err := NewMatcher(in.upstreams)
+			Expect(err).ToNot(HaveOccurred())
+
+			upstreamID, ok := matcher.Match(in.path)
+			Expect(ok).To(Equal(in.expectedMatch))
+			Expect(upstreamID).To(Equal(in.expectedUpstream))
+		},
+		Entry("with a path under the root upstream", matchTableInput{
+			upstreams:        upstreams,
+			path:             "/foo/bar",
+			expectedUpstream: "root",
+			expectedMatch:    true,
+		}),
+		Entry("with a path under a longer prefix", matchTableInput{
+			upstreams:        upstreams,
+			path:             "/api/foo",
+			expectedUpstream: "api",
+			expectedMatch:    true,
+		}),
+		Entry("with an exact path", matchTableInput{
+			upstreams:        upstreams,
+			path:             "/api/exact",
+			expectedUpstream: "exact",
+			expectedMatch:    true,
+		}),
+		Entry("with a rewrite path", matchTableInput{
+			upstreams:        upstreams,
+			path:             "/rewrite/foo",
+			expectedUpstream: "rewrite",
+			expectedMatch:    true,
+		}),
+		Entry("with no matching upstream", matchTableInput{
+			upstreams:        options.Upstreams{{ID: "exact", Path: "/exact"}},
+			path:             "/other",
+			expectedUpstream: "",
+			expectedMatch:    false,
+		}),
+	)
+
+	It("does not sort the given upstreams", func() {
+		_, err := NewMatcher(upstreams)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(upstreams[0].ID).To(Equal("root"))
+	})
+})
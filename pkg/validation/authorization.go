@@ -0,0 +1,84 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateAuthorization checks the authorization rules of the upstreams are
+// well formed.
+func validateAuthorization(upstreams options.Upstreams) []string {
+	msgs := []string{}
+
+	for _, upstream := range upstreams {
+		upstreamAuthz := upstream.Authorization
+		if upstreamAuthz == nil {
+			continue
+		}
+		id := upstream.ID
+
+		if upstreamAuthz.DefaultPolicy != "" && !isValidAuthorizationPolicy(upstreamAuthz.DefaultPolicy) {
+			msgs = append(msgs, fmt.Sprintf("authorization rules for upstream %q have invalid defaultPolicy %q: must be allow or deny", id, upstreamAuthz.DefaultPolicy))
+		}
+
+		for i, rule := range upstreamAuthz.Rules {
+			msgs = append(msgs, validateAuthorizationRule(id, strconv.Itoa(i), rule)...)
+		}
+		msgs = append(msgs, validateAuthenticationRequirements(id, upstreamAuthz.Authentication)...)
+	}
+
+	return msgs
+}
+
+// validateAuthorizationRule checks a single rule of an upstream
+func validateAuthorizationRule(upstreamID, index string, rule options.AuthorizationRule) []string {
+	msgs := []string{}
+
+	ruleID := rule.ID
+	if ruleID == "" {
+		ruleID = index
+	}
+
+	if !isValidAuthorizationPolicy(rule.Policy) {
+		msgs = append(msgs, fmt.Sprintf("authorization rule %q of upstream %q has invalid policy %q: must be allow or deny", ruleID, upstreamID, rule.Policy))
+	}
+	if rule.Path != "" {
+		if _, err := regexp.Compile(rule.Path); err != nil {
+			msgs = append(msgs, fmt.Sprintf("authorization rule %q of upstream %q has invalid path %q: %v", ruleID, upstreamID, rule.Path, err))
+		}
+	}
+	for _, claim := range rule.Claims {
+		if claim.Claim == "" {
+			msgs = append(msgs, fmt.Sprintf("authorization rule %q of upstream %q has a claim requirement without a claim", ruleID, upstreamID))
+		}
+	}
+
+	return msgs
+}
+
+// validateAuthenticationRequirements checks the step-up authentication
+// requirements of an upstream
+func validateAuthenticationRequirements(upstreamID string, requirements *options.AuthenticationRequirements) []string {
+	msgs := []string{}
+	if requirements == nil {
+		return msgs
+	}
+
+	for _, acr := range requirements.AcrValues {
+		if acr == "" {
+			msgs = append(msgs, fmt.Sprintf("authentication requirements of upstream %q have an empty acr value", upstreamID))
+		}
+	}
+	if requirements.MaxAge != nil && requirements.MaxAge.Duration() <= 0 {
+		msgs = append(msgs, fmt.Sprintf("authentication requirements of upstream %q have a maxAge that is not positive", upstreamID))
+	}
+
+	return msgs
+}
+
+func isValidAuthorizationPolicy(policy options.AuthorizationPolicy) bool {
+	return policy == options.AllowPolicy || policy == options.DenyPolicy
+}
@@ -0,0 +1,86 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authorization", func() {
+	type validateAuthorizationTableInput struct {
+		authorization *options.UpstreamAuthorization
+		errStrings    []string
+	}
+
+	maxAge := options.Duration(5 * time.Minute)
+	zero := options.Duration(0)
+
+	DescribeTable("validateAuthorization",
+		func(o *validateAuthorizationTableInput) {
+			upstreams := options.Upstreams{
+				{ID: "app", Path: "/", URI: "http://localhost:8080"},
+				{ID: "admin", Path: "/admin/", URI: "http://localhost:8081", Authorization: o.authorization},
+			}
+			Expect(validateAuthorization(upstreams)).To(ConsistOf(o.errStrings))
+		},
+		Entry("with no authorization rules", &validateAuthorizationTableInput{
+			authorization: nil,
+			errStrings:    []string{},
+		}),
+		Entry("with valid authorization rules", &validateAuthorizationTableInput{
+			authorization: &options.UpstreamAuthorization{
+				Rules: []options.AuthorizationRule{
+					{Policy: options.AllowPolicy, Path: "^/admin/users", Groups: []string{"ops"}},
+					{Policy: options.DenyPolicy, Claims: []options.ClaimRequirement{{Claim: "roles"}}},
+				},
+				DefaultPolicy: options.DenyPolicy,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid policies", &validateAuthorizationTableInput{
+			authorization: &options.UpstreamAuthorization{
+				Rules:         []options.AuthorizationRule{{ID: "missing"}},
+				DefaultPolicy: "maybe",
+			},
+			errStrings: []string{
+				"authorization rules for upstream \"admin\" have invalid defaultPolicy \"maybe\": must be allow or deny",
+				"authorization rule \"missing\" of upstream \"admin\" has invalid policy \"\": must be allow or deny",
+			},
+		}),
+		Entry("with an invalid rule", &validateAuthorizationTableInput{
+			authorization: &options.UpstreamAuthorization{
+				Rules: []options.AuthorizationRule{
+					{Policy: options.AllowPolicy, Path: "^/(foo", Claims: []options.ClaimRequirement{{Values: []string{"bar"}}}},
+				},
+			},
+			errStrings: []string{
+				"authorization rule \"0\" of upstream \"admin\" has invalid path \"^/(foo\": error parsing regexp: missing closing ): `^/(foo`",
+				"authorization rule \"0\" of upstream \"admin\" has a claim requirement without a claim",
+			},
+		}),
+		Entry("with valid authentication requirements", &validateAuthorizationTableInput{
+			authorization: &options.UpstreamAuthorization{
+				Authentication: &options.AuthenticationRequirements{
+					AcrValues: []string{"gold"},
+					MaxAge:    &maxAge,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid authentication requirements", &validateAuthorizationTableInput{
+			authorization: &options.UpstreamAuthorization{
+				Authentication: &options.AuthenticationRequirements{
+					AcrValues: []string{"gold", ""},
+					MaxAge:    &zero,
+				},
+			},
+			errStrings: []string{
+				"authentication requirements of upstream \"admin\" have an empty acr value",
+				"authentication requirements of upstream \"admin\" have a maxAge that is not positive",
+			},
+		}),
+	)
+})
@@ -11,6 +11,9 @@ import (
 
 func validateCookie(o options.Cookie) []string {
 	msgs := validateCookieSecret(o.Secret)
+	for i, secret := range o.PreviousSecrets {
+		msgs = append(msgs, validateSecretLength(fmt.Sprintf("cookie_previous_secrets[%d]", i), secret)...)
+	}
 
 	if o.Refresh >= o.Expire {
 		msgs = append(msgs, fmt.Sprintf(
@@ -19,6 +22,12 @@ func validateCookie(o options.Cookie) []string {
 			o.Expire.String()))
 	}
 
+	if o.RefreshBeforeExpiry < 0 {
+		msgs = append(msgs, fmt.Sprintf(
+			"cookie_refresh_before_expiry (%q) must not be negative",
+			o.RefreshBeforeExpiry.String()))
+	}
+
 	switch o.SameSite {
 	case "", "none", "lax", "strict":
 	default:
@@ -53,6 +62,10 @@ func validateCookieSecret(secret string) []string {
 		return []string{"missing setting: cookie-secret"}
 	}
 
+	return validateSecretLength("cookie_secret", secret)
+}
+
+func validateSecretLength(name string, secret string) []string {
 	secretBytes := encryption.SecretBytes(secret)
 	// Check if the secret is a valid length
 	switch len(secretBytes) {
@@ -62,7 +75,7 @@ func validateCookieSecret(secret string) []string {
 	}
 	// Invalid secret size found, return a message
 	return []string{fmt.Sprintf(
-		"cookie_secret must be 16, 24, or 32 bytes to create an AES cipher, but is %d bytes",
-		len(secretBytes)),
+		"%s must be 16, 24, or 32 bytes to create an AES cipher, but is %d bytes",
+		name, len(secretBytes)),
 	}
 }
@@ -36,6 +36,8 @@ func TestValidateCookie(t *testing.T) {
 	invalidBase64SecretMsg := "cookie_secret must be 16, 24, or 32 bytes to create an AES cipher, but is 10 bytes"
 	refreshLongerThanExpireMsg := "cookie_refresh (\"1h0m0s\") must be less than cookie_expire (\"15m0s\")"
 	invalidSameSiteMsg := "cookie_samesite (\"invalid\") must be one of ['', 'lax', 'strict', 'none']"
+	negativeRefreshBeforeExpiryMsg := "cookie_refresh_before_expiry (\"-1m0s\") must not be negative"
+	invalidPreviousSecretMsg := "cookie_previous_secrets[1] must be 16, 24, or 32 bytes to create an AES cipher, but is 6 bytes"
 
 	testCases := []struct {
 		name       string
@@ -236,6 +238,44 @@ func TestValidateCookie(t *testing.T) {
 				invalidSameSiteMsg,
 			},
 		},
+		{
+			name: "with a negative refresh before expiry",
+			cookie: options.Cookie{
+				Name:     validName,
+				Secret:   validSecret,
+				Domains:  emptyDomains,
+				Path:     "",
+				Expire:   time.Hour,
+				Refresh:  15 * time.Minute,
+				Secure:   true,
+				HTTPOnly: false,
+				SameSite: "",
+
+				RefreshBeforeExpiry: -time.Minute,
+			},
+			errStrings: []string{
+				negativeRefreshBeforeExpiryMsg,
+			},
+		},
+		{
+			name: "with valid and invalid previous secrets",
+			cookie: options.Cookie{
+				Name:     validName,
+				Secret:   validSecret,
+				Domains:  emptyDomains,
+				Path:     "",
+				Expire:   time.Hour,
+				Refresh:  15 * time.Minute,
+				Secure:   true,
+				HTTPOnly: false,
+				SameSite: "",
+
+				PreviousSecrets: []string{validBase64Secret, invalidSecret},
+			},
+			errStrings: []string{
+				invalidPreviousSecretMsg,
+			},
+		},
 		{
 			name: "with a combination of configuration errors",
 			cookie: options.Cookie{
@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateJWTBearer checks the bearer token rules are well formed and can
+// take effect.
+func validateJWTBearer(o *options.Options) []string {
+	msgs := []string{}
+	jwtBearer := o.JWTBearer
+
+	configured := len(jwtBearer.Audiences) > 0 || jwtBearer.MaxAge != nil ||
+		len(jwtBearer.Claims) > 0 || len(jwtBearer.Routes) > 0
+	if configured && !o.SkipJwtBearerTokens {
+		msgs = append(msgs, "jwtBearer rules require skip-jwt-bearer-tokens to be enabled")
+	}
+
+	if jwtBearer.MaxAge != nil && jwtBearer.MaxAge.Duration() <= 0 {
+		msgs = append(msgs, fmt.Sprintf("jwtBearer maxAge must be positive, got %s", jwtBearer.MaxAge.Duration()))
+	}
+	for _, audience := range jwtBearer.Audiences {
+		if audience == "" {
+			msgs = append(msgs, "jwtBearer audiences must not be empty")
+		}
+	}
+	msgs = append(msgs, validateJWTBearerClaims("jwtBearer", jwtBearer.Claims)...)
+
+	for i, route := range jwtBearer.Routes {
+		prefix := fmt.Sprintf("jwtBearer route %d", i)
+		if route.Path != "" {
+			if _, err := regexp.Compile(route.Path); err != nil {
+				msgs = append(msgs, fmt.Sprintf("%s has invalid path %q: %v", prefix, route.Path, err))
+			}
+		}
+		if len(route.Scopes) == 0 && len(route.Claims) == 0 {
+			msgs = append(msgs, fmt.Sprintf("%s requires no scopes or claims", prefix))
+		}
+		msgs = append(msgs, validateJWTBearerClaims(prefix, route.Claims)...)
+	}
+	return msgs
+}
+
+func validateJWTBearerClaims(prefix string, claims []options.ClaimRequirement) []string {
+	msgs := []string{}
+	for _, claim := range claims {
+		if claim.Claim == "" {
+			msgs = append(msgs, fmt.Sprintf("%s has a claim requirement without a claim", prefix))
+		}
+	}
+	return msgs
+}
+
+// newAudienceVerifiers builds verifiers accepting bearer tokens issued by the
+// OIDC providers and the extra JWT issuers for the additional jwtBearer
+// audiences.
+func newAudienceVerifiers(o *options.Options, extraIssuers []jwtIssuer) ([]*oidc.IDTokenVerifier, []string) {
+	verifiers := []*oidc.IDTokenVerifier{}
+	msgs := []string{}
+
+	for _, audience := range o.JWTBearer.Audiences {
+		for _, p := range o.Providers {
+			if p.OIDCConfig.IssuerURL == "" {
+				continue
+			}
+			verifier, err := newProviderAudienceVerifier(p, audience)
+			if err != nil {
+				msgs = append(msgs, fmt.Sprintf("error building verifier for audience %q of provider %q: %s", audience, p.ID, err))
+				continue
+			}
+			verifiers = append(verifiers, verifier)
+		}
+
+		// Issuers already configured for this audience need no other verifier
+		seen := map[string]struct{}{}
+		for _, issuer := range extraIssuers {
+			if issuer.audience == audience {
+				seen[issuer.issuerURI] = struct{}{}
+			}
+		}
+		for _, issuer := range extraIssuers {
+			if _, ok := seen[issuer.issuerURI]; ok {
+				continue
+			}
+			seen[issuer.issuerURI] = struct{}{}
+
+			verifier, err := newVerifierFromJwtIssuer(jwtIssuer{issuerURI: issuer.issuerURI, audience: audience})
+			if err != nil {
+				msgs = append(msgs, fmt.Sprintf("error building verifier for audience %q of issuer %q: %s", audience, issuer.issuerURI, err))
+				continue
+			}
+			verifiers = append(verifiers, verifier)
+		}
+	}
+	return verifiers, msgs
+}
+
+// newProviderAudienceVerifier builds a verifier for the provider's issuer
+// that expects the audience instead of the provider's client ID.
+// configureOIDCProvider must have configured the provider first.
+func newProviderAudienceVerifier(p options.Provider, audience string) (*oidc.IDTokenVerifier, error) {
+	ctx := context.Background()
+	config := &oidc.Config{
+		ClientID:        audience,
+		SkipIssuerCheck: p.OIDCConfig.InsecureSkipIssuerVerification,
+	}
+	if p.OIDCConfig.SkipDiscovery {
+		keySet := oidc.NewRemoteKeySet(ctx, p.OIDCConfig.JwksURL)
+		return oidc.NewVerifier(p.OIDCConfig.IssuerURL, keySet, config), nil
+	}
+	provider, err := oidc.NewProvider(ctx, p.OIDCConfig.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Verifier(config), nil
+}
@@ -0,0 +1,74 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JWTBearer", func() {
+	type validateJWTBearerTableInput struct {
+		skipJwtBearerTokens bool
+		jwtBearer           options.JWTBearer
+		errStrings          []string
+	}
+
+	maxAge := options.Duration(time.Hour)
+	negativeMaxAge := options.Duration(-time.Minute)
+
+	DescribeTable("validateJWTBearer",
+		func(o *validateJWTBearerTableInput) {
+			opts := &options.Options{
+				SkipJwtBearerTokens: o.skipJwtBearerTokens,
+				JWTBearer:           o.jwtBearer,
+			}
+			Expect(validateJWTBearer(opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("with no bearer token rules", &validateJWTBearerTableInput{
+			errStrings: []string{},
+		}),
+		Entry("with valid bearer token rules", &validateJWTBearerTableInput{
+			skipJwtBearerTokens: true,
+			jwtBearer: options.JWTBearer{
+				Audiences: []string{"api://default"},
+				MaxAge:    &maxAge,
+				Claims:    []options.ClaimRequirement{{Claim: "azp", Values: []string{"frontend"}}},
+				Routes: []options.JWTBearerRoute{
+					{Path: "^/api/", Methods: []string{"POST"}, Scopes: []string{"write"}},
+					{Path: "^/admin/", Claims: []options.ClaimRequirement{{Claim: "roles", Values: []string{"admin"}}}},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("without skip-jwt-bearer-tokens", &validateJWTBearerTableInput{
+			jwtBearer: options.JWTBearer{
+				Audiences: []string{"api://default"},
+			},
+			errStrings: []string{"jwtBearer rules require skip-jwt-bearer-tokens to be enabled"},
+		}),
+		Entry("with invalid rules", &validateJWTBearerTableInput{
+			skipJwtBearerTokens: true,
+			jwtBearer: options.JWTBearer{
+				Audiences: []string{""},
+				MaxAge:    &negativeMaxAge,
+				Claims:    []options.ClaimRequirement{{Values: []string{"frontend"}}},
+				Routes: []options.JWTBearerRoute{
+					{Path: "^/api/(public", Scopes: []string{"read"}},
+					{Path: "^/admin/"},
+					{Claims: []options.ClaimRequirement{{}}},
+				},
+			},
+			errStrings: []string{
+				"jwtBearer maxAge must be positive, got -1m0s",
+				"jwtBearer audiences must not be empty",
+				"jwtBearer has a claim requirement without a claim",
+				"jwtBearer route 0 has invalid path \"^/api/(public\": error parsing regexp: missing closing ): `^/api/(public`",
+				"jwtBearer route 1 requires no scopes or claims",
+				"jwtBearer route 2 has a claim requirement without a claim",
+			},
+		}),
+	)
+})
@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateLDAP checks the LDAP options when an LDAP URL is configured
+func validateLDAP(o *options.Options) []string {
+	if o.LDAP.URL == "" {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if o.HtpasswdFile != "" {
+		msgs = append(msgs, "htpasswd-file and ldap-url cannot be used together")
+	}
+
+	u, err := url.Parse(o.LDAP.URL)
+	switch {
+	case err != nil:
+		msgs = append(msgs, fmt.Sprintf("invalid ldap-url (%q): %v", o.LDAP.URL, err))
+	case u.Scheme != "ldap" && u.Scheme != "ldaps":
+		msgs = append(msgs, fmt.Sprintf("ldap-url (%q) must use the ldap:// or ldaps:// scheme", o.LDAP.URL))
+	case u.Scheme == "ldaps" && o.LDAP.StartTLS:
+		msgs = append(msgs, "ldap-start-tls cannot be used with an ldaps:// ldap-url")
+	}
+
+	if o.LDAP.UserBaseDN == "" {
+		msgs = append(msgs, "missing setting: ldap-user-base-dn")
+	}
+	if o.LDAP.UserAttribute == "" {
+		msgs = append(msgs, "missing setting: ldap-user-attribute")
+	}
+	if o.LDAP.UserFilter != "" {
+		if _, err := ldap.CompileFilter(o.LDAP.UserFilter); err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid ldap-user-filter (%q): %v", o.LDAP.UserFilter, err))
+		}
+	}
+	if o.LDAP.PoolSize < 0 {
+		msgs = append(msgs, "ldap-pool-size must not be negative")
+	}
+	if o.LDAP.CacheTTL < 0 {
+		msgs = append(msgs, "ldap-cache-ttl must not be negative")
+	}
+	if o.LDAP.Timeout <= 0 {
+		msgs = append(msgs, "ldap-timeout must be greater than 0")
+	}
+	return msgs
+}
@@ -0,0 +1,100 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LDAP", func() {
+	validLDAP := func() options.LDAP {
+		return options.LDAP{
+			URL:           "ldap://ldap.example.com",
+			UserBaseDN:    "ou=users,dc=example,dc=com",
+			UserAttribute: "uid",
+			UserFilter:    "(objectClass=person)",
+			PoolSize:      5,
+			CacheTTL:      time.Minute,
+			Timeout:       10 * time.Second,
+		}
+	}
+
+	type validateLDAPTableInput struct {
+		opts       func(*options.Options)
+		errStrings []string
+	}
+
+	DescribeTable("validateLDAP",
+		func(in validateLDAPTableInput) {
+			o := &options.Options{LDAP: validLDAP()}
+			in.opts(o)
+			Expect(validateLDAP(o)).To(ConsistOf(in.errStrings))
+		},
+		Entry("without an LDAP URL", validateLDAPTableInput{
+			opts: func(o *options.Options) {
+				o.LDAP = options.LDAP{}
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a valid configuration", validateLDAPTableInput{
+			opts:       func(*options.Options) {},
+			errStrings: []string{},
+		}),
+		Entry("with StartTLS", validateLDAPTableInput{
+			opts: func(o *options.Options) {
+				o.LDAP.StartTLS = true
+			},
+			errStrings: []string{},
+		}),
+		Entry("with an htpasswd file", validateLDAPTableInput{
+			opts: func(o *options.Options) {
+				o.HtpasswdFile = "/etc/htpasswd"
+			},
+			errStrings: []string{"htpasswd-file and ldap-url cannot be used together"},
+		}),
+		Entry("with an invalid scheme", validateLDAPTableInput{
+			opts: func(o *options.Options) {
+				o.LDAP.URL = "https://ldap.example.com"
+			},
+			errStrings: []string{"ldap-url (\"https://ldap.example.com\") must use the ldap:// or ldaps:// scheme"},
+		}),
+		Entry("with StartTLS and LDAPS", validateLDAPTableInput{
+			opts: func(o *options.Options) {
+				o.LDAP.URL = "ldaps://ldap.example.com"
+				o.LDAP.StartTLS = true
+			},
+			errStrings: []string{"ldap-start-tls cannot be used with an ldaps:// ldap-url"},
+		}),
+		Entry("without a user base DN or attribute", validateLDAPTableInput{
+			opts: func(o *options.Options) {
+				o.LDAP.UserBaseDN = ""
+				o.LDAP.UserAttribute = ""
+			},
+			errStrings: []string{
+				"missing setting: ldap-user-base-dn",
+				"missing setting: ldap-user-attribute",
+			},
+		}),
+		Entry("with an invalid user filter", validateLDAPTableInput{
+			opts: func(o *options.Options) {
+				o.LDAP.UserFilter = "(objectClass=person"
+			},
+			errStrings: []string{"invalid ldap-user-filter (\"(objectClass=person\"): LDAP Result Code 201 \"Filter Compile Error\": ldap: unexpected end of filter"},
+		}),
+		Entry("with invalid pool, cache and timeout settings", validateLDAPTableInput{
+			opts: func(o *options.Options) {
+				o.LDAP.PoolSize = -1
+				o.LDAP.CacheTTL = -time.Minute
+				o.LDAP.Timeout = 0
+			},
+			errStrings: []string{
+				"ldap-pool-size must not be negative",
+				"ldap-cache-ttl must not be negative",
+				"ldap-timeout must be greater than 0",
+			},
+		}),
+	)
+})
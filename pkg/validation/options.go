@@ -2,18 +2,23 @@ package validation
 
 import (
 	"context"
+	"crypto"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/golang-jwt/jwt"
 	"github.com/mbland/hmacauth"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	optionsutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
@@ -24,9 +29,16 @@ import (
 // Validate checks that required options are set and validates those that they
 // are of the correct format
 func Validate(o *options.Options) error {
-	msgs := validateCookie(o.Cookie)
+	msgs := loadSecrets(o)
+	msgs = append(msgs, validateCookie(o.Cookie)...)
+	msgs = append(msgs, validateSessionLifetime(o)...)
+	msgs = append(msgs, validateSessionLimit(o)...)
 	msgs = append(msgs, validateSessionCookieMinimal(o)...)
 	msgs = append(msgs, validateRedisSessionStore(o)...)
+	msgs = append(msgs, validateSQLSessionStore(o)...)
+	msgs = append(msgs, validateMemorySessionStore(o)...)
+	msgs = append(msgs, validateAdminSessionStore(o)...)
+	msgs = append(msgs, validateLDAP(o)...)
 	msgs = append(msgs, prefixValues("injectRequestHeaders: ", validateHeaders(o.InjectRequestHeaders)...)...)
 	msgs = append(msgs, prefixValues("injectResponseHeaders: ", validateHeaders(o.InjectResponseHeaders)...)...)
 	msgs = append(msgs, validateProviders(o)...)
@@ -40,8 +52,8 @@ func Validate(o *options.Options) error {
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		}
 		http.DefaultClient = &http.Client{Transport: insecureTransport}
-	} else if len(o.Providers[0].CAFiles) > 0 {
-		pool, err := util.GetCertPool(o.Providers[0].CAFiles)
+	} else if caFiles := providerCAFiles(o.Providers); len(caFiles) > 0 {
+		pool, err := util.GetCertPool(caFiles)
 		if err == nil {
 			transport := http.DefaultTransport.(*http.Transport).Clone()
 			transport.TLSClientConfig = &tls.Config{
@@ -55,102 +67,29 @@ func Validate(o *options.Options) error {
 		}
 	}
 
-	if o.AuthenticatedEmailsFile == "" && len(o.EmailDomains) == 0 && o.HtpasswdFile == "" {
+	if o.AuthenticatedEmailsFile == "" && len(o.EmailDomains) == 0 && o.HtpasswdFile == "" && o.LDAP.URL == "" {
 		msgs = append(msgs, "missing setting for email validation: email-domain or authenticated-emails-file required."+
 			"\n      use email-domain=* to authorize all email addresses")
 	}
 
-	if o.Providers[0].OIDCConfig.IssuerURL != "" {
-
-		ctx := context.Background()
-
-		if o.Providers[0].OIDCConfig.InsecureSkipIssuerVerification && !o.Providers[0].OIDCConfig.SkipDiscovery {
-			// go-oidc doesn't let us pass bypass the issuer check this in the oidc.NewProvider call
-			// (which uses discovery to get the URLs), so we'll do a quick check ourselves and if
-			// we get the URLs, we'll just use the non-discovery path.
-
-			logger.Printf("Performing OIDC Discovery...")
-
-			requestURL := strings.TrimSuffix(o.Providers[0].OIDCConfig.IssuerURL, "/") + "/.well-known/openid-configuration"
-			body, err := requests.New(requestURL).
-				WithContext(ctx).
-				Do().
-				UnmarshalJSON()
-			if err != nil {
-				logger.Errorf("error: failed to discover OIDC configuration: %v", err)
-			} else {
-				// Prefer manually configured URLs. It's a bit unclear
-				// why you'd be doing discovery and also providing the URLs
-				// explicitly though...
-				if o.Providers[0].LoginURL == "" {
-					o.Providers[0].LoginURL = body.Get("authorization_endpoint").MustString()
-				}
-
-				if o.Providers[0].RedeemURL == "" {
-					o.Providers[0].RedeemURL = body.Get("token_endpoint").MustString()
-				}
-
-				if o.Providers[0].OIDCConfig.JwksURL == "" {
-					o.Providers[0].OIDCConfig.JwksURL = body.Get("jwks_uri").MustString()
-				}
-
-				if o.Providers[0].ProfileURL == "" {
-					o.Providers[0].ProfileURL = body.Get("userinfo_endpoint").MustString()
-				}
-
-				o.Providers[0].OIDCConfig.SkipDiscovery = true
-			}
-		}
-
-		// Construct a manual IDTokenVerifier from issuer URL & JWKS URI
-		// instead of metadata discovery if we enable -skip-oidc-discovery.
-		// In this case we need to make sure the required endpoints for
-		// the provider are configured.
-		if o.Providers[0].OIDCConfig.SkipDiscovery {
-			if o.Providers[0].LoginURL == "" {
-				msgs = append(msgs, "missing setting: login-url")
-			}
-			if o.Providers[0].RedeemURL == "" {
-				msgs = append(msgs, "missing setting: redeem-url")
-			}
-			if o.Providers[0].OIDCConfig.JwksURL == "" {
-				msgs = append(msgs, "missing setting: oidc-jwks-url")
-			}
-			keySet := oidc.NewRemoteKeySet(ctx, o.Providers[0].OIDCConfig.JwksURL)
-			o.SetOIDCVerifier(oidc.NewVerifier(o.Providers[0].OIDCConfig.IssuerURL, keySet, &oidc.Config{
-				ClientID:        o.Providers[0].ClientID,
-				SkipIssuerCheck: o.Providers[0].OIDCConfig.InsecureSkipIssuerVerification,
-			}))
-		} else {
-			// Configure discoverable provider data.
-			provider, err := oidc.NewProvider(ctx, o.Providers[0].OIDCConfig.IssuerURL)
-			if err != nil {
-				return err
-			}
-			o.SetOIDCVerifier(provider.Verifier(&oidc.Config{
-				ClientID:        o.Providers[0].ClientID,
-				SkipIssuerCheck: o.Providers[0].OIDCConfig.InsecureSkipIssuerVerification,
-			}))
-
-			o.Providers[0].LoginURL = provider.Endpoint().AuthURL
-			o.Providers[0].RedeemURL = provider.Endpoint().TokenURL
-		}
-		if o.Providers[0].Scope == "" {
-			o.Providers[0].Scope = "openid email profile"
+	if o.HtpasswdRehashFile != "" && o.HtpasswdRehashFile == o.HtpasswdFile {
+		msgs = append(msgs, "htpasswd-rehash-file must not be the htpasswd-file")
+	}
 
-			if len(o.Providers[0].AllowedGroups) > 0 {
-				o.Providers[0].Scope += " groups"
-			}
-		}
-		if o.Providers[0].OIDCConfig.UserIDClaim == "" {
-			o.Providers[0].OIDCConfig.UserIDClaim = "email"
+	verifiers := make([]*oidc.IDTokenVerifier, len(o.Providers))
+	for i := range o.Providers {
+		var err error
+		verifiers[i], msgs, err = configureOIDCProvider(&o.Providers[i], msgs)
+		if err != nil {
+			return err
 		}
 	}
 
+	msgs = append(msgs, validateJWTBearer(o)...)
 	if o.SkipJwtBearerTokens {
 		// Configure extra issuers
+		var jwtIssuers []jwtIssuer
 		if len(o.ExtraJwtIssuers) > 0 {
-			var jwtIssuers []jwtIssuer
 			jwtIssuers, msgs = parseJwtIssuers(o.ExtraJwtIssuers, msgs)
 			for _, jwtIssuer := range jwtIssuers {
 				verifier, err := newVerifierFromJwtIssuer(jwtIssuer)
@@ -160,6 +99,11 @@ func Validate(o *options.Options) error {
 				o.SetJWTBearerVerifiers(append(o.GetJWTBearerVerifiers(), verifier))
 			}
 		}
+
+		// Configure the additional audiences of the providers and extra issuers
+		audienceVerifiers, audienceMsgs := newAudienceVerifiers(o, jwtIssuers)
+		msgs = append(msgs, audienceMsgs...)
+		o.SetJWTBearerVerifiers(append(o.GetJWTBearerVerifiers(), audienceVerifiers...))
 	}
 
 	var redirectURL *url.URL
@@ -170,7 +114,8 @@ func Validate(o *options.Options) error {
 	}
 
 	msgs = append(msgs, validateUpstreams(o.UpstreamServers)...)
-	msgs = parseProviderInfo(o, msgs)
+	msgs = append(msgs, validateAuthorization(o.UpstreamServers)...)
+	msgs = parseProviderInfo(o, verifiers, msgs)
 
 	if o.ReverseProxy {
 		parser, err := ip.GetRealClientIPParser(o.RealClientIPHeader)
@@ -195,89 +140,122 @@ func Validate(o *options.Options) error {
 	return nil
 }
 
-func parseProviderInfo(o *options.Options, msgs []string) []string {
+func parseProviderInfo(o *options.Options, verifiers []*oidc.IDTokenVerifier, msgs []string) []string {
+	configured := make([]providers.Provider, 0, len(o.Providers))
+	for i, providerOpts := range o.Providers {
+		var provider providers.Provider
+		provider, msgs = parseProvider(providerOpts, verifiers[i], msgs)
+		if provider != nil {
+			provider.Data().IntrospectionAudiences = o.JWTBearer.Audiences
+			configured = append(configured, provider)
+		}
+	}
+	o.SetProviders(configured)
+	return msgs
+}
+
+// parseProvider builds a single provider from its options and the OIDC
+// verifier (if any) that was configured for it.
+func parseProvider(providerOpts options.Provider, verifier *oidc.IDTokenVerifier, msgs []string) (providers.Provider, []string) {
 	p := &providers.ProviderData{
-		Scope:            o.Providers[0].Scope,
-		ClientID:         o.Providers[0].ClientID,
-		ClientSecret:     o.Providers[0].ClientSecret,
-		ClientSecretFile: o.Providers[0].ClientSecretFile,
-		Prompt:           o.Providers[0].Prompt,
-		ApprovalPrompt:   o.Providers[0].ApprovalPrompt,
-		AcrValues:        o.Providers[0].AcrValues,
-	}
-	p.LoginURL, msgs = parseURL(o.Providers[0].LoginURL, "login", msgs)
-	p.RedeemURL, msgs = parseURL(o.Providers[0].RedeemURL, "redeem", msgs)
-	p.ProfileURL, msgs = parseURL(o.Providers[0].ProfileURL, "profile", msgs)
-	p.ValidateURL, msgs = parseURL(o.Providers[0].ValidateURL, "validate", msgs)
-	p.ProtectedResource, msgs = parseURL(o.Providers[0].ProtectedResource, "resource", msgs)
+		ID:               providerOpts.ID,
+		Scope:            providerOpts.Scope,
+		ClientID:         providerOpts.ClientID,
+		ClientSecret:     providerOpts.ClientSecret,
+		ClientSecretFile: providerOpts.ClientSecretFile,
+		Prompt:           providerOpts.Prompt,
+		ApprovalPrompt:   providerOpts.ApprovalPrompt,
+		AcrValues:        providerOpts.AcrValues,
+
+		CodeChallengeMethod: providerOpts.CodeChallengeMethod,
+	}
+	p.LoginURL, msgs = parseURL(providerOpts.LoginURL, "login", msgs)
+	p.RedeemURL, msgs = parseURL(providerOpts.RedeemURL, "redeem", msgs)
+	p.ProfileURL, msgs = parseURL(providerOpts.ProfileURL, "profile", msgs)
+	p.ValidateURL, msgs = parseURL(providerOpts.ValidateURL, "validate", msgs)
+	p.ProtectedResource, msgs = parseURL(providerOpts.ProtectedResource, "resource", msgs)
+	p.EndSessionURL, msgs = parseURL(providerOpts.OIDCConfig.EndSessionURL, "oidc-end-session", msgs)
+	if providerOpts.OIDCConfig.IntrospectBearerTokens {
+		if providerOpts.OIDCConfig.IntrospectionURL == "" {
+			msgs = append(msgs, "missing setting: oidc-introspection-url")
+		}
+		p.IntrospectionURL, msgs = parseURL(providerOpts.OIDCConfig.IntrospectionURL, "oidc-introspection", msgs)
+	}
+	if providerOpts.LogoutURL != "" {
+		logoutURLTemplate, err := template.New("logout-url").Parse(providerOpts.LogoutURL)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("error parsing logout-url=%q %s", providerOpts.LogoutURL, err))
+		}
+		p.LogoutURLTemplate = logoutURLTemplate
+	}
+	msgs = parseClientAuthentication(p, providerOpts.ClientAuthentication, msgs)
 
 	// Make the OIDC options available to all providers that support it
-	p.AllowUnverifiedEmail = o.Providers[0].OIDCConfig.InsecureAllowUnverifiedEmail
-	p.EmailClaim = o.Providers[0].OIDCConfig.EmailClaim
-	p.GroupsClaim = o.Providers[0].OIDCConfig.GroupsClaim
-	p.Verifier = o.GetOIDCVerifier()
+	p.AllowUnverifiedEmail = providerOpts.OIDCConfig.InsecureAllowUnverifiedEmail
+	p.EmailClaim = providerOpts.OIDCConfig.EmailClaim
+	p.GroupsClaim = providerOpts.OIDCConfig.GroupsClaim
+	p.Verifier = verifier
 
 	// TODO (@NickMeves) - Remove This
 	// Backwards Compatibility for Deprecated UserIDClaim option
-	if o.Providers[0].OIDCConfig.EmailClaim == providers.OIDCEmailClaim &&
-		o.Providers[0].OIDCConfig.UserIDClaim != providers.OIDCEmailClaim {
-		p.EmailClaim = o.Providers[0].OIDCConfig.UserIDClaim
+	if providerOpts.OIDCConfig.EmailClaim == providers.OIDCEmailClaim &&
+		providerOpts.OIDCConfig.UserIDClaim != providers.OIDCEmailClaim {
+		p.EmailClaim = providerOpts.OIDCConfig.UserIDClaim
 	}
 
-	p.SetAllowedGroups(o.Providers[0].AllowedGroups)
+	p.SetAllowedGroups(providerOpts.AllowedGroups)
 
-	provider := providers.New(o.Providers[0].Type, p)
+	provider := providers.New(providerOpts.Type, p)
 	if provider == nil {
-		msgs = append(msgs, fmt.Sprintf("invalid setting: provider '%s' is not available", o.Providers[0].Type))
-		return msgs
+		msgs = append(msgs, fmt.Sprintf("invalid setting: provider '%s' is not available", providerOpts.Type))
+		return nil, msgs
 	}
-	o.SetProvider(provider)
 
-	switch p := o.GetProvider().(type) {
+	switch p := provider.(type) {
 	case *providers.AzureProvider:
-		p.Configure(o.Providers[0].AzureConfig.Tenant)
+		p.Configure(providerOpts.AzureConfig.Tenant)
 	case *providers.ADFSProvider:
-		p.Configure(o.Providers[0].ADFSConfig.SkipScope)
+		p.Configure(providerOpts.ADFSConfig.SkipScope)
 	case *providers.GitHubProvider:
-		p.SetOrgTeam(o.Providers[0].GitHubConfig.Org, o.Providers[0].GitHubConfig.Team)
-		p.SetRepo(o.Providers[0].GitHubConfig.Repo, o.Providers[0].GitHubConfig.Token)
-		p.SetUsers(o.Providers[0].GitHubConfig.Users)
+		p.SetOrgTeam(providerOpts.GitHubConfig.Org, providerOpts.GitHubConfig.Team)
+		p.SetRepo(providerOpts.GitHubConfig.Repo, providerOpts.GitHubConfig.Token)
+		p.SetUsers(providerOpts.GitHubConfig.Users)
 	case *providers.KeycloakProvider:
 		// Backwards compatibility with `--keycloak-group` option
-		if len(o.Providers[0].KeycloakConfig.Groups) > 0 {
-			p.SetAllowedGroups(o.Providers[0].KeycloakConfig.Groups)
+		if len(providerOpts.KeycloakConfig.Groups) > 0 {
+			p.SetAllowedGroups(providerOpts.KeycloakConfig.Groups)
 		}
 	case *providers.KeycloakOIDCProvider:
 		if p.Verifier == nil {
 			msgs = append(msgs, "keycloak-oidc provider requires an oidc issuer URL")
 		}
-		p.AddAllowedRoles(o.Providers[0].KeycloakConfig.Roles)
+		p.AddAllowedRoles(providerOpts.KeycloakConfig.Roles)
 	case *providers.GoogleProvider:
-		if o.Providers[0].GoogleConfig.ServiceAccountJSON != "" {
-			file, err := os.Open(o.Providers[0].GoogleConfig.ServiceAccountJSON)
+		if providerOpts.GoogleConfig.ServiceAccountJSON != "" {
+			file, err := os.Open(providerOpts.GoogleConfig.ServiceAccountJSON)
 			if err != nil {
-				msgs = append(msgs, "invalid Google credentials file: "+o.Providers[0].GoogleConfig.ServiceAccountJSON)
+				msgs = append(msgs, "invalid Google credentials file: "+providerOpts.GoogleConfig.ServiceAccountJSON)
 			} else {
-				groups := o.Providers[0].AllowedGroups
+				groups := providerOpts.AllowedGroups
 				// Backwards compatibility with `--google-group` option
-				if len(o.Providers[0].GoogleConfig.Groups) > 0 {
-					groups = o.Providers[0].GoogleConfig.Groups
+				if len(providerOpts.GoogleConfig.Groups) > 0 {
+					groups = providerOpts.GoogleConfig.Groups
 					p.SetAllowedGroups(groups)
 				}
-				p.SetGroupRestriction(groups, o.Providers[0].GoogleConfig.AdminEmail, file)
+				p.SetGroupRestriction(groups, providerOpts.GoogleConfig.AdminEmail, file)
 			}
 		}
 	case *providers.BitbucketProvider:
-		p.SetTeam(o.Providers[0].BitbucketConfig.Team)
-		p.SetRepository(o.Providers[0].BitbucketConfig.Repository)
+		p.SetTeam(providerOpts.BitbucketConfig.Team)
+		p.SetRepository(providerOpts.BitbucketConfig.Repository)
 	case *providers.OIDCProvider:
-		p.SkipNonce = o.Providers[0].OIDCConfig.InsecureSkipNonce
+		p.SkipNonce = providerOpts.OIDCConfig.InsecureSkipNonce
 		if p.Verifier == nil {
 			msgs = append(msgs, "oidc provider requires an oidc issuer URL")
 		}
 	case *providers.GitLabProvider:
-		p.Groups = o.Providers[0].GitLabConfig.Group
-		err := p.AddProjects(o.Providers[0].GitLabConfig.Projects)
+		p.Groups = providerOpts.GitLabConfig.Group
+		err := p.AddProjects(providerOpts.GitLabConfig.Projects)
 		if err != nil {
 			msgs = append(msgs, "failed to setup gitlab project access level")
 		}
@@ -293,47 +271,296 @@ func parseProviderInfo(o *options.Options, msgs []string) []string {
 				msgs = append(msgs, "failed to initialize oidc provider for gitlab.com")
 			} else {
 				p.Verifier = provider.Verifier(&oidc.Config{
-					ClientID: o.Providers[0].ClientID,
+					ClientID: providerOpts.ClientID,
 				})
 
 				p.LoginURL, msgs = parseURL(provider.Endpoint().AuthURL, "login", msgs)
 				p.RedeemURL, msgs = parseURL(provider.Endpoint().TokenURL, "redeem", msgs)
 			}
 		}
+	case *providers.SAMLProvider:
+		msgs = parseSAMLConfig(p, providerOpts.SAMLConfig, msgs)
 	case *providers.LoginGovProvider:
-		p.PubJWKURL, msgs = parseURL(o.Providers[0].LoginGovConfig.PubJWKURL, "pubjwk", msgs)
+		p.PubJWKURL, msgs = parseURL(providerOpts.LoginGovConfig.PubJWKURL, "pubjwk", msgs)
 
 		// JWT key can be supplied via env variable or file in the filesystem, but not both.
 		switch {
-		case o.Providers[0].LoginGovConfig.JWTKey != "" && o.Providers[0].LoginGovConfig.JWTKeyFile != "":
+		case providerOpts.LoginGovConfig.JWTKey != "" && providerOpts.LoginGovConfig.JWTKeyFile != "":
 			msgs = append(msgs, "cannot set both jwt-key and jwt-key-file options")
-		case o.Providers[0].LoginGovConfig.JWTKey == "" && o.Providers[0].LoginGovConfig.JWTKeyFile == "":
+		case providerOpts.LoginGovConfig.JWTKey == "" && providerOpts.LoginGovConfig.JWTKeyFile == "":
 			msgs = append(msgs, "login.gov provider requires a private key for signing JWTs")
-		case o.Providers[0].LoginGovConfig.JWTKey != "":
+		case providerOpts.LoginGovConfig.JWTKey != "":
 			// The JWT Key is in the commandline argument
-			signKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(o.Providers[0].LoginGovConfig.JWTKey))
+			signKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(providerOpts.LoginGovConfig.JWTKey))
 			if err != nil {
 				msgs = append(msgs, "could not parse RSA Private Key PEM")
 			} else {
 				p.JWTKey = signKey
 			}
-		case o.Providers[0].LoginGovConfig.JWTKeyFile != "":
+		case providerOpts.LoginGovConfig.JWTKeyFile != "":
 			// The JWT key is in the filesystem
-			keyData, err := ioutil.ReadFile(o.Providers[0].LoginGovConfig.JWTKeyFile)
+			keyData, err := ioutil.ReadFile(providerOpts.LoginGovConfig.JWTKeyFile)
 			if err != nil {
-				msgs = append(msgs, "could not read key file: "+o.Providers[0].LoginGovConfig.JWTKeyFile)
+				msgs = append(msgs, "could not read key file: "+providerOpts.LoginGovConfig.JWTKeyFile)
 			}
 			signKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
 			if err != nil {
-				msgs = append(msgs, "could not parse private key from PEM file:"+o.Providers[0].LoginGovConfig.JWTKeyFile)
+				msgs = append(msgs, "could not parse private key from PEM file:"+providerOpts.LoginGovConfig.JWTKeyFile)
 			} else {
 				p.JWTKey = signKey
 			}
 		}
 	}
+	return provider, msgs
+}
+
+// parseClientAuthentication loads the keys authenticating the client to the
+// token endpoint of the provider.
+func parseClientAuthentication(p *providers.ProviderData, clientAuth options.ClientAuthentication, msgs []string) []string {
+	p.ClientAuthMethod = clientAuth.Method
+
+	switch clientAuth.Method {
+	case providers.PrivateKeyJWTAuthMethod:
+		if clientAuth.PrivateKey == nil {
+			break
+		}
+		keyData, err := optionsutil.GetSecretValue(clientAuth.PrivateKey)
+		if err != nil {
+			return append(msgs, fmt.Sprintf("could not load client authentication private key: %v", err))
+		}
+		key, err := parsePrivateKey(keyData)
+		if err != nil {
+			return append(msgs, fmt.Sprintf("could not parse client authentication private key: %v", err))
+		}
+		p.ClientAssertionKey = key
+		p.ClientAssertionKeyID = clientAuth.PrivateKeyID
+		p.ClientAssertionSigningAlgorithm = clientAuth.SigningAlgorithm
+	case providers.TLSClientAuthMethod:
+		if clientAuth.Certificate == nil || clientAuth.CertificateKey == nil {
+			break
+		}
+		certData, err := optionsutil.GetSecretValue(clientAuth.Certificate)
+		if err != nil {
+			return append(msgs, fmt.Sprintf("could not load client authentication certificate: %v", err))
+		}
+		keyData, err := optionsutil.GetSecretValue(clientAuth.CertificateKey)
+		if err != nil {
+			return append(msgs, fmt.Sprintf("could not load client authentication certificate key: %v", err))
+		}
+		cert, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return append(msgs, fmt.Sprintf("could not parse client authentication certificate: %v", err))
+		}
+		p.ClientCertificate = &cert
+	}
+
+	p.TokenClient = p.NewTokenClient()
 	return msgs
 }
 
+// samlMetadataTimeout limits the time to fetch the metadata of a SAML
+// identity provider
+const samlMetadataTimeout = 10 * time.Second
+
+// parseSAMLConfig loads the identity provider metadata and the service
+// provider key pair of a SAML provider.
+func parseSAMLConfig(p *providers.SAMLProvider, samlConfig options.SAMLOptions, msgs []string) []string {
+	p.EntityID = samlConfig.EntityID
+	if samlConfig.Binding != "" {
+		p.Binding = samlConfig.Binding
+	}
+	if samlConfig.EmailAttribute != "" {
+		p.EmailAttribute = samlConfig.EmailAttribute
+	}
+	p.UserAttribute = samlConfig.UserAttribute
+	if samlConfig.GroupsAttribute != "" {
+		p.GroupsAttribute = samlConfig.GroupsAttribute
+	}
+
+	var metadata []byte
+	switch {
+	case samlConfig.IDPMetadataFile != "":
+		data, err := ioutil.ReadFile(samlConfig.IDPMetadataFile)
+		if err != nil {
+			return append(msgs, fmt.Sprintf("could not read saml idp metadata file: %v", err))
+		}
+		metadata = data
+	case samlConfig.IDPMetadataURL != "":
+		ctx, cancel := context.WithTimeout(context.Background(), samlMetadataTimeout)
+		defer cancel()
+		result := requests.New(samlConfig.IDPMetadataURL).
+			WithContext(ctx).
+			Do()
+		if result.Error() != nil {
+			return append(msgs, fmt.Sprintf("could not fetch saml idp metadata: %v", result.Error()))
+		}
+		if result.StatusCode() != http.StatusOK {
+			return append(msgs, fmt.Sprintf("could not fetch saml idp metadata: unexpected status %d", result.StatusCode()))
+		}
+		metadata = result.Body()
+	default:
+		return msgs
+	}
+	if err := p.SetIDPMetadata(metadata); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+
+	if samlConfig.Certificate == nil || samlConfig.PrivateKey == nil {
+		return msgs
+	}
+	certData, err := optionsutil.GetSecretValue(samlConfig.Certificate)
+	if err != nil {
+		return append(msgs, fmt.Sprintf("could not load saml certificate: %v", err))
+	}
+	keyData, err := optionsutil.GetSecretValue(samlConfig.PrivateKey)
+	if err != nil {
+		return append(msgs, fmt.Sprintf("could not load saml private key: %v", err))
+	}
+	if err := p.SetKeyPair(certData, keyData); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// parsePrivateKey parses a PEM encoded RSA or EC private key
+func parsePrivateKey(keyData []byte) (crypto.Signer, error) {
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData); err == nil {
+		return rsaKey, nil
+	}
+	if ecKey, err := jwt.ParseECPrivateKeyFromPEM(keyData); err == nil {
+		return ecKey, nil
+	}
+	return nil, errors.New("key must be a PEM encoded RSA or EC private key")
+}
+
+// providerCAFiles collects the CA files configured across all providers.
+func providerCAFiles(providerList options.Providers) []string {
+	var caFiles []string
+	for _, provider := range providerList {
+		caFiles = append(caFiles, provider.CAFiles...)
+	}
+	return caFiles
+}
+
+// configureOIDCProvider performs OIDC discovery for a provider with an issuer
+// URL configured and returns the ID Token verifier for the provider.
+// Discovered endpoints are stored back into the provider options.
+func configureOIDCProvider(p *options.Provider, msgs []string) (*oidc.IDTokenVerifier, []string, error) {
+	if p.OIDCConfig.IssuerURL == "" {
+		return nil, msgs, nil
+	}
+
+	ctx := context.Background()
+
+	if p.OIDCConfig.InsecureSkipIssuerVerification && !p.OIDCConfig.SkipDiscovery {
+		// go-oidc doesn't let us pass bypass the issuer check this in the oidc.NewProvider call
+		// (which uses discovery to get the URLs), so we'll do a quick check ourselves and if
+		// we get the URLs, we'll just use the non-discovery path.
+
+		logger.Printf("Performing OIDC Discovery...")
+
+		requestURL := strings.TrimSuffix(p.OIDCConfig.IssuerURL, "/") + "/.well-known/openid-configuration"
+		body, err := requests.New(requestURL).
+			WithContext(ctx).
+			Do().
+			UnmarshalJSON()
+		if err != nil {
+			logger.Errorf("error: failed to discover OIDC configuration: %v", err)
+		} else {
+			// Prefer manually configured URLs. It's a bit unclear
+			// why you'd be doing discovery and also providing the URLs
+			// explicitly though...
+			if p.LoginURL == "" {
+				p.LoginURL = body.Get("authorization_endpoint").MustString()
+			}
+
+			if p.RedeemURL == "" {
+				p.RedeemURL = body.Get("token_endpoint").MustString()
+			}
+
+			if p.OIDCConfig.JwksURL == "" {
+				p.OIDCConfig.JwksURL = body.Get("jwks_uri").MustString()
+			}
+
+			if p.ProfileURL == "" {
+				p.ProfileURL = body.Get("userinfo_endpoint").MustString()
+			}
+
+			if p.OIDCConfig.EndSessionURL == "" {
+				p.OIDCConfig.EndSessionURL = body.Get("end_session_endpoint").MustString()
+			}
+
+			if p.OIDCConfig.IntrospectionURL == "" {
+				p.OIDCConfig.IntrospectionURL = body.Get("introspection_endpoint").MustString()
+			}
+
+			p.OIDCConfig.SkipDiscovery = true
+		}
+	}
+
+	var verifier *oidc.IDTokenVerifier
+	// Construct a manual IDTokenVerifier from issuer URL & JWKS URI
+	// instead of metadata discovery if we enable -skip-oidc-discovery.
+	// In this case we need to make sure the required endpoints for
+	// the provider are configured.
+	if p.OIDCConfig.SkipDiscovery {
+		if p.LoginURL == "" {
+			msgs = append(msgs, "missing setting: login-url")
+		}
+		if p.RedeemURL == "" {
+			msgs = append(msgs, "missing setting: redeem-url")
+		}
+		if p.OIDCConfig.JwksURL == "" {
+			msgs = append(msgs, "missing setting: oidc-jwks-url")
+		}
+		keySet := oidc.NewRemoteKeySet(ctx, p.OIDCConfig.JwksURL)
+		verifier = oidc.NewVerifier(p.OIDCConfig.IssuerURL, keySet, &oidc.Config{
+			ClientID:        p.ClientID,
+			SkipIssuerCheck: p.OIDCConfig.InsecureSkipIssuerVerification,
+		})
+	} else {
+		// Configure discoverable provider data.
+		provider, err := oidc.NewProvider(ctx, p.OIDCConfig.IssuerURL)
+		if err != nil {
+			return nil, msgs, err
+		}
+		verifier = provider.Verifier(&oidc.Config{
+			ClientID:        p.ClientID,
+			SkipIssuerCheck: p.OIDCConfig.InsecureSkipIssuerVerification,
+		})
+
+		p.LoginURL = provider.Endpoint().AuthURL
+		p.RedeemURL = provider.Endpoint().TokenURL
+
+		// The end session and introspection endpoints are optional in the
+		// discovery document
+		var claims struct {
+			EndSessionURL    string `json:"end_session_endpoint"`
+			IntrospectionURL string `json:"introspection_endpoint"`
+		}
+		if err := provider.Claims(&claims); err != nil {
+			return nil, msgs, err
+		}
+		if p.OIDCConfig.EndSessionURL == "" {
+			p.OIDCConfig.EndSessionURL = claims.EndSessionURL
+		}
+		if p.OIDCConfig.IntrospectionURL == "" {
+			p.OIDCConfig.IntrospectionURL = claims.IntrospectionURL
+		}
+	}
+	if p.Scope == "" {
+		p.Scope = "openid email profile"
+
+		if len(p.AllowedGroups) > 0 {
+			p.Scope += " groups"
+		}
+	}
+	if p.OIDCConfig.UserIDClaim == "" {
+		p.OIDCConfig.UserIDClaim = "email"
+	}
+	return verifier, msgs, nil
+}
+
 func parseSignatureKey(o *options.Options, msgs []string) []string {
 	if o.SignatureKey == "" {
 		return msgs
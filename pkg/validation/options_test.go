@@ -2,7 +2,14 @@ package validation
 
 import (
 	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
@@ -167,6 +174,33 @@ func TestDefaultProviderApiSettings(t *testing.T) {
 	assert.Equal(t, "profile email", p.Scope)
 }
 
+func TestMultipleProviders(t *testing.T) {
+	o := testOptions()
+	o.Providers = append(o.Providers, options.Provider{
+		ID:           "github",
+		Type:         "github",
+		ClientID:     "github-client",
+		ClientSecret: clientSecret,
+		GitHubConfig: options.GitHubOptions{
+			Org: "my-org",
+		},
+	})
+	assert.Equal(t, nil, Validate(o))
+
+	configured := o.GetProviders()
+	assert.Equal(t, 2, len(configured))
+
+	assert.Equal(t, providerID, configured[0].Data().ID)
+	assert.Equal(t, clientID, configured[0].Data().ClientID)
+	assert.Equal(t, "Google", configured[0].Data().ProviderName)
+
+	assert.Equal(t, "github", configured[1].Data().ID)
+	assert.Equal(t, "github-client", configured[1].Data().ClientID)
+	assert.Equal(t, "GitHub", configured[1].Data().ProviderName)
+
+	assert.Equal(t, configured[0], o.GetProvider())
+}
+
 func TestCookieRefreshMustBeLessThanCookieExpire(t *testing.T) {
 	o := testOptions()
 	assert.Equal(t, nil, Validate(o))
@@ -179,6 +213,18 @@ func TestCookieRefreshMustBeLessThanCookieExpire(t *testing.T) {
 	assert.Equal(t, nil, Validate(o))
 }
 
+func TestHtpasswdRehashFileMustNotBeHtpasswdFile(t *testing.T) {
+	o := testOptions()
+	o.HtpasswdFile = "/etc/oauth2-proxy/htpasswd"
+	o.HtpasswdRehashFile = o.HtpasswdFile
+
+	err := Validate(o)
+	assert.Equal(t, errorMsg([]string{"htpasswd-rehash-file must not be the htpasswd-file"}), err.Error())
+
+	o.HtpasswdRehashFile = "/var/lib/oauth2-proxy/htpasswd-rehashed"
+	assert.Equal(t, nil, Validate(o))
+}
+
 func TestBase64CookieSecret(t *testing.T) {
 	o := testOptions()
 	assert.Equal(t, nil, Validate(o))
@@ -245,6 +291,101 @@ func TestSkipOIDCDiscovery(t *testing.T) {
 	assert.Equal(t, nil, Validate(o))
 }
 
+func TestIntrospectionURL(t *testing.T) {
+	o := testOptions()
+	o.Providers[0].OIDCConfig.IntrospectBearerTokens = true
+	err := Validate(o)
+	assert.Equal(t, "invalid configuration:\n  missing setting: oidc-introspection-url", err.Error())
+
+	o = testOptions()
+	o.Providers[0].OIDCConfig.IntrospectBearerTokens = true
+	o.Providers[0].OIDCConfig.IntrospectionURL = "https://provider.example.com/introspect"
+	assert.Equal(t, nil, Validate(o))
+	assert.Equal(t, "https://provider.example.com/introspect", o.GetProviders()[0].Data().IntrospectionURL.String())
+
+	// The introspection endpoint is only used when bearer tokens are introspected
+	o = testOptions()
+	o.Providers[0].OIDCConfig.IntrospectionURL = "https://provider.example.com/introspect"
+	assert.Equal(t, nil, Validate(o))
+	assert.Nil(t, o.GetProviders()[0].Data().IntrospectionURL)
+}
+
+func TestIntrospectionURLDiscovery(t *testing.T) {
+	var issuerURL string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(rw, `{"issuer": %q, "authorization_endpoint": "%[1]s/auth", "token_endpoint": "%[1]s/token",
+			"jwks_uri": "%[1]s/jwks", "introspection_endpoint": "%[1]s/introspect"}`, issuerURL)
+	}))
+	defer server.Close()
+	issuerURL = server.URL
+
+	o := testOptions()
+	o.Providers[0].Type = "oidc"
+	o.Providers[0].OIDCConfig.IssuerURL = issuerURL
+	o.Providers[0].OIDCConfig.IntrospectBearerTokens = true
+
+	assert.Equal(t, nil, Validate(o))
+	assert.Equal(t, issuerURL+"/introspect", o.Providers[0].OIDCConfig.IntrospectionURL)
+	assert.Equal(t, issuerURL+"/introspect", o.GetProviders()[0].Data().IntrospectionURL.String())
+}
+
+func TestLogoutURLTemplate(t *testing.T) {
+	o := testOptions()
+	o.Providers[0].LogoutURL = "https://provider.example.com/logout?returnTo={{.PostLogoutRedirectURI}}"
+	assert.Equal(t, nil, Validate(o))
+	assert.NotNil(t, o.GetProviders()[0].Data().LogoutURLTemplate)
+
+	o = testOptions()
+	o.Providers[0].LogoutURL = "https://provider.example.com/logout?returnTo={{.PostLogoutRedirectURI"
+	err := Validate(o)
+	assert.Equal(t, "invalid configuration:\n"+
+		"  error parsing logout-url=\"https://provider.example.com/logout?returnTo={{.PostLogoutRedirectURI\" "+
+		"template: logout-url:1: unclosed action", err.Error())
+}
+
+func TestClientAuthenticationPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	keyFile, err := ioutil.TempFile("", "client_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyFile.Name())
+	if _, err := keyFile.Write(keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	keyFile.Close()
+
+	o := testOptions()
+	o.Providers[0].ClientSecret = ""
+	o.Providers[0].ClientAuthentication = options.ClientAuthentication{
+		Method:       "private_key_jwt",
+		PrivateKey:   &options.SecretSource{FromFile: keyFile.Name()},
+		PrivateKeyID: "key-id",
+	}
+	assert.Equal(t, nil, Validate(o))
+
+	p := o.GetProviders()[0].Data()
+	assert.Equal(t, "private_key_jwt", p.ClientAuthMethod)
+	assert.Equal(t, key, p.ClientAssertionKey)
+	assert.Equal(t, "key-id", p.ClientAssertionKeyID)
+	assert.NotNil(t, p.TokenClient)
+
+	o = testOptions()
+	o.Providers[0].ClientAuthentication = options.ClientAuthentication{
+		Method:     "private_key_jwt",
+		PrivateKey: &options.SecretSource{Value: []byte("not a key")},
+	}
+	err = Validate(o)
+	assert.Equal(t, "invalid configuration:\n"+
+		"  could not parse client authentication private key: key must be a PEM encoded RSA or EC private key", err.Error())
+}
+
 func TestGCPHealthcheck(t *testing.T) {
 	o := testOptions()
 	o.GCPHealthChecks = true
@@ -3,8 +3,11 @@ package validation
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
 )
 
 // validateProviders is the initial validation migration for multiple providrers
@@ -22,8 +25,19 @@ func validateProviders(o *options.Options) []string {
 
 	providerIDs := make(map[string]struct{})
 
+	hasSAMLProvider := false
 	for _, provider := range o.Providers {
 		msgs = append(msgs, validateProvider(provider, providerIDs)...)
+		hasSAMLProvider = hasSAMLProvider || provider.Type == "saml"
+	}
+
+	// The SAML endpoints must not follow the host of the request, assertions
+	// are checked against them
+	if hasSAMLProvider {
+		redirectURL, err := url.Parse(o.RawRedirectURL)
+		if err == nil && (redirectURL.Scheme == "" || redirectURL.Host == "") {
+			msgs = append(msgs, "saml providers require an absolute redirect-url")
+		}
 	}
 
 	return msgs
@@ -42,13 +56,20 @@ func validateProvider(provider options.Provider, providerIDs map[string]struct{}
 	}
 	providerIDs[provider.ID] = struct{}{}
 
+	// SAML providers are not OAuth2 clients
+	if provider.Type == "saml" {
+		return append(msgs, validateSAMLConfig(provider.SAMLConfig)...)
+	}
+
 	if provider.ClientID == "" {
 		msgs = append(msgs, "provider missing setting: client-id")
 	}
 
-	// login.gov uses a signed JWT to authenticate, not a client-secret
-	if provider.Type != "login.gov" {
-		if provider.ClientSecret == "" && provider.ClientSecretFile == "" {
+	// login.gov uses a signed JWT to authenticate, not a client-secret.
+	// Public clients using PKCE may omit the client-secret, as may clients
+	// using another client authentication method.
+	if provider.Type != "login.gov" && provider.ClientAuthentication.Method == "" {
+		if provider.ClientSecret == "" && provider.ClientSecretFile == "" && provider.CodeChallengeMethod == "" {
 			msgs = append(msgs, "missing setting: client-secret or client-secret-file")
 		}
 		if provider.ClientSecret == "" && provider.ClientSecretFile != "" {
@@ -59,11 +80,96 @@ func validateProvider(provider options.Provider, providerIDs map[string]struct{}
 		}
 	}
 
+	msgs = append(msgs, validateCodeChallengeMethod(provider)...)
+	msgs = append(msgs, prefixValues("invalid clientAuthentication: ", validateClientAuthentication(provider.ClientAuthentication)...)...)
 	msgs = append(msgs, validateGoogleConfig(provider)...)
 
 	return msgs
 }
 
+func validateCodeChallengeMethod(provider options.Provider) []string {
+	switch provider.CodeChallengeMethod {
+	case "", encryption.CodeChallengeMethodPlain, encryption.CodeChallengeMethodS256:
+		return []string{}
+	default:
+		return []string{fmt.Sprintf("invalid code-challenge-method %q: must be %q or %q",
+			provider.CodeChallengeMethod, encryption.CodeChallengeMethodPlain, encryption.CodeChallengeMethodS256)}
+	}
+}
+
+func validateClientAuthentication(clientAuth options.ClientAuthentication) []string {
+	msgs := []string{}
+	switch clientAuth.Method {
+	case "":
+	case providers.PrivateKeyJWTAuthMethod:
+		if clientAuth.PrivateKey == nil {
+			msgs = append(msgs, "missing setting: privateKey")
+		} else {
+			msgs = append(msgs, prefixValues("invalid privateKey: ", validateSecretSource(*clientAuth.PrivateKey))...)
+		}
+		if clientAuth.SigningAlgorithm != "" && !isClientAssertionAlgorithm(clientAuth.SigningAlgorithm) {
+			msgs = append(msgs, fmt.Sprintf("unsupported signingAlgorithm %q", clientAuth.SigningAlgorithm))
+		}
+	case providers.TLSClientAuthMethod:
+		if clientAuth.Certificate == nil || clientAuth.CertificateKey == nil {
+			msgs = append(msgs, "missing setting: certificate and certificateKey are required")
+		}
+		if clientAuth.Certificate != nil {
+			msgs = append(msgs, prefixValues("invalid certificate: ", validateSecretSource(*clientAuth.Certificate))...)
+		}
+		if clientAuth.CertificateKey != nil {
+			msgs = append(msgs, prefixValues("invalid certificateKey: ", validateSecretSource(*clientAuth.CertificateKey))...)
+		}
+	default:
+		msgs = append(msgs, fmt.Sprintf("unknown method %q: must be %q or %q",
+			clientAuth.Method, providers.PrivateKeyJWTAuthMethod, providers.TLSClientAuthMethod))
+	}
+	return msgs
+}
+
+// isClientAssertionAlgorithm checks the algorithm can sign client assertions
+// with RSA or EC keys
+func isClientAssertionAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512":
+		return true
+	default:
+		return false
+	}
+}
+
+func validateSAMLConfig(samlConfig options.SAMLOptions) []string {
+	msgs := []string{}
+	if samlConfig.EntityID == "" {
+		msgs = append(msgs, "missing setting: saml entityID")
+	}
+
+	switch {
+	case samlConfig.IDPMetadataURL == "" && samlConfig.IDPMetadataFile == "":
+		msgs = append(msgs, "missing setting: saml-idp-metadata-url or saml-idp-metadata-file")
+	case samlConfig.IDPMetadataURL != "" && samlConfig.IDPMetadataFile != "":
+		msgs = append(msgs, "cannot set both saml-idp-metadata-url and saml-idp-metadata-file")
+	}
+
+	switch samlConfig.Binding {
+	case "", providers.SAMLRedirectBinding, providers.SAMLPostBinding:
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid saml binding %q: must be %q or %q",
+			samlConfig.Binding, providers.SAMLRedirectBinding, providers.SAMLPostBinding))
+	}
+
+	if (samlConfig.Certificate == nil) != (samlConfig.PrivateKey == nil) {
+		msgs = append(msgs, "saml certificate and privateKey must be set together")
+	}
+	if samlConfig.Certificate != nil {
+		msgs = append(msgs, prefixValues("invalid saml certificate: ", validateSecretSource(*samlConfig.Certificate))...)
+	}
+	if samlConfig.PrivateKey != nil {
+		msgs = append(msgs, prefixValues("invalid saml privateKey: ", validateSecretSource(*samlConfig.PrivateKey))...)
+	}
+	return msgs
+}
+
 func validateGoogleConfig(provider options.Provider) []string {
 	msgs := []string{}
 	if len(provider.GoogleConfig.Groups) > 0 ||
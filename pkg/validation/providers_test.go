@@ -31,10 +31,102 @@ var _ = Describe("Providers", func() {
 		ClientSecret: "ClientSecret",
 	}
 
+	publicPKCEProvider := options.Provider{
+		ID:                  "ProviderIDPublic",
+		ClientID:            "ClientID",
+		CodeChallengeMethod: "S256",
+	}
+
+	invalidPKCEProvider := options.Provider{
+		ID:                  "ProviderIDInvalidPKCE",
+		ClientID:            "ClientID",
+		ClientSecret:        "ClientSecret",
+		CodeChallengeMethod: "S512",
+	}
+
+	privateKeyJWTProvider := options.Provider{
+		ID:       "ProviderIDPrivateKeyJWT",
+		ClientID: "ClientID",
+		ClientAuthentication: options.ClientAuthentication{
+			Method:           "private_key_jwt",
+			PrivateKey:       &options.SecretSource{Value: []byte("key")},
+			SigningAlgorithm: "ES256",
+		},
+	}
+
+	invalidPrivateKeyJWTProvider := options.Provider{
+		ID:       "ProviderIDInvalidPrivateKeyJWT",
+		ClientID: "ClientID",
+		ClientAuthentication: options.ClientAuthentication{
+			Method:           "private_key_jwt",
+			SigningAlgorithm: "HS256",
+		},
+	}
+
+	invalidTLSClientAuthProvider := options.Provider{
+		ID:       "ProviderIDInvalidTLSClientAuth",
+		ClientID: "ClientID",
+		ClientAuthentication: options.ClientAuthentication{
+			Method:      "tls_client_auth",
+			Certificate: &options.SecretSource{Value: []byte("cert"), FromEnv: "CERT"},
+		},
+	}
+
+	unknownClientAuthProvider := options.Provider{
+		ID:       "ProviderIDUnknownClientAuth",
+		ClientID: "ClientID",
+		ClientAuthentication: options.ClientAuthentication{
+			Method: "client_secret_jwt",
+		},
+	}
+
+	samlProvider := options.Provider{
+		ID:   "ProviderIDSAML",
+		Type: "saml",
+		SAMLConfig: options.SAMLOptions{
+			EntityID:       "https://proxy.example.com/oauth2/saml/metadata",
+			IDPMetadataURL: "https://idp.example.com/metadata",
+			Binding:        "post",
+			Certificate:    &options.SecretSource{Value: []byte("cert")},
+			PrivateKey:     &options.SecretSource{Value: []byte("key")},
+		},
+	}
+
+	missingMetadataSAMLProvider := options.Provider{
+		ID:   "ProviderIDMissingMetadataSAML",
+		Type: "saml",
+		SAMLConfig: options.SAMLOptions{
+			Binding:     "artifact",
+			Certificate: &options.SecretSource{Value: []byte("cert"), FromEnv: "CERT"},
+		},
+	}
+
+	multipleMetadataSAMLProvider := options.Provider{
+		ID:   "ProviderIDMultipleMetadataSAML",
+		Type: "saml",
+		SAMLConfig: options.SAMLOptions{
+			IDPMetadataURL:  "https://idp.example.com/metadata",
+			IDPMetadataFile: "/etc/oauth2-proxy/idp.xml",
+		},
+	}
+
 	missingProvider := "at least one provider has to be defined"
 	emptyIDMsg := "provider has empty id: ids are required for all providers"
 	duplicateProviderIDMsg := "multiple providers found with id ProviderID: provider ids must be unique"
 	skipButtonAndMultipleProvidersMsg := "SkipProviderButton and multiple providers are mutually exclusive"
+	missingPrivateKeyMsg := "invalid clientAuthentication: missing setting: privateKey"
+	unsupportedSigningAlgorithmMsg := "invalid clientAuthentication: unsupported signingAlgorithm \"HS256\""
+	missingCertificateMsg := "invalid clientAuthentication: missing setting: certificate and certificateKey are required"
+	invalidCertificateMsg := "invalid clientAuthentication: invalid certificate: " + multipleValuesForSecretSource
+	unknownClientAuthMethodMsg := "invalid clientAuthentication: unknown method \"client_secret_jwt\": must be \"private_key_jwt\" or \"tls_client_auth\""
+	invalidCodeChallengeMethodMsg := "invalid code-challenge-method \"S512\": must be \"plain\" or \"S256\""
+	missingSAMLMetadataMsg := "missing setting: saml-idp-metadata-url or saml-idp-metadata-file"
+	multipleSAMLMetadataMsg := "cannot set both saml-idp-metadata-url and saml-idp-metadata-file"
+	invalidSAMLBindingMsg := "invalid saml binding \"artifact\": must be \"redirect\" or \"post\""
+	missingSAMLKeyPairMsg := "saml certificate and privateKey must be set together"
+	invalidSAMLCertificateMsg := "invalid saml certificate: " + multipleValuesForSecretSource
+	missingSAMLEntityIDMsg := "missing setting: saml entityID"
+	relativeSAMLRedirectURLMsg := "saml providers require an absolute redirect-url"
 
 	DescribeTable("validateProviders",
 		func(o *validateProvidersTableInput) {
@@ -80,5 +172,81 @@ var _ = Describe("Providers", func() {
 			},
 			errStrings: []string{skipButtonAndMultipleProvidersMsg},
 		}),
+		Entry("with a public client using PKCE", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					publicPKCEProvider,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with an invalid code challenge method", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					invalidPKCEProvider,
+				},
+			},
+			errStrings: []string{invalidCodeChallengeMethodMsg},
+		}),
+		Entry("with private key JWT client authentication", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					privateKeyJWTProvider,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid client authentication", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					invalidPrivateKeyJWTProvider,
+					invalidTLSClientAuthProvider,
+					unknownClientAuthProvider,
+				},
+			},
+			errStrings: []string{
+				missingPrivateKeyMsg,
+				unsupportedSigningAlgorithmMsg,
+				missingCertificateMsg,
+				invalidCertificateMsg,
+				unknownClientAuthMethodMsg,
+			},
+		}),
+		Entry("with a SAML provider", &validateProvidersTableInput{
+			options: &options.Options{
+				RawRedirectURL: "https://proxy.example.com/oauth2/callback",
+				Providers: options.Providers{
+					samlProvider,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a SAML provider and a relative redirect URL", &validateProvidersTableInput{
+			options: &options.Options{
+				RawRedirectURL: "/oauth2/callback",
+				Providers: options.Providers{
+					samlProvider,
+				},
+			},
+			errStrings: []string{relativeSAMLRedirectURLMsg},
+		}),
+		Entry("with invalid SAML providers", &validateProvidersTableInput{
+			options: &options.Options{
+				RawRedirectURL: "https://proxy.example.com/oauth2/callback",
+				Providers: options.Providers{
+					missingMetadataSAMLProvider,
+					multipleMetadataSAMLProvider,
+				},
+			},
+			errStrings: []string{
+				missingSAMLEntityIDMsg,
+				missingSAMLEntityIDMsg,
+				missingSAMLMetadataMsg,
+				invalidSAMLBindingMsg,
+				missingSAMLKeyPairMsg,
+				invalidSAMLCertificateMsg,
+				multipleSAMLMetadataMsg,
+			},
+		}),
 	)
 })
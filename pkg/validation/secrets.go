@@ -0,0 +1,68 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	optionsutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
+)
+
+// loadSecrets loads the secrets configured with secret sources into the
+// options they replace. This runs before the other validations so that the
+// loaded secrets are validated like secrets set directly.
+func loadSecrets(o *options.Options) []string {
+	msgs := []string{}
+	load := func(name string, source *options.SecretSource, secret *string) {
+		if source == nil {
+			return
+		}
+		value, msg := loadSecret(source)
+		if msg != "" {
+			msgs = append(msgs, fmt.Sprintf("could not load the %s: %s", name, msg))
+			return
+		}
+		*secret = value
+	}
+
+	load("cookie secret", o.Secrets.CookieSecret, &o.Cookie.Secret)
+	if len(o.Secrets.PreviousCookieSecrets) > 0 {
+		previous := make([]string, len(o.Secrets.PreviousCookieSecrets))
+		for i := range o.Secrets.PreviousCookieSecrets {
+			load(fmt.Sprintf("previous cookie secret %d", i), &o.Secrets.PreviousCookieSecrets[i], &previous[i])
+		}
+		o.Cookie.PreviousSecrets = previous
+	}
+	load("signature key", o.Secrets.SignatureKey, &o.SignatureKey)
+	load("redis password", o.Secrets.RedisPassword, &o.Session.Redis.Password)
+	load("redis sentinel password", o.Secrets.RedisSentinelPassword, &o.Session.Redis.SentinelPassword)
+	load("sql connection url", o.Secrets.SQLConnectionURL, &o.Session.SQL.ConnectionURL)
+	load("ldap bind password", o.Secrets.LDAPBindPassword, &o.LDAP.BindPassword)
+
+	for i := range o.Providers {
+		provider := &o.Providers[i]
+		if source := provider.ClientSecretSource; source != nil && source.FromFile != "" && len(source.Value) == 0 && source.FromEnv == "" {
+			// The client secret file is read again on each use
+			provider.ClientSecret = ""
+			provider.ClientSecretFile = source.FromFile
+		} else {
+			load(fmt.Sprintf("client secret of provider %s", provider.ID), source, &provider.ClientSecret)
+		}
+		load(fmt.Sprintf("github token of provider %s", provider.ID), provider.GitHubConfig.TokenSource, &provider.GitHubConfig.Token)
+	}
+
+	return msgs
+}
+
+// loadSecret returns the value of the secret source without trailing line
+// breaks, or a message if it could not be loaded
+func loadSecret(source *options.SecretSource) (string, string) {
+	if msg := validateSecretSource(*source); msg != "" {
+		return "", msg
+	}
+	value, err := optionsutil.GetSecretValue(source)
+	if err != nil {
+		return "", err.Error()
+	}
+	return strings.TrimRight(string(value), "\r\n"), ""
+}
@@ -0,0 +1,111 @@
+package validation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Secrets", func() {
+	var dir string
+
+	writeSecret := func(name, value string) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(value), 0600)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "oauth2-proxy-secrets")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("loads the secrets into the options they replace", func() {
+		o := &options.Options{
+			Secrets: options.Secrets{
+				CookieSecret: &options.SecretSource{FromFile: writeSecret("cookie", "secretthirtytwobytes+abcdefghijk\n")},
+				PreviousCookieSecrets: []options.SecretSource{
+					{Value: []byte("previousthirtytwobytes+abcdefghi")},
+				},
+				SignatureKey:          &options.SecretSource{FromFile: writeSecret("signature", "sha256:signature\r\n")},
+				RedisPassword:         &options.SecretSource{FromFile: writeSecret("redis", "redis")},
+				RedisSentinelPassword: &options.SecretSource{FromFile: writeSecret("sentinel", "sentinel")},
+				SQLConnectionURL:      &options.SecretSource{FromFile: writeSecret("sql", "postgres://proxy:password@db/sessions\n")},
+				LDAPBindPassword:      &options.SecretSource{FromFile: writeSecret("ldap", "ldap\n")},
+			},
+			Providers: options.Providers{
+				{
+					ID:                 "github",
+					ClientSecretSource: &options.SecretSource{Value: []byte("client-secret")},
+					GitHubConfig: options.GitHubOptions{
+						TokenSource: &options.SecretSource{FromFile: writeSecret("token", "token\n")},
+					},
+				},
+			},
+		}
+
+		Expect(loadSecrets(o)).To(BeEmpty())
+		Expect(o.Cookie.Secret).To(Equal("secretthirtytwobytes+abcdefghijk"))
+		Expect(o.Cookie.PreviousSecrets).To(Equal([]string{"previousthirtytwobytes+abcdefghi"}))
+		Expect(o.SignatureKey).To(Equal("sha256:signature"))
+		Expect(o.Session.Redis.Password).To(Equal("redis"))
+		Expect(o.Session.Redis.SentinelPassword).To(Equal("sentinel"))
+		Expect(o.Session.SQL.ConnectionURL).To(Equal("postgres://proxy:password@db/sessions"))
+		Expect(o.LDAP.BindPassword).To(Equal("ldap"))
+		Expect(o.Providers[0].ClientSecret).To(Equal("client-secret"))
+		Expect(o.Providers[0].GitHubConfig.Token).To(Equal("token"))
+	})
+
+	It("reads a client secret file on each use", func() {
+		path := writeSecret("client", "client-secret")
+		o := &options.Options{
+			Providers: options.Providers{
+				{
+					ID:                 "oidc",
+					ClientSecret:       "replaced",
+					ClientSecretSource: &options.SecretSource{FromFile: path},
+				},
+			},
+		}
+
+		Expect(loadSecrets(o)).To(BeEmpty())
+		Expect(o.Providers[0].ClientSecret).To(BeEmpty())
+		Expect(o.Providers[0].ClientSecretFile).To(Equal(path))
+	})
+
+	It("keeps the options without secret sources", func() {
+		o := &options.Options{
+			Cookie:       options.Cookie{Secret: "cookie"},
+			SignatureKey: "sha256:signature",
+		}
+
+		Expect(loadSecrets(o)).To(BeEmpty())
+		Expect(o.Cookie.Secret).To(Equal("cookie"))
+		Expect(o.SignatureKey).To(Equal("sha256:signature"))
+	})
+
+	It("returns messages for secrets that cannot be loaded", func() {
+		o := &options.Options{
+			Cookie: options.Cookie{Secret: "cookie"},
+			Secrets: options.Secrets{
+				CookieSecret:     &options.SecretSource{FromFile: filepath.Join(dir, "missing")},
+				LDAPBindPassword: &options.SecretSource{Value: []byte("ldap"), FromEnv: "LDAP_PASSWORD"},
+			},
+		}
+
+		Expect(loadSecrets(o)).To(ConsistOf(
+			"could not load the cookie secret: error loadig secret from file: stat "+filepath.Join(dir, "missing")+": no such file or directory",
+			"could not load the ldap bind password: "+multipleValuesForSecretSource,
+		))
+		Expect(o.Cookie.Secret).To(Equal("cookie"))
+	})
+})
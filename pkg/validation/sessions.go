@@ -4,13 +4,50 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/sql"
 )
 
+// sqlTablePrefixRegex restricts the table prefix to a plain identifier as it
+// is interpolated into the queries of the sql session store
+var sqlTablePrefixRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateSessionLifetime checks the idle timeout and maximum lifetime of
+// sessions
+func validateSessionLifetime(o *options.Options) []string {
+	msgs := []string{}
+	if o.Session.IdleTimeout < 0 {
+		msgs = append(msgs, "session-idle-timeout must not be negative")
+	}
+	if o.Session.MaxLifetime < 0 {
+		msgs = append(msgs, "session-max-lifetime must not be negative")
+	}
+	return msgs
+}
+
+// validateSessionLimit checks the limit on the number of sessions per user
+func validateSessionLimit(o *options.Options) []string {
+	msgs := []string{}
+	if o.Session.MaxPerUser < 0 {
+		msgs = append(msgs, "session-max-per-user must not be negative")
+	}
+	if o.Session.MaxPerUser > 0 && o.Session.Type == options.CookieSessionStoreType {
+		msgs = append(msgs, "session-max-per-user requires a persistent session store: session-store-type must not be cookie")
+	}
+	switch o.Session.LimitPolicy {
+	case "", options.RejectSessionLimitPolicy, options.EvictOldestSessionLimitPolicy:
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid session-limit-policy %q: must be %q or %q",
+			o.Session.LimitPolicy, options.RejectSessionLimitPolicy, options.EvictOldestSessionLimitPolicy))
+	}
+	return msgs
+}
+
 func validateSessionCookieMinimal(o *options.Options) []string {
 	if !o.Session.Cookie.Minimal {
 		return []string{}
@@ -36,9 +73,25 @@ func validateSessionCookieMinimal(o *options.Options) []string {
 		msgs = append(msgs,
 			"cookie_refresh > 0 requires oauth tokens in sessions. session_cookie_minimal cannot be set")
 	}
+	if o.Cookie.RefreshBeforeExpiry != time.Duration(0) {
+		msgs = append(msgs,
+			"cookie_refresh_before_expiry > 0 requires oauth tokens in sessions. session_cookie_minimal cannot be set")
+	}
 	return msgs
 }
 
+// validateAdminSessionStore ensures the admin API is only enabled with session
+// stores that can keep track of the sessions of each user
+func validateAdminSessionStore(o *options.Options) []string {
+	if len(o.AdminEmails) == 0 && len(o.AdminGroups) == 0 {
+		return []string{}
+	}
+	if o.Session.Type == options.CookieSessionStoreType {
+		return []string{"admin-email and admin-group require a persistent session store: session-store-type must not be cookie"}
+	}
+	return []string{}
+}
+
 // validateRedisSessionStore builds a Redis Client from the options and
 // attempts to connect, Set, Get and Del a random health check key
 func validateRedisSessionStore(o *options.Options) []string {
@@ -86,3 +139,57 @@ func sendRedisConnectionTest(client redis.Client, key string, val string) []stri
 	}
 	return msgs
 }
+
+// validateSQLSessionStore checks the sql session store options and attempts
+// to connect to the configured database
+func validateSQLSessionStore(o *options.Options) []string {
+	if o.Session.Type != options.SQLSessionStoreType {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if o.Session.SQL.Driver == "" {
+		msgs = append(msgs, "missing setting: sql-driver")
+	}
+	if o.Session.SQL.ConnectionURL == "" {
+		msgs = append(msgs, "missing setting: sql-connection-url")
+	}
+	if !sqlTablePrefixRegex.MatchString(o.Session.SQL.TablePrefix) {
+		msgs = append(msgs, fmt.Sprintf("invalid sql-table-prefix %q: must only contain letters, digits and underscores", o.Session.SQL.TablePrefix))
+	}
+	if o.Session.SQL.CleanupInterval < 0 {
+		msgs = append(msgs, "sql-cleanup-interval must not be negative")
+	}
+	if len(msgs) > 0 {
+		return msgs
+	}
+
+	db, err := sql.OpenDB(o.Session.SQL)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to initialize a sql client: %v", err)}
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return []string{fmt.Sprintf("unable to connect to the sql database: %v", err)}
+	}
+	return msgs
+}
+
+// validateMemorySessionStore checks the memory session store options
+func validateMemorySessionStore(o *options.Options) []string {
+	if o.Session.Type != options.MemorySessionStoreType {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if o.Session.Memory.MaxSessions <= 0 {
+		msgs = append(msgs, "memory-max-sessions must be greater than 0")
+	}
+	if o.Session.Memory.CleanupInterval < 0 {
+		msgs = append(msgs, "memory-cleanup-interval must not be negative")
+	}
+	return msgs
+}
@@ -16,6 +16,7 @@ var _ = Describe("Sessions", func() {
 		idTokenConflictMsg     = "id_token claim for header \"X-ID-Token\" requires oauth tokens in sessions. session_cookie_minimal cannot be set"
 		accessTokenConflictMsg = "access_token claim for header \"X-Access-Token\" requires oauth tokens in sessions. session_cookie_minimal cannot be set"
 		cookieRefreshMsg       = "cookie_refresh > 0 requires oauth tokens in sessions. session_cookie_minimal cannot be set"
+		refreshExpiryMsg       = "cookie_refresh_before_expiry > 0 requires oauth tokens in sessions. session_cookie_minimal cannot be set"
 	)
 
 	type cookieMinimalTableInput struct {
@@ -148,6 +149,19 @@ var _ = Describe("Sessions", func() {
 			},
 			errStrings: []string{cookieRefreshMsg},
 		}),
+		Entry("CookieRefreshBeforeExpiry conflict", &cookieMinimalTableInput{
+			opts: &options.Options{
+				Cookie: options.Cookie{
+					RefreshBeforeExpiry: time.Minute,
+				},
+				Session: options.SessionOptions{
+					Cookie: options.CookieStoreOptions{
+						Minimal: true,
+					},
+				},
+			},
+			errStrings: []string{refreshExpiryMsg},
+		}),
 		Entry("Multiple conflicts", &cookieMinimalTableInput{
 			opts: &options.Options{
 				Session: options.SessionOptions{
@@ -405,4 +419,255 @@ var _ = Describe("Sessions", func() {
 			errStrings: []string{clusterAndSentinelMsg},
 		}),
 	)
+
+	type sqlStoreTableInput struct {
+		opts       *options.Options
+		errStrings []string
+	}
+
+	DescribeTable("validateSQLSessionStore",
+		func(o *sqlStoreTableInput) {
+			Expect(validateSQLSessionStore(o.opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("cookie sessions are skipped", &sqlStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.CookieSessionStoreType,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("connect successfully to sqlite", &sqlStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.SQLSessionStoreType,
+					SQL: options.SQLStoreOptions{
+						Driver:        "sqlite3",
+						ConnectionURL: "file::memory:",
+						TablePrefix:   "oauth2_proxy",
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("missing driver and connection url", &sqlStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.SQLSessionStoreType,
+					SQL: options.SQLStoreOptions{
+						TablePrefix: "oauth2_proxy",
+					},
+				},
+			},
+			errStrings: []string{
+				"missing setting: sql-driver",
+				"missing setting: sql-connection-url",
+			},
+		}),
+		Entry("invalid table prefix", &sqlStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.SQLSessionStoreType,
+					SQL: options.SQLStoreOptions{
+						Driver:        "sqlite3",
+						ConnectionURL: "file::memory:",
+						TablePrefix:   "sessions; DROP TABLE users",
+					},
+				},
+			},
+			errStrings: []string{
+				"invalid sql-table-prefix \"sessions; DROP TABLE users\": must only contain letters, digits and underscores",
+			},
+		}),
+		Entry("unsupported driver", &sqlStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.SQLSessionStoreType,
+					SQL: options.SQLStoreOptions{
+						Driver:        "oracle",
+						ConnectionURL: "oracle://localhost",
+						TablePrefix:   "oauth2_proxy",
+					},
+				},
+			},
+			errStrings: []string{
+				"unable to initialize a sql client: unsupported sql driver \"oracle\": supported drivers are postgres, mysql and sqlite3",
+			},
+		}),
+	)
+
+	type memoryStoreTableInput struct {
+		opts       *options.Options
+		errStrings []string
+	}
+
+	DescribeTable("validateMemorySessionStore",
+		func(o *memoryStoreTableInput) {
+			Expect(validateMemorySessionStore(o.opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("cookie sessions are skipped", &memoryStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.CookieSessionStoreType,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("valid options", &memoryStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.MemorySessionStoreType,
+					Memory: options.MemoryStoreOptions{
+						MaxSessions:     100,
+						CleanupInterval: time.Minute,
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("invalid max sessions and cleanup interval", &memoryStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.MemorySessionStoreType,
+					Memory: options.MemoryStoreOptions{
+						MaxSessions:     0,
+						CleanupInterval: -time.Minute,
+					},
+				},
+			},
+			errStrings: []string{
+				"memory-max-sessions must be greater than 0",
+				"memory-cleanup-interval must not be negative",
+			},
+		}),
+	)
+
+	type sessionLifetimeTableInput struct {
+		opts       *options.Options
+		errStrings []string
+	}
+
+	DescribeTable("validateSessionLifetime",
+		func(o *sessionLifetimeTableInput) {
+			Expect(validateSessionLifetime(o.opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("without limits", &sessionLifetimeTableInput{
+			opts:       &options.Options{},
+			errStrings: []string{},
+		}),
+		Entry("valid limits", &sessionLifetimeTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					IdleTimeout: 30 * time.Minute,
+					MaxLifetime: 12 * time.Hour,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("negative limits", &sessionLifetimeTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					IdleTimeout: -time.Minute,
+					MaxLifetime: -time.Hour,
+				},
+			},
+			errStrings: []string{
+				"session-idle-timeout must not be negative",
+				"session-max-lifetime must not be negative",
+			},
+		}),
+	)
+
+	type sessionLimitTableInput struct {
+		opts       *options.Options
+		errStrings []string
+	}
+
+	DescribeTable("validateSessionLimit",
+		func(o *sessionLimitTableInput) {
+			Expect(validateSessionLimit(o.opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("without a limit", &sessionLimitTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type:        options.CookieSessionStoreType,
+					LimitPolicy: options.RejectSessionLimitPolicy,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("a limit with redis sessions", &sessionLimitTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type:        options.RedisSessionStoreType,
+					MaxPerUser:  3,
+					LimitPolicy: options.EvictOldestSessionLimitPolicy,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("a limit with cookie sessions", &sessionLimitTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type:       options.CookieSessionStoreType,
+					MaxPerUser: 3,
+				},
+			},
+			errStrings: []string{
+				"session-max-per-user requires a persistent session store: session-store-type must not be cookie",
+			},
+		}),
+		Entry("a negative limit and an unknown policy", &sessionLimitTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type:        options.MemorySessionStoreType,
+					MaxPerUser:  -1,
+					LimitPolicy: "evict-newest",
+				},
+			},
+			errStrings: []string{
+				"session-max-per-user must not be negative",
+				"invalid session-limit-policy \"evict-newest\": must be \"reject\" or \"evict-oldest\"",
+			},
+		}),
+	)
+
+	type adminStoreTableInput struct {
+		opts       *options.Options
+		errStrings []string
+	}
+
+	DescribeTable("validateAdminSessionStore",
+		func(o *adminStoreTableInput) {
+			Expect(validateAdminSessionStore(o.opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("no admins with cookie sessions", &adminStoreTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.CookieSessionStoreType,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("admins with redis sessions", &adminStoreTableInput{
+			opts: &options.Options{
+				AdminEmails: []string{"admin@example.com"},
+				Session: options.SessionOptions{
+					Type: options.RedisSessionStoreType,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("admins with cookie sessions", &adminStoreTableInput{
+			opts: &options.Options{
+				AdminGroups: []string{"admins"},
+				Session: options.SessionOptions{
+					Type: options.CookieSessionStoreType,
+				},
+			},
+			errStrings: []string{
+				"admin-email and admin-group require a persistent session store: session-store-type must not be cookie",
+			},
+		}),
+	)
 })
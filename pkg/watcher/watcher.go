@@ -1,8 +1,9 @@
 // +build go1.3,!plan9,!solaris
 
-package main
+package watcher
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
@@ -12,9 +13,9 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 )
 
-// WaitForReplacement waits for a file to exist on disk and then starts a watch
+// waitForReplacement waits for a file to exist on disk and then starts a watch
 // for the file
-func WaitForReplacement(filename string, op fsnotify.Op,
+func waitForReplacement(filename string, op fsnotify.Op,
 	watcher *fsnotify.Watcher) {
 	const sleepInterval = 50 * time.Millisecond
 
@@ -33,18 +34,23 @@ func WaitForReplacement(filename string, op fsnotify.Op,
 	}
 }
 
-// WatchForUpdates performs an action every time a file on disk is updated
-func WatchForUpdates(filename string, done <-chan bool, action func()) {
+// WatchFileForUpdates performs an action every time a file on disk is updated
+func WatchFileForUpdates(filename string, done <-chan bool, action func()) error {
 	filename = filepath.Clean(filename)
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		logger.Fatal("failed to create watcher for ", filename, ": ", err)
+		return fmt.Errorf("failed to create watcher for '%s': %s", filename, err)
 	}
+	if err = watcher.Add(filename); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("failed to add '%s' to watcher: %v", filename, err)
+	}
+
 	go func() {
 		defer func(w *fsnotify.Watcher) {
 			cerr := w.Close()
 			if cerr != nil {
-				logger.Fatalf("error closing watcher: %v", err)
+				logger.Errorf("error closing watcher: %v", cerr)
 			}
 		}(watcher)
 		for {
@@ -60,21 +66,19 @@ func WatchForUpdates(filename string, done <-chan bool, action func()) {
 				// can't be opened.
 				if event.Op&(fsnotify.Remove|fsnotify.Rename|fsnotify.Chmod) != 0 {
 					logger.Printf("watching interrupted on event: %s", event)
-					err = watcher.Remove(filename)
+					err := watcher.Remove(filename)
 					if err != nil {
 						logger.Printf("error removing watcher on %s: %v", filename, err)
 					}
-					WaitForReplacement(filename, event.Op, watcher)
+					waitForReplacement(filename, event.Op, watcher)
 				}
 				logger.Printf("reloading after event: %s", event)
 				action()
-			case err = <-watcher.Errors:
+			case err := <-watcher.Errors:
 				logger.Errorf("error watching %s: %s", filename, err)
 			}
 		}
 	}()
-	if err = watcher.Add(filename); err != nil {
-		logger.Fatal("failed to add ", filename, " to watcher: ", err)
-	}
 	logger.Printf("watching %s for updates", filename)
+	return nil
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
+)
+
+// providerRegistry holds the configured providers indexed by their IDs.
+// The first provider registered is the default provider, it is used when
+// no provider ID is given.
+type providerRegistry struct {
+	ordered []providers.Provider
+	byID    map[string]providers.Provider
+}
+
+// newProviderRegistry builds a registry from an ordered list of providers.
+func newProviderRegistry(list []providers.Provider) *providerRegistry {
+	r := &providerRegistry{
+		ordered: list,
+		byID:    make(map[string]providers.Provider, len(list)),
+	}
+	for _, p := range list {
+		r.byID[p.Data().ID] = p
+	}
+	return r
+}
+
+// all returns the providers in the order they were configured.
+func (r *providerRegistry) all() []providers.Provider {
+	return r.ordered
+}
+
+// defaultProvider returns the first configured provider.
+func (r *providerRegistry) defaultProvider() providers.Provider {
+	if len(r.ordered) == 0 {
+		return nil
+	}
+	return r.ordered[0]
+}
+
+// get returns the provider with the given ID.
+// An empty ID selects the default provider.
+func (r *providerRegistry) get(id string) (providers.Provider, error) {
+	if id == "" {
+		if p := r.defaultProvider(); p != nil {
+			return p, nil
+		}
+		return nil, fmt.Errorf("no providers configured")
+	}
+	if p, ok := r.byID[id]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown provider %q", id)
+}
+
+// forSession returns the provider that issued the session.
+// Sessions without a provider ID (eg. those created before multiple providers
+// were supported) belong to the default provider.
+func (r *providerRegistry) forSession(s *sessionsapi.SessionState) (providers.Provider, error) {
+	return r.get(s.ProviderID)
+}
+
+// refreshSession refreshes the session with the provider that issued it.
+func (r *providerRegistry) refreshSession(ctx context.Context, s *sessionsapi.SessionState) (bool, error) {
+	provider, err := r.forSession(s)
+	if err != nil {
+		return false, err
+	}
+	return provider.RefreshSession(ctx, s)
+}
+
+// validateSession validates the session with the provider that issued it.
+// Sessions issued by a provider that is no longer configured are invalid.
+func (r *providerRegistry) validateSession(ctx context.Context, s *sessionsapi.SessionState) bool {
+	provider, err := r.forSession(s)
+	if err != nil {
+		logger.Errorf("Unable to validate session: %v", err)
+		return false
+	}
+	return provider.ValidateSession(ctx, s)
+}
+
+// authorize checks the session against the authorization rules of the
+// provider that issued it.
+func (r *providerRegistry) authorize(ctx context.Context, s *sessionsapi.SessionState) (bool, error) {
+	provider, err := r.forSession(s)
+	if err != nil {
+		return false, err
+	}
+	return provider.Authorize(ctx, s)
+}
+
+// verifyLogoutToken verifies a back-channel logout token with the OIDC
+// providers. The token belongs to the first provider able to verify it.
+func (r *providerRegistry) verifyLogoutToken(ctx context.Context, rawToken string) (providers.Provider, *providers.LogoutToken, error) {
+	var errs []string
+	for _, provider := range r.ordered {
+		if provider.Data().Verifier == nil {
+			continue
+		}
+		token, err := provider.Data().VerifyLogoutToken(ctx, rawToken)
+		if err == nil {
+			return provider, token, nil
+		}
+		errs = append(errs, fmt.Sprintf("provider %q: %v", provider.Data().ID, err))
+	}
+	if len(errs) == 0 {
+		return nil, nil, fmt.Errorf("no OIDC providers configured")
+	}
+	return nil, nil, fmt.Errorf("unable to verify logout_token: %s", strings.Join(errs, "; "))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderRegistry(t *testing.T) {
+	providerA := &TestProvider{
+		ProviderData: &providers.ProviderData{ID: "provider-a"},
+		ValidToken:   true,
+	}
+	providerB := &TestProvider{
+		ProviderData: &providers.ProviderData{ID: "provider-b"},
+		ValidToken:   false,
+	}
+	registry := newProviderRegistry([]providers.Provider{providerA, providerB})
+
+	testCases := map[string]struct {
+		providerID       string
+		expectedProvider providers.Provider
+		expectedValid    bool
+		expectError      bool
+	}{
+		"Empty ID selects the default provider": {
+			providerID:       "",
+			expectedProvider: providerA,
+			expectedValid:    true,
+		},
+		"Default provider by ID": {
+			providerID:       "provider-a",
+			expectedProvider: providerA,
+			expectedValid:    true,
+		},
+		"Second provider by ID": {
+			providerID:       "provider-b",
+			expectedProvider: providerB,
+			expectedValid:    false,
+		},
+		"Unknown provider": {
+			providerID:    "provider-c",
+			expectedValid: false,
+			expectError:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			session := &sessions.SessionState{ProviderID: tc.providerID}
+
+			provider, err := registry.forSession(session)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedProvider, provider)
+			assert.Equal(t, tc.expectedValid, registry.validateSession(context.Background(), session))
+
+			_, err = registry.refreshSession(context.Background(), session)
+			if tc.expectError {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -314,7 +314,7 @@ func TestAzureProviderRedeem(t *testing.T) {
 			bURL, _ := url.Parse(b.URL)
 			p := testAzureProvider(bURL.Host)
 			p.Data().RedeemURL.Path = "/common/oauth2/token"
-			s, err := p.Redeem(context.Background(), "https://localhost", "1234")
+			s, err := p.Redeem(context.Background(), "https://localhost", "1234", "")
 			if testCase.InjectRedeemURLError {
 				assert.NotNil(t, err)
 			} else {
@@ -336,7 +336,7 @@ func TestAzureProviderRedeem(t *testing.T) {
 func TestAzureProviderProtectedResourceConfigured(t *testing.T) {
 	p := testAzureProvider("")
 	p.ProtectedResource, _ = url.Parse("http://my.resource.test")
-	result := p.GetLoginURL("https://my.test.app/oauth", "", "")
+	result := p.GetLoginURL("https://my.test.app/oauth", "", "", url.Values{})
 	assert.Contains(t, result, "resource="+url.QueryEscape("http://my.resource.test"))
 }
 
@@ -0,0 +1,240 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// PrivateKeyJWTAuthMethod authenticates the client with a JWT assertion
+	// signed by its private key (RFC 7523)
+	PrivateKeyJWTAuthMethod = "private_key_jwt"
+
+	// TLSClientAuthMethod authenticates the client with a TLS client
+	// certificate (RFC 8705)
+	TLSClientAuthMethod = "tls_client_auth"
+
+	clientAssertionType     = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	clientAssertionLifetime = 5 * time.Minute
+)
+
+// addClientSecret adds the client secret to the token request parameters
+// when the client authenticates with its secret.
+// Public clients without a secret only send their client ID.
+func (p *ProviderData) addClientSecret(params url.Values) error {
+	if p.ClientAuthMethod != "" {
+		return nil
+	}
+
+	clientSecret, err := p.GetClientSecret()
+	if err != nil {
+		return err
+	}
+	if clientSecret != "" {
+		params.Add("client_secret", clientSecret)
+	}
+	return nil
+}
+
+// oauth2Config returns the configuration for code and refresh token
+// exchanges with the token endpoint
+func (p *ProviderData) oauth2Config(redirectURL string) (*oauth2.Config, error) {
+	c := &oauth2.Config{
+		ClientID: p.ClientID,
+		Endpoint: oauth2.Endpoint{
+			TokenURL: p.RedeemURL.String(),
+		},
+		RedirectURL: redirectURL,
+	}
+
+	if p.ClientAuthMethod != "" {
+		// Only send the client ID, the token client authenticates the requests
+		c.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+		return c, nil
+	}
+
+	clientSecret, err := p.GetClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	c.ClientSecret = clientSecret
+	return c, nil
+}
+
+// tokenContext makes the oauth2 package use the token client for the
+// requests made with the context
+func (p *ProviderData) tokenContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, p.tokenClient())
+}
+
+// tokenClient returns the HTTP client for requests to the token endpoint.
+// The default client is used until the token client is built.
+func (p *ProviderData) tokenClient() *http.Client {
+	if p.TokenClient != nil {
+		return p.TokenClient
+	}
+	return http.DefaultClient
+}
+
+// NewTokenClient builds the HTTP client for requests to the token endpoint.
+// It authenticates the client with the configured client authentication
+// method and builds on the default client, so it must be called once the
+// provider CAs are configured.
+func (p *ProviderData) NewTokenClient() *http.Client {
+	switch p.ClientAuthMethod {
+	case PrivateKeyJWTAuthMethod:
+		return &http.Client{
+			Transport: &clientAssertionTransport{
+				next:     defaultTransport(),
+				provider: p,
+			},
+		}
+	case TLSClientAuthMethod:
+		transport := cloneDefaultTransport()
+		if p.ClientCertificate != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{*p.ClientCertificate}
+		}
+		return &http.Client{Transport: transport}
+	default:
+		return http.DefaultClient
+	}
+}
+
+// defaultTransport returns the transport of the default client, which holds
+// the configured provider CAs
+func defaultTransport() http.RoundTripper {
+	if http.DefaultClient.Transport != nil {
+		return http.DefaultClient.Transport
+	}
+	return http.DefaultTransport
+}
+
+func cloneDefaultTransport() *http.Transport {
+	transport, ok := defaultTransport().(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	} else {
+		transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+	}
+	return transport
+}
+
+// clientAssertionTransport adds a signed client assertion to the form
+// encoded token requests it sends
+type clientAssertionTransport struct {
+	next     http.RoundTripper
+	provider *ProviderData
+}
+
+// RoundTrip replaces the body of the request with one that carries the client
+// assertion, the original request is left untouched
+func (t *clientAssertionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading token request body: %v", err)
+		}
+	}
+
+	params, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing token request body: %v", err)
+	}
+
+	// The audience of the assertion is the token endpoint
+	audience := *req.URL
+	audience.RawQuery = ""
+	audience.Fragment = ""
+
+	assertion, err := t.provider.signClientAssertion(audience.String())
+	if err != nil {
+		return nil, err
+	}
+	params.Del("client_secret")
+	params.Set("client_assertion_type", clientAssertionType)
+	params.Set("client_assertion", assertion)
+
+	encoded := params.Encode()
+	authenticated := req.Clone(req.Context())
+	authenticated.Body = ioutil.NopCloser(strings.NewReader(encoded))
+	authenticated.ContentLength = int64(len(encoded))
+	authenticated.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return t.next.RoundTrip(authenticated)
+}
+
+// signClientAssertion creates a client assertion JWT for the audience
+func (p *ProviderData) signClientAssertion(audience string) (string, error) {
+	if p.ClientAssertionKey == nil {
+		return "", fmt.Errorf("no private key configured to sign client assertions")
+	}
+
+	algorithm := p.ClientAssertionSigningAlgorithm
+	if algorithm == "" {
+		algorithm = DefaultSigningAlgorithm(p.ClientAssertionKey)
+	}
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return "", fmt.Errorf("unknown client assertion signing algorithm %q", algorithm)
+	}
+
+	now := time.Now()
+	claims := &jwt.StandardClaims{
+		Issuer:    p.ClientID,
+		Subject:   p.ClientID,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(clientAssertionLifetime).Unix(),
+		Id:        randSeq(32),
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if p.ClientAssertionKeyID != "" {
+		token.Header["kid"] = p.ClientAssertionKeyID
+	}
+
+	assertion, err := token.SignedString(p.ClientAssertionKey)
+	if err != nil {
+		return "", fmt.Errorf("error signing client assertion: %v", err)
+	}
+	return assertion, nil
+}
+
+// DefaultSigningAlgorithm returns the JWT signing algorithm used for client
+// assertions signed with the key when none is configured
+func DefaultSigningAlgorithm(key crypto.Signer) string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256.Alg()
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P384():
+			return jwt.SigningMethodES384.Alg()
+		case elliptic.P521():
+			return jwt.SigningMethodES512.Alg()
+		default:
+			return jwt.SigningMethodES256.Alg()
+		}
+	default:
+		return ""
+	}
+}
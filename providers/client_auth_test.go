@@ -0,0 +1,197 @@
+package providers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+)
+
+const clientAuthTokenResponse = `{"access_token": "access", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600}`
+
+func newClientAuthTokenServer(g *WithT, form *url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		g.Expect(req.ParseForm()).To(Succeed())
+		*form = req.PostForm
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write([]byte(clientAuthTokenResponse))
+	}))
+}
+
+func TestPrivateKeyJWTClientAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		provider          *ProviderData
+		expectedAlgorithm string
+		expectedKeyID     string
+		publicKey         interface{}
+	}{
+		"RSA key": {
+			provider: &ProviderData{
+				ClientAssertionKey:   rsaKey,
+				ClientAssertionKeyID: "rsa-key",
+			},
+			expectedAlgorithm: "RS256",
+			expectedKeyID:     "rsa-key",
+			publicKey:         &rsaKey.PublicKey,
+		},
+		"RSA key with signing algorithm": {
+			provider: &ProviderData{
+				ClientAssertionKey:              rsaKey,
+				ClientAssertionSigningAlgorithm: "PS512",
+			},
+			expectedAlgorithm: "PS512",
+			publicKey:         &rsaKey.PublicKey,
+		},
+		"EC key": {
+			provider: &ProviderData{
+				ClientAssertionKey: ecKey,
+			},
+			expectedAlgorithm: "ES384",
+			publicKey:         &ecKey.PublicKey,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for _, flow := range []string{"redeem", "refresh"} {
+				g := NewWithT(t)
+
+				var form url.Values
+				server := newClientAuthTokenServer(g, &form)
+				defer server.Close()
+
+				p := tc.provider
+				p.ClientID = "client"
+				p.ClientSecret = "secret"
+				p.ClientAuthMethod = PrivateKeyJWTAuthMethod
+				p.TokenClient = p.NewTokenClient()
+				p.RedeemURL, err = url.Parse(server.URL + "/token")
+				g.Expect(err).ToNot(HaveOccurred())
+
+				switch flow {
+				case "redeem":
+					_, err = p.Redeem(context.Background(), "https://my.test.app/oauth", "code", "")
+				case "refresh":
+					// The oauth2 package refreshes the sessions of the OIDC based providers
+					var c *oauth2.Config
+					c, err = p.oauth2Config("")
+					g.Expect(err).ToNot(HaveOccurred())
+					_, err = c.TokenSource(p.tokenContext(context.Background()), &oauth2.Token{RefreshToken: "refresh"}).Token()
+				}
+				g.Expect(err).ToNot(HaveOccurred())
+
+				g.Expect(form.Get("client_id")).To(Equal("client"))
+				g.Expect(form).ToNot(HaveKey("client_secret"))
+				g.Expect(form.Get("client_assertion_type")).To(Equal(clientAssertionType))
+
+				claims := &jwt.StandardClaims{}
+				token, err := jwt.ParseWithClaims(form.Get("client_assertion"), claims, func(token *jwt.Token) (interface{}, error) {
+					return tc.publicKey, nil
+				})
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(token.Method.Alg()).To(Equal(tc.expectedAlgorithm))
+				if tc.expectedKeyID != "" {
+					g.Expect(token.Header["kid"]).To(Equal(tc.expectedKeyID))
+				} else {
+					g.Expect(token.Header).ToNot(HaveKey("kid"))
+				}
+				g.Expect(claims.Issuer).To(Equal("client"))
+				g.Expect(claims.Subject).To(Equal("client"))
+				g.Expect(claims.Audience).To(Equal(server.URL + "/token"))
+				g.Expect(claims.Id).ToNot(BeEmpty())
+				g.Expect(claims.ExpiresAt).To(BeNumerically("<=", time.Now().Add(clientAssertionLifetime).Unix()))
+			}
+		})
+	}
+}
+
+func TestTLSClientAuth(t *testing.T) {
+	g := NewWithT(t)
+
+	clientCert := newTestClientCertificate(t)
+
+	var form url.Values
+	var peerCertificates []*x509.Certificate
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		g.Expect(req.ParseForm()).To(Succeed())
+		form = req.PostForm
+		peerCertificates = req.TLS.PeerCertificates
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write([]byte(clientAuthTokenResponse))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// The token client builds on the default client that trusts the provider CAs
+	defaultClient := http.DefaultClient
+	http.DefaultClient = server.Client()
+	defer func() { http.DefaultClient = defaultClient }()
+
+	redeemURL, err := url.Parse(server.URL)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	p := &ProviderData{
+		ClientID:          "client",
+		ClientSecret:      "secret",
+		ClientAuthMethod:  TLSClientAuthMethod,
+		ClientCertificate: &clientCert,
+		RedeemURL:         redeemURL,
+	}
+	p.TokenClient = p.NewTokenClient()
+	g.Expect(p.tokenClient()).To(BeIdenticalTo(p.TokenClient))
+
+	session, err := p.Redeem(context.Background(), "https://my.test.app/oauth", "code", "")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(session.AccessToken).To(Equal("access"))
+
+	g.Expect(form.Get("client_id")).To(Equal("client"))
+	g.Expect(form).ToNot(HaveKey("client_secret"))
+	g.Expect(form).ToNot(HaveKey("client_assertion"))
+	g.Expect(peerCertificates).To(HaveLen(1))
+	g.Expect(peerCertificates[0].Subject.CommonName).To(Equal("client"))
+}
+
+func newTestClientCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
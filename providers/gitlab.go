@@ -83,21 +83,12 @@ func NewGitLabProvider(p *ProviderData) *GitLabProvider {
 }
 
 // Redeem exchanges the OAuth2 authentication token for an ID token
-func (p *GitLabProvider) Redeem(ctx context.Context, redirectURL, code string) (s *sessions.SessionState, err error) {
-	clientSecret, err := p.GetClientSecret()
+func (p *GitLabProvider) Redeem(ctx context.Context, redirectURL, code, codeVerifier string) (s *sessions.SessionState, err error) {
+	c, err := p.oauth2Config(redirectURL)
 	if err != nil {
 		return
 	}
-
-	c := oauth2.Config{
-		ClientID:     p.ClientID,
-		ClientSecret: clientSecret,
-		Endpoint: oauth2.Endpoint{
-			TokenURL: p.RedeemURL.String(),
-		},
-		RedirectURL: redirectURL,
-	}
-	token, err := c.Exchange(ctx, code)
+	token, err := c.Exchange(p.tokenContext(ctx), code, codeVerifierOptions(codeVerifier)...)
 	if err != nil {
 		return nil, fmt.Errorf("token exchange: %v", err)
 	}
@@ -139,23 +130,15 @@ func (p *GitLabProvider) RefreshSession(ctx context.Context, s *sessions.Session
 }
 
 func (p *GitLabProvider) redeemRefreshToken(ctx context.Context, s *sessions.SessionState) error {
-	clientSecret, err := p.GetClientSecret()
+	c, err := p.oauth2Config("")
 	if err != nil {
 		return err
 	}
-
-	c := oauth2.Config{
-		ClientID:     p.ClientID,
-		ClientSecret: clientSecret,
-		Endpoint: oauth2.Endpoint{
-			TokenURL: p.RedeemURL.String(),
-		},
-	}
 	t := &oauth2.Token{
 		RefreshToken: s.RefreshToken,
 		Expiry:       time.Now().Add(-time.Hour),
 	}
-	token, err := c.TokenSource(ctx, t).Token()
+	token, err := c.TokenSource(p.tokenContext(ctx), t).Token()
 	if err != nil {
 		return fmt.Errorf("failed to get token: %v", err)
 	}
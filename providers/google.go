@@ -124,21 +124,22 @@ func claimsFromIDToken(idToken string) (*claims, error) {
 }
 
 // Redeem exchanges the OAuth2 authentication token for an ID token
-func (p *GoogleProvider) Redeem(ctx context.Context, redirectURL, code string) (*sessions.SessionState, error) {
+func (p *GoogleProvider) Redeem(ctx context.Context, redirectURL, code, codeVerifier string) (*sessions.SessionState, error) {
 	if code == "" {
 		return nil, ErrMissingCode
 	}
-	clientSecret, err := p.GetClientSecret()
-	if err != nil {
-		return nil, err
-	}
-
 	params := url.Values{}
 	params.Add("redirect_uri", redirectURL)
 	params.Add("client_id", p.ClientID)
-	params.Add("client_secret", clientSecret)
+	err := p.addClientSecret(params)
+	if err != nil {
+		return nil, err
+	}
 	params.Add("code", code)
 	params.Add("grant_type", "authorization_code")
+	if codeVerifier != "" {
+		params.Add("code_verifier", codeVerifier)
+	}
 
 	var jsonResponse struct {
 		AccessToken  string `json:"access_token"`
@@ -149,6 +150,7 @@ func (p *GoogleProvider) Redeem(ctx context.Context, redirectURL, code string) (
 
 	err = requests.New(p.RedeemURL.String()).
 		WithContext(ctx).
+		WithClient(p.tokenClient()).
 		WithMethod("POST").
 		WithBody(bytes.NewBufferString(params.Encode())).
 		SetHeader("Content-Type", "application/x-www-form-urlencoded").
@@ -289,14 +291,12 @@ func (p *GoogleProvider) RefreshSession(ctx context.Context, s *sessions.Session
 
 func (p *GoogleProvider) redeemRefreshToken(ctx context.Context, s *sessions.SessionState) error {
 	// https://developers.google.com/identity/protocols/OAuth2WebServer#refresh
-	clientSecret, err := p.GetClientSecret()
+	params := url.Values{}
+	params.Add("client_id", p.ClientID)
+	err := p.addClientSecret(params)
 	if err != nil {
 		return err
 	}
-
-	params := url.Values{}
-	params.Add("client_id", p.ClientID)
-	params.Add("client_secret", clientSecret)
 	params.Add("refresh_token", s.RefreshToken)
 	params.Add("grant_type", "refresh_token")
 
@@ -308,6 +308,7 @@ func (p *GoogleProvider) redeemRefreshToken(ctx context.Context, s *sessions.Ses
 
 	err = requests.New(p.RedeemURL.String()).
 		WithContext(ctx).
+		WithClient(p.tokenClient()).
 		WithMethod("POST").
 		WithBody(bytes.NewBufferString(params.Encode())).
 		SetHeader("Content-Type", "application/x-www-form-urlencoded").
@@ -0,0 +1,255 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+const (
+	// introspectionCacheMaxEntries is the number of introspected and rejected
+	// tokens kept in memory
+	introspectionCacheMaxEntries = 10000
+
+	// introspectionRejectionTTL is how long rejected tokens are cached, so
+	// that repeated requests with them don't all reach the introspection
+	// endpoint
+	introspectionRejectionTTL = time.Minute
+)
+
+// ErrInactiveToken is returned when the introspection endpoint reports that
+// a token is not active
+var ErrInactiveToken = errors.New("bearer token is not active")
+
+// IntrospectToken sends a bearer token to the introspection endpoint of the
+// provider (RFC 7662) and converts the response into a session.
+// The client authenticates to the introspection endpoint as it does to the
+// token endpoint.
+func (p *ProviderData) IntrospectToken(ctx context.Context, token string) (*sessions.SessionState, error) {
+	claims, err := p.introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return p.buildSessionFromIntrospection(token, claims)
+}
+
+// introspect returns the claims of the introspection response for the token
+func (p *ProviderData) introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	if p.IntrospectionURL == nil || p.IntrospectionURL.String() == "" {
+		return nil, ErrNotImplemented
+	}
+
+	params := url.Values{}
+	params.Add("token", token)
+	params.Add("token_type_hint", "access_token")
+	params.Add("client_id", p.ClientID)
+	if err := p.addClientSecret(params); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	err := requests.New(p.IntrospectionURL.String()).
+		WithContext(ctx).
+		WithClient(p.tokenClient()).
+		WithMethod("POST").
+		WithBody(bytes.NewBufferString(params.Encode())).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetHeader("Accept", "application/json").
+		Do().
+		UnmarshalInto(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("error introspecting bearer token: %v", err)
+	}
+	return claims, nil
+}
+
+// buildSessionFromIntrospection maps the claims of an introspection response
+// into a session. Only active tokens issued for this client are accepted.
+// The claims are kept on the session for the bearer token rules.
+func (p *ProviderData) buildSessionFromIntrospection(token string, claims map[string]interface{}) (*sessions.SessionState, error) {
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrInactiveToken
+	}
+	if err := p.checkIntrospectedAudience(claims); err != nil {
+		return nil, err
+	}
+
+	ss := &sessions.SessionState{
+		AccessToken:         token,
+		Groups:              p.extractGroups(claims),
+		IntrospectionClaims: claims,
+	}
+	ss.User, _ = claims["sub"].(string)
+	ss.PreferredUsername, _ = claims["username"].(string)
+	if ss.User == "" {
+		ss.User = ss.PreferredUsername
+	}
+	if ss.User == "" {
+		return nil, errors.New("introspection response has no sub or username claim")
+	}
+	if email := claims[p.EmailClaim]; email != nil {
+		ss.Email = fmt.Sprint(email)
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		ss.Scopes = strings.Fields(scope)
+	}
+
+	// Numeric claims are decoded as float64
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresOn := time.Unix(int64(exp), 0)
+		ss.ExpiresOn = &expiresOn
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		createdAt := time.Unix(int64(iat), 0)
+		ss.CreatedAt = &createdAt
+	}
+	return ss, nil
+}
+
+// checkIntrospectedAudience checks the token was issued for this client.
+// When the response has an `aud` claim it must contain the client ID or one
+// of the introspection audiences, otherwise the `client_id` claim must be the
+// client ID.
+func (p *ProviderData) checkIntrospectedAudience(claims map[string]interface{}) error {
+	accepted := append([]string{p.ClientID}, p.IntrospectionAudiences...)
+
+	if aud, ok := claims["aud"]; ok {
+		var audiences []string
+		switch a := aud.(type) {
+		case string:
+			audiences = []string{a}
+		case []interface{}:
+			for _, v := range a {
+				if s, ok := v.(string); ok {
+					audiences = append(audiences, s)
+				}
+			}
+		}
+		for _, audience := range audiences {
+			if containsString(accepted, audience) {
+				return nil
+			}
+		}
+		return fmt.Errorf("introspected token audience %v is not accepted", aud)
+	}
+
+	clientID, _ := claims["client_id"].(string)
+	if clientID == "" {
+		return errors.New("introspection response has no aud or client_id claim")
+	}
+	if clientID != p.ClientID {
+		return fmt.Errorf("introspected token was issued to client %q", clientID)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateIntrospectionTokenToSessionFunc provides a handler converting opaque
+// bearer tokens into sessions with the introspection endpoint of the provider.
+// Active tokens are cached until they expire, so the endpoint is only called
+// once for each token. Rejected tokens are cached for a minute.
+func (p *ProviderData) CreateIntrospectionTokenToSessionFunc() middleware.TokenToSessionFunc {
+	tokens := newIntrospectionCache()
+
+	return func(ctx context.Context, token string) (*sessions.SessionState, error) {
+		if session, err := tokens.Get(token); session != nil || err != nil {
+			return session, err
+		}
+
+		claims, err := p.introspect(ctx, token)
+		if err != nil {
+			// The endpoint could not be reached, try again with the next request
+			return nil, err
+		}
+
+		session, err := p.buildSessionFromIntrospection(token, claims)
+		if err == nil && session.IsExpired() {
+			err = errors.New("bearer token has expired")
+		}
+		if err != nil {
+			tokens.Reject(token, err)
+			return nil, err
+		}
+
+		tokens.Set(token, session)
+		return copySession(session), nil
+	}
+}
+
+// introspectionCache caches the sessions of introspected tokens until they
+// expire, and the errors of rejected tokens for the introspectionRejectionTTL.
+// Entries are keyed by a hash of the token so that tokens are not kept in
+// memory. Tokens without an expiry are not cached.
+type introspectionCache struct {
+	entries *cache.Cache
+}
+
+func newIntrospectionCache() *introspectionCache {
+	return &introspectionCache{entries: cache.New(introspectionCacheMaxEntries)}
+}
+
+// Get returns a copy of the session cached for the token, or the error of the
+// token if it was rejected. Both are nil if the token is not cached or the
+// entry has expired.
+func (c *introspectionCache) Get(token string) (*sessions.SessionState, error) {
+	value, ok := c.entries.Get(introspectionCacheKey(token))
+	if !ok {
+		return nil, nil
+	}
+	if err, ok := value.(error); ok {
+		return nil, err
+	}
+	return copySession(value.(*sessions.SessionState)), nil
+}
+
+// Set caches the session of the token
+func (c *introspectionCache) Set(token string, session *sessions.SessionState) {
+	if session.ExpiresOn == nil {
+		return
+	}
+	c.entries.Set(introspectionCacheKey(token), copySession(session), *session.ExpiresOn)
+}
+
+// Reject caches the error of a rejected token
+func (c *introspectionCache) Reject(token string, err error) {
+	c.entries.Set(introspectionCacheKey(token), err, c.entries.Clock.Now().Add(introspectionRejectionTTL))
+}
+
+func introspectionCacheKey(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// copySession returns a copy of a cached session, so that callers may modify
+// the session they are given
+func copySession(s *sessions.SessionState) *sessions.SessionState {
+	c := *s
+	c.Groups = append([]string(nil), s.Groups...)
+	c.Scopes = append([]string(nil), s.Scopes...)
+	if s.IntrospectionClaims != nil {
+		c.IntrospectionClaims = make(map[string]interface{}, len(s.IntrospectionClaims))
+		for k, v := range s.IntrospectionClaims {
+			c.IntrospectionClaims[k] = v
+		}
+	}
+	return &c
+}
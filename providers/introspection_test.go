@@ -0,0 +1,270 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/gomega"
+)
+
+const introspectedToken = "2YotnFZFEjr1zCsicMWpAA"
+
+// newIntrospectionServer returns the response for the introspected token and
+// an inactive response for any other token, and counts the requests
+func newIntrospectionServer(g *WithT, response string, form *url.Values, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		g.Expect(req.Method).To(Equal("POST"))
+		g.Expect(req.ParseForm()).To(Succeed())
+		*form = req.PostForm
+		*requests++
+
+		rw.Header().Set("Content-Type", "application/json")
+		if req.PostForm.Get("token") != introspectedToken {
+			_, _ = rw.Write([]byte(`{"active": false}`))
+			return
+		}
+		_, _ = rw.Write([]byte(response))
+	}))
+}
+
+func newIntrospectionProvider(g *WithT, server *httptest.Server) *ProviderData {
+	introspectionURL, err := url.Parse(server.URL)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return &ProviderData{
+		ClientID:         "client",
+		ClientSecret:     "secret",
+		EmailClaim:       OIDCEmailClaim,
+		GroupsClaim:      OIDCGroupsClaim,
+		IntrospectionURL: introspectionURL,
+	}
+}
+
+func TestProviderData_IntrospectToken(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	iat := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	testCases := map[string]struct {
+		token           string
+		response        string
+		expectedSession *sessions.SessionState
+		expectedError   string
+	}{
+		"active token": {
+			token: introspectedToken,
+			response: fmt.Sprintf(`{"active": true, "sub": "123", "username": "jdoe", "email": "jdoe@example.com",
+				"client_id": "client", "scope": "read write", "groups": ["admins", "users"], "exp": %d, "iat": %d}`, exp.Unix(), iat.Unix()),
+			expectedSession: &sessions.SessionState{
+				AccessToken:       introspectedToken,
+				User:              "123",
+				PreferredUsername: "jdoe",
+				Email:             "jdoe@example.com",
+				Groups:            []string{"admins", "users"},
+				Scopes:            []string{"read", "write"},
+				ExpiresOn:         &exp,
+				CreatedAt:         &iat,
+			},
+		},
+		"active token without sub or email": {
+			token:    introspectedToken,
+			response: `{"active": true, "username": "jdoe", "client_id": "client"}`,
+			expectedSession: &sessions.SessionState{
+				AccessToken:       introspectedToken,
+				User:              "jdoe",
+				PreferredUsername: "jdoe",
+			},
+		},
+		"active token without an identity": {
+			token:         introspectedToken,
+			response:      `{"active": true, "client_id": "client", "scope": "read"}`,
+			expectedError: "introspection response has no sub or username claim",
+		},
+		"active token for an accepted audience": {
+			token:    introspectedToken,
+			response: `{"active": true, "sub": "123", "client_id": "frontend", "aud": ["api://orders", "other"]}`,
+			expectedSession: &sessions.SessionState{
+				AccessToken: introspectedToken,
+				User:        "123",
+			},
+		},
+		"active token for another audience": {
+			token:         introspectedToken,
+			response:      `{"active": true, "sub": "123", "client_id": "client", "aud": "other"}`,
+			expectedError: "introspected token audience other is not accepted",
+		},
+		"active token issued to another client": {
+			token:         introspectedToken,
+			response:      `{"active": true, "sub": "123", "client_id": "frontend"}`,
+			expectedError: "introspected token was issued to client \"frontend\"",
+		},
+		"active token without an audience": {
+			token:         introspectedToken,
+			response:      `{"active": true, "sub": "123"}`,
+			expectedError: "introspection response has no aud or client_id claim",
+		},
+		"inactive token": {
+			token:         "revoked",
+			expectedError: ErrInactiveToken.Error(),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var form url.Values
+			requests := 0
+			server := newIntrospectionServer(g, tc.response, &form, &requests)
+			defer server.Close()
+
+			p := newIntrospectionProvider(g, server)
+			p.IntrospectionAudiences = []string{"api://orders"}
+			session, err := p.IntrospectToken(context.Background(), tc.token)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+
+				// All claims of the response are kept on the session
+				var claims map[string]interface{}
+				g.Expect(json.Unmarshal([]byte(tc.response), &claims)).To(Succeed())
+				g.Expect(session.IntrospectionClaims).To(Equal(claims))
+				session.IntrospectionClaims = nil
+			}
+			g.Expect(session).To(Equal(tc.expectedSession))
+
+			g.Expect(form.Get("token")).To(Equal(tc.token))
+			g.Expect(form.Get("token_type_hint")).To(Equal("access_token"))
+			g.Expect(form.Get("client_id")).To(Equal("client"))
+			g.Expect(form.Get("client_secret")).To(Equal("secret"))
+		})
+	}
+}
+
+func TestProviderData_IntrospectTokenWithoutEndpoint(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := (&ProviderData{}).IntrospectToken(context.Background(), introspectedToken)
+	g.Expect(err).To(Equal(ErrNotImplemented))
+}
+
+func TestProviderData_CreateIntrospectionTokenToSessionFunc(t *testing.T) {
+	testCases := map[string]struct {
+		exp              time.Time
+		expectedRequests int
+		expectedError    string
+	}{
+		"token with an expiry is cached": {
+			exp:              time.Now().Add(time.Hour),
+			expectedRequests: 1,
+		},
+		"token without an expiry is not cached": {
+			expectedRequests: 2,
+		},
+		"expired token is rejected and cached": {
+			exp:              time.Now().Add(-time.Minute),
+			expectedRequests: 1,
+			expectedError:    "bearer token has expired",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			response := `{"active": true, "sub": "123", "client_id": "client", "groups": ["admins"]}`
+			if !tc.exp.IsZero() {
+				response = fmt.Sprintf(`{"active": true, "sub": "123", "client_id": "client", "groups": ["admins"], "exp": %d}`, tc.exp.Unix())
+			}
+
+			var form url.Values
+			requests := 0
+			server := newIntrospectionServer(g, response, &form, &requests)
+			defer server.Close()
+
+			loader := newIntrospectionProvider(g, server).CreateIntrospectionTokenToSessionFunc()
+			for i := 0; i < 2; i++ {
+				session, err := loader(context.Background(), introspectedToken)
+				if tc.expectedError != "" {
+					g.Expect(err).To(MatchError(tc.expectedError))
+					continue
+				}
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(session.User).To(Equal("123"))
+				g.Expect(session.Groups).To(Equal([]string{"admins"}))
+
+				// Changes to the returned session must not change the cache
+				session.Groups[0] = "modified"
+				session.ProviderID = "provider"
+				session.IntrospectionClaims["sub"] = "modified"
+			}
+			g.Expect(requests).To(Equal(tc.expectedRequests))
+		})
+	}
+}
+
+func TestProviderData_CreateIntrospectionTokenToSessionFuncInactiveToken(t *testing.T) {
+	g := NewWithT(t)
+
+	var form url.Values
+	requests := 0
+	server := newIntrospectionServer(g, "", &form, &requests)
+	defer server.Close()
+
+	// Inactive tokens are rejected without calling the endpoint again
+	loader := newIntrospectionProvider(g, server).CreateIntrospectionTokenToSessionFunc()
+	for i := 0; i < 2; i++ {
+		_, err := loader(context.Background(), "revoked")
+		g.Expect(err).To(Equal(ErrInactiveToken))
+	}
+	g.Expect(requests).To(Equal(1))
+}
+
+func TestIntrospectionCache(t *testing.T) {
+	g := NewWithT(t)
+
+	cache := newIntrospectionCache()
+	now := time.Now()
+	cache.entries.Clock.Set(now)
+
+	expiresOn := now.Add(time.Minute)
+	cache.Set(introspectedToken, &sessions.SessionState{User: "123", ExpiresOn: &expiresOn})
+	g.Expect(cache.Get(introspectedToken)).To(Equal(&sessions.SessionState{User: "123", ExpiresOn: &expiresOn}))
+	g.Expect(cache.Get("other")).To(BeNil())
+	// Entries are keyed by a hash of the token
+	_, ok := cache.entries.Get(introspectedToken)
+	g.Expect(ok).To(BeFalse())
+
+	g.Expect(cache.entries.Clock.Add(time.Minute)).To(Succeed())
+	g.Expect(cache.Get(introspectedToken)).To(BeNil())
+	g.Expect(cache.entries.Len()).To(Equal(0))
+
+	// Tokens without an expiry are not cached
+	cache.Set(introspectedToken, &sessions.SessionState{User: "123"})
+	g.Expect(cache.Get(introspectedToken)).To(BeNil())
+
+	// The cache is bounded, the least recently used token is evicted to make room
+	later := now.Add(2 * time.Minute)
+	for i := 0; i < introspectionCacheMaxEntries; i++ {
+		cache.Set(fmt.Sprint(i), &sessions.SessionState{ExpiresOn: &later})
+	}
+	cache.Set("other", &sessions.SessionState{User: "456", ExpiresOn: &later})
+	g.Expect(cache.entries.Len()).To(Equal(introspectionCacheMaxEntries))
+	g.Expect(cache.Get("0")).To(BeNil())
+	g.Expect(cache.Get("other")).To(Equal(&sessions.SessionState{User: "456", ExpiresOn: &later}))
+
+	// Rejected tokens are cached for the rejection TTL
+	cache.Reject("revoked", ErrInactiveToken)
+	_, err := cache.Get("revoked")
+	g.Expect(err).To(Equal(ErrInactiveToken))
+
+	g.Expect(cache.entries.Clock.Add(introspectionRejectionTTL)).To(Succeed())
+	g.Expect(cache.Get("revoked")).To(BeNil())
+}
@@ -0,0 +1,55 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// backChannelLogoutEvent is the event a logout token must contain
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// LogoutToken holds the claims of an OpenID Connect Back-Channel Logout Token
+// that identify the sessions to log out.
+type LogoutToken struct {
+	Subject   string
+	SessionID string
+}
+
+// VerifyLogoutToken verifies a Back-Channel Logout Token with the OIDC
+// verifier of the provider and validates its claims.
+// See https://openid.net/specs/openid-connect-backchannel-1_0.html#Validation
+func (p *ProviderData) VerifyLogoutToken(ctx context.Context, rawToken string) (*LogoutToken, error) {
+	if p.Verifier == nil {
+		return nil, ErrMissingOIDCVerifier
+	}
+
+	token, err := p.Verifier.Verify(ctx, rawToken)
+	if err != nil {
+		return nil, fmt.Errorf("could not verify logout_token: %v", err)
+	}
+
+	var claims struct {
+		SessionID string                 `json:"sid"`
+		Events    map[string]interface{} `json:"events"`
+		Nonce     *string                `json:"nonce"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse logout_token claims: %v", err)
+	}
+
+	if _, ok := claims.Events[backChannelLogoutEvent].(map[string]interface{}); !ok {
+		return nil, errors.New("logout_token does not contain a back-channel logout event")
+	}
+	if claims.Nonce != nil {
+		return nil, errors.New("logout_token must not contain a nonce")
+	}
+	if token.Subject == "" && claims.SessionID == "" {
+		return nil, errors.New("logout_token must contain a sub or sid claim")
+	}
+
+	return &LogoutToken{
+		Subject:   token.Subject,
+		SessionID: claims.SessionID,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+type logoutTokenClaims struct {
+	Events    map[string]interface{} `json:"events,omitempty"`
+	SessionID string                 `json:"sid,omitempty"`
+	Nonce     string                 `json:"nonce,omitempty"`
+	jwt.StandardClaims
+}
+
+func newSignedTestLogoutToken(claims logoutTokenClaims) (string, error) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+}
+
+func TestProviderData_VerifyLogoutToken(t *testing.T) {
+	logoutEvent := map[string]interface{}{
+		backChannelLogoutEvent: map[string]interface{}{},
+	}
+
+	testCases := map[string]struct {
+		claims        logoutTokenClaims
+		expectedToken *LogoutToken
+		expectedError string
+	}{
+		"Valid token with sub and sid": {
+			claims: logoutTokenClaims{
+				Events:         logoutEvent,
+				SessionID:      "08a5019c-17e1-4977-8f42-65a12843ea02",
+				StandardClaims: standardClaims,
+			},
+			expectedToken: &LogoutToken{
+				Subject:   "123456789",
+				SessionID: "08a5019c-17e1-4977-8f42-65a12843ea02",
+			},
+		},
+		"Valid token with only sub": {
+			claims: logoutTokenClaims{
+				Events:         logoutEvent,
+				StandardClaims: standardClaims,
+			},
+			expectedToken: &LogoutToken{
+				Subject: "123456789",
+			},
+		},
+		"Missing logout event": {
+			claims: logoutTokenClaims{
+				Events: map[string]interface{}{
+					"http://schemas.openid.net/event/other": map[string]interface{}{},
+				},
+				StandardClaims: standardClaims,
+			},
+			expectedError: "logout_token does not contain a back-channel logout event",
+		},
+		"Token with a nonce": {
+			claims: logoutTokenClaims{
+				Events:         logoutEvent,
+				Nonce:          oidcNonce,
+				StandardClaims: standardClaims,
+			},
+			expectedError: "logout_token must not contain a nonce",
+		},
+		"Missing sub and sid": {
+			claims: logoutTokenClaims{
+				Events: logoutEvent,
+				StandardClaims: jwt.StandardClaims{
+					Audience:  standardClaims.Audience,
+					ExpiresAt: standardClaims.ExpiresAt,
+					IssuedAt:  standardClaims.IssuedAt,
+					Issuer:    standardClaims.Issuer,
+				},
+			},
+			expectedError: "logout_token must contain a sub or sid claim",
+		},
+		"Wrong audience": {
+			claims: logoutTokenClaims{
+				Events: logoutEvent,
+				StandardClaims: jwt.StandardClaims{
+					Audience:  "https://other.myapp.com",
+					ExpiresAt: standardClaims.ExpiresAt,
+					IssuedAt:  standardClaims.IssuedAt,
+					Issuer:    standardClaims.Issuer,
+					Subject:   standardClaims.Subject,
+				},
+			},
+			expectedError: "could not verify logout_token: oidc: expected audience \"https://test.myapp.com\" got [\"https://other.myapp.com\"]",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			provider := newOIDCProvider(&url.URL{})
+			rawToken, err := newSignedTestLogoutToken(tc.claims)
+			assert.NoError(t, err)
+
+			token, err := provider.VerifyLogoutToken(context.Background(), rawToken)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, token)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedToken, token)
+			}
+		})
+	}
+}
+
+func TestProviderData_VerifyLogoutTokenWithoutVerifier(t *testing.T) {
+	provider := &ProviderData{}
+	_, err := provider.VerifyLogoutToken(context.Background(), "token")
+	assert.Equal(t, ErrMissingOIDCVerifier, err)
+}
@@ -33,8 +33,7 @@ func NewOIDCProvider(p *ProviderData) *OIDCProvider {
 var _ Provider = (*OIDCProvider)(nil)
 
 // GetLoginURL makes the LoginURL with optional nonce support
-func (p *OIDCProvider) GetLoginURL(redirectURI, state, nonce string) string {
-	extraParams := url.Values{}
+func (p *OIDCProvider) GetLoginURL(redirectURI, state, nonce string, extraParams url.Values) string {
 	if !p.SkipNonce {
 		extraParams.Add("nonce", nonce)
 	}
@@ -43,21 +42,12 @@ func (p *OIDCProvider) GetLoginURL(redirectURI, state, nonce string) string {
 }
 
 // Redeem exchanges the OAuth2 authentication token for an ID token
-func (p *OIDCProvider) Redeem(ctx context.Context, redirectURL, code string) (*sessions.SessionState, error) {
-	clientSecret, err := p.GetClientSecret()
+func (p *OIDCProvider) Redeem(ctx context.Context, redirectURL, code, codeVerifier string) (*sessions.SessionState, error) {
+	c, err := p.oauth2Config(redirectURL)
 	if err != nil {
 		return nil, err
 	}
-
-	c := oauth2.Config{
-		ClientID:     p.ClientID,
-		ClientSecret: clientSecret,
-		Endpoint: oauth2.Endpoint{
-			TokenURL: p.RedeemURL.String(),
-		},
-		RedirectURL: redirectURL,
-	}
-	token, err := c.Exchange(ctx, code)
+	token, err := c.Exchange(p.tokenContext(ctx), code, codeVerifierOptions(codeVerifier)...)
 	if err != nil {
 		return nil, fmt.Errorf("token exchange failed: %v", err)
 	}
@@ -160,23 +150,15 @@ func (p *OIDCProvider) RefreshSession(ctx context.Context, s *sessions.SessionSt
 // redeemRefreshToken uses a RefreshToken with the RedeemURL to refresh the
 // Access Token and (probably) the ID Token.
 func (p *OIDCProvider) redeemRefreshToken(ctx context.Context, s *sessions.SessionState) error {
-	clientSecret, err := p.GetClientSecret()
+	c, err := p.oauth2Config("")
 	if err != nil {
 		return err
 	}
-
-	c := oauth2.Config{
-		ClientID:     p.ClientID,
-		ClientSecret: clientSecret,
-		Endpoint: oauth2.Endpoint{
-			TokenURL: p.RedeemURL.String(),
-		},
-	}
 	t := &oauth2.Token{
 		RefreshToken: s.RefreshToken,
 		Expiry:       time.Now().Add(-time.Hour),
 	}
-	token, err := c.TokenSource(ctx, t).Token()
+	token, err := c.TokenSource(p.tokenContext(ctx), t).Token()
 	if err != nil {
 		return fmt.Errorf("failed to get token: %v", err)
 	}
@@ -195,6 +177,16 @@ func (p *OIDCProvider) redeemRefreshToken(ctx context.Context, s *sessions.Sessi
 		s.User = newSession.User
 		s.Groups = newSession.Groups
 		s.PreferredUsername = newSession.PreferredUsername
+		s.Subject = newSession.Subject
+		// The sid claim is optional in refreshed ID Tokens, but doesn't change
+		if newSession.SessionID != "" {
+			s.SessionID = newSession.SessionID
+		}
+		// Refreshed ID Tokens keep the authentication of the user
+		if newSession.AuthTime != nil {
+			s.Acr = newSession.Acr
+			s.AuthTime = newSession.AuthTime
+		}
 	}
 
 	s.AccessToken = newSession.AccessToken
@@ -253,6 +245,26 @@ func (p *OIDCProvider) createSession(ctx context.Context, token *oauth2.Token, r
 		return nil, err
 	}
 
+	// Record the session at the provider so that it can be found on back-channel logout,
+	// and how the user authenticated for step-up authentication
+	if idToken != nil {
+		var claims struct {
+			SessionID string  `json:"sid"`
+			Acr       string  `json:"acr"`
+			AuthTime  float64 `json:"auth_time"`
+		}
+		if err := idToken.Claims(&claims); err != nil {
+			return nil, fmt.Errorf("couldn't extract sid, acr and auth_time claims from id_token (%v)", err)
+		}
+		ss.Subject = idToken.Subject
+		ss.SessionID = claims.SessionID
+		ss.Acr = claims.Acr
+		if claims.AuthTime > 0 {
+			authTime := time.Unix(int64(claims.AuthTime), 0)
+			ss.AuthTime = &authTime
+		}
+	}
+
 	ss.AccessToken = token.AccessToken
 	ss.RefreshToken = token.RefreshToken
 	ss.IDToken = getIDToken(token)
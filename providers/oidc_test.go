@@ -2,6 +2,8 @@ package providers
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,8 +12,10 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/stretchr/testify/assert"
@@ -88,11 +92,11 @@ func TestOIDCProviderGetLoginURL(t *testing.T) {
 	nonce := base64.RawURLEncoding.EncodeToString(n)
 
 	// SkipNonce defaults to true
-	skipNonce := provider.GetLoginURL("http://redirect/", "", nonce)
+	skipNonce := provider.GetLoginURL("http://redirect/", "", nonce, url.Values{})
 	assert.NotContains(t, skipNonce, "nonce")
 
 	provider.SkipNonce = false
-	withNonce := provider.GetLoginURL("http://redirect/", "", nonce)
+	withNonce := provider.GetLoginURL("http://redirect/", "", nonce, url.Values{})
 	assert.Contains(t, withNonce, fmt.Sprintf("nonce=%s", nonce))
 }
 
@@ -109,13 +113,69 @@ func TestOIDCProviderRedeem(t *testing.T) {
 	server, provider := newTestOIDCSetup(body)
 	defer server.Close()
 
-	session, err := provider.Redeem(context.Background(), provider.RedeemURL.String(), "code1234")
+	session, err := provider.Redeem(context.Background(), provider.RedeemURL.String(), "code1234", "")
 	assert.Equal(t, nil, err)
 	assert.Equal(t, defaultIDToken.Email, session.Email)
 	assert.Equal(t, accessToken, session.AccessToken)
 	assert.Equal(t, idToken, session.IDToken)
 	assert.Equal(t, refreshToken, session.RefreshToken)
 	assert.Equal(t, "123456789", session.User)
+	assert.Equal(t, "123456789", session.Subject)
+	assert.Equal(t, "", session.SessionID)
+}
+
+func TestOIDCProviderRedeem_session_id(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idToken, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, struct {
+		SessionID string `json:"sid"`
+		idTokenClaims
+	}{
+		SessionID:     "08a5019c-17e1-4977-8f42-65a12843ea02",
+		idTokenClaims: defaultIDToken,
+	}).SignedString(key)
+	body, _ := json.Marshal(redeemTokenResponse{
+		AccessToken:  accessToken,
+		ExpiresIn:    10,
+		TokenType:    "Bearer",
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+	})
+
+	server, provider := newTestOIDCSetup(body)
+	defer server.Close()
+
+	session, err := provider.Redeem(context.Background(), provider.RedeemURL.String(), "code1234", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "123456789", session.Subject)
+	assert.Equal(t, "08a5019c-17e1-4977-8f42-65a12843ea02", session.SessionID)
+}
+
+func TestOIDCProviderRedeem_acr_and_auth_time(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idToken, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, struct {
+		Acr      string `json:"acr"`
+		AuthTime int64  `json:"auth_time"`
+		idTokenClaims
+	}{
+		Acr:           "urn:mace:incommon:iap:silver",
+		AuthTime:      1610000000,
+		idTokenClaims: defaultIDToken,
+	}).SignedString(key)
+	body, _ := json.Marshal(redeemTokenResponse{
+		AccessToken:  accessToken,
+		ExpiresIn:    10,
+		TokenType:    "Bearer",
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+	})
+
+	server, provider := newTestOIDCSetup(body)
+	defer server.Close()
+
+	session, err := provider.Redeem(context.Background(), provider.RedeemURL.String(), "code1234", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "urn:mace:incommon:iap:silver", session.Acr)
+	assert.Equal(t, time.Unix(1610000000, 0), *session.AuthTime)
 }
 
 func TestOIDCProviderRedeem_custom_userid(t *testing.T) {
@@ -132,7 +192,7 @@ func TestOIDCProviderRedeem_custom_userid(t *testing.T) {
 	provider.EmailClaim = "phone_number"
 	defer server.Close()
 
-	session, err := provider.Redeem(context.Background(), provider.RedeemURL.String(), "code1234")
+	session, err := provider.Redeem(context.Background(), provider.RedeemURL.String(), "code1234", "")
 	assert.Equal(t, nil, err)
 	assert.Equal(t, defaultIDToken.Phone, session.Email)
 }
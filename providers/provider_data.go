@@ -2,12 +2,16 @@ package providers
 
 import (
 	"context"
+	"crypto"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"reflect"
 	"strings"
+	"text/template"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
@@ -23,12 +27,19 @@ const (
 // ProviderData contains information required to configure all implementations
 // of OAuth2 providers
 type ProviderData struct {
+	ID                string
 	ProviderName      string
 	LoginURL          *url.URL
 	RedeemURL         *url.URL
 	ProfileURL        *url.URL
 	ProtectedResource *url.URL
 	ValidateURL       *url.URL
+	EndSessionURL     *url.URL
+	IntrospectionURL  *url.URL
+	LogoutURLTemplate *template.Template
+	// IntrospectionAudiences are accepted in the `aud` claim of introspected
+	// bearer tokens, in addition to the client ID
+	IntrospectionAudiences []string
 	// Auth request params & related, see
 	//https://openid.net/specs/openid-connect-basic-1_0.html#rfc.section.2.1.1.1
 	AcrValues        string
@@ -39,6 +50,19 @@ type ProviderData struct {
 	Scope            string
 	Prompt           string
 
+	// PKCE code challenge method, PKCE is disabled when it is empty
+	CodeChallengeMethod string
+
+	// Client authentication to the token endpoint, the client secret is used
+	// when ClientAuthMethod is empty. TokenClient is built once from them by
+	// NewTokenClient and sends the requests to the token endpoint.
+	ClientAuthMethod                string
+	ClientAssertionKey              crypto.Signer
+	ClientAssertionKeyID            string
+	ClientAssertionSigningAlgorithm string
+	ClientCertificate               *tls.Certificate
+	TokenClient                     *http.Client
+
 	// Common OIDC options for any OIDC-based providers to consume
 	AllowUnverifiedEmail bool
 	EmailClaim           string
@@ -67,6 +91,55 @@ func (p *ProviderData) GetClientSecret() (clientSecret string, err error) {
 	return string(fileClientSecret), nil
 }
 
+// LogoutURLData holds the values available to a logout URL template.
+// All values are query escaped.
+type LogoutURLData struct {
+	ClientID              string
+	IDToken               string
+	PostLogoutRedirectURI string
+}
+
+// GetLogoutURL returns the URL to redirect the user to in order to end their
+// session at the provider. A configured logout URL template takes precedence
+// over the OIDC end session endpoint. An empty URL is returned when the
+// provider supports neither.
+// See https://openid.net/specs/openid-connect-rpinitiated-1_0.html
+func (p *ProviderData) GetLogoutURL(s *sessions.SessionState, postLogoutRedirectURI string) (string, error) {
+	var idToken string
+	if s != nil {
+		idToken = s.IDToken
+	}
+
+	if p.LogoutURLTemplate != nil {
+		var logoutURL strings.Builder
+		err := p.LogoutURLTemplate.Execute(&logoutURL, LogoutURLData{
+			ClientID:              url.QueryEscape(p.ClientID),
+			IDToken:               url.QueryEscape(idToken),
+			PostLogoutRedirectURI: url.QueryEscape(postLogoutRedirectURI),
+		})
+		if err != nil {
+			return "", fmt.Errorf("could not render logout URL: %v", err)
+		}
+		return logoutURL.String(), nil
+	}
+
+	if p.EndSessionURL == nil || p.EndSessionURL.String() == "" {
+		return "", nil
+	}
+
+	logoutURL := *p.EndSessionURL
+	params, _ := url.ParseQuery(logoutURL.RawQuery)
+	if idToken != "" {
+		params.Set("id_token_hint", idToken)
+	}
+	if postLogoutRedirectURI != "" {
+		params.Set("post_logout_redirect_uri", postLogoutRedirectURI)
+		params.Set("client_id", p.ClientID)
+	}
+	logoutURL.RawQuery = params.Encode()
+	return logoutURL.String(), nil
+}
+
 // SetAllowedGroups organizes a group list into the AllowedGroups map
 // to be consumed by Authorize implementations
 func (p *ProviderData) SetAllowedGroups(groups []string) {
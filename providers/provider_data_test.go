@@ -8,8 +8,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"testing"
+	"text/template"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -496,3 +498,65 @@ func TestProviderData_extractGroups(t *testing.T) {
 		})
 	}
 }
+
+func TestProviderData_GetLogoutURL(t *testing.T) {
+	testCases := map[string]struct {
+		endSessionURL         string
+		logoutURLTemplate     string
+		session               *sessions.SessionState
+		postLogoutRedirectURI string
+		expectedURL           string
+	}{
+		"No logout support": {
+			session:               &sessions.SessionState{IDToken: idToken},
+			postLogoutRedirectURI: "https://app.example.com/",
+			expectedURL:           "",
+		},
+		"End session endpoint": {
+			endSessionURL:         "https://issuer.example.com/logout",
+			session:               &sessions.SessionState{IDToken: idToken},
+			postLogoutRedirectURI: "https://app.example.com/",
+			expectedURL:           "https://issuer.example.com/logout?client_id=https%3A%2F%2Ftest.myapp.com&id_token_hint=" + idToken + "&post_logout_redirect_uri=https%3A%2F%2Fapp.example.com%2F",
+		},
+		"End session endpoint with existing query": {
+			endSessionURL:         "https://issuer.example.com/logout?tenant=example",
+			session:               &sessions.SessionState{IDToken: idToken},
+			postLogoutRedirectURI: "",
+			expectedURL:           "https://issuer.example.com/logout?id_token_hint=" + idToken + "&tenant=example",
+		},
+		"End session endpoint without ID token": {
+			endSessionURL:         "https://issuer.example.com/logout",
+			session:               &sessions.SessionState{},
+			postLogoutRedirectURI: "https://app.example.com/",
+			expectedURL:           "https://issuer.example.com/logout?client_id=https%3A%2F%2Ftest.myapp.com&post_logout_redirect_uri=https%3A%2F%2Fapp.example.com%2F",
+		},
+		"Logout URL template takes precedence": {
+			endSessionURL:         "https://issuer.example.com/logout",
+			logoutURLTemplate:     "https://provider.example.com/logout?client={{.ClientID}}&returnTo={{.PostLogoutRedirectURI}}",
+			session:               &sessions.SessionState{IDToken: idToken},
+			postLogoutRedirectURI: "https://app.example.com/?a=b",
+			expectedURL:           "https://provider.example.com/logout?client=https%3A%2F%2Ftest.myapp.com&returnTo=https%3A%2F%2Fapp.example.com%2F%3Fa%3Db",
+		},
+	}
+	for testName, tc := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			g := NewWithT(t)
+
+			provider := &ProviderData{
+				ClientID: oidcClientID,
+			}
+			if tc.endSessionURL != "" {
+				endSessionURL, err := url.Parse(tc.endSessionURL)
+				g.Expect(err).ToNot(HaveOccurred())
+				provider.EndSessionURL = endSessionURL
+			}
+			if tc.logoutURLTemplate != "" {
+				provider.LogoutURLTemplate = template.Must(template.New("logout-url").Parse(tc.logoutURLTemplate))
+			}
+
+			logoutURL, err := provider.GetLogoutURL(tc.session, tc.postLogoutRedirectURI)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(logoutURL).To(Equal(tc.expectedURL))
+		})
+	}
+}
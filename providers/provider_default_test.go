@@ -2,6 +2,8 @@ package providers
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
@@ -39,7 +41,7 @@ func TestAcrValuesNotConfigured(t *testing.T) {
 		},
 	}
 
-	result := p.GetLoginURL("https://my.test.app/oauth", "", "")
+	result := p.GetLoginURL("https://my.test.app/oauth", "", "", url.Values{})
 	assert.NotContains(t, result, "acr_values")
 }
 
@@ -53,10 +55,107 @@ func TestAcrValuesConfigured(t *testing.T) {
 		AcrValues: "testValue",
 	}
 
-	result := p.GetLoginURL("https://my.test.app/oauth", "", "")
+	result := p.GetLoginURL("https://my.test.app/oauth", "", "", url.Values{})
 	assert.Contains(t, result, "acr_values=testValue")
 }
 
+func TestStepUpLoginURL(t *testing.T) {
+	p := &ProviderData{
+		LoginURL: &url.URL{
+			Scheme: "http",
+			Host:   "my.test.idp",
+			Path:   "/oauth/authorize",
+		},
+		AcrValues:      "low",
+		ApprovalPrompt: "force",
+	}
+
+	extraParams := url.Values{}
+	extraParams.Set("acr_values", "high")
+	extraParams.Set("max_age", "300")
+	extraParams.Set("prompt", "login")
+
+	result, err := url.Parse(p.GetLoginURL("https://my.test.app/oauth", "", "", extraParams))
+	assert.NoError(t, err)
+	query := result.Query()
+	assert.Equal(t, []string{"high"}, query["acr_values"])
+	assert.Equal(t, []string{"300"}, query["max_age"])
+	assert.Equal(t, []string{"login"}, query["prompt"])
+	assert.NotContains(t, query, "approval_prompt")
+}
+
+func TestCodeChallengeLoginURL(t *testing.T) {
+	p := &ProviderData{
+		LoginURL: &url.URL{
+			Scheme: "http",
+			Host:   "my.test.idp",
+			Path:   "/oauth/authorize",
+		},
+	}
+
+	extraParams := url.Values{}
+	extraParams.Add("code_challenge", "challenge")
+	extraParams.Add("code_challenge_method", "S256")
+
+	result := p.GetLoginURL("https://my.test.app/oauth", "", "", extraParams)
+	assert.Contains(t, result, "code_challenge=challenge")
+	assert.Contains(t, result, "code_challenge_method=S256")
+}
+
+func TestRedeemCodeVerifier(t *testing.T) {
+	testCases := map[string]struct {
+		clientSecret         string
+		codeVerifier         string
+		expectedClientSecret []string
+		expectedCodeVerifier []string
+	}{
+		"confidential client without PKCE": {
+			clientSecret:         "secret",
+			expectedClientSecret: []string{"secret"},
+		},
+		"confidential client with PKCE": {
+			clientSecret:         "secret",
+			codeVerifier:         "verifier",
+			expectedClientSecret: []string{"secret"},
+			expectedCodeVerifier: []string{"verifier"},
+		},
+		"public client with PKCE": {
+			codeVerifier:         "verifier",
+			expectedCodeVerifier: []string{"verifier"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var form url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				g.Expect(req.ParseForm()).To(Succeed())
+				form = req.PostForm
+				rw.Header().Set("Content-Type", "application/json")
+				_, _ = rw.Write([]byte(`{"access_token": "access"}`))
+			}))
+			defer server.Close()
+
+			redeemURL, err := url.Parse(server.URL)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			p := &ProviderData{
+				ClientID:     "client",
+				ClientSecret: tc.clientSecret,
+				RedeemURL:    redeemURL,
+			}
+
+			session, err := p.Redeem(context.Background(), "https://my.test.app/oauth", "code", tc.codeVerifier)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(session.AccessToken).To(Equal("access"))
+			g.Expect(form["client_secret"]).To(Equal(tc.expectedClientSecret))
+			g.Expect(form["code_verifier"]).To(Equal(tc.expectedCodeVerifier))
+		})
+	}
+}
+
 func TestProviderDataEnrichSession(t *testing.T) {
 	g := NewWithT(t)
 	p := &ProviderData{}
@@ -0,0 +1,365 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// SAMLProvider represents a SAML 2.0 identity provider. The proxy acts as a
+// SAML service provider for it instead of an OAuth2 client.
+type SAMLProvider struct {
+	*ProviderData
+
+	// EntityID is the entity ID of the proxy as a service provider.
+	// Assertions must have it as their audience.
+	EntityID string
+
+	// Binding is the binding of the authentication requests,
+	// either SAMLRedirectBinding or SAMLPostBinding
+	Binding string
+
+	// EmailAttribute, UserAttribute and GroupsAttribute are the names or
+	// friendly names of the assertion attributes mapped into the session.
+	// The NameID is the user when UserAttribute is not set.
+	EmailAttribute  string
+	UserAttribute   string
+	GroupsAttribute string
+
+	idpMetadata *saml.EntityDescriptor
+	certificate *x509.Certificate
+	key         *rsa.PrivateKey
+}
+
+var _ Provider = (*SAMLProvider)(nil)
+
+const (
+	samlProviderName = "SAML"
+
+	// SAMLRedirectBinding sends authentication requests with the HTTP-Redirect binding
+	SAMLRedirectBinding = "redirect"
+
+	// SAMLPostBinding sends authentication requests with the HTTP-POST binding
+	SAMLPostBinding = "post"
+
+	// SAMLDefaultEmailAttribute is the default attribute holding the email
+	SAMLDefaultEmailAttribute = "email"
+
+	// SAMLDefaultGroupsAttribute is the default attribute holding the groups
+	SAMLDefaultGroupsAttribute = "groups"
+)
+
+var (
+	// ErrSAMLKeyRequired is returned when an identity provider sends an
+	// encrypted assertion but the service provider has no key to decrypt it
+	ErrSAMLKeyRequired = errors.New("encrypted SAML assertions require a service provider private key")
+
+	// ErrSAMLEntityIDRequired is returned when the entity ID of the service
+	// provider is not configured
+	ErrSAMLEntityIDRequired = errors.New("SAML service provider entity ID is not configured")
+)
+
+// NewSAMLProvider initiates a new SAMLProvider
+func NewSAMLProvider(p *ProviderData) *SAMLProvider {
+	p.ProviderName = samlProviderName
+	return &SAMLProvider{
+		ProviderData:    p,
+		Binding:         SAMLRedirectBinding,
+		EmailAttribute:  SAMLDefaultEmailAttribute,
+		GroupsAttribute: SAMLDefaultGroupsAttribute,
+	}
+}
+
+// SetIDPMetadata parses the metadata of the identity provider that the
+// assertions are validated against
+func (p *SAMLProvider) SetIDPMetadata(data []byte) error {
+	metadata, err := samlsp.ParseMetadata(data)
+	if err != nil {
+		return fmt.Errorf("could not parse SAML identity provider metadata: %v", err)
+	}
+	if len(metadata.IDPSSODescriptors) == 0 {
+		return errors.New("SAML metadata does not describe an identity provider")
+	}
+
+	// The browser is sent to the single sign on service of the metadata
+	for _, descriptor := range metadata.IDPSSODescriptors {
+		for _, service := range descriptor.SingleSignOnServices {
+			location, err := url.Parse(service.Location)
+			if err != nil || (location.Scheme != "https" && location.Scheme != "http") {
+				return fmt.Errorf("invalid SAML single sign on service location %q", service.Location)
+			}
+		}
+	}
+
+	p.idpMetadata = metadata
+	return nil
+}
+
+// SetKeyPair sets the PEM encoded certificate and RSA private key of the
+// service provider. They sign the authentication requests and decrypt
+// encrypted assertions.
+func (p *SAMLProvider) SetKeyPair(certPEM, keyPEM []byte) error {
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("could not parse SAML service provider key pair: %v", err)
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("SAML service provider key must be an RSA private key")
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("could not parse SAML service provider certificate: %v", err)
+	}
+
+	p.certificate = cert
+	p.key = key
+	return nil
+}
+
+// Metadata returns the metadata of the proxy as a service provider with
+// the given metadata and assertion consumer service URLs
+func (p *SAMLProvider) Metadata(metadataURL, acsURL string) ([]byte, error) {
+	sp, err := p.serviceProvider(metadataURL, acsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := sp.Metadata()
+	// Assertions are only consumed with the HTTP-POST binding
+	for i := range metadata.SPSSODescriptors {
+		descriptor := &metadata.SPSSODescriptors[i]
+		services := descriptor.AssertionConsumerServices[:0]
+		for _, service := range descriptor.AssertionConsumerServices {
+			if service.Binding == saml.HTTPPostBinding {
+				services = append(services, service)
+			}
+		}
+		descriptor.AssertionConsumerServices = services
+	}
+
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not encode SAML metadata: %v", err)
+	}
+	return data, nil
+}
+
+// LoginURL returns the URL sending an authentication request to the
+// identity provider with the HTTP-Redirect binding.
+// The request ID is mirrored in the response and the relay state is sent
+// back to the assertion consumer service with it.
+// A `prompt=login` extra param forces the user to authenticate again, and
+// the first of the `acr_values` is requested as authentication context.
+func (p *SAMLProvider) LoginURL(metadataURL, acsURL, requestID, relayState string, extraParams url.Values) (string, error) {
+	sp, req, err := p.authnRequest(metadataURL, acsURL, saml.HTTPRedirectBinding, requestID, extraParams)
+	if err != nil {
+		return "", err
+	}
+	loginURL, err := req.Redirect(url.QueryEscape(relayState), sp)
+	if err != nil {
+		return "", fmt.Errorf("could not sign SAML authentication request: %v", err)
+	}
+	return loginURL.String(), nil
+}
+
+// LoginForm returns an HTML form posting an authentication request to the
+// identity provider with the HTTP-POST binding. It takes the same arguments
+// as LoginURL.
+func (p *SAMLProvider) LoginForm(metadataURL, acsURL, requestID, relayState string, extraParams url.Values) ([]byte, error) {
+	sp, req, err := p.authnRequest(metadataURL, acsURL, saml.HTTPPostBinding, requestID, extraParams)
+	if err != nil {
+		return nil, err
+	}
+	if sp.SignatureMethod != "" {
+		if err := sp.SignAuthnRequest(req); err != nil {
+			return nil, fmt.Errorf("could not sign SAML authentication request: %v", err)
+		}
+	}
+	return req.Post(relayState), nil
+}
+
+// authnRequest creates the authentication request with the given ID for
+// the single sign on service of the binding
+func (p *SAMLProvider) authnRequest(metadataURL, acsURL, binding, requestID string, extraParams url.Values) (*saml.ServiceProvider, *saml.AuthnRequest, error) {
+	sp, err := p.serviceProvider(metadataURL, acsURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	location := sp.GetSSOBindingLocation(binding)
+	if location == "" {
+		return nil, nil, fmt.Errorf("SAML identity provider has no single sign on service for binding %s", binding)
+	}
+
+	if extraParams.Get("prompt") == "login" {
+		forceAuthn := true
+		sp.ForceAuthn = &forceAuthn
+	}
+	if acrValues := strings.Fields(extraParams.Get("acr_values")); len(acrValues) > 0 {
+		sp.RequestedAuthnContext = &saml.RequestedAuthnContext{
+			Comparison:           "exact",
+			AuthnContextClassRef: acrValues[0],
+		}
+	}
+
+	// Signatures of requests with the HTTP-POST binding are added once the ID is set
+	req, err := sp.MakeAuthenticationRequest(location, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create SAML authentication request: %v", err)
+	}
+	req.ID = requestID
+	return sp, req, nil
+}
+
+// ParseResponse validates the SAML response posted to the assertion consumer
+// service in reply to the authentication request with the given ID, and
+// creates a session from its assertion.
+// The response or its assertion must be signed by the identity provider.
+func (p *SAMLProvider) ParseResponse(req *http.Request, metadataURL, acsURL, requestID string) (*sessions.SessionState, error) {
+	sp, err := p.serviceProvider(metadataURL, acsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := base64.StdEncoding.DecodeString(req.PostForm.Get("SAMLResponse"))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode SAML response: %v", err)
+	}
+	if p.key == nil && bytes.Contains(response, []byte("EncryptedAssertion")) {
+		return nil, ErrSAMLKeyRequired
+	}
+
+	assertion, err := sp.ParseXMLResponse(response, []string{requestID})
+	if err != nil {
+		var invalidErr *saml.InvalidResponseError
+		if errors.As(err, &invalidErr) {
+			err = invalidErr.PrivateErr
+		}
+		return nil, fmt.Errorf("invalid SAML response: %v", err)
+	}
+
+	return p.sessionFromAssertion(assertion), nil
+}
+
+// sessionFromAssertion maps the subject, authentication statement and
+// attributes of the assertion into a session
+func (p *SAMLProvider) sessionFromAssertion(assertion *saml.Assertion) *sessions.SessionState {
+	s := &sessions.SessionState{}
+	s.CreatedAtNow()
+
+	var nameID string
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		nameID = assertion.Subject.NameID.Value
+		s.Subject = nameID
+		if assertion.Subject.NameID.Format == string(saml.EmailAddressNameIDFormat) {
+			s.Email = nameID
+		}
+	}
+
+	for _, statement := range assertion.AuthnStatements {
+		authTime := statement.AuthnInstant
+		s.AuthTime = &authTime
+		s.SessionID = statement.SessionIndex
+		if statement.AuthnContext.AuthnContextClassRef != nil {
+			s.Acr = statement.AuthnContext.AuthnContextClassRef.Value
+		}
+		if statement.SessionNotOnOrAfter != nil {
+			expiresOn := *statement.SessionNotOnOrAfter
+			s.ExpiresOn = &expiresOn
+		}
+	}
+
+	attributes := make(map[string][]string)
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			for _, value := range attribute.Values {
+				attributes[attribute.Name] = append(attributes[attribute.Name], value.Value)
+				if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+					attributes[attribute.FriendlyName] = append(attributes[attribute.FriendlyName], value.Value)
+				}
+			}
+		}
+	}
+
+	if values := attributes[p.EmailAttribute]; len(values) > 0 {
+		s.Email = values[0]
+	}
+	s.User = nameID
+	if p.UserAttribute != "" {
+		s.User = ""
+		if values := attributes[p.UserAttribute]; len(values) > 0 {
+			s.User = values[0]
+		}
+	}
+	s.Groups = attributes[p.GroupsAttribute]
+
+	return s
+}
+
+// serviceProvider returns the service provider with the given metadata and
+// assertion consumer service URLs.
+// The entity ID must be configured, the metadata URL would otherwise be used
+// as the audience of the assertions.
+func (p *SAMLProvider) serviceProvider(metadataURL, acsURL string) (*saml.ServiceProvider, error) {
+	if p.idpMetadata == nil {
+		return nil, errors.New("SAML identity provider metadata is not configured")
+	}
+	if p.EntityID == "" {
+		return nil, ErrSAMLEntityIDRequired
+	}
+	parsedMetadataURL, err := url.Parse(metadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML metadata URL: %v", err)
+	}
+	parsedACSURL, err := url.Parse(acsURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML assertion consumer service URL: %v", err)
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:          p.EntityID,
+		MetadataURL:       *parsedMetadataURL,
+		AcsURL:            *parsedACSURL,
+		IDPMetadata:       p.idpMetadata,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+	if p.key != nil {
+		sp.Key = p.key
+		sp.Certificate = p.certificate
+		sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	}
+	return sp, nil
+}
+
+// Redeem is not supported by SAML providers, their users sign in with the
+// assertion consumer service instead of the OAuth2 callback
+func (p *SAMLProvider) Redeem(_ context.Context, _, _, _ string) (*sessions.SessionState, error) {
+	return nil, ErrNotImplemented
+}
+
+// ValidateSession checks the session of the identity provider has not ended.
+// There is no token to validate with the identity provider.
+func (p *SAMLProvider) ValidateSession(_ context.Context, s *sessions.SessionState) bool {
+	return !s.IsExpired()
+}
+
+// RefreshSession does nothing, SAML sessions can't be refreshed
+func (p *SAMLProvider) RefreshSession(_ context.Context, _ *sessions.SessionState) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,419 @@
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"html"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	samlTestEntityID    = "https://proxy.example.com/saml"
+	samlTestMetadataURL = "https://proxy.example.com/oauth2/saml/metadata"
+	samlTestACSURL      = "https://proxy.example.com/oauth2/saml/acs"
+	samlTestRequestID   = "id-request"
+)
+
+// samlTestIDP is a local SAML identity provider with a generated certificate
+type samlTestIDP struct {
+	idp         *saml.IdentityProvider
+	spMetadata  *saml.EntityDescriptor
+	session     *saml.Session
+	certificate []byte
+	key         []byte
+}
+
+func newSAMLTestKeyPair(t *testing.T, commonName string) (*rsa.PrivateKey, *x509.Certificate, []byte, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return key, cert, certPEM, keyPEM
+}
+
+func newSAMLTestIDP(t *testing.T) *samlTestIDP {
+	key, cert, certPEM, keyPEM := newSAMLTestKeyPair(t, "idp.example.com")
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+
+	testIDP := &samlTestIDP{
+		certificate: certPEM,
+		key:         keyPEM,
+		session: &saml.Session{
+			CreateTime: time.Now().Add(-time.Minute).UTC().Truncate(time.Second),
+			Index:      "session-index",
+			NameID:     "jdoe",
+			CustomAttributes: []saml.Attribute{
+				{Name: "email", Values: []saml.AttributeValue{{Value: "jdoe@example.com"}}},
+				{Name: "groups", Values: []saml.AttributeValue{{Value: "admins"}, {Value: "users"}}},
+				{Name: "urn:oid:0.9.2342.19200300.100.1.1", FriendlyName: "uid", Values: []saml.AttributeValue{{Value: "john"}}},
+			},
+		},
+	}
+	testIDP.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: testIDP,
+	}
+	return testIDP
+}
+
+func (i *samlTestIDP) GetServiceProvider(_ *http.Request, _ string) (*saml.EntityDescriptor, error) {
+	return i.spMetadata, nil
+}
+
+func (i *samlTestIDP) metadata(t *testing.T) []byte {
+	data, err := xml.Marshal(i.idp.Metadata())
+	require.NoError(t, err)
+	return data
+}
+
+// respond answers the authentication request of the login URL and returns
+// the form the browser posts to the assertion consumer service
+func (i *samlTestIDP) respond(t *testing.T, p *SAMLProvider, loginURL string) url.Values {
+	metadata, err := p.Metadata(samlTestMetadataURL, samlTestACSURL)
+	require.NoError(t, err)
+	i.spMetadata = &saml.EntityDescriptor{}
+	require.NoError(t, xml.Unmarshal(metadata, i.spMetadata))
+
+	req, err := saml.NewIdpAuthnRequest(i.idp, httptest.NewRequest(http.MethodGet, loginURL, nil))
+	require.NoError(t, err)
+	require.NoError(t, req.Validate())
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(req, i.session))
+	form, err := req.PostBinding()
+	require.NoError(t, err)
+	assert.Equal(t, samlTestACSURL, form.URL)
+
+	return url.Values{
+		"SAMLResponse": []string{form.SAMLResponse},
+		"RelayState":   []string{form.RelayState},
+	}
+}
+
+func newSAMLTestProvider(t *testing.T, testIDP *samlTestIDP) *SAMLProvider {
+	p := NewSAMLProvider(&ProviderData{ID: "saml"})
+	p.EntityID = samlTestEntityID
+	require.NoError(t, p.SetIDPMetadata(testIDP.metadata(t)))
+	return p
+}
+
+func newSAMLCallbackRequest(form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, samlTestACSURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_ = req.ParseForm()
+	return req
+}
+
+func TestSAMLProviderDefaults(t *testing.T) {
+	p := NewSAMLProvider(&ProviderData{})
+	assert.Equal(t, "SAML", p.Data().ProviderName)
+	assert.Equal(t, SAMLRedirectBinding, p.Binding)
+	assert.Equal(t, "email", p.EmailAttribute)
+	assert.Equal(t, "", p.UserAttribute)
+	assert.Equal(t, "groups", p.GroupsAttribute)
+}
+
+func TestSAMLProviderSetIDPMetadata(t *testing.T) {
+	testIDP := newSAMLTestIDP(t)
+	p := NewSAMLProvider(&ProviderData{})
+
+	assert.NoError(t, p.SetIDPMetadata(testIDP.metadata(t)))
+	assert.EqualError(t, p.SetIDPMetadata([]byte(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="sp"></EntityDescriptor>`)),
+		"SAML metadata does not describe an identity provider")
+	assert.Error(t, p.SetIDPMetadata([]byte("not xml")))
+
+	testIDP.idp.SSOURL = url.URL{Scheme: "javascript", Opaque: "alert(1)"}
+	assert.EqualError(t, p.SetIDPMetadata(testIDP.metadata(t)), `invalid SAML single sign on service location "javascript:alert(1)"`)
+}
+
+func TestSAMLProviderSetKeyPair(t *testing.T) {
+	_, _, certPEM, keyPEM := newSAMLTestKeyPair(t, "proxy.example.com")
+	_, _, _, otherKeyPEM := newSAMLTestKeyPair(t, "other.example.com")
+	p := NewSAMLProvider(&ProviderData{})
+
+	assert.NoError(t, p.SetKeyPair(certPEM, keyPEM))
+	assert.Error(t, p.SetKeyPair(certPEM, otherKeyPEM))
+}
+
+func TestSAMLProviderMetadata(t *testing.T) {
+	testIDP := newSAMLTestIDP(t)
+	p := newSAMLTestProvider(t, testIDP)
+
+	metadata, err := p.Metadata(samlTestMetadataURL, samlTestACSURL)
+	require.NoError(t, err)
+	descriptor := &saml.EntityDescriptor{}
+	require.NoError(t, xml.Unmarshal(metadata, descriptor))
+
+	assert.Equal(t, samlTestEntityID, descriptor.EntityID)
+	require.Len(t, descriptor.SPSSODescriptors, 1)
+	assert.Equal(t, []saml.IndexedEndpoint{{Binding: saml.HTTPPostBinding, Location: samlTestACSURL, Index: 1}},
+		descriptor.SPSSODescriptors[0].AssertionConsumerServices)
+	assert.Empty(t, descriptor.SPSSODescriptors[0].KeyDescriptors)
+	assert.False(t, *descriptor.SPSSODescriptors[0].AuthnRequestsSigned)
+
+	// The key pair of the service provider is published for signatures and encryption
+	require.NoError(t, p.SetKeyPair(testIDP.certificate, testIDP.key))
+	metadata, err = p.Metadata(samlTestMetadataURL, samlTestACSURL)
+	require.NoError(t, err)
+	descriptor = &saml.EntityDescriptor{}
+	require.NoError(t, xml.Unmarshal(metadata, descriptor))
+
+	assert.Len(t, descriptor.SPSSODescriptors[0].KeyDescriptors, 2)
+	assert.True(t, *descriptor.SPSSODescriptors[0].AuthnRequestsSigned)
+
+	// The metadata URL is not used as entity ID
+	p.EntityID = ""
+	_, err = p.Metadata(samlTestMetadataURL, samlTestACSURL)
+	assert.Equal(t, ErrSAMLEntityIDRequired, err)
+}
+
+func TestSAMLProviderLoginURL(t *testing.T) {
+	testIDP := newSAMLTestIDP(t)
+	p := newSAMLTestProvider(t, testIDP)
+
+	loginURL, err := p.LoginURL(samlTestMetadataURL, samlTestACSURL, samlTestRequestID, "state", url.Values{})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(loginURL, "https://idp.example.com/sso?SAMLRequest="))
+
+	metadata, err := p.Metadata(samlTestMetadataURL, samlTestACSURL)
+	require.NoError(t, err)
+	testIDP.spMetadata = &saml.EntityDescriptor{}
+	require.NoError(t, xml.Unmarshal(metadata, testIDP.spMetadata))
+
+	req, err := saml.NewIdpAuthnRequest(testIDP.idp, httptest.NewRequest(http.MethodGet, loginURL, nil))
+	require.NoError(t, err)
+	require.NoError(t, req.Validate())
+	assert.Equal(t, "state", req.RelayState)
+	assert.Equal(t, samlTestRequestID, req.Request.ID)
+	assert.Equal(t, samlTestACSURL, req.Request.AssertionConsumerServiceURL)
+	assert.Equal(t, samlTestEntityID, req.Request.Issuer.Value)
+	assert.Nil(t, req.Request.ForceAuthn)
+	assert.Nil(t, req.Request.RequestedAuthnContext)
+
+	// Step-up authentication params are mapped into the request
+	loginURL, err = p.LoginURL(samlTestMetadataURL, samlTestACSURL, samlTestRequestID, "state", url.Values{
+		"prompt":     []string{"login"},
+		"acr_values": []string{"urn:gold urn:silver"},
+	})
+	require.NoError(t, err)
+	req, err = saml.NewIdpAuthnRequest(testIDP.idp, httptest.NewRequest(http.MethodGet, loginURL, nil))
+	require.NoError(t, err)
+	require.NoError(t, req.Validate())
+	require.NotNil(t, req.Request.ForceAuthn)
+	assert.True(t, *req.Request.ForceAuthn)
+	require.NotNil(t, req.Request.RequestedAuthnContext)
+	assert.Equal(t, "urn:gold", req.Request.RequestedAuthnContext.AuthnContextClassRef)
+
+	// Signed requests carry the signature in the query
+	require.NoError(t, p.SetKeyPair(testIDP.certificate, testIDP.key))
+	loginURL, err = p.LoginURL(samlTestMetadataURL, samlTestACSURL, samlTestRequestID, "state", url.Values{})
+	require.NoError(t, err)
+	parsed, err := url.Parse(loginURL)
+	require.NoError(t, err)
+	assert.NotEmpty(t, parsed.Query().Get("Signature"))
+	assert.Equal(t, "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256", parsed.Query().Get("SigAlg"))
+}
+
+func TestSAMLProviderLoginForm(t *testing.T) {
+	testIDP := newSAMLTestIDP(t)
+	testIDP.idp.SSOURL = url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"}
+	p := newSAMLTestProvider(t, testIDP)
+	require.NoError(t, p.SetKeyPair(testIDP.certificate, testIDP.key))
+
+	form, err := p.LoginForm(samlTestMetadataURL, samlTestACSURL, samlTestRequestID, "state", url.Values{})
+	require.NoError(t, err)
+	assert.Contains(t, string(form), `<form method="post" action="https://idp.example.com/sso" id="SAMLRequestForm">`)
+	assert.Contains(t, string(form), `<input type="hidden" name="RelayState" value="state" />`)
+
+	start := strings.Index(string(form), `name="SAMLRequest" value="`) + len(`name="SAMLRequest" value="`)
+	end := strings.Index(string(form)[start:], `"`)
+	request, err := base64.StdEncoding.DecodeString(html.UnescapeString(string(form)[start : start+end]))
+	require.NoError(t, err)
+	assert.Contains(t, string(request), `ID="id-request"`)
+	assert.Contains(t, string(request), "SignatureValue")
+}
+
+func TestSAMLProviderParseResponse(t *testing.T) {
+	testIDP := newSAMLTestIDP(t)
+	p := newSAMLTestProvider(t, testIDP)
+
+	loginURL, err := p.LoginURL(samlTestMetadataURL, samlTestACSURL, samlTestRequestID, "state", url.Values{})
+	require.NoError(t, err)
+	form := testIDP.respond(t, p, loginURL)
+	assert.Equal(t, "state", form.Get("RelayState"))
+
+	session, err := p.ParseResponse(newSAMLCallbackRequest(form), samlTestMetadataURL, samlTestACSURL, samlTestRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "jdoe@example.com", session.Email)
+	assert.Equal(t, "jdoe", session.User)
+	assert.Equal(t, "jdoe", session.Subject)
+	assert.Equal(t, []string{"admins", "users"}, session.Groups)
+	assert.Equal(t, "session-index", session.SessionID)
+	assert.Equal(t, "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport", session.Acr)
+	require.NotNil(t, session.AuthTime)
+	assert.True(t, session.AuthTime.Equal(testIDP.session.CreateTime))
+	assert.NotNil(t, session.CreatedAt)
+	assert.True(t, p.ValidateSession(context.Background(), session))
+
+	// Attributes are mapped by name or friendly name
+	p.UserAttribute = "uid"
+	p.EmailAttribute = "mail"
+	p.GroupsAttribute = "roles"
+	session, err = p.ParseResponse(newSAMLCallbackRequest(form), samlTestMetadataURL, samlTestACSURL, samlTestRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "john", session.User)
+	assert.Equal(t, "", session.Email)
+	assert.Empty(t, session.Groups)
+}
+
+func TestSAMLProviderParseResponseEmailNameID(t *testing.T) {
+	testIDP := newSAMLTestIDP(t)
+	testIDP.session.NameID = "jane@example.com"
+	testIDP.session.NameIDFormat = string(saml.EmailAddressNameIDFormat)
+	testIDP.session.CustomAttributes = nil
+	p := newSAMLTestProvider(t, testIDP)
+
+	loginURL, err := p.LoginURL(samlTestMetadataURL, samlTestACSURL, samlTestRequestID, "state", url.Values{})
+	require.NoError(t, err)
+	form := testIDP.respond(t, p, loginURL)
+
+	session, err := p.ParseResponse(newSAMLCallbackRequest(form), samlTestMetadataURL, samlTestACSURL, samlTestRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", session.Email)
+	assert.Equal(t, "jane@example.com", session.User)
+}
+
+func TestSAMLProviderParseResponseEncrypted(t *testing.T) {
+	testIDP := newSAMLTestIDP(t)
+	p := newSAMLTestProvider(t, testIDP)
+	_, _, certPEM, keyPEM := newSAMLTestKeyPair(t, "proxy.example.com")
+	require.NoError(t, p.SetKeyPair(certPEM, keyPEM))
+
+	loginURL, err := p.LoginURL(samlTestMetadataURL, samlTestACSURL, samlTestRequestID, "state", url.Values{})
+	require.NoError(t, err)
+	form := testIDP.respond(t, p, loginURL)
+
+	response, err := base64.StdEncoding.DecodeString(form.Get("SAMLResponse"))
+	require.NoError(t, err)
+	assert.Contains(t, string(response), "EncryptedAssertion")
+
+	session, err := p.ParseResponse(newSAMLCallbackRequest(form), samlTestMetadataURL, samlTestACSURL, samlTestRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "jdoe@example.com", session.Email)
+
+	// Encrypted assertions can't be read without the key
+	withoutKey := newSAMLTestProvider(t, testIDP)
+	_, err = withoutKey.ParseResponse(newSAMLCallbackRequest(form), samlTestMetadataURL, samlTestACSURL, samlTestRequestID)
+	assert.Equal(t, ErrSAMLKeyRequired, err)
+}
+
+func TestSAMLProviderParseInvalidResponse(t *testing.T) {
+	testIDP := newSAMLTestIDP(t)
+	p := newSAMLTestProvider(t, testIDP)
+
+	loginURL, err := p.LoginURL(samlTestMetadataURL, samlTestACSURL, samlTestRequestID, "state", url.Values{})
+	require.NoError(t, err)
+	form := testIDP.respond(t, p, loginURL)
+	response, err := base64.StdEncoding.DecodeString(form.Get("SAMLResponse"))
+	require.NoError(t, err)
+
+	tampered := url.Values{"SAMLResponse": []string{base64.StdEncoding.EncodeToString(
+		[]byte(strings.Replace(string(response), "jdoe@example.com", "admin@example.com", 1)),
+	)}}
+	otherIDP := newSAMLTestIDP(t)
+	otherAudience := newSAMLTestProvider(t, testIDP)
+	otherAudience.EntityID = "https://other.example.com/saml"
+
+	testCases := map[string]struct {
+		provider  *SAMLProvider
+		form      url.Values
+		requestID string
+		acsURL    string
+	}{
+		"with another request ID": {
+			provider:  p,
+			form:      form,
+			requestID: "id-other",
+			acsURL:    samlTestACSURL,
+		},
+		"with another assertion consumer service": {
+			provider:  p,
+			form:      form,
+			requestID: samlTestRequestID,
+			acsURL:    "https://other.example.com/oauth2/saml/acs",
+		},
+		"with another audience": {
+			provider:  otherAudience,
+			form:      form,
+			requestID: samlTestRequestID,
+			acsURL:    samlTestACSURL,
+		},
+		"with a tampered assertion": {
+			provider:  p,
+			form:      tampered,
+			requestID: samlTestRequestID,
+			acsURL:    samlTestACSURL,
+		},
+		"with the certificate of another identity provider": {
+			provider:  newSAMLTestProvider(t, otherIDP),
+			form:      form,
+			requestID: samlTestRequestID,
+			acsURL:    samlTestACSURL,
+		},
+		"with an invalid encoding": {
+			provider:  p,
+			form:      url.Values{"SAMLResponse": []string{"%%%"}},
+			requestID: samlTestRequestID,
+			acsURL:    samlTestACSURL,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			session, err := tc.provider.ParseResponse(newSAMLCallbackRequest(tc.form), samlTestMetadataURL, tc.acsURL, tc.requestID)
+			assert.Error(t, err)
+			assert.Nil(t, session)
+		})
+	}
+}
+
+func TestSAMLProviderSessions(t *testing.T) {
+	p := NewSAMLProvider(&ProviderData{})
+
+	_, err := p.Redeem(context.Background(), samlTestACSURL, "code", "")
+	assert.Equal(t, ErrNotImplemented, err)
+
+	refreshed, err := p.RefreshSession(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.False(t, refreshed)
+}
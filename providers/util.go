@@ -51,15 +51,30 @@ func makeLoginURL(p *ProviderData, redirectURI, state string, extraParams url.Va
 	params.Set("client_id", p.ClientID)
 	params.Set("response_type", "code")
 	params.Add("state", state)
+	// Extra parameters replace the configured ones, eg. the acr_values
+	// requested for step-up authentication
 	for n, p := range extraParams {
+		params.Del(n)
 		for _, v := range p {
 			params.Add(n, v)
 		}
 	}
+	if extraParams.Get("prompt") != "" {
+		params.Del("approval_prompt")
+	}
 	a.RawQuery = params.Encode()
 	return a
 }
 
+// codeVerifierOptions returns the options to send the PKCE code verifier
+// when exchanging a code with the oauth2 library
+func codeVerifierOptions(codeVerifier string) []oauth2.AuthCodeOption {
+	if codeVerifier == "" {
+		return nil
+	}
+	return []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("code_verifier", codeVerifier)}
+}
+
 // getIDToken extracts an IDToken stored in the `Extra` fields of an
 // oauth2.Token
 func getIDToken(token *oauth2.Token) string {
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/watcher"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	reloadSuccess = "success"
+	reloadFailure = "failure"
+)
+
+// configReloader reloads the configuration of a running OAuthProxy when the
+// configuration files change or the process receives a SIGHUP
+type configReloader struct {
+	proxy *OAuthProxy
+	load  func() (*options.Options, error)
+
+	reloads     *prometheus.CounterVec
+	lastSuccess prometheus.Gauge
+
+	// mu serialises reloads and guards the current options
+	mu      sync.Mutex
+	current *options.Options
+}
+
+// newConfigReloader creates a configReloader for the proxy running with the
+// current options. The load function loads the new options on each reload.
+func newConfigReloader(proxy *OAuthProxy, current *options.Options, load func() (*options.Options, error)) *configReloader {
+	return &configReloader{
+		proxy:       proxy,
+		load:        load,
+		reloads:     registerConfigReloadsCounter(prometheus.DefaultRegisterer),
+		lastSuccess: registerConfigLastReloadSuccessGauge(prometheus.DefaultRegisterer),
+		current:     current,
+	}
+}
+
+// Watch reloads the configuration whenever one of the files changes or the
+// process receives a SIGHUP
+func (r *configReloader) Watch(files []string, done <-chan bool) {
+	for _, file := range files {
+		if file != "" {
+			if err := watcher.WatchFileForUpdates(file, done, r.Reload); err != nil {
+				logger.Errorf("ERROR: failed to watch %s, it will only be reloaded on SIGHUP: %v", file, err)
+			}
+		}
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sighup)
+		for {
+			select {
+			case <-done:
+				return
+			case <-sighup:
+				logger.Printf("reloading configuration after SIGHUP")
+				r.Reload()
+			}
+		}
+	}()
+}
+
+// Reload loads and validates the configuration, and swaps it into the proxy.
+// An invalid configuration is rejected and the proxy keeps running with the
+// previous configuration.
+func (r *configReloader) Reload() {
+	if err := r.reload(); err != nil {
+		r.reloads.WithLabelValues(reloadFailure).Inc()
+		logger.Errorf("Rejected configuration reload, keeping the previous configuration: %v", err)
+		return
+	}
+	r.reloads.WithLabelValues(reloadSuccess).Inc()
+	r.lastSuccess.SetToCurrentTime()
+	logger.Printf("Reloaded configuration")
+}
+
+func (r *configReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	opts, err := r.load()
+	if err != nil {
+		return err
+	}
+	keepRestartOptions(r.current, opts)
+
+	if err := validation.Validate(opts); err != nil {
+		return err
+	}
+	if err := r.proxy.Reload(opts); err != nil {
+		return fmt.Errorf("failed to initialise OAuth2 Proxy: %v", err)
+	}
+
+	r.current = opts
+	return nil
+}
+
+// secretFiles returns the files the secrets are loaded from, so that rotated
+// secrets are reloaded. Client secret files are read on each use instead.
+func secretFiles(opts *options.Options) []string {
+	files := opts.Secrets.Files()
+	for _, provider := range opts.Providers {
+		clientAuth := provider.ClientAuthentication
+		for _, source := range []*options.SecretSource{provider.GitHubConfig.TokenSource, clientAuth.PrivateKey, clientAuth.Certificate, clientAuth.CertificateKey} {
+			if source != nil && source.FromFile != "" {
+				files = append(files, source.FromFile)
+			}
+		}
+	}
+	return files
+}
+
+// keepRestartOptions copies the options that can only be changed with a
+// restart from the current options into the next options, and warns about
+// changes to them. The secrets within them can be rotated without a restart.
+func keepRestartOptions(current, next *options.Options) {
+	cookie := current.Cookie
+	cookie.Secret = next.Cookie.Secret
+	cookie.PreviousSecrets = next.Cookie.PreviousSecrets
+	session := current.Session
+	session.Redis.Password = next.Session.Redis.Password
+	session.Redis.SentinelPassword = next.Session.Redis.SentinelPassword
+	session.SQL.ConnectionURL = next.Session.SQL.ConnectionURL
+	ldap := current.LDAP
+	ldap.BindPassword = next.LDAP.BindPassword
+
+	changed := []string{}
+	if !reflect.DeepEqual(current.Server, next.Server) || !reflect.DeepEqual(current.MetricsServer, next.MetricsServer) {
+		changed = append(changed, "server")
+	}
+	if !reflect.DeepEqual(cookie, next.Cookie) {
+		changed = append(changed, "cookie")
+	}
+	if !reflect.DeepEqual(session, next.Session) {
+		changed = append(changed, "session")
+	}
+	if current.HtpasswdFile != next.HtpasswdFile || current.HtpasswdRejectWeak != next.HtpasswdRejectWeak || current.HtpasswdRehashFile != next.HtpasswdRehashFile {
+		changed = append(changed, "htpasswd-file")
+	}
+	if !reflect.DeepEqual(ldap, next.LDAP) {
+		changed = append(changed, "ldap")
+	}
+	if current.APIKeysFile != next.APIKeysFile {
+		changed = append(changed, "api-keys-file")
+	}
+	if current.AuthenticatedEmailsFile != next.AuthenticatedEmailsFile || !reflect.DeepEqual(current.EmailDomains, next.EmailDomains) {
+		changed = append(changed, "email")
+	}
+	if len(changed) > 0 {
+		logger.Printf("WARNING: changes to the %s options require a restart and were not applied", strings.Join(changed, ", "))
+	}
+
+	next.Server = current.Server
+	next.MetricsServer = current.MetricsServer
+	next.Cookie = cookie
+	next.Session = session
+	next.HtpasswdFile = current.HtpasswdFile
+	next.HtpasswdRejectWeak = current.HtpasswdRejectWeak
+	next.HtpasswdRehashFile = current.HtpasswdRehashFile
+	next.LDAP = ldap
+	next.APIKeysFile = current.APIKeysFile
+	next.AuthenticatedEmailsFile = current.AuthenticatedEmailsFile
+	next.EmailDomains = current.EmailDomains
+}
+
+// registerConfigReloadsCounter registers 'oauth2_proxy_config_reloads_total'
+// This keeps a tally of the configuration reloads bucketed by whether the
+// new configuration was applied or rejected
+func registerConfigReloadsCounter(registerer prometheus.Registerer) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oauth2_proxy_config_reloads_total",
+			Help: "Total number of configuration reloads by result.",
+		},
+		[]string{"result"},
+	)
+
+	if err := registerer.Register(counter); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			counter = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			panic(err)
+		}
+	}
+
+	return counter
+}
+
+// registerConfigLastReloadSuccessGauge registers
+// 'oauth2_proxy_config_last_reload_success_timestamp_seconds'
+// This holds the time of the last configuration reload that was applied
+func registerConfigLastReloadSuccessGauge(registerer prometheus.Registerer) prometheus.Gauge {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "oauth2_proxy_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload.",
+	})
+
+	if err := registerer.Register(gauge); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			gauge = are.ExistingCollector.(prometheus.Gauge)
+		} else {
+			panic(err)
+		}
+	}
+
+	return gauge
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReloadTestOptions(t *testing.T, upstreamURL string, skipAuthRoutes ...string) *options.Options {
+	opts := baseTestOptions()
+	opts.UpstreamServers = options.Upstreams{
+		{
+			ID:   upstreamURL,
+			Path: "/",
+			URI:  upstreamURL,
+		},
+	}
+	opts.SkipAuthRoutes = skipAuthRoutes
+	if err := validation.Validate(opts); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+func newReloadTestUpstream(t *testing.T) *httptest.Server {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, err := w.Write([]byte("response"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+	return upstreamServer
+}
+
+func serveReloadTestRequest(proxy *OAuthProxy, path string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path, nil)
+	proxy.ServeHTTP(rw, req)
+	return rw
+}
+
+func TestOAuthProxyReload(t *testing.T) {
+	upstreamServer := newReloadTestUpstream(t)
+
+	proxy, err := NewOAuthProxy(newReloadTestOptions(t, upstreamServer.URL), func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusForbidden, serveReloadTestRequest(proxy, "/public").Code)
+
+	err = proxy.Reload(newReloadTestOptions(t, upstreamServer.URL, "GET=^/public"))
+	assert.NoError(t, err)
+
+	rw := serveReloadTestRequest(proxy, "/public")
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "response", rw.Body.String())
+	assert.Equal(t, http.StatusForbidden, serveReloadTestRequest(proxy, "/private").Code)
+}
+
+func TestConfigReloader(t *testing.T) {
+	upstreamServer := newReloadTestUpstream(t)
+
+	current := newReloadTestOptions(t, upstreamServer.URL)
+	proxy, err := NewOAuthProxy(current, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var next *options.Options
+	reloader := newConfigReloader(proxy, current, func() (*options.Options, error) {
+		return next, nil
+	})
+
+	t.Run("with a valid configuration", func(t *testing.T) {
+		successes := testutil.ToFloat64(reloader.reloads.WithLabelValues(reloadSuccess))
+
+		next = baseTestOptions()
+		next.UpstreamServers = current.UpstreamServers
+		next.SkipAuthRoutes = []string{"GET=^/public"}
+		next.Cookie.Name = "_changed"
+		reloader.Reload()
+
+		assert.Equal(t, float64(1), testutil.ToFloat64(reloader.reloads.WithLabelValues(reloadSuccess))-successes)
+		assert.Equal(t, http.StatusOK, serveReloadTestRequest(proxy, "/public").Code)
+		// Cookie options can only be changed with a restart
+		assert.Equal(t, "_oauth2_proxy", reloader.current.Cookie.Name)
+	})
+
+	t.Run("with an invalid configuration", func(t *testing.T) {
+		failures := testutil.ToFloat64(reloader.reloads.WithLabelValues(reloadFailure))
+
+		next = baseTestOptions()
+		next.UpstreamServers = current.UpstreamServers
+		next.SkipAuthRoutes = []string{"GET=^/("}
+		reloader.Reload()
+
+		assert.Equal(t, float64(1), testutil.ToFloat64(reloader.reloads.WithLabelValues(reloadFailure))-failures)
+		// The previous configuration keeps serving requests
+		assert.Equal(t, http.StatusOK, serveReloadTestRequest(proxy, "/public").Code)
+		assert.Equal(t, []string{"GET=^/public"}, reloader.current.SkipAuthRoutes)
+	})
+}
+
+func TestConfigReloaderRotatesSecrets(t *testing.T) {
+	upstreamServer := newReloadTestUpstream(t)
+
+	dir := t.TempDir()
+	cookieSecretFile := filepath.Join(dir, "cookie-secret")
+	previousCookieSecretFile := filepath.Join(dir, "previous-cookie-secret")
+	writeSecrets := func(cookieSecret, previousCookieSecret string) {
+		if err := ioutil.WriteFile(cookieSecretFile, []byte(cookieSecret+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(previousCookieSecretFile, []byte(previousCookieSecret+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load := func() (*options.Options, error) {
+		opts := baseTestOptions()
+		opts.Cookie.Secret = ""
+		opts.Session.Type = options.MemorySessionStoreType
+		opts.UpstreamServers = options.Upstreams{{ID: "upstream", Path: "/", URI: upstreamServer.URL}}
+		opts.Secrets.CookieSecret = &options.SecretSource{FromFile: cookieSecretFile}
+		opts.Secrets.PreviousCookieSecrets = []options.SecretSource{{FromFile: previousCookieSecretFile}}
+		return opts, nil
+	}
+
+	writeSecrets(rawCookieSecret, "previousthirtytwobytes+abcdefghi")
+	current, _ := load()
+	if err := validation.Validate(current); err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := NewOAuthProxy(current, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader := newConfigReloader(proxy, current, load)
+	assert.Equal(t, []string{cookieSecretFile, previousCookieSecretFile}, secretFiles(current))
+
+	// Save a session with the current cookie secret
+	rw := httptest.NewRecorder()
+	err = proxy.sessionStore.Save(rw, httptest.NewRequest("GET", "/", nil), &sessionsapi.SessionState{Email: "john.doe@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeSecrets("rotatedthirtytwobytes+abcdefghij", rawCookieSecret)
+	reloader.Reload()
+
+	assert.Equal(t, "rotatedthirtytwobytes+abcdefghij", reloader.current.Cookie.Secret)
+	assert.Equal(t, []string{rawCookieSecret}, reloader.current.Cookie.PreviousSecrets)
+	assert.Equal(t, "rotatedthirtytwobytes+abcdefghij", proxy.activeProxy().CookieOptions.Secret)
+
+	// The session saved before the rotation is kept and still decodes
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range rw.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	session, err := proxy.activeProxy().sessionStore.Load(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "john.doe@example.com", session.Email)
+	}
+}
+
+// closeRecordingStore records whether the session store was closed
+type closeRecordingStore struct {
+	sessionsapi.SessionStore
+	closed bool
+}
+
+func (s *closeRecordingStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestOAuthProxyReloadClosesReplacedSessionStore(t *testing.T) {
+	upstreamServer := newReloadTestUpstream(t)
+
+	current := newReloadTestOptions(t, upstreamServer.URL)
+	proxy, err := NewOAuthProxy(current, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &closeRecordingStore{SessionStore: proxy.sessionStore}
+	proxy.sessionStore = store
+
+	// A rotated cookie secret keeps the store
+	next := newReloadTestOptions(t, upstreamServer.URL)
+	next.Cookie.Secret = "rotatedthirtytwobytes+abcdefghij"
+	assert.NoError(t, proxy.Reload(next))
+	assert.False(t, store.closed)
+
+	// Changed session options replace the store, which is closed once the new
+	// one serves requests
+	store = &closeRecordingStore{SessionStore: proxy.activeProxy().sessionStore}
+	proxy.activeProxy().sessionStore = store
+	next = newReloadTestOptions(t, upstreamServer.URL)
+	next.Cookie.Secret = "rotatedthirtytwobytes+abcdefghij"
+	next.Session.Cookie.Minimal = true
+	assert.NoError(t, proxy.Reload(next))
+	assert.True(t, store.closed)
+	assert.NotEqual(t, store, proxy.activeProxy().sessionStore)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
+)
+
+const (
+	samlMetadataPath = "/saml/metadata"
+	samlACSPath      = "/saml/acs"
+)
+
+// SAMLMetadata responds with the service provider metadata of the SAML
+// provider selected by the `provider` query parameter, or of the default
+// provider
+func (p *OAuthProxy) SAMLMetadata(rw http.ResponseWriter, req *http.Request) {
+	provider, err := p.providers.get(req.FormValue("provider"))
+	if err != nil {
+		p.ErrorPage(rw, req, http.StatusNotFound, err.Error())
+		return
+	}
+	samlProvider, ok := provider.(*providers.SAMLProvider)
+	if !ok {
+		p.ErrorPage(rw, req, http.StatusNotFound, fmt.Sprintf("provider %q is not a SAML provider", provider.Data().ID))
+		return
+	}
+
+	metadataURL, acsURL := p.getSAMLURLs()
+	metadata, err := samlProvider.Metadata(metadataURL, acsURL)
+	if err != nil {
+		logger.Errorf("Error generating SAML metadata: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/samlmetadata+xml")
+	rw.WriteHeader(http.StatusOK)
+	_, err = rw.Write(metadata)
+	if err != nil {
+		logger.Printf("Error writing SAML metadata: %v", err)
+	}
+}
+
+// startSAML sends the user to sign in with the SAML identity provider.
+// Relay states are limited to 80 bytes, so only the state nonce of the CSRF
+// cookie is sent as relay state and the application redirect is kept in the
+// cookie. The ID of the authentication request is derived from its OIDC
+// nonce so that the response can be matched to the request.
+func (p *OAuthProxy) startSAML(rw http.ResponseWriter, req *http.Request, provider *providers.SAMLProvider, csrf cookies.CSRF, appRedirect string, extraParams url.Values) {
+	metadataURL, acsURL := p.getSAMLURLs()
+	requestID := samlRequestID(csrf)
+	state := csrf.HashOAuthState()
+	csrf.SetRedirect(appRedirect)
+
+	var loginURL string
+	var loginForm []byte
+	var err error
+	if provider.Binding == providers.SAMLPostBinding {
+		loginForm, err = provider.LoginForm(metadataURL, acsURL, requestID, state, extraParams)
+	} else {
+		loginURL, err = provider.LoginURL(metadataURL, acsURL, requestID, state, extraParams)
+	}
+	if err != nil {
+		logger.Errorf("Error creating SAML authentication request: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if _, err := csrf.SetCookie(rw, req); err != nil {
+		logger.Errorf("Error setting CSRF cookie: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if loginURL != "" {
+		http.Redirect(rw, req, loginURL, http.StatusFound)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	_, err = rw.Write(loginForm)
+	if err != nil {
+		logger.Printf("Error writing SAML login form: %v", err)
+	}
+}
+
+// SAMLCallback is the assertion consumer service that finishes the SAML
+// authentication flow. The identity provider posts its response and the
+// relay state to it.
+func (p *OAuthProxy) SAMLCallback(rw http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		logger.Errorf("Error while parsing SAML response: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	csrf, err := cookies.LoadCSRFCookie(req, p.CookieOptions)
+	if err != nil {
+		logger.PrintAuthf("", req, logger.AuthFailure, "Invalid authentication via SAML: unable to obtain CSRF cookie")
+		p.ErrorPage(rw, req, http.StatusForbidden, err.Error(), "Login Failed: Unable to find a valid CSRF token. Please try again.")
+		return
+	}
+
+	nonce := req.PostForm.Get("RelayState")
+	if !csrf.CheckOAuthState(nonce) {
+		csrf.ClearCookie(rw, req)
+		logger.PrintAuthf("", req, logger.AuthFailure, "Invalid authentication via SAML: CSRF token mismatch, potential attack")
+		p.ErrorPage(rw, req, http.StatusForbidden, "CSRF token mismatch, potential attack", "Login Failed: Unable to find a valid CSRF token. Please try again.")
+		return
+	}
+
+	providerID := csrf.GetProviderID()
+	provider, err := p.providers.get(providerID)
+	if err != nil {
+		logger.Errorf("Error selecting provider during SAML callback: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	samlProvider, ok := provider.(*providers.SAMLProvider)
+	if !ok {
+		p.ErrorPage(rw, req, http.StatusBadRequest, fmt.Sprintf("provider %q is not a SAML provider", providerID))
+		return
+	}
+
+	metadataURL, acsURL := p.getSAMLURLs()
+	session, err := samlProvider.ParseResponse(req, metadataURL, acsURL, samlRequestID(csrf))
+	if err != nil {
+		logger.PrintAuthf("", req, logger.AuthFailure, "Invalid authentication via SAML: %v", err)
+		p.ErrorPage(rw, req, http.StatusForbidden, err.Error(), "Login Failed: The identity provider response could not be validated.")
+		return
+	}
+	session.ProviderID = samlProvider.Data().ID
+	if session.ExpiresOn == nil {
+		session.ExpiresIn(p.CookieOptions.Expire)
+	}
+
+	p.finishSignIn(rw, req, samlProvider, csrf, session, nonce, csrf.GetRedirect(), "SAML")
+}
+
+// getSAMLURLs returns the URLs of the SAML metadata and assertion consumer
+// service endpoints, on the host and scheme of the configured redirect URL.
+// They don't follow the host of the request, the destination of assertions
+// is checked against them.
+func (p *OAuthProxy) getSAMLURLs() (string, string) {
+	metadataURL := url.URL{Scheme: p.redirectURL.Scheme, Host: p.redirectURL.Host, Path: p.ProxyPrefix + samlMetadataPath}
+	acsURL := url.URL{Scheme: p.redirectURL.Scheme, Host: p.redirectURL.Host, Path: p.ProxyPrefix + samlACSPath}
+	return metadataURL.String(), acsURL.String()
+}
+
+// samlRequestID returns the ID of the SAML authentication request for the
+// nonce of the CSRF cookie. IDs must not start with a digit.
+func samlRequestID(csrf cookies.CSRF) string {
+	return "id-" + csrf.HashOIDCNonce()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+type samlTest struct {
+	proxy      *OAuthProxy
+	idp        *saml.IdentityProvider
+	spMetadata *saml.EntityDescriptor
+}
+
+func (test *samlTest) GetServiceProvider(_ *http.Request, _ string) (*saml.EntityDescriptor, error) {
+	return test.spMetadata, nil
+}
+
+func newSAMLTest(t *testing.T) *samlTest {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	test := &samlTest{}
+	test.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+		ServiceProviderProvider: test,
+	}
+	idpMetadata, err := xml.Marshal(test.idp.Metadata())
+	assert.NoError(t, err)
+
+	opts := baseTestOptions()
+	opts.RawRedirectURL = "https://proxy.example.com/oauth2/callback"
+	err = validation.Validate(opts)
+	assert.NoError(t, err)
+
+	provider := providers.NewSAMLProvider(&providers.ProviderData{ID: "corp"})
+	provider.EntityID = "urn:proxy.example.com"
+	assert.NoError(t, provider.SetIDPMetadata(idpMetadata))
+	opts.SetProviders([]providers.Provider{provider})
+
+	test.proxy, err = NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := test.serve(httptest.NewRequest(http.MethodGet, "/oauth2/saml/metadata", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	test.spMetadata = &saml.EntityDescriptor{}
+	assert.NoError(t, xml.Unmarshal(rw.Body.Bytes(), test.spMetadata))
+	return test
+}
+
+func (test *samlTest) serve(req *http.Request) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	test.proxy.ServeHTTP(rw, req)
+	return rw
+}
+
+// signIn starts the sign in and returns the response of the identity
+// provider posted to the assertion consumer service
+func (test *samlTest) signIn(t *testing.T, target string, session *saml.Session) *http.Request {
+	rw := test.serve(httptest.NewRequest(http.MethodGet, target, nil))
+	assert.Equal(t, http.StatusFound, rw.Code)
+
+	idpReq, err := saml.NewIdpAuthnRequest(test.idp, httptest.NewRequest(http.MethodGet, rw.Header().Get("Location"), nil))
+	assert.NoError(t, err)
+	assert.NoError(t, idpReq.Validate())
+	assert.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(idpReq, session))
+	form, err := idpReq.PostBinding()
+	assert.NoError(t, err)
+
+	body := url.Values{"SAMLResponse": []string{form.SAMLResponse}, "RelayState": []string{form.RelayState}}
+	req := httptest.NewRequest(http.MethodPost, form.URL, strings.NewReader(body.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range rw.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestSAMLMetadata(t *testing.T) {
+	test := newSAMLTest(t)
+
+	assert.Equal(t, "urn:proxy.example.com", test.spMetadata.EntityID)
+	assert.Equal(t, "https://proxy.example.com/oauth2/saml/acs", test.spMetadata.SPSSODescriptors[0].AssertionConsumerServices[0].Location)
+
+	// The endpoints don't follow the host of the request
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/saml/metadata", nil)
+	req.Host = "attacker.example.com"
+	rw := test.serve(req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotContains(t, rw.Body.String(), "attacker.example.com")
+
+	rw = test.serve(httptest.NewRequest(http.MethodGet, "/oauth2/saml/metadata?provider=unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestSAMLSignIn(t *testing.T) {
+	test := newSAMLTest(t)
+
+	req := test.signIn(t, "/oauth2/start?rd=%2Fapp", &saml.Session{
+		NameID:     "jdoe",
+		CreateTime: time.Now(),
+		Index:      "session-index",
+		CustomAttributes: []saml.Attribute{
+			{Name: "email", Values: []saml.AttributeValue{{Value: "jdoe@example.com"}}},
+		},
+	})
+	// The relay state only carries the state nonce of the CSRF cookie
+	assert.NotContains(t, req.PostFormValue("RelayState"), "/app")
+	assert.LessOrEqual(t, len(req.PostFormValue("RelayState")), 80)
+
+	rw := test.serve(req)
+	assert.Equal(t, http.StatusFound, rw.Code)
+	assert.Equal(t, "/app", rw.Header().Get("Location"))
+
+	sessionReq := httptest.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+	for _, c := range rw.Result().Cookies() {
+		sessionReq.AddCookie(c)
+	}
+	session, err := test.proxy.LoadCookiedSession(sessionReq)
+	assert.NoError(t, err)
+	assert.Equal(t, "jdoe@example.com", session.Email)
+	assert.Equal(t, "jdoe", session.User)
+	assert.Equal(t, "corp", session.ProviderID)
+	assert.Equal(t, "session-index", session.SessionID)
+}
+
+func TestSAMLCallbackInvalid(t *testing.T) {
+	test := newSAMLTest(t)
+	session := &saml.Session{NameID: "jdoe@example.com", CreateTime: time.Now()}
+
+	// Responses are only accepted with the CSRF cookie of their request
+	req := test.signIn(t, "/oauth2/start", session)
+	other := test.signIn(t, "/oauth2/start", session)
+	req.Header.Del("Cookie")
+	for _, c := range other.Cookies() {
+		req.AddCookie(c)
+	}
+	assert.Equal(t, http.StatusForbidden, test.serve(req).Code)
+
+	req = test.signIn(t, "/oauth2/start", session)
+	req.Header.Del("Cookie")
+	assert.Equal(t, http.StatusForbidden, test.serve(req).Code)
+
+	req = test.signIn(t, "/oauth2/start", session)
+	req.Body = ioutil.NopCloser(strings.NewReader(url.Values{
+		"SAMLResponse": []string{req.PostFormValue("SAMLResponse")},
+		"RelayState":   []string{"invalid"},
+	}.Encode()))
+	req.PostForm = nil
+	req.Form = nil
+	assert.Equal(t, http.StatusForbidden, test.serve(req).Code)
+}